@@ -0,0 +1,282 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 動態紀錄 =================
+
+// maxActivity 只保留最近的動態，避免狀態檔無限長大
+const maxActivity = 1000
+
+const (
+	activityAdded    = "added"
+	activityEdited   = "edited"
+	activityDeleted  = "deleted"
+	activityRestored = "restored"
+)
+
+// Activity 一筆變更紀錄（誰、從哪台裝置、對什麼做了什麼）
+type Activity struct {
+	At       int64  `json:"at"`
+	User     string `json:"user,omitempty"`
+	Device   string `json:"device,omitempty"`
+	IP       string `json:"ip,omitempty"`
+	Action   string `json:"action"`
+	Target   string `json:"target"` // bill、person，或 categories 等整份設定
+	TargetID int    `json:"targetId,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Message  string `json:"message"`
+	// DeviceID 發出變更的裝置（GET /api/devices 的 id）
+	DeviceID string `json:"deviceId,omitempty"`
+}
+
+// Actor 發起變更的人與裝置；前端以 X-Splitter-User / X-Splitter-Device 表頭告知，
+// DeviceID 為伺服器發給該裝置的權杖代號
+type Actor struct {
+	User     string
+	Device   string
+	IP       string
+	DeviceID string
+}
+
+// systemActor 伺服器自己產生的變更（例如週期帳單）
+var systemActor = Actor{User: "系統"}
+
+func actorFromRequest(r *http.Request) Actor {
+	a := Actor{
+		User:     truncateRunes(strings.TrimSpace(r.Header.Get("X-Splitter-User")), 50),
+		Device:   truncateRunes(strings.TrimSpace(r.Header.Get("X-Splitter-Device")), 100),
+		IP:       r.RemoteAddr,
+		DeviceID: deviceFromRequest(r),
+	}
+	if a.Device == "" {
+		a.Device = truncateRunes(r.UserAgent(), 100)
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		a.IP = host
+	}
+	return a
+}
+
+func (a Actor) name() string {
+	switch {
+	case a.User != "":
+		return a.User
+	case a.IP != "":
+		return a.IP
+	default:
+		return "有人"
+	}
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
+
+// diffActivity 比較變更前後的狀態，逐筆列出帳單與人員的新增/修改/刪除/還原，
+// 其他設定（分類、群組、範本、預算、期初欠款、本位幣）只記一筆「修改了…」
+func diffActivity(before, after GlobalState, a Actor, now time.Time) []Activity {
+	var out []Activity
+	add := func(action, target string, id int, title, msg string) {
+		out = append(out, Activity{
+			At: now.UnixMilli(), User: a.User, Device: a.Device, IP: a.IP, DeviceID: a.DeviceID,
+			Action: action, Target: target, TargetID: id, Title: title,
+			Message: a.name() + " " + msg,
+		})
+	}
+	verbs := map[string]string{
+		activityAdded:    "新增了",
+		activityEdited:   "修改了",
+		activityDeleted:  "刪除了",
+		activityRestored: "還原了",
+	}
+
+	prevBills := make(map[int]Bill, len(before.Bills))
+	for _, b := range before.Bills {
+		prevBills[b.ID] = b
+	}
+	seenBills := make(map[int]bool, len(after.Bills))
+	for _, b := range after.Bills {
+		seenBills[b.ID] = true
+		prev, existed := prevBills[b.ID]
+		action := changeAction(existed, prev.DeletedAt, b.DeletedAt, func() bool { return billChanged(prev, b) })
+		switch action {
+		case "":
+		case activityEdited:
+			add(action, "bill", b.ID, b.Title, describeBillEdit(prev, b))
+		default:
+			add(action, "bill", b.ID, b.Title, fmt.Sprintf("%s帳單「%s」", verbs[action], b.Title))
+		}
+	}
+	for _, b := range before.Bills {
+		if !seenBills[b.ID] && b.DeletedAt == 0 {
+			add(activityDeleted, "bill", b.ID, b.Title, fmt.Sprintf("刪除了帳單「%s」", b.Title))
+		}
+	}
+
+	prevPeople := make(map[int]Person, len(before.People))
+	for _, p := range before.People {
+		prevPeople[p.ID] = p
+	}
+	seenPeople := make(map[int]bool, len(after.People))
+	for _, p := range after.People {
+		seenPeople[p.ID] = true
+		prev, existed := prevPeople[p.ID]
+		action := changeAction(existed, prev.DeletedAt, p.DeletedAt, func() bool { return personChanged(prev, p) })
+		if action != "" {
+			add(action, "person", p.ID, p.Name, fmt.Sprintf("%s成員「%s」", verbs[action], p.Name))
+		}
+	}
+	for _, p := range before.People {
+		if !seenPeople[p.ID] && p.DeletedAt == 0 {
+			add(activityDeleted, "person", p.ID, p.Name, fmt.Sprintf("刪除了成員「%s」", p.Name))
+		}
+	}
+
+	settings := []struct {
+		target, label string
+		before, after any
+	}{
+		{"categories", "分類", before.Categories, after.Categories},
+		{"groups", "群組", before.Groups, after.Groups},
+		{"templates", "帳單範本", before.Templates, after.Templates},
+		{"budgets", "預算", before.Budgets, after.Budgets},
+		{"constraints", "結算偏好", before.Constraints, after.Constraints},
+		{"openingBalances", "期初欠款", before.OpeningBalances, after.OpeningBalances},
+		{"baseCurrency", "本位幣", before.BaseCurrency, after.BaseCurrency},
+	}
+	for _, s := range settings {
+		if !sameJSON(s.before, s.after) {
+			add(activityEdited, s.target, 0, "", "修改了"+s.label)
+		}
+	}
+	return out
+}
+
+// changeAction 依變更前後的存在與刪除狀態判斷動作；沒有變化回傳空字串
+func changeAction(existed bool, prevDeletedAt, deletedAt int64, changed func() bool) string {
+	switch {
+	case !existed && deletedAt == 0:
+		return activityAdded
+	case !existed:
+		return ""
+	case prevDeletedAt == 0 && deletedAt != 0:
+		return activityDeleted
+	case prevDeletedAt != 0 && deletedAt == 0:
+		return activityRestored
+	case deletedAt == 0 && changed():
+		return activityEdited
+	}
+	return ""
+}
+
+// billChanged 忽略畫面計算後回寫的 AmountBase 與伺服器填寫的版本資訊
+func billChanged(a, b Bill) bool {
+	a.AmountBase, b.AmountBase = 0, 0
+	a.Revision, a.UpdatedAt, a.UpdatedBy, a.Version = 0, 0, "", 0
+	b.Revision, b.UpdatedAt, b.UpdatedBy, b.Version = 0, 0, "", 0
+	return !sameJSON(a, b)
+}
+
+// personChanged 忽略伺服器填寫的版本資訊
+func personChanged(a, b Person) bool {
+	a.Revision, a.UpdatedAt, a.UpdatedBy, b.Revision, b.UpdatedAt, b.UpdatedBy = 0, 0, "", 0, 0, ""
+	return !sameJSON(a, b)
+}
+
+// describeBillEdit 留言、收據與鎖定各有專屬 API，分開描述比「修改了帳單」好懂
+func describeBillEdit(prev, b Bill) string {
+	rest := func(x Bill) Bill {
+		x.AmountBase, x.Comments, x.Attachments, x.Locked = 0, nil, nil, false
+		return x
+	}
+	if sameJSON(rest(prev), rest(b)) {
+		switch {
+		case len(b.Comments) > len(prev.Comments):
+			return fmt.Sprintf("在帳單「%s」留言", b.Title)
+		case !sameJSON(prev.Attachments, b.Attachments):
+			return fmt.Sprintf("更新了帳單「%s」的收據", b.Title)
+		case b.Locked && !prev.Locked:
+			return fmt.Sprintf("鎖定了帳單「%s」", b.Title)
+		case !b.Locked && prev.Locked:
+			return fmt.Sprintf("解除了帳單「%s」的鎖定", b.Title)
+		}
+	}
+	return fmt.Sprintf("修改了帳單「%s」", b.Title)
+}
+
+// recordActivity 把這次變更附加到 fn 執行前的動態紀錄之後，匯入或還原快照也不會改寫過去的紀錄
+func recordActivity(s *GlobalState, prev []Activity, before GlobalState, a Actor, now time.Time) {
+	s.Activity = append(prev, diffActivity(before, *s, a, now)...)
+	if len(s.Activity) > maxActivity {
+		s.Activity = s.Activity[len(s.Activity)-maxActivity:]
+	}
+}
+
+// activitySubject 只擷取 diffActivity 需要比較的欄位，避免連快照一起複製
+func activitySubject(s GlobalState) GlobalState {
+	return cloneState(GlobalState{
+		People:          s.People,
+		Bills:           s.Bills,
+		BaseCurrency:    s.BaseCurrency,
+		OpeningBalances: s.OpeningBalances,
+		Categories:      s.Categories,
+		Groups:          s.Groups,
+		Templates:       s.Templates,
+		Budgets:         s.Budgets,
+		Constraints:     s.Constraints,
+	})
+}
+
+// handleActivity GET /api/activity?limit=100&billId=3，最新的在前
+func handleActivity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = min(n, maxActivity)
+	}
+	billID := 0
+	if v := r.URL.Query().Get("billId"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid billId")
+			return
+		}
+		billID = n
+	}
+
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		log.Printf("load state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	feed := make([]Activity, 0, limit)
+	for i := len(state.Activity) - 1; i >= 0 && len(feed) < limit; i-- {
+		a := state.Activity[i]
+		if billID != 0 && (a.Target != "bill" || a.TargetID != billID) {
+			continue
+		}
+		feed = append(feed, a)
+	}
+	writeJSON(w, http.StatusOK, feed)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 動態紀錄測試
+// ==========================================
+func TestDiffActivity(t *testing.T) {
+	before := GlobalState{
+		People: []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}},
+		Bills: []Bill{
+			{ID: 1, Title: "Taxi", Amount: 400, PaidBy: 1, Participants: []int{1, 2}},
+			{ID: 2, Title: "Hotel", Amount: 3000, PaidBy: 2, Participants: []int{1, 2}},
+			{ID: 3, Title: "Museum", Amount: 600, PaidBy: 1, Participants: []int{1, 2}, DeletedAt: 1},
+		},
+	}
+	after := cloneState(before)
+	after.Bills[0].DeletedAt = 2                                              // 刪除 Taxi
+	after.Bills[1].AmountBase = 3000                                          // 只有換算金額變動，不算修改
+	after.Bills[2].DeletedAt = 0                                              // 從垃圾桶還原 Museum
+	after.Bills = append(after.Bills, Bill{ID: 4, Title: "Lunch", PaidBy: 2}) // 新增
+	after.People[1].Name = "Bobby"
+
+	feed := diffActivity(before, after, Actor{User: "Bob", IP: "10.0.0.2"}, time.Now())
+	want := []string{"Bob 刪除了帳單「Taxi」", "Bob 還原了帳單「Museum」", "Bob 新增了帳單「Lunch」", "Bob 修改了成員「Bobby」"}
+	if len(feed) != len(want) {
+		t.Fatalf("應產生 %d 筆動態, got %+v", len(want), feed)
+	}
+	for i, msg := range want {
+		if feed[i].Message != msg || feed[i].IP != "10.0.0.2" {
+			t.Errorf("第 %d 筆: got %q, want %q", i+1, feed[i].Message, msg)
+		}
+	}
+
+	commented := cloneState(before)
+	commented.Bills[1].Comments = []Comment{{ID: 1, Text: "?"}}
+	if feed := diffActivity(before, commented, Actor{}, time.Now()); len(feed) != 1 || !strings.Contains(feed[0].Message, "在帳單「Hotel」留言") {
+		t.Errorf("新增留言應有專屬描述, got %+v", feed)
+	}
+}
+
+func TestActivityAPI(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	sync := func(body string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+		req.Header.Set("X-Splitter-User", "Bob")
+		ifMatchCurrent(req)
+		req.RemoteAddr = "192.168.1.20:51234"
+		rec := httptest.NewRecorder()
+		handleSync(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("同步失敗: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	people := `"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]`
+	sync(`{` + people + `,"bills":[{"id":1,"title":"Taxi","amount":400,"paidBy":1,"participants":[1,2]}]}`)
+	sync(`{` + people + `,"bills":[]}`)
+	// 客戶端不能改寫動態紀錄
+	sync(`{` + people + `,"bills":[],"activity":[]}`)
+
+	rec := httptest.NewRecorder()
+	handleActivity(rec, httptest.NewRequest(http.MethodGet, "/api/activity?billId=1", nil))
+	var feed []Activity
+	if err := json.Unmarshal(rec.Body.Bytes(), &feed); err != nil {
+		t.Fatal(err)
+	}
+	if len(feed) != 2 || feed[0].Message != "Bob 刪除了帳單「Taxi」" || feed[0].IP != "192.168.1.20" || feed[1].Action != activityAdded {
+		t.Errorf("動態應由新到舊列出帳單的新增與刪除, got %+v", feed)
+	}
+
+	state, _ := currentState()
+	if visibleState(state).Activity != nil {
+		t.Error("同步回應不應包含動態紀錄")
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// ================= 統一錯誤格式 =================
+
+// APIError 所有 API 錯誤回應的格式：Code 給程式判斷（不會隨翻譯改變），Message 給人看，
+// Field 為出錯的欄位（JSON 路徑），Details 視錯誤種類附上更多資料（例如每個欄位的驗證錯誤）
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"`
+	Details any    `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+const (
+	codeInvalidRequest    = "invalid_request"
+	codeInvalidBody       = "invalid_body"
+	codeInvalidJSON       = "invalid_json"
+	codeValidation        = "validation_failed"
+	codeUnauthorized      = "unauthorized"
+	codeForbidden         = "forbidden"
+	codeNotFound          = "not_found"
+	codeMethodNotAllowed  = "method_not_allowed"
+	codeConflict          = "conflict"
+	codeAlreadyExists     = "already_exists"
+	codeInUse             = "in_use"
+	codeBillLocked        = "bill_locked"
+	codeStaleRevision     = "stale_revision"
+	codeRevisionRequired  = "revision_required"
+	codeInvalidRevision   = "invalid_revision"
+	codeSettlementChanged = "settlement_changed"
+	codeInvalidPatch      = "invalid_patch"
+	codePatchTestFailed   = "patch_test_failed"
+	codePayloadTooLarge   = "payload_too_large"
+	codeUnsupportedMedia  = "unsupported_media_type"
+	codeUpgradeRequired   = "upgrade_required"
+	codeRatesUnavailable  = "rates_unavailable"
+	codeMissingRate       = "missing_rate"
+	codeNoHistoricalRates = "historical_rates_unsupported"
+	codeTooManyItems      = "too_many_items"
+	codeRoomArchived      = "room_archived"
+	codeCalculationFailed = "calculation_failed"
+	codeInternal          = "internal_error"
+)
+
+// statusCodes 沒有更明確的錯誤種類時，依 HTTP 狀態碼決定 Code
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            codeInvalidRequest,
+	http.StatusUnauthorized:          codeUnauthorized,
+	http.StatusForbidden:             codeForbidden,
+	http.StatusNotFound:              codeNotFound,
+	http.StatusMethodNotAllowed:      codeMethodNotAllowed,
+	http.StatusConflict:              codeConflict,
+	http.StatusRequestEntityTooLarge: codePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  codeUnsupportedMedia,
+	http.StatusUpgradeRequired:       codeUpgradeRequired,
+	http.StatusPreconditionRequired:  codeRevisionRequired,
+	http.StatusBadGateway:            codeRatesUnavailable,
+}
+
+// errorCodes 已知的錯誤對應的 Code，依序比對（errors.Is）
+var errorCodes = []struct {
+	err  error
+	code string
+}{
+	{errBillLocked, codeBillLocked},
+	{errRoomArchived, codeRoomArchived},
+	{errStaleRevision, codeStaleRevision},
+	{errRevisionRequired, codeRevisionRequired},
+	{errInvalidRevision, codeInvalidRevision},
+	{errSettlementChanged, codeSettlementChanged},
+	{errPatchTestFailed, codePatchTestFailed},
+	{errInvalidPatch, codeInvalidPatch},
+	{errCategoryExists, codeAlreadyExists},
+	{errCategoryInUse, codeInUse},
+	{errGroupInUse, codeInUse},
+	{errPersonInUse, codeInUse},
+	{errInvalidGroup, codeValidation},
+	{errInvalidTemplate, codeValidation},
+	{errInvalidPayment, codeValidation},
+	{errInvalidRateTable, codeValidation},
+	{errInvalidMerge, codeValidation},
+	{errBillNotFound, codeNotFound},
+	{errPersonNotFound, codeNotFound},
+	{errGroupNotFound, codeNotFound},
+	{errCategoryNotFound, codeNotFound},
+	{errTemplateNotFound, codeNotFound},
+	{errSettlementNotFound, codeNotFound},
+	{errSnapshotNotFound, codeNotFound},
+	{errNotInTrash, codeNotFound},
+	{errRateCircuitOpen, codeRatesUnavailable},
+	{errRatesUnavailable, codeRatesUnavailable},
+	{errNoHistoricalRates, codeNoHistoricalRates},
+}
+
+// missingRateError 匯率來源沒有 cur 的匯率；details.currency 為幣別代碼
+func missingRateError(cur, message string) error {
+	return &APIError{Code: codeMissingRate, Message: message, Details: map[string]string{"currency": strings.ToUpper(cur)}}
+}
+
+func codeForStatus(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return codeInternal
+	}
+	return codeInvalidRequest
+}
+
+// apiErrorFrom 將 err 轉成 APIError；驗證錯誤附上每個欄位，不認得的錯誤使用 fallback 作為 Code
+func apiErrorFrom(err error, fallback string) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var invalid ValidationErrors
+	if errors.As(err, &invalid) && len(invalid) > 0 {
+		return &APIError{Code: codeValidation, Message: invalid.Error(), Field: invalid[0].Field, Details: []FieldError(invalid)}
+	}
+	var limit *limitError
+	if errors.As(err, &limit) {
+		return &APIError{Code: codeTooManyItems, Message: limit.Error(), Field: limit.Field, Details: map[string]int{"count": limit.Count, "max": limit.Max}}
+	}
+	for _, c := range errorCodes {
+		if errors.Is(err, c.err) {
+			return &APIError{Code: c.code, Message: err.Error()}
+		}
+	}
+	return &APIError{Code: fallback, Message: err.Error()}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, e *APIError) {
+	writeJSON(w, status, e)
+}
+
+// writeError 回傳統一格式的錯誤，Code 依狀態碼決定
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeAPIError(w, status, &APIError{Code: codeForStatus(status), Message: message})
+}
+
+// writeErrorCode 同 writeError，但指定 Code
+func writeErrorCode(w http.ResponseWriter, status int, code, message string) {
+	writeAPIError(w, status, &APIError{Code: code, Message: message})
+}
+
+// writeErrorFor 依 err 的種類決定 Code（認不得時依狀態碼），訊息為 err.Error()
+func writeErrorFor(w http.ResponseWriter, status int, err error) {
+	writeAPIError(w, status, apiErrorFrom(err, codeForStatus(status)))
+}
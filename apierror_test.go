@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// validationErrorBody 驗證失敗時的錯誤回應，details 為每個欄位的錯誤
+type validationErrorBody struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Field   string       `json:"field"`
+	Details []FieldError `json:"details"`
+}
+
+// ==========================================
+// 錯誤對應 Code 測試
+// ==========================================
+func TestAPIErrorFrom(t *testing.T) {
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: 第 3 筆", errBillLocked), codeBillLocked},
+		{fmt.Errorf("%w: 帳單「Taxi」", errPersonInUse), codeInUse},
+		{errTemplateNotFound, codeNotFound},
+		{fmt.Errorf("fetch: %w", errRateCircuitOpen), codeRatesUnavailable},
+		{fmt.Errorf("something else"), codeCalculationFailed},
+	}
+	for _, c := range cases {
+		if got := apiErrorFrom(c.err, codeCalculationFailed); got.Code != c.want || got.Message != c.err.Error() {
+			t.Errorf("apiErrorFrom(%v) = %+v, want code %s", c.err, got, c.want)
+		}
+	}
+
+	invalid := ValidationErrors{{Field: "bills[0].amount", Message: "金額必須大於 0"}, {Field: "bills[0].paidBy", Message: "付款人不存在"}}
+	got := apiErrorFrom(fmt.Errorf("sync: %w", invalid), codeInvalidRequest)
+	if got.Code != codeValidation || got.Field != "bills[0].amount" || len(got.Details.([]FieldError)) != 2 {
+		t.Errorf("驗證錯誤應附上欄位, got %+v", got)
+	}
+}
+
+// ==========================================
+// HTTP 錯誤回應格式測試
+// ==========================================
+func TestWriteError_Envelope(t *testing.T) {
+	cases := []struct {
+		method, path string
+		status       int
+		code         string
+	}{
+		{http.MethodDelete, "/api/people", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{http.MethodPut, "/api/people/x", http.StatusBadRequest, codeInvalidRequest},
+		{http.MethodGet, "/api/ws", http.StatusUpgradeRequired, codeUpgradeRequired},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, nil)
+		rec := httptest.NewRecorder()
+		switch c.path {
+		case "/api/people":
+			handlePeople(rec, req)
+		case "/api/ws":
+			handleWS(rec, req)
+		default:
+			req.SetPathValue("id", "x")
+			handlePerson(rec, req)
+		}
+		var body APIError
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Errorf("%s %s 應回傳 JSON: %v %q", c.method, c.path, err, rec.Body.String())
+			continue
+		}
+		if rec.Code != c.status || body.Code != c.code || body.Message == "" {
+			t.Errorf("%s %s = %d %+v, want %d %s", c.method, c.path, rec.Code, body, c.status, c.code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q", ct)
+		}
+	}
+}
+
+// ==========================================
+// 計算錯誤的 errorInfo 測試
+// ==========================================
+func TestProcessCalculate_ErrorInfo(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03}})
+
+	req := `{"baseCurrency":"TWD","people":[{"id":1,"name":"Alice"}],"bills":[{"title":"Pho","amount":75000,"currency":"VND","paidBy":1,"participants":[1]}]}`
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculateContext(context.Background(), req)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error == "" || resp.ErrorInfo == nil || resp.ErrorInfo.Code != codeMissingRate || resp.ErrorInfo.Message != resp.Error {
+		t.Fatalf("缺少匯率應回傳 missing_rate, got %+v", resp.ErrorInfo)
+	}
+	if details, _ := resp.ErrorInfo.Details.(map[string]any); details["currency"] != "VND" {
+		t.Errorf("details 應包含幣別, got %+v", resp.ErrorInfo.Details)
+	}
+
+	resp = CalculateResponse{}
+	json.Unmarshal([]byte(processCalculate(`{`)), &resp)
+	if resp.ErrorInfo == nil || resp.ErrorInfo.Code != codeInvalidJSON {
+		t.Errorf("解析失敗應回傳 invalid_json, got %+v", resp)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// ================= 收據附件 =================
+
+// maxAttachmentSize 單張收據照片的上限；手機拍照壓縮後通常在 5MB 內
+const maxAttachmentSize = 10 << 20
+
+// attachmentTypes 允許的圖片格式（以實際內容判斷，不信任客戶端宣稱的 Content-Type）
+var attachmentTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// dataDir 伺服器存放附件等檔案的目錄，由 -data-dir 設定
+var dataDir = "data"
+
+var errBillNotFound = errors.New("bill not found")
+
+// Attachment 帳單附帶的收據；檔案存在 <房間目錄>/attachments/<帳單 ID>/<ID><副檔名>
+type Attachment struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	UploadedAt  int64  `json:"uploadedAt"`
+}
+
+func (a Attachment) fileName() string { return a.ID + attachmentTypes[a.ContentType] }
+
+func attachmentPath(dir string, billID int, a Attachment) string {
+	return filepath.Join(dir, "attachments", strconv.Itoa(billID), a.fileName())
+}
+
+func newAttachmentID() string {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+func findLiveBill(s *GlobalState, id int) *Bill {
+	for i := range s.Bills {
+		if s.Bills[i].ID == id && s.Bills[i].DeletedAt == 0 {
+			return &s.Bills[i]
+		}
+	}
+	return nil
+}
+
+// handleAttachmentUpload POST /api/bills/{id}/attachments，multipart 欄位名稱為 file
+func handleAttachmentUpload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	billID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+
+	// 預留 multipart 表頭的空間
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentSize+64<<10)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "missing file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxAttachmentSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "read file failed")
+		return
+	}
+	if len(data) > maxAttachmentSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "attachment too large")
+		return
+	}
+	contentType := http.DetectContentType(data)
+	if _, ok := attachmentTypes[contentType]; !ok {
+		writeError(w, http.StatusUnsupportedMediaType, "unsupported attachment type "+contentType)
+		return
+	}
+
+	att := Attachment{
+		ID:          newAttachmentID(),
+		Name:        filepath.Base(header.Filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		UploadedAt:  clock.Now().UnixMilli(),
+	}
+
+	// 先確認帳單存在再寫檔，避免替不存在的帳單留下孤兒檔案
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	if findLiveBill(&state, billID) == nil {
+		writeError(w, http.StatusNotFound, "bill not found")
+		return
+	}
+
+	path := attachmentPath(roomOf(r).dir(), billID, att)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		log.Printf("create attachment dir failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save attachment failed")
+		return
+	}
+	if err := writeFileAtomic(path, data, 0o600); err != nil {
+		log.Printf("write attachment failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save attachment failed")
+		return
+	}
+
+	_, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		bill := findLiveBill(s, billID)
+		if bill == nil {
+			return errBillNotFound
+		}
+		bill.Attachments = append(bill.Attachments, att)
+		return nil
+	})
+	if err != nil {
+		_ = os.Remove(path)
+		if errors.Is(err, errBillNotFound) {
+			writeError(w, http.StatusNotFound, "bill not found")
+			return
+		}
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	writeJSON(w, http.StatusCreated, att)
+}
+
+// handleAttachment GET 下載、DELETE 刪除 /api/bills/{id}/attachments/{attachment}
+func handleAttachment(w http.ResponseWriter, r *http.Request) {
+	billID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+	attID := r.PathValue("attachment")
+
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		att, ok := findAttachment(&state, billID, attID)
+		if !ok {
+			writeError(w, http.StatusNotFound, "attachment not found")
+			return
+		}
+		w.Header().Set("Content-Type", att.ContentType)
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		http.ServeFile(w, r, attachmentPath(roomOf(r).dir(), billID, att))
+
+	case http.MethodDelete:
+		var removed Attachment
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			bill := findLiveBill(s, billID)
+			if bill == nil {
+				return errBillNotFound
+			}
+			if bill.Locked {
+				return errBillLocked
+			}
+			for i, a := range bill.Attachments {
+				if a.ID == attID {
+					removed = a
+					bill.Attachments = append(bill.Attachments[:i], bill.Attachments[i+1:]...)
+					return nil
+				}
+			}
+			return errBillNotFound
+		})
+		if errors.Is(err, errBillNotFound) {
+			writeError(w, http.StatusNotFound, "attachment not found")
+			return
+		}
+		if errors.Is(err, errBillLocked) {
+			writeErrorCode(w, http.StatusConflict, codeBillLocked, "bill is locked")
+			return
+		}
+		if err != nil {
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		if err := os.Remove(attachmentPath(roomOf(r).dir(), billID, removed)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("remove attachment file failed: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func findAttachment(s *GlobalState, billID int, attID string) (Attachment, bool) {
+	bill := findLiveBill(s, billID)
+	if bill == nil {
+		return Attachment{}, false
+	}
+	for _, a := range bill.Attachments {
+		if a.ID == attID {
+			return a, true
+		}
+	}
+	return Attachment{}, false
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// ==========================================
+// 收據附件上傳 / 下載 / 刪除測試
+// ==========================================
+func TestAttachmentLifecycle(t *testing.T) {
+	state := newGlobalState()
+	state.Bills = []Bill{{ID: 7, Title: "Dinner", Amount: 900, PaidBy: 1, Participants: []int{1}}}
+	withRoomState(t, state)
+	savedDir := dataDir
+	dataDir = t.TempDir()
+	t.Cleanup(func() { dataDir = savedDir })
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/bills/{id}/{rest...}", handleBillSubresource)
+	mux.HandleFunc("/api/bills/from-template/{id}", handleBillFromTemplate)
+
+	upload := func(billID string, content []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		fw, _ := mw.CreateFormFile("file", "receipt.png")
+		fw.Write(content)
+		mw.Close()
+		req := httptest.NewRequest(http.MethodPost, "/api/bills/"+billID+"/attachments", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 32)...)
+	rec := upload("7", png)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("上傳失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var att Attachment
+	if err := json.Unmarshal(rec.Body.Bytes(), &att); err != nil || att.ContentType != "image/png" || att.Name != "receipt.png" {
+		t.Fatalf("回應不正確: %s", rec.Body.String())
+	}
+
+	state, _ = currentState()
+	if len(state.Bills[0].Attachments) != 1 {
+		t.Fatalf("帳單應記錄附件: %+v", state.Bills[0])
+	}
+
+	// 客戶端送來不含附件的完整狀態時，附件應保留
+	incoming := overlaySyncedState(state, []byte(`{"bills":[{"id":7,"title":"Dinner","amount":900,"paidBy":1,"participants":[1]}]}`))
+	keepServerBillFields(state, incoming)
+	if len(incoming.Bills[0].Attachments) != 1 {
+		t.Error("同步時不應覆蓋伺服器上的附件")
+	}
+
+	if rec := upload("7", []byte("not an image")); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("非圖片應回傳 415, got %d", rec.Code)
+	}
+	if rec := upload("99", png); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的帳單應回傳 404, got %d", rec.Code)
+	}
+	if rec := upload("7", make([]byte, maxAttachmentSize+1)); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("超過大小上限應回傳 413, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/bills/7/attachments/"+att.ID, nil))
+	if rec.Code != http.StatusOK || !bytes.Equal(rec.Body.Bytes(), png) {
+		t.Errorf("下載內容不正確: %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/api/bills/7/attachments/"+att.ID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("刪除失敗: %d", rec.Code)
+	}
+	if _, err := os.Stat(attachmentPath(dataDir, 7, att)); !os.IsNotExist(err) {
+		t.Error("刪除後檔案應一併移除")
+	}
+	state, _ = currentState()
+	if len(state.Bills[0].Attachments) != 0 {
+		t.Error("刪除後帳單不應再列出附件")
+	}
+}
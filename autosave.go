@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ================= 桌面版自動存檔 =================
+
+// defaultDesktopStatePath 回傳各作業系統的設定目錄
+// （Linux: $XDG_CONFIG_HOME、Windows: %AppData%、macOS: ~/Library/Application Support）
+func defaultDesktopStatePath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "bill-splitter")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "state.json"), nil
+}
+
+// desktopAutosaveStore 沒有指定 -state 等儲存位置時，桌面版預設的存檔位置
+func desktopAutosaveStore(passphrase string) Store {
+	path, err := defaultDesktopStatePath()
+	if err != nil {
+		log.Printf("autosave disabled: %v", err)
+		return nil
+	}
+	return NewFileStore(path, passphrase)
+}
+
+// desktopLoadState 綁定給前端的 loadState()，啟動時取回上次的人員與帳單
+func desktopLoadState() (string, error) {
+	state, err := currentState()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(visibleState(state))
+	return string(data), err
+}
+
+// desktopDeviceID 桌面版在區網同步時的裝置 ID，記在每筆修改的 updatedBy
+var desktopDeviceID string
+
+// desktopSaveState 綁定給前端的 saveState()，每次變更都寫入設定目錄
+func desktopSaveState(stateJSON string) (string, error) {
+	body := []byte(stateJSON)
+	var probe GlobalState
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return "", err
+	}
+	// 與 POST /api/sync 相同的檢查：數量上限、驗證、伺服器管理的欄位與已鎖定的帳單
+	state, err := updateStateAs(Actor{Device: "desktop", DeviceID: desktopDeviceID}, func(s *GlobalState) error {
+		return applySyncedState(s, overlaySyncedState(*s, body))
+	})
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(visibleState(state))
+	return string(data), err
+}
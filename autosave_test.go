@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 桌面版自動存檔測試
+// ==========================================
+func TestDesktopAutosave_ReloadsAfterRestart(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := loadStateStore(NewFileStore(path, "")); err != nil {
+		t.Fatalf("載入失敗: %v", err)
+	}
+	if _, err := desktopSaveState(`{"people":[{"id":1,"name":"Alice"}],"bills":[],"baseCurrency":"EUR"}`); err != nil {
+		t.Fatalf("自動存檔失敗: %v", err)
+	}
+
+	// 模擬關閉視窗後重新開啟
+	if err := loadStateStore(NewFileStore(path, "")); err != nil {
+		t.Fatalf("重新載入失敗: %v", err)
+	}
+	got, err := desktopLoadState()
+	if err != nil {
+		t.Fatalf("讀取失敗: %v", err)
+	}
+	if !strings.Contains(got, `"Alice"`) || !strings.Contains(got, `"EUR"`) {
+		t.Errorf("重新開啟後資料遺失: %s", got)
+	}
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ================= S3 相容儲存的雲端備份 =================
+
+// S3Config 適用 AWS S3、MinIO、Cloudflare R2 等相容服務（使用 path-style 網址）
+type S3Config struct {
+	Endpoint  string // 例如 https://s3.us-east-1.amazonaws.com 或 http://127.0.0.1:9000
+	Bucket    string
+	Region    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+}
+
+// S3Backup 定期上傳狀態快照，並能從最新的備份還原
+type S3Backup struct {
+	cfg    S3Config
+	client *http.Client
+	cipher *stateCipher
+	now    func() time.Time
+}
+
+func NewS3Backup(cfg S3Config, passphrase string) *S3Backup {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	b := &S3Backup{
+		cfg:    cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+	if passphrase != "" {
+		b.cipher = newStateCipher(passphrase)
+	}
+	return b
+}
+
+// Upload 上傳一份帶時間戳的備份，key 依時間排序，最新的排最後
+func (b *S3Backup) Upload(state GlobalState) (string, error) {
+	return b.UploadRoom("", state)
+}
+
+// UploadRoom 上傳房間的備份；預設房間直接放在 prefix 底下，其他房間放在 prefix/rooms/代碼/
+func (b *S3Backup) UploadRoom(code string, state GlobalState) (string, error) {
+	data, err := encodeStateFile(state, b.cipher)
+	if err != nil {
+		return "", err
+	}
+
+	prefix := b.cfg.Prefix
+	if code != "" {
+		prefix += "rooms/" + code + "/"
+	}
+	key := prefix + "state-" + b.now().UTC().Format("20060102T150405Z") + ".json"
+	resp, err := b.do(http.MethodPut, key, nil, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return key, nil
+}
+
+// Latest 下載 prefix 底下最新的一份備份
+func (b *S3Backup) Latest() (GlobalState, string, error) {
+	keys, err := b.list()
+	if err != nil {
+		return GlobalState{}, "", err
+	}
+	if len(keys) == 0 {
+		return GlobalState{}, "", errors.New("找不到任何備份")
+	}
+	sort.Strings(keys)
+	key := keys[len(keys)-1]
+
+	resp, err := b.do(http.MethodGet, key, nil, nil)
+	if err != nil {
+		return GlobalState{}, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GlobalState{}, "", err
+	}
+	state, err := decodeStateFile(data, b.cipher)
+	return state, key, err
+}
+
+type s3ListResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (b *S3Backup) list() ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {b.cfg.Prefix + "state-"}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		resp, err := b.do(http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range res.Contents {
+			keys = append(keys, c.Key)
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = res.NextContinuationToken
+	}
+}
+
+// do 送出經 AWS Signature V4 簽章的請求，非 2xx 視為錯誤
+func (b *S3Backup) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	endpoint, err := url.Parse(strings.TrimRight(b.cfg.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	path := "/" + b.cfg.Bucket
+	if key != "" {
+		path += "/" + key
+	}
+
+	u := *endpoint
+	u.Path = path
+	u.RawPath = awsURIEncode(path, false)
+	u.RawQuery = awsCanonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	signS3Request(req, body, b.cfg, b.now().UTC())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("S3 %s %s: HTTP %d %s", method, path, resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func signS3Request(req *http.Request, body []byte, cfg S3Config, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("x-amz-date", amzDate)
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hex.EncodeToString(hmacSHA256(awsSigningKey(cfg.SecretKey, day, cfg.Region, "s3"), stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func awsSigningKey(secret, day, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), day)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// awsURIEncode 依 SigV4 規則編碼；路徑中的 / 保留
+func awsURIEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			sb.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			sb.WriteByte(c)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", c)
+		}
+	}
+	return sb.String()
+}
+
+func awsCanonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, awsURIEncode(k, true)+"="+awsURIEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// runBackupLoop 每隔 interval 檢查每個房間的狀態，有變更才上傳
+func runBackupLoop(b *S3Backup, interval time.Duration) {
+	lastUploaded := map[string]int64{}
+	for range time.Tick(interval) {
+		backupRooms(b, serverRooms.all(), lastUploaded)
+	}
+}
+
+// backupRooms 上傳 LastUpdated 與上次上傳時不同的房間，lastUploaded 以房間代碼記錄
+func backupRooms(b *S3Backup, rooms []*room, lastUploaded map[string]int64) {
+	for _, rm := range rooms {
+		state, err := rm.currentState()
+		if err != nil {
+			log.Printf("backup: load room %q failed: %v", rm.code, err)
+			continue
+		}
+		if state.LastUpdated == lastUploaded[rm.code] {
+			continue
+		}
+		key, err := b.UploadRoom(rm.code, state)
+		if err != nil {
+			log.Printf("backup: upload room %q failed: %v", rm.code, err)
+			continue
+		}
+		lastUploaded[rm.code] = state.LastUpdated
+		log.Printf("backup: uploaded %s", key)
+	}
+}
+
+// restoreLatestBackup 供 restore-backup 子指令使用：下載最新備份寫入本機狀態
+func restoreLatestBackup(b *S3Backup, store Store) error {
+	if b == nil {
+		return errors.New("請用 -s3-endpoint 與 -s3-bucket 設定備份位置")
+	}
+	if store == nil {
+		return errors.New("請用 -state、-journal、-webdav 或 -pg 指定狀態來源")
+	}
+	state, key, err := b.Latest()
+	if err != nil {
+		return err
+	}
+	state.LastUpdated = clock.Now().UnixMilli()
+	if err := store.Save(state); err != nil {
+		return err
+	}
+	log.Printf("restored %s (%d people, %d bills)", key, len(state.People), len(state.Bills))
+	return nil
+}
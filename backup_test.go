@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// S3 備份測試
+// ==========================================
+func TestAWSSigningKey(t *testing.T) {
+	// AWS 文件中的官方範例
+	key := awsSigningKey("wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "20120215", "us-east-1", "iam")
+	want := "f4780e2d9f65fa895f9c67b32ce1baf0b0d8a43505a000a1a9e090d414db404d"
+	if got := hex.EncodeToString(key); got != want {
+		t.Errorf("signing key 錯誤, got %s, want %s", got, want)
+	}
+}
+
+func TestS3Backup_UploadAndLatest(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AK/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[strings.TrimPrefix(r.URL.Path, "/trips/")] = body
+		case r.URL.Query().Get("list-type") == "2":
+			var sb strings.Builder
+			sb.WriteString("<ListBucketResult>")
+			for k := range objects {
+				sb.WriteString("<Contents><Key>" + k + "</Key></Contents>")
+			}
+			sb.WriteString("</ListBucketResult>")
+			io.WriteString(w, sb.String())
+		default:
+			w.Write(objects[strings.TrimPrefix(r.URL.Path, "/trips/")])
+		}
+	}))
+	defer srv.Close()
+
+	b := NewS3Backup(S3Config{Endpoint: srv.URL, Bucket: "trips", Prefix: "p/", AccessKey: "AK", SecretKey: "SK"}, "")
+	clock := time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return clock }
+
+	state := newGlobalState()
+	state.BaseCurrency = "EUR"
+	if _, err := b.Upload(state); err != nil {
+		t.Fatalf("上傳失敗: %v", err)
+	}
+	clock = clock.Add(time.Hour)
+	state.BaseCurrency = "JPY"
+	if _, err := b.Upload(state); err != nil {
+		t.Fatalf("上傳失敗: %v", err)
+	}
+
+	latest, key, err := b.Latest()
+	if err != nil {
+		t.Fatalf("下載失敗: %v", err)
+	}
+	if latest.BaseCurrency != "JPY" || !strings.HasSuffix(key, "T110000Z.json") {
+		t.Errorf("應取回最新的備份, got %s (%s)", key, latest.BaseCurrency)
+	}
+}
+
+func TestBackupRooms_EachRoom(t *testing.T) {
+	reg := useRooms(t)
+	withRoomState(t, newGlobalState())
+	var mu sync.Mutex
+	var keys []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		keys = append(keys, strings.TrimPrefix(r.URL.Path, "/trips/"))
+	}))
+	defer srv.Close()
+
+	b := NewS3Backup(S3Config{Endpoint: srv.URL, Bucket: "trips", Prefix: "p/", AccessKey: "AK", SecretKey: "SK"}, "")
+	b.now = func() time.Time { return time.Date(2025, 5, 1, 10, 0, 0, 0, time.UTC) }
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defaultRoom.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.BaseCurrency = "EUR"
+		return nil
+	})
+
+	// 預設房間與其他房間都要備份，各自放在自己的 prefix 底下
+	last := map[string]int64{}
+	backupRooms(b, reg.all(), last)
+	want := []string{"p/state-20250501T100000Z.json", "p/rooms/" + rm.code + "/state-20250501T100000Z.json"}
+	if strings.Join(keys, ",") != strings.Join(want, ",") {
+		t.Errorf("上傳的 key = %v, want %v", keys, want)
+	}
+
+	// 沒有變更的房間不再上傳
+	keys = nil
+	backupRooms(b, reg.all(), last)
+	if len(keys) != 0 {
+		t.Errorf("沒有變更時不應上傳, got %v", keys)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ================= 期初餘額 =================
+
+// OpeningBalance 開帳前就存在的欠款（例如上一趟旅行 Charlie 還欠 Alice 800），
+// 金額以本位幣計，From 欠 To
+type OpeningBalance struct {
+	From   int     `json:"from"`
+	To     int     `json:"to"`
+	Amount float64 `json:"amount"`
+	Note   string  `json:"note,omitempty"`
+}
+
+func validateOpeningBalances(people []Person, balances []OpeningBalance) error {
+	known := make(map[int]bool, len(people))
+	for _, p := range people {
+		known[p.ID] = true
+	}
+	for i, ob := range balances {
+		if !known[ob.From] || !known[ob.To] {
+			return fmt.Errorf("期初餘額第 %d 筆的人員不存在", i+1)
+		}
+		if ob.From == ob.To {
+			return fmt.Errorf("期初餘額第 %d 筆的欠款人與債權人不能是同一人", i+1)
+		}
+		if ob.Amount <= 0 || math.IsNaN(ob.Amount) || math.IsInf(ob.Amount, 0) {
+			return fmt.Errorf("期初餘額第 %d 筆的金額必須大於 0", i+1)
+		}
+	}
+	return nil
+}
+
+// openingBalanceBills 把期初餘額當成「To 先替 From 付了錢」的轉帳帶進 calculate，
+// 只在計算時使用，不會出現在回應的帳單列表中
+func openingBalanceBills(balances []OpeningBalance) []Bill {
+	bills := make([]Bill, 0, len(balances))
+	for _, ob := range balances {
+		bills = append(bills, Bill{
+			Type:         billTypeTransfer,
+			Title:        ob.Note,
+			Amount:       ob.Amount,
+			AmountBase:   ob.Amount,
+			PaidBy:       ob.To,
+			Participants: []int{ob.From},
+		})
+	}
+	return bills
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// ==========================================
+// 期初餘額驗證與日期篩選測試
+// ==========================================
+func TestOpeningBalancesInProcessCalculate(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+
+	run := func(req CalculateRequest) CalculateResponse {
+		data, _ := json.Marshal(req)
+		var resp CalculateResponse
+		if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	resp := run(CalculateRequest{People: people, Bills: []Bill{},
+		OpeningBalances: []OpeningBalance{{From: 2, To: 1, Amount: 800, Note: "上次旅行"}}})
+	if resp.Error != "" || len(resp.Settlements) != 1 || resp.Settlements[0].From != "Bob" || resp.Settlements[0].Amount != 800 {
+		t.Errorf("期初欠款應直接成為結算: %+v", resp)
+	}
+	if len(resp.Bills) != 0 {
+		t.Errorf("期初欠款不應出現在帳單列表: %+v", resp.Bills)
+	}
+
+	// 指定起始日期時，期初欠款屬於期間之前，不列入
+	resp = run(CalculateRequest{People: people, Bills: []Bill{}, From: "2025-01-01",
+		OpeningBalances: []OpeningBalance{{From: 2, To: 1, Amount: 800}}})
+	if resp.Error != "" || len(resp.Settlements) != 0 {
+		t.Errorf("指定期間時不應計入期初欠款: %+v", resp)
+	}
+
+	for _, bad := range [][]OpeningBalance{
+		{{From: 2, To: 9, Amount: 100}},
+		{{From: 1, To: 1, Amount: 100}},
+		{{From: 2, To: 1, Amount: -5}},
+	} {
+		if err := validateOpeningBalances(people, bad); err == nil {
+			t.Errorf("應驗證失敗: %+v", bad)
+		}
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 帳單查詢 =================
+
+const billDateLayout = "2006-01-02"
+
+// dateRange 以 YYYY-MM-DD 字串比較；空字串代表不限
+type dateRange struct {
+	From string
+	To   string
+}
+
+func parseDateRange(from, to string) (dateRange, error) {
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse(billDateLayout, d); err != nil {
+			return dateRange{}, fmt.Errorf("日期格式錯誤 %q，請使用 YYYY-MM-DD", d)
+		}
+	}
+	if from != "" && to != "" && from > to {
+		return dateRange{}, fmt.Errorf("起始日期 %s 晚於結束日期 %s", from, to)
+	}
+	return dateRange{From: from, To: to}, nil
+}
+
+// contains 指定了範圍時，沒有日期的帳單不算在內
+func (dr dateRange) contains(date string) bool {
+	if dr.From == "" && dr.To == "" {
+		return true
+	}
+	if date == "" {
+		return false
+	}
+	return (dr.From == "" || date >= dr.From) && (dr.To == "" || date <= dr.To)
+}
+
+func filterBillsByDate(bills []Bill, dr dateRange) []Bill {
+	out := make([]Bill, 0, len(bills))
+	for _, b := range bills {
+		if dr.contains(b.Date) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// billMatches tag 需完全符合其中一個標籤（不分大小寫）；
+// q 在名稱、分類、備註與標籤中做子字串搜尋。空字串代表不限
+func billMatches(b Bill, tag, q string) bool {
+	if tag != "" {
+		found := false
+		for _, t := range b.Tags {
+			if strings.EqualFold(strings.TrimSpace(t), tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if q == "" {
+		return true
+	}
+	q = strings.ToLower(q)
+	fields := append([]string{b.Title, b.Category, b.Notes}, b.Tags...)
+	for _, f := range fields {
+		if strings.Contains(strings.ToLower(f), q) {
+			return true
+		}
+	}
+	return false
+}
+
+func searchBills(bills []Bill, tag, q string) []Bill {
+	tag, q = strings.TrimSpace(tag), strings.TrimSpace(q)
+	if tag == "" && q == "" {
+		return bills
+	}
+	out := make([]Bill, 0, len(bills))
+	for _, b := range bills {
+		if billMatches(b, tag, q) {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// maxBillPage 每頁最多回傳的帳單數，limit 超過時以此為準
+const maxBillPage = 500
+
+// billListQuery GET /api/bills 的分類、付款人篩選、排序與分頁條件
+type billListQuery struct {
+	Category string
+	PaidBy   int
+	// Sort 為 date、amount，前面加 "-" 代表由大到小；空字串維持原本的順序
+	Sort   string
+	Limit  int
+	Offset int
+}
+
+// parseBillListQuery 解析 category、paidBy、sort、limit、offset；limit 為 0 代表不分頁
+func parseBillListQuery(q url.Values) (billListQuery, error) {
+	bq := billListQuery{Category: strings.TrimSpace(q.Get("category"))}
+	if v := q.Get("paidBy"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return bq, fmt.Errorf("invalid paidBy %q", v)
+		}
+		bq.PaidBy = n
+	}
+	switch bq.Sort = q.Get("sort"); strings.TrimPrefix(bq.Sort, "-") {
+	case "", "date", "amount":
+	default:
+		return bq, fmt.Errorf(`sort must be "date" or "amount" (prefix "-" for descending)`)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return bq, fmt.Errorf("invalid limit %q", v)
+		}
+		bq.Limit = min(n, maxBillPage)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return bq, fmt.Errorf("invalid offset %q", v)
+		}
+		bq.Offset = n
+	}
+	return bq, nil
+}
+
+// filter 分類不分大小寫完全符合；付款人比對 PaidBy 或多人付款中的任何一人
+func (bq billListQuery) filter(bills []Bill) []Bill {
+	if bq.Category == "" && bq.PaidBy == 0 {
+		return bills
+	}
+	out := make([]Bill, 0, len(bills))
+	for _, b := range bills {
+		if bq.Category != "" && !strings.EqualFold(strings.TrimSpace(b.Category), bq.Category) {
+			continue
+		}
+		if bq.PaidBy != 0 && !paidByPerson(b, bq.PaidBy) {
+			continue
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+func paidByPerson(b Bill, id int) bool {
+	if b.PaidBy == id {
+		return true
+	}
+	for _, p := range b.Payers {
+		if p.PersonID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// sort 依日期或金額（原幣別，不換匯）穩定排序；沒有日期的帳單不論方向都排最後
+func (bq billListQuery) sort(bills []Bill) []Bill {
+	if bq.Sort == "" {
+		return bills
+	}
+	desc := strings.HasPrefix(bq.Sort, "-")
+	out := slices.Clone(bills)
+	sort.SliceStable(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if desc {
+			a, b = b, a
+		}
+		if strings.TrimPrefix(bq.Sort, "-") == "amount" {
+			return a.Amount < b.Amount
+		}
+		if out[i].Date == "" || out[j].Date == "" {
+			return out[j].Date == "" && out[i].Date != ""
+		}
+		return a.Date < b.Date
+	})
+	return out
+}
+
+// page 取出 offset 開始的 limit 筆
+func (bq billListQuery) page(bills []Bill) []Bill {
+	start := min(bq.Offset, len(bills))
+	end := len(bills)
+	if bq.Limit > 0 {
+		end = min(start+bq.Limit, end)
+	}
+	return bills[start:end]
+}
+
+// BillDay 同一天的帳單，沒有日期的歸在 Date 為空的那一組
+type BillDay struct {
+	Date  string `json:"date"`
+	Bills []Bill `json:"bills"`
+}
+
+func groupBillsByDay(bills []Bill) []BillDay {
+	index := map[string]int{}
+	var days []BillDay
+	for _, b := range bills {
+		i, ok := index[b.Date]
+		if !ok {
+			i = len(days)
+			index[b.Date] = i
+			days = append(days, BillDay{Date: b.Date})
+		}
+		days[i].Bills = append(days[i].Bills, b)
+	}
+	sort.SliceStable(days, func(i, j int) bool {
+		// 沒有日期的排最後
+		if days[i].Date == "" || days[j].Date == "" {
+			return days[j].Date == ""
+		}
+		return days[i].Date < days[j].Date
+	})
+	return days
+}
+
+// BillsResponse Total 為篩選後、分頁前的筆數；Days 只包含這一頁的帳單
+type BillsResponse struct {
+	Bills  []Bill    `json:"bills"`
+	Days   []BillDay `json:"days,omitempty"`
+	Total  int       `json:"total"`
+	Offset int       `json:"offset,omitempty"`
+	Limit  int       `json:"limit,omitempty"`
+}
+
+// handleBills GET /api/bills?from=&to=&tag=&q=&category=&paidBy=&sort=&limit=&offset=&group=day 查詢、POST 新增一筆帳單（ID 由伺服器指定）
+func handleBills(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		createBill(w, r)
+		return
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	q := r.URL.Query()
+	dr, err := parseDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	}
+	bq, err := parseBillListQuery(q)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+
+	bills := filterBillsByDate(visibleState(state).Bills, dr)
+	bills = bq.sort(bq.filter(searchBills(bills, q.Get("tag"), q.Get("q"))))
+	resp := BillsResponse{Bills: bq.page(bills), Total: len(bills), Offset: bq.Offset, Limit: bq.Limit}
+	switch q.Get("group") {
+	case "":
+	case "day":
+		resp.Days = groupBillsByDay(resp.Bills)
+	default:
+		writeError(w, http.StatusBadRequest, `group must be "day"`)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func createBill(w http.ResponseWriter, r *http.Request) {
+	var b Bill
+	if !decodeResource(w, r, &b) {
+		return
+	}
+	_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		if errs := validateBill(*s, b); len(errs) > 0 {
+			return errs
+		}
+		if err := checkLimits(0, len(visibleState(*s).Bills)+1); err != nil {
+			return err
+		}
+		b.ID = maxBillID(s.Bills) + 1
+		b.Attachments, b.Comments, b.Locked, b.DeletedAt = nil, nil, false, 0
+		s.Bills = append(s.Bills, b)
+		ensureBillCategories(s)
+		return nil
+	})
+	if !billUpdateOK(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, b)
+}
+
+// handleBillsBatch POST /api/bills:batch 一次新增多筆帳單（JSON 陣列）。
+// 全部通過檢查才寫入，任何一筆有問題就整批不新增；錯誤欄位以 bills[i]. 標示第幾筆
+func handleBillsBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var bills []Bill
+	if !decodeResource(w, r, &bills) {
+		return
+	}
+	if len(bills) == 0 {
+		writeErrorCode(w, http.StatusBadRequest, codeInvalidRequest, "bills must not be empty")
+		return
+	}
+	_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		if err := checkLimits(0, len(visibleState(*s).Bills)+len(bills)); err != nil {
+			return err
+		}
+		var errs ValidationErrors
+		for _, e := range validatePeopleAndBills(visibleState(*s).People, bills) {
+			if strings.HasPrefix(e.Field, "bills[") {
+				errs = append(errs, e)
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		next := maxBillID(s.Bills)
+		for i := range bills {
+			next++
+			bills[i].ID = next
+			bills[i].Attachments, bills[i].Comments, bills[i].Locked, bills[i].DeletedAt = nil, nil, false, 0
+		}
+		s.Bills = append(s.Bills, bills...)
+		ensureBillCategories(s)
+		return nil
+	})
+	if !billUpdateOK(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, bills)
+}
+
+// handleBill PUT 修改、DELETE 刪除（移到垃圾桶）/api/bills/{id}；已鎖定的帳單兩者都不行
+func handleBill(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var b Bill
+		if !decodeResource(w, r, &b) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := liveBillIndex(*s, id)
+			if i < 0 {
+				return errBillNotFound
+			}
+			cur := s.Bills[i]
+			if cur.Locked {
+				return fmt.Errorf("%w: 帳單「%s」已結算鎖定，不能修改", errBillLocked, cur.Title)
+			}
+			if errs := validateBill(*s, b); len(errs) > 0 {
+				return errs
+			}
+			b.ID, b.Locked, b.DeletedAt = id, false, 0
+			b.Attachments, b.Comments = cur.Attachments, cur.Comments
+			s.Bills[i] = b
+			ensureBillCategories(s)
+			return nil
+		})
+		if !billUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, b)
+
+	case http.MethodDelete:
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := liveBillIndex(*s, id)
+			if i < 0 {
+				return errBillNotFound
+			}
+			if s.Bills[i].Locked {
+				return fmt.Errorf("%w: 帳單「%s」已結算鎖定，不能刪除", errBillLocked, s.Bills[i].Title)
+			}
+			s.Bills[i].DeletedAt = clock.Now().UnixMilli()
+			return nil
+		})
+		if !billUpdateOK(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// liveBillIndex 不在垃圾桶中、ID 為 id 的帳單位置，找不到回傳 -1
+func liveBillIndex(s GlobalState, id int) int {
+	for i, b := range s.Bills {
+		if b.ID == id && b.DeletedAt == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateBill 以目前的人員名單檢查單筆帳單，欄位路徑不帶 bills[i] 前綴
+func validateBill(s GlobalState, b Bill) ValidationErrors {
+	return fieldsUnder(validatePeopleAndBills(visibleState(s).People, []Bill{b}), "bills[0].")
+}
+
+// fieldsUnder 只留下欄位路徑以 prefix 開頭的錯誤，並去掉 prefix
+func fieldsUnder(errs ValidationErrors, prefix string) ValidationErrors {
+	var out ValidationErrors
+	for _, e := range errs {
+		if field, ok := strings.CutPrefix(e.Field, prefix); ok {
+			e.Field = field
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func decodeResource(w http.ResponseWriter, r *http.Request, v any) bool {
+	body, err := readBody(w, r)
+	if err != nil {
+		return false
+	}
+	if err := decodeJSON(body, v); err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	return true
+}
+
+// billUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func billUpdateOK(w http.ResponseWriter, err error) bool {
+	var invalid ValidationErrors
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		writeErrorFor(w, http.StatusBadRequest, invalid)
+	case errors.Is(err, errBillNotFound):
+		writeError(w, http.StatusNotFound, "bill not found")
+	case errors.Is(err, errTooManyItems):
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, errBillLocked):
+		writeErrorFor(w, http.StatusConflict, err)
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
+
+// keepServerBillFields 附件、留言與鎖定狀態只能透過各自的 API 變更；
+// 客戶端推送完整狀態時沿用伺服器上的值，避免舊畫面把剛上傳的收據或新留言蓋掉
+func keepServerBillFields(cur, incoming GlobalState) {
+	type serverFields struct {
+		attachments []Attachment
+		comments    []Comment
+		locked      bool
+	}
+	existing := make(map[int]serverFields, len(cur.Bills))
+	for _, b := range cur.Bills {
+		if b.DeletedAt == 0 {
+			existing[b.ID] = serverFields{b.Attachments, b.Comments, b.Locked}
+		}
+	}
+	for i := range incoming.Bills {
+		f := existing[incoming.Bills[i].ID]
+		incoming.Bills[i].Attachments = f.attachments
+		incoming.Bills[i].Comments = f.comments
+		incoming.Bills[i].Locked = f.locked
+	}
+}
+
+// handleBillSubresource 處理 /api/bills/{id}/... 底下的路徑。
+// 直接註冊 /api/bills/{id}/attachments 會與 /api/bills/from-template/{id} 衝突
+// （兩者都符合 /api/bills/from-template/attachments），因此統一在這裡分派
+func handleBillSubresource(w http.ResponseWriter, r *http.Request) {
+	rest := r.PathValue("rest")
+	switch {
+	case rest == "attachments":
+		handleAttachmentUpload(w, r)
+	case rest == "comments":
+		handleBillComments(w, r)
+	case rest == "history":
+		handleBillHistory(w, r)
+	case strings.HasPrefix(rest, "attachments/") && !strings.Contains(rest[len("attachments/"):], "/"):
+		r.SetPathValue("attachment", rest[len("attachments/"):])
+		handleAttachment(w, r)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
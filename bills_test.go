@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 帳單日期篩選測試
+// ==========================================
+func TestFilterAndGroupBillsByDate(t *testing.T) {
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Date: "2025-05-01"},
+		{ID: 2, Title: "Taxi", Date: "2025-05-02"},
+		{ID: 3, Title: "Snack"},
+		{ID: 4, Title: "Museum", Date: "2025-05-01"},
+		{ID: 5, Title: "Train", Date: "2025-05-04"},
+	}
+
+	dr, err := parseDateRange("2025-05-01", "2025-05-02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered := filterBillsByDate(bills, dr)
+	if len(filtered) != 3 {
+		t.Errorf("範圍內應有 3 筆, got %+v", filtered)
+	}
+
+	days := groupBillsByDay(bills)
+	if len(days) != 4 || days[0].Date != "2025-05-01" || len(days[0].Bills) != 2 || days[3].Date != "" {
+		t.Errorf("分組結果錯誤: %+v", days)
+	}
+
+	if _, err := parseDateRange("2025-05-03", "2025-05-01"); err == nil {
+		t.Error("起始日期晚於結束日期應報錯")
+	}
+}
+
+// ==========================================
+// 帳單標籤與關鍵字搜尋測試
+// ==========================================
+func TestSearchBills(t *testing.T) {
+	bills := []Bill{
+		{ID: 1, Title: "Airport Taxi", Tags: []string{"transport"}},
+		{ID: 2, Title: "Louvre", Tags: []string{"Museum", "paris"}},
+		{ID: 3, Title: "Dinner", Notes: "搭 taxi 回飯店前吃的"},
+		{ID: 4, Title: "Orsay", Category: "museum"},
+	}
+
+	tests := []struct {
+		name string
+		tag  string
+		q    string
+		want []int
+	}{
+		{"不篩選", "", "", []int{1, 2, 3, 4}},
+		{"標籤不分大小寫", "museum", "", []int{2}},
+		{"關鍵字比對名稱與備註", "", "TAXI", []int{1, 3}},
+		{"關鍵字比對分類與標籤", "", "muse", []int{2, 4}},
+		{"標籤加關鍵字", "paris", "louvre", []int{2}},
+		{"沒有符合", "food", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := searchBills(bills, tt.tag, tt.q)
+			var ids []int
+			for _, b := range got {
+				ids = append(ids, b.ID)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) {
+				t.Errorf("got %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
+
+// ==========================================
+// 帳單 API 測試
+// ==========================================
+func TestBillCRUD(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1, 2}, Comments: []Comment{{ID: 1, Text: "收據在我這"}}},
+		{ID: 2, Title: "Museum", Amount: 30, PaidBy: 2, Participants: []int{1, 2}, Locked: true},
+		{ID: 5, Title: "Old", Amount: 10, PaidBy: 1, Participants: []int{1}, DeletedAt: 1},
+	}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/bills", handleBills)
+	mux.HandleFunc("/api/bills/{id}", handleBill)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	// ID 由伺服器指定，不與垃圾桶裡的重複
+	rec := do(http.MethodPost, "/api/bills", `{"id":1,"title":"Taxi","amount":20,"category":"交通","paidBy":2,"participants":[1,2],"locked":true}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("新增失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var created Bill
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID != 6 || created.Locked {
+		t.Errorf("created = %+v, want id 6 unlocked", created)
+	}
+
+	rec = do(http.MethodPost, "/api/bills", `{"title":"Lunch","amount":20,"paidBy":9,"participants":[1]}`)
+	var invalid validationErrorBody
+	json.Unmarshal(rec.Body.Bytes(), &invalid)
+	if rec.Code != http.StatusBadRequest || invalid.Code != codeValidation || len(invalid.Details) != 1 || invalid.Field != "paidBy" {
+		t.Errorf("付款人不存在應回傳 400 與欄位, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 修改時留言沿用伺服器上的
+	if rec := do(http.MethodPut, "/api/bills/1", `{"title":"Hotel","amount":320,"paidBy":1,"participants":[1,2]}`); rec.Code != http.StatusOK {
+		t.Fatalf("修改失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "/api/bills/2", `{"title":"Museum","amount":40,"paidBy":2,"participants":[1,2]}`); rec.Code != http.StatusConflict {
+		t.Errorf("已鎖定的帳單不能修改, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/bills/5", `{"title":"Old","amount":10,"paidBy":1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("垃圾桶裡的帳單應回傳 404, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodDelete, "/api/bills/2", ""); rec.Code != http.StatusConflict {
+		t.Errorf("已鎖定的帳單不能刪除, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/bills/6", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("刪除失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	state, _ = currentState()
+	if got := state.Bills[0]; got.Amount != 320 || len(got.Comments) != 1 {
+		t.Errorf("bill 1 = %+v", got)
+	}
+	if got := state.Bills[3]; got.ID != 6 || got.DeletedAt == 0 {
+		t.Errorf("刪除的帳單應移到垃圾桶, got %+v", got)
+	}
+	if findCategory(state.Categories, "交通") < 0 {
+		t.Error("新帳單的分類應加入分類清單")
+	}
+}
+
+// ==========================================
+// 帳單分頁、排序與篩選測試
+// ==========================================
+func TestBillsPaging(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Hotel", Date: "2025-05-01", Category: "Lodging", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Taxi", Date: "2025-05-03", Category: "transport", Amount: 20, PaidBy: 2, Participants: []int{1, 2}},
+		{ID: 3, Title: "Snack", Category: "Food", Amount: 5, PaidBy: 1, Participants: []int{1}},
+		{ID: 4, Title: "Train", Date: "2025-05-02", Category: "Transport", Amount: 80, Payers: []Payer{{PersonID: 1, Amount: 40}, {PersonID: 2, Amount: 40}}, Participants: []int{1, 2}},
+		{ID: 5, Title: "Dinner", Date: "2025-05-02", Category: "Food", Amount: 120, PaidBy: 2, Participants: []int{1, 2}},
+	}
+	withRoomState(t, state)
+
+	get := func(query string) (int, BillsResponse, []int) {
+		rec := httptest.NewRecorder()
+		handleBills(rec, httptest.NewRequest(http.MethodGet, "/api/bills?"+query, nil))
+		var resp BillsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		var ids []int
+		for _, b := range resp.Bills {
+			ids = append(ids, b.ID)
+		}
+		return rec.Code, resp, ids
+	}
+
+	tests := []struct {
+		query string
+		want  []int
+		total int
+	}{
+		{"", []int{1, 2, 3, 4, 5}, 5},
+		{"sort=date", []int{1, 4, 5, 2, 3}, 5},
+		{"sort=-date", []int{2, 4, 5, 1, 3}, 5},
+		{"sort=-amount", []int{1, 5, 4, 2, 3}, 5},
+		{"category=transport&sort=amount", []int{2, 4}, 2},
+		{"paidBy=2", []int{2, 4, 5}, 3},
+		{"sort=date&limit=2", []int{1, 4}, 5},
+		{"sort=date&limit=2&offset=2", []int{5, 2}, 5},
+		{"sort=date&limit=2&offset=4", []int{3}, 5},
+		{"offset=9", nil, 5},
+	}
+	for _, tt := range tests {
+		code, resp, ids := get(tt.query)
+		if code != http.StatusOK || fmt.Sprint(ids) != fmt.Sprint(tt.want) || resp.Total != tt.total {
+			t.Errorf("%q: got %d %v (total %d), want %v (total %d)", tt.query, code, ids, resp.Total, tt.want, tt.total)
+		}
+	}
+
+	// 分組只包含這一頁
+	if _, resp, _ := get("sort=date&limit=3&group=day"); len(resp.Days) != 2 || len(resp.Days[1].Bills) != 2 || resp.Limit != 3 {
+		t.Errorf("days = %+v", resp.Days)
+	}
+	if _, resp, _ := get("limit=100000"); resp.Limit != maxBillPage {
+		t.Errorf("limit 應限制在 %d, got %d", maxBillPage, resp.Limit)
+	}
+
+	for _, query := range []string{"limit=0", "limit=x", "offset=-1", "paidBy=bob", "sort=title"} {
+		if code, _, _ := get(query); code != http.StatusBadRequest {
+			t.Errorf("%q 應回 400, got %d", query, code)
+		}
+	}
+}
+
+// ==========================================
+// 批次新增帳單測試
+// ==========================================
+func TestBillsBatch(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{{ID: 7, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1, 2}}}
+	withRoomState(t, state)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleBillsBatch(rec, httptest.NewRequest(http.MethodPost, "/api/bills:batch", strings.NewReader(body)))
+		return rec
+	}
+
+	// 第二筆的付款人不存在：整批都不新增
+	rec := post(`[{"title":"Taxi","amount":20,"paidBy":2,"participants":[1,2]},{"title":"Lunch","amount":30,"paidBy":9,"participants":[1]}]`)
+	var e validationErrorBody
+	json.Unmarshal(rec.Body.Bytes(), &e)
+	if rec.Code != http.StatusBadRequest || len(e.Details) != 1 || !strings.HasPrefix(e.Details[0].Field, "bills[1].") {
+		t.Fatalf("有錯誤的批次應回 400 並標示第幾筆, got %d %s", rec.Code, rec.Body.String())
+	}
+	if len(defaultRoom.state.Bills) != 1 {
+		t.Fatalf("失敗時不應新增任何帳單, got %+v", defaultRoom.state.Bills)
+	}
+
+	rec = post(`[{"id":1,"title":"Taxi","amount":20,"paidBy":2,"participants":[1,2],"locked":true},{"title":"Lunch","amount":30,"category":"餐飲","paidBy":1,"participants":[1]}]`)
+	var created []Bill
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if rec.Code != http.StatusCreated || len(created) != 2 || created[0].ID != 8 || created[1].ID != 9 || created[0].Locked {
+		t.Fatalf("批次新增失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(defaultRoom.state.Bills) != 3 {
+		t.Errorf("應有 3 筆帳單, got %d", len(defaultRoom.state.Bills))
+	}
+
+	if rec := post(`[]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("空陣列應回 400, got %d", rec.Code)
+	}
+	if rec := post(`{"title":"Taxi"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("不是陣列應回 400, got %d", rec.Code)
+	}
+	useLimits(t, 1<<20, false, 10, 4)
+	if rec := post(`[{"title":"A","amount":1,"paidBy":1,"participants":[1]},{"title":"B","amount":1,"paidBy":1,"participants":[1]}]`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("超過帳單上限應回 422, got %d", rec.Code)
+	}
+}
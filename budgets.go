@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ================= 預算上限 =================
+
+// Budget 預算上限（本位幣）：只填 PersonID 為個人總花費上限，只填 Category 為該分類的總花費上限，
+// 兩者都填則是某人在某分類的上限
+type Budget struct {
+	PersonID int     `json:"personId,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Limit    float64 `json:"limit"`
+}
+
+// BudgetWarning 超出預算的提醒，Spent 為實際花費（本位幣）
+type BudgetWarning struct {
+	PersonID int     `json:"personId,omitempty"`
+	Person   string  `json:"person,omitempty"`
+	Category string  `json:"category,omitempty"`
+	Limit    float64 `json:"limit"`
+	Spent    float64 `json:"spent"`
+	Message  string  `json:"message"`
+}
+
+func validateBudgets(people []Person, budgets []Budget) error {
+	known := make(map[int]bool, len(people))
+	for _, p := range people {
+		known[p.ID] = true
+	}
+	for i, b := range budgets {
+		if b.PersonID == 0 && strings.TrimSpace(b.Category) == "" {
+			return fmt.Errorf("預算第 %d 筆需要指定人員或分類", i+1)
+		}
+		if b.PersonID != 0 && !known[b.PersonID] {
+			return fmt.Errorf("預算第 %d 筆的人員 %d 不存在", i+1, b.PersonID)
+		}
+		if b.Limit <= 0 || math.IsNaN(b.Limit) || math.IsInf(b.Limit, 0) {
+			return fmt.Errorf("預算第 %d 筆的上限必須大於 0", i+1)
+		}
+	}
+	return nil
+}
+
+// checkBudgets 依已換算為本位幣的帳單計算花費並回傳超出的預算。
+// 個人花費指他應分攤的部分（不是先墊付的金額），還款不算花費，請客算在付款人身上
+func checkBudgets(people []Person, bills []Bill, budgets []Budget) []BudgetWarning {
+	if len(budgets) == 0 {
+		return nil
+	}
+	names := make(map[int]string, len(people))
+	for _, p := range people {
+		names[p.ID] = p.Name
+	}
+
+	type key struct {
+		person   int
+		category string
+	}
+	spent := map[key]float64{}
+	for _, bill := range bills {
+		if bill.isTransfer() || len(bill.Participants) == 0 {
+			continue
+		}
+		amt := bill.AmountBase
+		if amt == 0 {
+			amt = bill.Amount
+		}
+		category := strings.ToLower(strings.TrimSpace(bill.Category))
+		paid, owed := billCharges(bill, amt)
+		if bill.Treat {
+			// 請客的花費算在付款人身上
+			owed = paid
+		}
+		for pid, v := range owed {
+			spent[key{pid, ""}] += v
+			if category != "" {
+				spent[key{pid, category}] += v
+				spent[key{0, category}] += v
+			}
+		}
+	}
+
+	var warnings []BudgetWarning
+	for _, b := range budgets {
+		category := strings.ToLower(strings.TrimSpace(b.Category))
+		total := spent[key{b.PersonID, category}]
+		if total <= b.Limit+0.005 {
+			continue
+		}
+		w := BudgetWarning{
+			PersonID: b.PersonID,
+			Person:   names[b.PersonID],
+			Category: b.Category,
+			Limit:    b.Limit,
+			Spent:    math.Round(total*100) / 100,
+		}
+		switch {
+		case b.PersonID != 0 && b.Category != "":
+			w.Message = fmt.Sprintf("%s 在「%s」花費 %.2f，超出預算 %.2f", w.Person, b.Category, w.Spent, b.Limit)
+		case b.PersonID != 0:
+			w.Message = fmt.Sprintf("%s 總花費 %.2f，超出預算 %.2f", w.Person, w.Spent, b.Limit)
+		default:
+			w.Message = fmt.Sprintf("「%s」總花費 %.2f，超出預算 %.2f", b.Category, w.Spent, b.Limit)
+		}
+		warnings = append(warnings, w)
+	}
+	return warnings
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 預算上限提醒測試
+// ==========================================
+func TestCheckBudgets(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{
+		{ID: 1, AmountBase: 3000, Category: "住宿", PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, AmountBase: 800, Category: "飲食", PaidBy: 2, Participants: []int{1, 2}, Shares: map[int]float64{1: 3}},
+		{ID: 3, Type: billTypeTransfer, AmountBase: 5000, PaidBy: 2, Participants: []int{1}},
+	}
+	budgets := []Budget{
+		{PersonID: 1, Limit: 2000},                // Alice 花 1500 + 600 = 2100，超出
+		{PersonID: 2, Limit: 2000},                // Bob 花 1500 + 200 = 1700，未超出
+		{Category: "住宿", Limit: 2500},             // 住宿共 3000，超出
+		{PersonID: 2, Category: "飲食", Limit: 100}, // Bob 飲食 200，超出
+	}
+
+	warnings := checkBudgets(people, bills, budgets)
+	if len(warnings) != 3 {
+		t.Fatalf("應有 3 筆提醒, got %+v", warnings)
+	}
+	if warnings[0].Person != "Alice" || warnings[0].Spent != 2100 {
+		t.Errorf("個人預算提醒不正確（還款不算花費）: %+v", warnings[0])
+	}
+	if warnings[1].Category != "住宿" || warnings[1].Spent != 3000 {
+		t.Errorf("分類預算提醒不正確: %+v", warnings[1])
+	}
+	if !strings.Contains(warnings[2].Message, "Bob") || warnings[2].Spent != 200 {
+		t.Errorf("個人分類預算提醒不正確: %+v", warnings[2])
+	}
+
+	if err := validateBudgets(people, []Budget{{Limit: 100}}); err == nil {
+		t.Error("沒有指定人員或分類的預算應驗證失敗")
+	}
+	if err := validateBudgets(people, []Budget{{PersonID: 9, Limit: 100}}); err == nil {
+		t.Error("不存在的人員應驗證失敗")
+	}
+}
+
+func TestCheckBudgets_TreatCountsForPayer(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{{ID: 1, AmountBase: 900, Category: "飲食", PaidBy: 2, Participants: []int{1, 2}, Treat: true}}
+
+	warnings := checkBudgets(people, bills, []Budget{{PersonID: 1, Limit: 100}, {PersonID: 2, Limit: 500}, {Category: "飲食", Limit: 800}})
+	if len(warnings) != 2 || warnings[0].Person != "Bob" || warnings[0].Spent != 900 || warnings[1].Spent != 900 {
+		t.Errorf("請客應全額算在付款人與分類的花費: %+v", warnings)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// ================= 現金結算（湊整到常用面額） =================
+
+// cashDenominations 各幣別現金結算時湊整的單位；沒有列出的幣別以 1 元為單位
+var cashDenominations = map[string]float64{
+	"TWD": 10, "JPY": 100, "KRW": 1000, "VND": 10000, "IDR": 1000, "HKD": 10, "CNY": 1, "THB": 10,
+}
+
+func cashUnit(currency string) float64 {
+	if unit, ok := cashDenominations[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return unit
+	}
+	return 1
+}
+
+// CashAdjustment 為了湊整，某人的淨額被調整的量（本位幣）：正數代表多收或少付
+type CashAdjustment struct {
+	PersonID int     `json:"personId"`
+	Person   string  `json:"person"`
+	Amount   float64 `json:"amount"`
+}
+
+// roundBalancesToCash 把每個人的淨額湊成 unit 的倍數，之後算出的每筆轉帳自然也是 unit 的倍數。
+// 先各自往下取到 unit 的倍數，
+// 因為淨額加總為 0，差出來的幾個 unit 依餘數由大到小（同分時 ID 小的優先）補回去，加總仍為 0。
+// 回傳每個人被調整的量（最小單位數）
+func roundBalancesToCash(balance map[int]Money, unit Money) map[int]Money {
+	ids := slices.Sorted(maps.Keys(balance))
+	rest := make(map[int]Money, len(ids))
+	var missing Money
+	for _, id := range ids {
+		r := balance[id] % unit
+		if r < 0 {
+			r += unit
+		}
+		rest[id] = r
+		missing += r
+	}
+	slices.SortStableFunc(ids, func(a, b int) int { return cmp.Compare(rest[b], rest[a]) })
+
+	drift := make(map[int]Money)
+	for _, id := range ids {
+		rounded := balance[id] - rest[id]
+		if missing > 0 {
+			rounded += unit
+			missing -= unit
+		}
+		if rounded != balance[id] {
+			drift[id] = rounded - balance[id]
+			balance[id] = rounded
+		}
+	}
+	return drift
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// ==========================================
+// 現金結算測試
+// ==========================================
+func TestCalculateWithOptions_CashUnit(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	bills := []Bill{{ID: 1, AmountBase: 1000, PaidBy: 1, Participants: []int{1, 2, 3}}}
+
+	res, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", CashUnit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Settlement{{From: "Bob", To: "Alice", Amount: 330}, {From: "Charlie", To: "Alice", Amount: 330}}
+	if !sameJSON(res.Settlements, want) {
+		t.Errorf("got %+v, want %+v", res.Settlements, want)
+	}
+
+	// 調整量加總為 0：Alice 少收 6.66，Bob、Charlie 各少付 3.33
+	wantCash := []CashAdjustment{{PersonID: 1, Person: "Alice", Amount: -6.66}, {PersonID: 2, Person: "Bob", Amount: 3.33}, {PersonID: 3, Person: "Charlie", Amount: 3.33}}
+	if !sameJSON(res.Cash, wantCash) {
+		t.Errorf("got %+v, want %+v", res.Cash, wantCash)
+	}
+
+	if _, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", CashUnit: 0.001}); err == nil {
+		t.Error("小於最小單位的面額應報錯")
+	}
+	if _, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", CashUnit: -10}); err == nil {
+		t.Error("負數面額應報錯")
+	}
+}
+
+func TestRoundBalancesToCash(t *testing.T) {
+	balance := map[int]Money{1: 12345, 2: -4321, 3: -8024, 4: 0}
+	drift := roundBalancesToCash(balance, 1000)
+
+	var sum, driftSum Money
+	for id, amt := range balance {
+		if amt%1000 != 0 {
+			t.Errorf("%d 的淨額 %d 沒有湊整", id, amt)
+		}
+		sum += amt
+		driftSum += drift[id]
+		if drift[id].abs() >= 1000 {
+			t.Errorf("%d 的調整量 %d 不應超過一個面額", id, drift[id])
+		}
+	}
+	if sum != 0 || driftSum != 0 {
+		t.Errorf("湊整後淨額加總應為 0, got %d（調整 %d）", sum, driftSum)
+	}
+}
+
+func TestProcessCalculate_CashRounding(t *testing.T) {
+	req := CalculateRequest{
+		BaseCurrency: "JPY",
+		CashRounding: true,
+		People:       []Person{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}, {ID: 3, Name: "C"}},
+		Bills:        []Bill{{ID: 1, Title: "Ramen", Amount: 2950, Currency: "JPY", PaidBy: 1, Participants: []int{1, 2, 3}}},
+	}
+	data, _ := json.Marshal(req)
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" || resp.CashUnit != 100 {
+		t.Fatalf("日圓應以 100 為單位, got %+v", resp)
+	}
+	for _, s := range resp.Settlements {
+		if math.Mod(s.Amount, 100) != 0 {
+			t.Errorf("轉帳金額應為 100 的倍數, got %+v", resp.Settlements)
+		}
+	}
+	if len(resp.CashAdjustments) == 0 {
+		t.Error("應回報湊整的調整量")
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ================= 帳單分類 =================
+
+// Category 由伺服器統一管理的分類；Bill.Category 存的是 Name
+type Category struct {
+	Name  string `json:"name"`
+	Icon  string `json:"icon,omitempty"`
+	Color string `json:"color,omitempty"`
+}
+
+const (
+	defaultCategoryIcon  = "🏷️"
+	defaultCategoryColor = "#a0aec0"
+)
+
+var (
+	errCategoryExists   = errors.New("category already exists")
+	errCategoryNotFound = errors.New("category not found")
+	errCategoryInUse    = errors.New("category is used by bills")
+)
+
+// defaultCategories 與舊版畫面上的固定選項相同，新狀態與舊存檔升級時使用
+func defaultCategories() []Category {
+	return []Category{
+		{Name: "交通", Icon: "🚗", Color: "#4299e1"},
+		{Name: "飲食", Icon: "🍜", Color: "#ed8936"},
+		{Name: "住宿", Icon: "🏨", Color: "#9f7aea"},
+		{Name: "娛樂", Icon: "🎡", Color: "#ed64a6"},
+		{Name: "其他", Icon: "📦", Color: defaultCategoryColor},
+	}
+}
+
+func findCategory(cats []Category, name string) int {
+	for i, c := range cats {
+		if strings.EqualFold(c.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// ensureBillCategories 帳單用到清單裡沒有的分類（舊資料、手動編輯的匯入檔）時補進清單，
+// 讓統計時每個分類都有對應的圖示與顏色
+func ensureBillCategories(s *GlobalState) {
+	for _, b := range s.Bills {
+		name := strings.TrimSpace(b.Category)
+		if name != "" && findCategory(s.Categories, name) < 0 {
+			s.Categories = append(s.Categories, Category{Name: name, Icon: defaultCategoryIcon, Color: defaultCategoryColor})
+		}
+	}
+}
+
+func validateCategory(c *Category) error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("分類名稱不能是空白")
+	}
+	if c.Icon == "" {
+		c.Icon = defaultCategoryIcon
+	}
+	if c.Color == "" {
+		c.Color = defaultCategoryColor
+	}
+	return nil
+}
+
+// handleCategories GET 列出、POST 新增 /api/categories
+func handleCategories(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, state.Categories)
+
+	case http.MethodPost:
+		var c Category
+		if !decodeCategory(w, r, &c) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			if findCategory(s.Categories, c.Name) >= 0 {
+				return errCategoryExists
+			}
+			s.Categories = append(s.Categories, c)
+			return nil
+		})
+		if !categoryUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, c)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleCategory PUT 修改（改名會一併更新帳單）、DELETE 刪除 /api/categories/{name}
+func handleCategory(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+
+	switch r.Method {
+	case http.MethodPut:
+		var c Category
+		if !decodeCategory(w, r, &c) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := findCategory(s.Categories, name)
+			if i < 0 {
+				return errCategoryNotFound
+			}
+			if j := findCategory(s.Categories, c.Name); j >= 0 && j != i {
+				return errCategoryExists
+			}
+			old := s.Categories[i].Name
+			s.Categories[i] = c
+			for k := range s.Bills {
+				if strings.EqualFold(s.Bills[k].Category, old) {
+					s.Bills[k].Category = c.Name
+				}
+			}
+			return nil
+		})
+		if !categoryUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, c)
+
+	case http.MethodDelete:
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := findCategory(s.Categories, name)
+			if i < 0 {
+				return errCategoryNotFound
+			}
+			for _, b := range s.Bills {
+				if b.DeletedAt == 0 && strings.EqualFold(b.Category, name) {
+					return errCategoryInUse
+				}
+			}
+			s.Categories = append(s.Categories[:i], s.Categories[i+1:]...)
+			return nil
+		})
+		if !categoryUpdateOK(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func decodeCategory(w http.ResponseWriter, r *http.Request, c *Category) bool {
+	body, err := readBody(w, r)
+	if err != nil {
+		return false
+	}
+	if err := decodeJSON(body, c); err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	if err := validateCategory(c); err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// categoryUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func categoryUpdateOK(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errCategoryNotFound):
+		writeError(w, http.StatusNotFound, "category not found")
+	case errors.Is(err, errCategoryExists):
+		writeErrorCode(w, http.StatusConflict, codeAlreadyExists, "category already exists")
+	case errors.Is(err, errCategoryInUse):
+		writeErrorCode(w, http.StatusConflict, codeInUse, "category is used by bills")
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
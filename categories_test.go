@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 分類管理 API 測試
+// ==========================================
+func TestCategoryCRUD(t *testing.T) {
+	state := newGlobalState()
+	state.Bills = []Bill{{ID: 1, Title: "Bus", Category: "交通", PaidBy: 1, Participants: []int{1}}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/categories", handleCategories)
+	mux.HandleFunc("/api/categories/{name}", handleCategory)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/categories", `{"name":"門票","icon":"🎟️"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("新增失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/categories", `{"name":"門票"}`); rec.Code != http.StatusConflict {
+		t.Errorf("重複新增應回傳 409, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/categories", `{"name":"  "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("空白名稱應回傳 400, got %d", rec.Code)
+	}
+
+	// 改名時帳單跟著更新
+	if rec := do(http.MethodPut, "/api/categories/%E4%BA%A4%E9%80%9A", `{"name":"交通費","color":"#000000"}`); rec.Code != http.StatusOK {
+		t.Fatalf("修改失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	state, _ = currentState()
+	if state.Bills[0].Category != "交通費" {
+		t.Errorf("改名後帳單分類應一併更新, got %q", state.Bills[0].Category)
+	}
+
+	if rec := do(http.MethodDelete, "/api/categories/交通費", ""); rec.Code != http.StatusConflict {
+		t.Errorf("仍有帳單使用的分類不能刪除, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/categories/門票", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("刪除失敗: %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/categories/門票", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("刪除不存在的分類應回傳 404, got %d", rec.Code)
+	}
+}
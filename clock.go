@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+// ================= 時鐘 =================
+
+// Clock 目前時間的來源。匯率快取的過期判斷、抓取時間，以及寫進狀態的時間（LastUpdated、快照、付款、
+// webhook、垃圾桶等）都透過 clock 取得，測試可以換成固定或可快轉的時鐘，之後也能把時間凍結在旅程結束那天；
+// WebSocket 逾時、計算時限這類實際經過的時間仍用 time.Now
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+var clock Clock = systemClock{}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 測試用的時鐘，只有呼叫 Advance 才會前進
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// useClock 測試期間改用 c 作為時鐘
+func useClock(t *testing.T, c Clock) {
+	t.Helper()
+	old := clock
+	clock = c
+	t.Cleanup(func() { clock = old })
+}
+
+// ==========================================
+// 時鐘測試
+// ==========================================
+func TestClock_RateCacheTTL(t *testing.T) {
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	fetcher := &countingFetcher{}
+	useRateFetcher(t, fetcher)
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD"}}
+	convert := func() {
+		t.Helper()
+		if _, _, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{}); err != nil {
+			t.Fatal(err)
+		}
+		rateRefresh.wg.Wait()
+	}
+
+	convert()
+	if e, _ := rateCache.Get("twd"); fetcher.calls != 1 || !e.FetchedAt.Equal(fc.Now()) {
+		t.Fatalf("calls = %d, fetchedAt = %v", fetcher.calls, e.FetchedAt)
+	}
+
+	// 剛好在 TTL 內仍用快取
+	fc.Advance(rateCacheTTL - time.Second)
+	convert()
+	if fetcher.calls != 1 {
+		t.Errorf("TTL 內不應重新抓取, calls = %d", fetcher.calls)
+	}
+
+	// 超過 TTL：先用舊的匯率，背景更新後抓取時間為現在
+	fc.Advance(2 * time.Second)
+	convert()
+	if e, _ := rateCache.Get("twd"); fetcher.calls != 2 || !e.FetchedAt.Equal(fc.Now()) {
+		t.Errorf("calls = %d, fetchedAt = %v, want refreshed at %v", fetcher.calls, e.FetchedAt, fc.Now())
+	}
+	if got := rateCacheReport(fc.Now()).Entries[0]; got.Stale || got.AgeSeconds != 0 {
+		t.Errorf("entry = %+v", got)
+	}
+}
+
+func TestClock_LastUpdated(t *testing.T) {
+	fc := &fakeClock{t: time.Date(2026, 8, 31, 23, 59, 0, 0, time.UTC)}
+	useClock(t, fc)
+	withRoomState(t, newGlobalState())
+
+	state, err := updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = append(s.People, Person{ID: 1, Name: "Alice"})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.LastUpdated != fc.Now().UnixMilli() {
+		t.Errorf("lastUpdated = %d, want %d", state.LastUpdated, fc.Now().UnixMilli())
+	}
+}
+
+func TestClock_StateTimestamps(t *testing.T) {
+	fc := &fakeClock{t: time.Date(2026, 8, 31, 23, 59, 0, 0, time.UTC)}
+	useClock(t, fc)
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	withRoomState(t, state)
+	want := fc.Now().UnixMilli()
+
+	// 快照、webhook 與同步時移到垃圾桶的時間都取自 clock
+	rec := httptest.NewRecorder()
+	handleSnapshots(rec, httptest.NewRequest(http.MethodPost, "/api/snapshots", strings.NewReader(`{"name":"出發前"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("建立快照失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handleWebhooks(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(`{"url":"https://example.com/hook"}`)))
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("登記 webhook 失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if _, err := updateState(func(s *GlobalState) error {
+		incoming := cloneState(*s)
+		incoming.People = nil
+		return applySyncedState(s, incoming)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	state, _ = currentState()
+	if len(state.People) != 1 || state.People[0].DeletedAt != want {
+		t.Errorf("刪除時間 = %+v, want %d", state.People, want)
+	}
+	if len(state.Snapshots) != 1 || state.Snapshots[0].CreatedAt != want {
+		t.Errorf("快照時間 = %+v, want %d", state.Snapshots, want)
+	}
+	if len(state.Webhooks) != 1 || state.Webhooks[0].CreatedAt != want {
+		t.Errorf("webhook 時間 = %+v, want %d", state.Webhooks, want)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ================= 帳單留言 =================
+
+// maxCommentLength 單則留言的字數上限
+const maxCommentLength = 2000
+
+// Comment 帳單底下的討論（「這筆是 1200 還是 2100？」）
+type Comment struct {
+	ID        int    `json:"id"`
+	Author    string `json:"author,omitempty"`
+	Text      string `json:"text"`
+	CreatedAt int64  `json:"createdAt"`
+}
+
+type CreateCommentRequest struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+// handleBillComments GET 列出、POST 新增 /api/bills/{id}/comments
+func handleBillComments(w http.ResponseWriter, r *http.Request) {
+	billID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		bill := findLiveBill(&state, billID)
+		if bill == nil {
+			writeError(w, http.StatusNotFound, "bill not found")
+			return
+		}
+		comments := bill.Comments
+		if comments == nil {
+			comments = []Comment{}
+		}
+		writeJSON(w, http.StatusOK, comments)
+
+	case http.MethodPost:
+		var req CreateCommentRequest
+		body, err := readBody(w, r)
+		if err != nil {
+			return
+		}
+		if err := decodeJSON(body, &req); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+		text := strings.TrimSpace(req.Text)
+		if text == "" {
+			writeError(w, http.StatusBadRequest, "comment text is required")
+			return
+		}
+		if utf8.RuneCountInString(text) > maxCommentLength {
+			writeError(w, http.StatusBadRequest, "comment too long")
+			return
+		}
+
+		comment := Comment{Author: strings.TrimSpace(req.Author), Text: text, CreatedAt: clock.Now().UnixMilli()}
+		_, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			bill := findLiveBill(s, billID)
+			if bill == nil {
+				return errBillNotFound
+			}
+			comment.ID = 1
+			for _, c := range bill.Comments {
+				if c.ID >= comment.ID {
+					comment.ID = c.ID + 1
+				}
+			}
+			bill.Comments = append(bill.Comments, comment)
+			return nil
+		})
+		if errors.Is(err, errBillNotFound) {
+			writeError(w, http.StatusNotFound, "bill not found")
+			return
+		}
+		if err != nil {
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		writeJSON(w, http.StatusCreated, comment)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
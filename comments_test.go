@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 帳單留言測試
+// ==========================================
+func TestBillComments(t *testing.T) {
+	state := newGlobalState()
+	state.Bills = []Bill{{ID: 3, Title: "Dinner", Amount: 1200, PaidBy: 1, Participants: []int{1}}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/bills/{id}/{rest...}", handleBillSubresource)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	for _, text := range []string{"這筆是 1200 還是 2100？", "收據上是 1200"} {
+		if rec := do(http.MethodPost, "/api/bills/3/comments", `{"author":"Bob","text":"`+text+`"}`); rec.Code != http.StatusCreated {
+			t.Fatalf("新增留言失敗: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodPost, "/api/bills/3/comments", `{"text":"   "}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("空白留言應回傳 400, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPost, "/api/bills/9/comments", `{"text":"hi"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的帳單應回傳 404, got %d", rec.Code)
+	}
+
+	rec := do(http.MethodGet, "/api/bills/3/comments", "")
+	var comments []Comment
+	if err := json.Unmarshal(rec.Body.Bytes(), &comments); err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[1].ID != 2 || comments[0].Author != "Bob" {
+		t.Errorf("留言列表不正確: %+v", comments)
+	}
+
+	// 客戶端推送的舊資料不應把留言蓋掉
+	state, _ = currentState()
+	incoming := overlaySyncedState(state, []byte(`{"bills":[{"id":3,"title":"Dinner","amount":1200,"paidBy":1,"participants":[1],"comments":[]}]}`))
+	keepServerBillFields(state, incoming)
+	if len(incoming.Bills[0].Comments) != 2 {
+		t.Error("同步時應保留伺服器上的留言")
+	}
+}
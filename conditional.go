@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 條件式 GET（ETag / Last-Modified） =================
+
+// 內嵌的頁面在程式執行期間不會變，ETag 取內容雜湊，重新啟動後仍然相同
+var (
+	indexETag     = contentETag([]byte(indexHTML))
+	indexModified = time.Now()
+)
+
+func contentETag(b []byte) string {
+	sum := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// handleIndex 回傳網頁；瀏覽器帶 If-None-Match / If-Modified-Since 且沒變時回 304
+func handleIndex(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("ETag", indexETag)
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "index.html", indexModified, bytes.NewReader([]byte(indexHTML)))
+}
+
+// revisionETag 狀態的 ETag 就是版本號，GET 拿到的值可以直接當作推送時的 If-Match
+func revisionETag(rev int64) string {
+	return `"` + strconv.FormatInt(rev, 10) + `"`
+}
+
+// setStateValidators 在回應加上狀態的 ETag 與 Last-Modified；no-cache 讓瀏覽器每次都先問伺服器
+func setStateValidators(w http.ResponseWriter, state GlobalState) {
+	w.Header().Set("ETag", revisionETag(state.Revision))
+	if t := stateModified(state); !t.IsZero() {
+		w.Header().Set("Last-Modified", t.UTC().Format(http.TimeFormat))
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+}
+
+// stateModified 狀態最後修改的時間，從未修改過時為零值
+func stateModified(state GlobalState) time.Time {
+	if state.LastUpdated <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(state.LastUpdated)
+}
+
+// notModified 依 If-None-Match（優先）或 If-Modified-Since 判斷客戶端手上的版本是否仍是最新的
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == etag {
+				return true
+			}
+		}
+		return false
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || modified.IsZero() {
+		return false
+	}
+	return !modified.Truncate(time.Second).After(ims)
+}
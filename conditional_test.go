@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 條件式 GET 測試
+// ==========================================
+func TestHandleSync_ConditionalGet(t *testing.T) {
+	state := newGlobalState()
+	state.Revision = 4
+	state.LastUpdated = time.Date(2026, 5, 1, 12, 0, 0, 500e6, time.UTC).UnixMilli()
+	withRoomState(t, state)
+
+	get := func(header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/sync", nil)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		rec := httptest.NewRecorder()
+		handleSync(rec, req)
+		return rec
+	}
+
+	rec := get("", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"4"` || rec.Header().Get("Last-Modified") != "Fri, 01 May 2026 12:00:00 GMT" {
+		t.Fatalf("got %d, headers %v", rec.Code, rec.Header())
+	}
+	if rec := get("If-None-Match", `"4"`); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("ETag 相同應回傳 304, got %d", rec.Code)
+	}
+	if rec := get("If-None-Match", `"3", W/"4"`); rec.Code != http.StatusNotModified {
+		t.Errorf("任一 ETag 相同應回傳 304, got %d", rec.Code)
+	}
+	if rec := get("If-None-Match", `"3"`); rec.Code != http.StatusOK {
+		t.Errorf("ETag 不同應回傳完整狀態, got %d", rec.Code)
+	}
+	if rec := get("If-Modified-Since", "Fri, 01 May 2026 12:00:00 GMT"); rec.Code != http.StatusNotModified {
+		t.Errorf("沒有更新應回傳 304, got %d", rec.Code)
+	}
+	if rec := get("If-Modified-Since", "Fri, 01 May 2026 11:59:59 GMT"); rec.Code != http.StatusOK {
+		t.Errorf("之後有更新應回傳完整狀態, got %d", rec.Code)
+	}
+
+	// 從未修改過的狀態不能因為 If-Modified-Since 回 304
+	defaultRoom.mu.Lock()
+	defaultRoom.state.LastUpdated = 0
+	defaultRoom.mu.Unlock()
+	if rec := get("If-Modified-Since", "Fri, 01 May 2026 12:00:00 GMT"); rec.Code != http.StatusOK || rec.Header().Get("Last-Modified") != "" {
+		t.Errorf("got %d, Last-Modified %q", rec.Code, rec.Header().Get("Last-Modified"))
+	}
+}
+
+func TestHandleIndex_ConditionalGet(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleIndex(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Body.Len() != len(indexHTML) {
+		t.Fatalf("got %d, ETag %q", rec.Code, etag)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handleIndex(rec, req)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("ETag 相同應回傳 304, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+)
+
+// ================= 結算偏好（誰付給誰） =================
+
+const (
+	constraintPrefer = "prefer" // 盡量讓 From 付給 To（例如小孩付給爸媽、大家付給財務）
+	constraintAvoid  = "avoid"  // 盡量不要讓 From 付給 To
+)
+
+// SettlementConstraint From 或 To 為 0 代表任何人
+type SettlementConstraint struct {
+	From int    `json:"from,omitempty"`
+	To   int    `json:"to,omitempty"`
+	Rule string `json:"rule"`
+}
+
+func (c SettlementConstraint) matches(from, to int) bool {
+	return (c.From == 0 || c.From == from) && (c.To == 0 || c.To == to)
+}
+
+func validateConstraints(people []Person, constraints []SettlementConstraint) error {
+	known := make(map[int]bool, len(people))
+	for _, p := range people {
+		known[p.ID] = true
+	}
+	for i, c := range constraints {
+		if c.Rule != constraintPrefer && c.Rule != constraintAvoid {
+			return fmt.Errorf("結算偏好第 %d 筆的規則 %q 不支援（可用 prefer、avoid）", i+1, c.Rule)
+		}
+		if c.From == 0 && c.To == 0 {
+			return fmt.Errorf("結算偏好第 %d 筆需要指定付款人或收款人", i+1)
+		}
+		if (c.From != 0 && !known[c.From]) || (c.To != 0 && !known[c.To]) {
+			return fmt.Errorf("結算偏好第 %d 筆的人員不存在", i+1)
+		}
+		if c.From != 0 && c.From == c.To {
+			return fmt.Errorf("結算偏好第 %d 筆的付款人與收款人相同", i+1)
+		}
+	}
+	return nil
+}
+
+// settleWithConstraints 先依序處理 prefer 的配對，剩下的交給 settle 並避開 avoid 的配對；
+// 避不開時（例如欠錢的人只能付給被排除的那位）仍照常結算，並回傳說明
+func settleWithConstraints(balance map[int]Money, constraints []SettlementConstraint, nameMap map[int]string,
+	settle func(balance map[int]Money) []transfer) ([]transfer, []string) {
+	balance = maps.Clone(balance)
+	avoided := func(from, to int) bool {
+		for _, c := range constraints {
+			if c.Rule == constraintAvoid && c.matches(from, to) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var transfers []transfer
+	for _, c := range constraints {
+		if c.Rule != constraintPrefer {
+			continue
+		}
+		transfers = append(transfers, matchDebts(balance, func(from, to int) bool {
+			return c.matches(from, to) && !avoided(from, to)
+		})...)
+	}
+
+	// 指定的演算法沒有踩到 avoid 就採用，否則改用會跳過 avoid 的依序配對
+	rest := settle(maps.Clone(balance))
+	ok := true
+	for _, t := range rest {
+		if avoided(t.from, t.to) {
+			ok = false
+			break
+		}
+	}
+	if ok {
+		return append(transfers, rest...), nil
+	}
+	transfers = append(transfers, matchDebts(balance, func(from, to int) bool { return !avoided(from, to) })...)
+
+	var warnings []string
+	for _, t := range matchDebts(balance, nil) {
+		warnings = append(warnings, fmt.Sprintf("無法避免 %s 付給 %s", nameMap[t.from], nameMap[t.to]))
+		transfers = append(transfers, t)
+	}
+	return transfers, warnings
+}
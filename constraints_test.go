@@ -0,0 +1,72 @@
+package main
+
+import (
+	"testing"
+)
+
+// ==========================================
+// 結算偏好測試
+// ==========================================
+func TestSettleWithConstraints(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Mom"}, {ID: 2, Name: "Dad"}, {ID: 3, Name: "Kid"}, {ID: 4, Name: "Friend"}}
+	// Mom 應收 50、Friend 應收 100；Dad 應付 50、Kid 應付 100
+	bills := []Bill{
+		{ID: 1, Type: billTypeTransfer, AmountBase: 50, PaidBy: 1, Participants: []int{2}},
+		{ID: 2, Type: billTypeTransfer, AmountBase: 100, PaidBy: 4, Participants: []int{3}},
+	}
+
+	tests := []struct {
+		name        string
+		constraints []SettlementConstraint
+		want        []Settlement
+		warnings    int
+	}{
+		{
+			name: "沒有偏好時依序配對",
+			want: []Settlement{{From: "Dad", To: "Mom", Amount: 50}, {From: "Kid", To: "Friend", Amount: 100}},
+		},
+		{
+			name:        "小孩付給媽媽",
+			constraints: []SettlementConstraint{{From: 3, To: 1, Rule: constraintPrefer}},
+			want: []Settlement{
+				{From: "Kid", To: "Mom", Amount: 50},
+				{From: "Dad", To: "Friend", Amount: 50},
+				{From: "Kid", To: "Friend", Amount: 50},
+			},
+		},
+		{
+			name:        "Dad 不付給 Mom",
+			constraints: []SettlementConstraint{{From: 2, To: 1, Rule: constraintAvoid}},
+			want: []Settlement{
+				{From: "Dad", To: "Friend", Amount: 50},
+				{From: "Kid", To: "Mom", Amount: 50},
+				{From: "Kid", To: "Friend", Amount: 50},
+			},
+		},
+		{
+			name:        "避不開時照常結算並提醒",
+			constraints: []SettlementConstraint{{From: 3, Rule: constraintAvoid}},
+			want:        []Settlement{{From: "Dad", To: "Mom", Amount: 50}, {From: "Kid", To: "Friend", Amount: 100}},
+			warnings:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", Constraints: tt.constraints})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !sameJSON(res.Settlements, tt.want) {
+				t.Errorf("got %+v, want %+v", res.Settlements, tt.want)
+			}
+			if len(res.Warnings) != tt.warnings {
+				t.Errorf("提醒筆數 got %v, want %d", res.Warnings, tt.warnings)
+			}
+		})
+	}
+
+	bad := []SettlementConstraint{{From: 9, To: 1, Rule: constraintPrefer}}
+	if _, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", Constraints: bad}); err == nil {
+		t.Error("不存在的人員應報錯")
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= CORS（跨來源呼叫 API） =================
+
+const (
+	defaultCORSMethods = "GET, POST, PUT, PATCH, DELETE"
+	defaultCORSHeaders = "Content-Type, Authorization, If-Match, If-None-Match, Last-Event-ID, X-Splitter-User, X-Splitter-Device, X-Splitter-Device-Token"
+	// corsExposeHeaders 跨來源的網頁也要讀得到版本號、下載檔名與裝置權杖
+	corsExposeHeaders = "ETag, Last-Modified, Content-Disposition, X-Splitter-Device-Token"
+)
+
+// CORSConfig 命令列的 CORS 設定；Origins 留空時不送 CORS 標頭，只有同源的網頁能呼叫 API
+type CORSConfig struct {
+	Origins string
+	Methods string
+	Headers string
+	MaxAge  time.Duration
+}
+
+type corsPolicy struct {
+	anyOrigin bool
+	origins   []string
+	methods   []string
+	headers   []string
+	maxAge    time.Duration
+}
+
+// serverCORS 伺服器模式使用的 CORS 設定，nil 表示關閉
+var serverCORS *corsPolicy
+
+// newCORSPolicy 解析設定；來源必須是 scheme://host[:port]，或以 * 允許任何來源
+func newCORSPolicy(cfg CORSConfig) (*corsPolicy, error) {
+	origins := splitList(cfg.Origins)
+	if len(origins) == 0 {
+		return nil, nil
+	}
+	p := &corsPolicy{
+		methods: splitList(orDefault(cfg.Methods, defaultCORSMethods)),
+		headers: splitList(orDefault(cfg.Headers, defaultCORSHeaders)),
+		maxAge:  cfg.MaxAge,
+	}
+	for _, o := range origins {
+		if o == "*" {
+			p.anyOrigin = true
+			continue
+		}
+		u, err := url.Parse(o)
+		if err != nil || u.Scheme == "" || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return nil, fmt.Errorf("-cors-origins: %q 不是有效的來源（例如 https://example.com）", o)
+		}
+		p.origins = append(p.origins, strings.ToLower(u.Scheme+"://"+u.Host))
+	}
+	for i, m := range p.methods {
+		p.methods[i] = strings.ToUpper(m)
+	}
+	return p, nil
+}
+
+func orDefault(v, fallback string) string {
+	if strings.TrimSpace(v) == "" {
+		return fallback
+	}
+	return v
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (p *corsPolicy) allowOrigin(origin string) bool {
+	return p.anyOrigin || slices.Contains(p.origins, strings.ToLower(origin))
+}
+
+// allowHeaders 預檢要求的標頭都在允許清單內（不分大小寫）
+func (p *corsPolicy) allowHeaders(requested string) bool {
+	for _, h := range splitList(requested) {
+		if !slices.ContainsFunc(p.headers, func(a string) bool { return strings.EqualFold(a, h) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// wrap 對 /api/ 底下的請求加上 CORS 標頭，並直接回應預檢（OPTIONS）請求
+func (p *corsPolicy) wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !p.allowOrigin(origin) {
+			if preflight {
+				writeError(w, http.StatusForbidden, "origin not allowed")
+				return
+			}
+			// 不加標頭，瀏覽器會擋下回應
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Set("Access-Control-Allow-Origin", origin)
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+		if !slices.Contains(p.methods, method) {
+			writeError(w, http.StatusForbidden, "method not allowed by CORS policy")
+			return
+		}
+		if !p.allowHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			writeError(w, http.StatusForbidden, "header not allowed by CORS policy")
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.methods, ", "))
+		h.Set("Access-Control-Allow-Headers", strings.Join(p.headers, ", "))
+		if p.maxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.maxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
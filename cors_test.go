@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// CORS 設定解析測試
+// ==========================================
+func TestNewCORSPolicy(t *testing.T) {
+	if p, err := newCORSPolicy(CORSConfig{}); p != nil || err != nil {
+		t.Errorf("沒有設定來源時應關閉 CORS, got %v %v", p, err)
+	}
+	if _, err := newCORSPolicy(CORSConfig{Origins: "example.com"}); err == nil {
+		t.Error("缺少 scheme 的來源應回報錯誤")
+	}
+	p, err := newCORSPolicy(CORSConfig{Origins: " https://Trip.example/ , http://localhost:3000", Methods: "get,post"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.allowOrigin("https://trip.example") || !p.allowOrigin("http://localhost:3000") || p.allowOrigin("https://evil.example") {
+		t.Errorf("origins = %v", p.origins)
+	}
+	if len(p.methods) != 2 || p.methods[0] != "GET" || len(p.headers) == 0 {
+		t.Errorf("methods = %v, headers = %v", p.methods, p.headers)
+	}
+}
+
+// ==========================================
+// CORS 中介層測試
+// ==========================================
+func TestCORSWrap(t *testing.T) {
+	p, err := newCORSPolicy(CORSConfig{Origins: "https://trip.example", MaxAge: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	called := 0
+	h := p.wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.Header().Set("ETag", `"3"`)
+		writeJSON(w, http.StatusOK, map[string]string{"ok": "1"})
+	}))
+	do := func(method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// 預檢：直接回 204，不進入 handler
+	rec := do(http.MethodOptions, "/api/calculate", "https://trip.example", map[string]string{
+		"Access-Control-Request-Method":  "POST",
+		"Access-Control-Request-Headers": "content-type, if-match",
+	})
+	if rec.Code != http.StatusNoContent || called != 0 {
+		t.Fatalf("預檢應回 204, got %d (handler 呼叫 %d 次)", rec.Code, called)
+	}
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://trip.example" ||
+		rec.Header().Get("Access-Control-Allow-Methods") == "" || rec.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("預檢標頭不正確: %v", rec.Header())
+	}
+
+	// 不允許的方法、標頭、來源
+	if rec := do(http.MethodOptions, "/api/sync", "https://trip.example", map[string]string{"Access-Control-Request-Method": "TRACE"}); rec.Code != http.StatusForbidden {
+		t.Errorf("不允許的方法應回 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodOptions, "/api/sync", "https://trip.example", map[string]string{
+		"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "X-Secret",
+	}); rec.Code != http.StatusForbidden {
+		t.Errorf("不允許的標頭應回 403, got %d", rec.Code)
+	}
+	if rec := do(http.MethodOptions, "/api/sync", "https://evil.example", map[string]string{"Access-Control-Request-Method": "GET"}); rec.Code != http.StatusForbidden {
+		t.Errorf("不允許的來源應回 403, got %d", rec.Code)
+	}
+
+	// 一般請求：允許的來源加上標頭；其他來源與同源請求不加
+	rec = do(http.MethodPost, "/api/calculate", "https://trip.example", nil)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://trip.example" || rec.Header().Get("Access-Control-Expose-Headers") == "" {
+		t.Errorf("允許的來源應加上 CORS 標頭: %v", rec.Header())
+	}
+	for _, origin := range []string{"https://evil.example", ""} {
+		if rec := do(http.MethodGet, "/api/sync", origin, nil); rec.Header().Get("Access-Control-Allow-Origin") != "" || rec.Code != http.StatusOK {
+			t.Errorf("來源 %q 不應加上 CORS 標頭: %d %v", origin, rec.Code, rec.Header())
+		}
+	}
+	if rec := do(http.MethodGet, "/", "https://trip.example", nil); rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("網頁本身不需要 CORS 標頭")
+	}
+}
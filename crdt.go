@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ================= 離線同步（LWW CRDT） =================
+
+// 人員與帳單視為以 ID 為鍵的 LWW-element map：每筆帶著最後的編輯時間（updatedAt）、刪除時間
+// （deletedAt，刪除後留下墓碑）與編輯的裝置（updatedBy）。兩筆版本比較時，
+// max(updatedAt, deletedAt) 較新的勝出，相同時比較裝置 ID，因此不論各裝置的修改以什麼順序送達，
+// 最後都會收斂成同一份狀態。手機離線時照常修改，連線後把改過的項目一次送到 POST /api/crdt 即可，
+// 不必先取得最新版本。
+
+// CRDTChanges POST /api/crdt 的內容：離線期間改過的人員與帳單（只送改過的）。
+// 刪除的帶上 deletedAt；updatedAt 為裝置上編輯當下的時間，沒帶或晚於伺服器現在時以收到的時間計
+type CRDTChanges struct {
+	People []Person `json:"people,omitempty"`
+	Bills  []Bill   `json:"bills,omitempty"`
+}
+
+// CRDTState GET/POST /api/crdt 的回應：版本 since 之後變動過的人員與帳單（包含刪除留下的墓碑），
+// 客戶端依 ID 逐筆套用，deletedAt 不為 0 的從畫面移除
+type CRDTState struct {
+	Revision  int64          `json:"revision"`
+	People    []Person       `json:"people"`
+	Bills     []Bill         `json:"bills"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+}
+
+// lwwNewer a 是否比 b 新：最後的編輯或刪除時間較晚的勝出，相同時裝置 ID 較大的勝出
+func lwwNewer(a, b syncMeta) bool {
+	ta, tb := max(a.updatedAt, a.deletedAt), max(b.updatedAt, b.deletedAt)
+	if ta != tb {
+		return ta > tb
+	}
+	return a.updatedBy > b.updatedBy
+}
+
+// lwwMerge 把 device 送來的 incoming 逐筆併入 cur：較新的取代，較舊的略過並列為衝突，已鎖定的不動；
+// 依據的是伺服器上較舊的版本、找得到共同舊版本（history）時逐欄位合併，兩邊的修改都保留。
+// 還沒有伺服器版本資訊（revision、version 為 0）卻撞到其他裝置 ID 的項目，是兩台裝置離線時各自新增的，改用 nextID 起算的新 ID
+func lwwMerge[T any](cur, incoming []T, device string, k syncKind[T], history func(id, version int) (T, bool), nextID int) (merged []T, renumbered map[int]int, conflicts []SyncConflict) {
+	merged = slices.Clone(cur)
+	index := make(map[int]int, len(cur))
+	for i, e := range merged {
+		index[k.meta(e).id] = i
+	}
+	renumbered = make(map[int]int)
+	conflict := func(m syncMeta, resolution, format string) {
+		conflicts = append(conflicts, SyncConflict{
+			Target: k.target, ID: m.id, Title: m.title, Resolution: resolution,
+			Message: fmt.Sprintf(format, k.label, m.title),
+		})
+	}
+
+	for _, in := range incoming {
+		m := k.meta(in)
+		i, ok := index[m.id]
+		if !ok {
+			// 伺服器沒看過就被刪掉的不必留墓碑
+			if m.deletedAt == 0 {
+				index[m.id] = len(merged)
+				merged = append(merged, in)
+			}
+			continue
+		}
+		cm := k.meta(merged[i])
+		combined, mc, concurrent := mergeConcurrent(k, history, merged[i], in)
+		switch {
+		case !k.changed(merged[i], in):
+		case m.unseen() && cm.updatedBy != device:
+			// 沒收到回應而重送同一批修改時，之前已改用新 ID 的項目不再新增一次
+			if j := slices.IndexFunc(merged, func(e T) bool {
+				em, dup := k.meta(e), in
+				k.setID(&dup, em.id)
+				return em.updatedBy == device && em.updatedAt == m.updatedAt && !k.changed(e, dup)
+			}); j >= 0 {
+				renumbered[m.id] = k.meta(merged[j]).id
+				continue
+			}
+			renumbered[m.id] = nextID
+			k.setID(&in, nextID)
+			nextID++
+			index[k.meta(in).id] = len(merged)
+			merged = append(merged, in)
+			conflict(k.meta(in), resolutionRenumbered, "%s「%s」與其他裝置離線新增的項目 ID 相同，已改用新的 ID")
+			conflicts[len(conflicts)-1].From = m.id
+		case concurrent:
+			merged[i] = combined
+			conflicts = append(conflicts, mc)
+		case !lwwNewer(m, cm):
+			conflict(cm, resolutionServer, "其他裝置較晚修改了%s「%s」，保留其他裝置的版本")
+		case cm.locked:
+			conflict(cm, resolutionServer, "%s「%s」已結算鎖定，保留伺服器上的版本")
+		default:
+			merged[i] = in
+		}
+	}
+	return merged, renumbered, conflicts
+}
+
+// lwwTimes 裝置時鐘可能比伺服器快，晚於 now 的時間以 now 計，免得這筆修改永遠勝出；
+// 沒帶編輯時間的修改以 now 計，刪除則以刪除時間為準
+func lwwTimes(updatedAt, deletedAt, now int64) (int64, int64) {
+	if updatedAt > now || updatedAt == 0 && deletedAt == 0 {
+		updatedAt = now
+	}
+	return updatedAt, min(deletedAt, now)
+}
+
+// mergeCRDT 把 device 離線期間的修改併入 s；合併後仍需通過與整份同步相同的驗證
+func mergeCRDT(s *GlobalState, changes CRDTChanges, device string, now time.Time) ([]SyncConflict, error) {
+	stamp := now.UnixMilli()
+	people, bills := slices.Clone(changes.People), slices.Clone(changes.Bills)
+	for i := range people {
+		p := &people[i]
+		p.UpdatedBy = device
+		p.UpdatedAt, p.DeletedAt = lwwTimes(p.UpdatedAt, p.DeletedAt, stamp)
+	}
+	for i := range bills {
+		b := &bills[i]
+		b.UpdatedBy = device
+		b.UpdatedAt, b.DeletedAt = lwwTimes(b.UpdatedAt, b.DeletedAt, stamp)
+	}
+	// 收據、留言與鎖定只能透過各自的 API 修改，沿用伺服器上的值
+	keepServerBillFields(*s, GlobalState{Bills: bills})
+
+	merged, personIDs, conflicts := lwwMerge(s.People, people, device, personSync, nil, maxPersonID(s.People, people)+1)
+	if len(personIDs) > 0 {
+		for i := range bills {
+			remapBillPeople(&bills[i], func(id int) int {
+				if to, ok := personIDs[id]; ok {
+					return to
+				}
+				return id
+			})
+		}
+	}
+	s.People = merged
+	var billConflicts []SyncConflict
+	s.Bills, _, billConflicts = lwwMerge(s.Bills, bills, device, billSync, billHistoryOf(*s), maxBillID(s.Bills, bills)+1)
+	conflicts = append(conflicts, billConflicts...)
+
+	// 一台裝置刪了成員、另一台同時新增了用到他的帳單：成員仍被使用，撤銷刪除
+	used := make(map[int]bool)
+	for _, b := range visibleState(*s).Bills {
+		remapBillPeople(&b, func(id int) int {
+			used[id] = true
+			return id
+		})
+	}
+	for i := range s.People {
+		if p := &s.People[i]; p.DeletedAt != 0 && used[p.ID] {
+			p.DeletedAt = 0
+			conflicts = append(conflicts, SyncConflict{
+				Target: personSync.target, ID: p.ID, Title: p.Name, Resolution: resolutionRestored,
+				Message: fmt.Sprintf("成員「%s」仍有帳單使用，已撤銷刪除", p.Name),
+			})
+		}
+	}
+
+	live := visibleState(*s)
+	if err := checkLimits(len(live.People), len(live.Bills)); err != nil {
+		return nil, err
+	}
+	if invalid := validatePeopleAndBills(live.People, live.Bills); len(invalid) > 0 {
+		return nil, invalid
+	}
+	ensureBillCategories(s)
+	return conflicts, nil
+}
+
+// crdtDelta 版本 since 之後變動過的人員與帳單，包含墓碑
+func crdtDelta(s GlobalState, since int64) CRDTState {
+	out := CRDTState{Revision: s.Revision, People: []Person{}, Bills: []Bill{}}
+	for _, p := range s.People {
+		if p.Revision > since {
+			out.People = append(out.People, p)
+		}
+	}
+	for _, b := range s.Bills {
+		if b.Revision > since {
+			out.Bills = append(out.Bills, b)
+		}
+	}
+	return out
+}
+
+// handleCRDT GET /api/crdt?since=N 取得版本 N 之後的變動；POST /api/crdt?since=N 送出離線期間的修改，
+// 不需要 If-Match，回應同樣是版本 N 之後的變動（包含這次送出、可能改過 ID 的項目）與沒有採用的修改
+func handleCRDT(w http.ResponseWriter, r *http.Request) {
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeErrorFor(w, http.StatusBadRequest, fmt.Errorf("%w: since %q", errInvalidRevision, v))
+			return
+		}
+		since = n
+	}
+
+	if r.Method == http.MethodGet {
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, crdtDelta(state, since))
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	var changes CRDTChanges
+	if err := decodeJSON(body, &changes); err != nil {
+		writeInvalidJSON(w, err)
+		return
+	}
+	actor := actorFromRequest(r)
+	var conflicts []SyncConflict
+	state, err := roomOf(r).updateStateAs(actor, func(s *GlobalState) error {
+		var err error
+		conflicts, err = mergeCRDT(s, changes, actor.DeviceID, clock.Now())
+		return err
+	})
+	var invalid ValidationErrors
+	var limit *limitError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid):
+		writeErrorFor(w, http.StatusBadRequest, invalid)
+		return
+	case errors.As(err, &limit):
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+		return
+	case errors.Is(err, errRoomArchived):
+		writeErrorFor(w, http.StatusConflict, err)
+		return
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	resp := crdtDelta(state, since)
+	resp.Conflicts = conflicts
+	writeJSON(w, http.StatusOK, resp)
+}
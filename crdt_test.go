@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 離線同步（LWW CRDT）測試
+// ==========================================
+func TestCRDT_Converges(t *testing.T) {
+	reg := useRooms(t)
+	t0 := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	fc := &fakeClock{t: t0}
+	useClock(t, fc)
+	at := func(sec int) int64 { return t0.Add(time.Duration(sec) * time.Second).UnixMilli() }
+
+	seed := func() *room {
+		rm, _ := reg.create()
+		rm.updateStateAs(Actor{DeviceID: "desk"}, func(s *GlobalState) error {
+			s.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+			s.Bills = []Bill{
+				{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+				{ID: 2, Title: "Museum", Amount: 50, PaidBy: 1, Participants: []int{1}},
+				{ID: 3, Title: "Lunch", Amount: 200, PaidBy: 1, Participants: []int{1}},
+			}
+			return nil
+		})
+		return rm
+	}
+	r1, r2 := seed(), seed()
+	fc.Advance(time.Minute)
+
+	handler := withDevice(newServerRouter())
+	tokenA, tokenB := strings.Repeat("a", deviceTokenLength), strings.Repeat("b", deviceTokenLength)
+	send := func(rm *room, token, body string) CRDTState {
+		req := httptest.NewRequest(http.MethodPost, "/api/rooms/"+rm.code+"/crdt?since=1", strings.NewReader(body))
+		req.Header.Set(deviceTokenHeader, token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("送出離線修改失敗: %d %s", rec.Code, rec.Body.String())
+		}
+		var resp CRDTState
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// 手機 A（地鐵上離線）：Hotel 改成 400、刪了 Museum、改了 Lunch、刪了 Bob、新增 Taxi（ID 4）
+	changesA := `{"people":[{"id":2,"name":"Bob","revision":1,"deletedAt":` + jsonInt(at(10)) + `}],"bills":[
+		{"id":1,"title":"Hotel","amount":400,"paidBy":1,"participants":[1,2],"revision":1,"updatedAt":` + jsonInt(at(10)) + `},
+		{"id":2,"title":"Museum","amount":50,"paidBy":1,"participants":[1],"revision":1,"deletedAt":` + jsonInt(at(5)) + `},
+		{"id":3,"title":"Lunch","amount":250,"paidBy":1,"participants":[1],"revision":1,"updatedAt":` + jsonInt(at(15)) + `},
+		{"id":4,"title":"Taxi","amount":120,"paidBy":1,"participants":[1],"updatedAt":` + jsonInt(at(12)) + `}]}`
+	// 手機 B：稍後把 Hotel 改成 500、改了 Museum、刪了 Lunch、也新增了 ID 4 的 Snacks（Bob 也有吃）
+	changesB := `{"bills":[
+		{"id":1,"title":"Hotel","amount":500,"paidBy":1,"participants":[1,2],"revision":1,"updatedAt":` + jsonInt(at(20)) + `},
+		{"id":2,"title":"Museum","amount":60,"paidBy":1,"participants":[1],"revision":1,"updatedAt":` + jsonInt(at(30)) + `},
+		{"id":3,"title":"Lunch","amount":200,"paidBy":1,"participants":[1],"revision":1,"deletedAt":` + jsonInt(at(40)) + `},
+		{"id":4,"title":"Snacks","amount":80,"paidBy":2,"participants":[1,2],"updatedAt":` + jsonInt(at(25)) + `}]}`
+
+	// 兩個房間以相反的順序收到，結果應相同
+	send(r1, tokenA, changesA)
+	send(r1, tokenB, changesB)
+	send(r2, tokenB, changesB)
+	late := send(r2, tokenA, changesA)
+
+	summary := func(rm *room) map[string]float64 {
+		state, _ := rm.currentState()
+		live := visibleState(state)
+		out := map[string]float64{}
+		for _, p := range live.People {
+			out["person:"+p.Name] = 1
+		}
+		for _, b := range live.Bills {
+			out[b.Title] = b.Amount
+		}
+		return out
+	}
+	s1, s2 := summary(r1), summary(r2)
+	want := map[string]float64{"person:Alice": 1, "person:Bob": 1, "Hotel": 500, "Museum": 60, "Taxi": 120, "Snacks": 80}
+	for _, s := range []map[string]float64{s1, s2} {
+		if len(s) != len(want) {
+			t.Errorf("合併結果 = %v, want %v", s, want)
+			continue
+		}
+		for k, v := range want {
+			if s[k] != v {
+				t.Errorf("%s = %v, want %v（結果 %v）", k, s[k], v, s)
+			}
+		}
+	}
+
+	// 後到的 A：Hotel 輸給 B、Taxi 撞到 B 的 ID 4 改用新 ID，並列出來讓畫面提示
+	got := map[string]SyncConflict{}
+	for _, c := range late.Conflicts {
+		got[c.Target+":"+c.Title] = c
+	}
+	if got["bill:Hotel"].Resolution != resolutionServer || got["bill:Taxi"].Resolution != resolutionRenumbered || got["bill:Taxi"].From != 4 {
+		t.Errorf("衝突 = %+v", late.Conflicts)
+	}
+	if got["person:Bob"].Resolution != resolutionRestored {
+		t.Errorf("仍被 Snacks 使用的 Bob 應撤銷刪除, got %+v", late.Conflicts)
+	}
+
+	// 重送同一批修改不會再改變任何東西
+	before, _ := r1.currentState()
+	send(r1, tokenB, changesB)
+	after, _ := r1.currentState()
+	for i := range after.Bills {
+		if billChanged(before.Bills[i], after.Bills[i]) || before.Bills[i].Revision != after.Bills[i].Revision {
+			t.Errorf("重送後帳單 %d 不應變動", after.Bills[i].ID)
+		}
+	}
+
+	// 墓碑也隨差異下發，客戶端才知道要移除
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/rooms/"+r1.code+"/crdt?since=1", nil))
+	var delta CRDTState
+	json.Unmarshal(rec.Body.Bytes(), &delta)
+	var tombstone bool
+	for _, b := range delta.Bills {
+		if b.Title == "Lunch" && b.DeletedAt == at(40) && b.UpdatedBy == deviceID(tokenB) {
+			tombstone = true
+		}
+	}
+	if !tombstone || delta.Revision != after.Revision {
+		t.Errorf("差異應包含 Lunch 的墓碑, got %+v", delta)
+	}
+}
+
+func TestLWWNewer(t *testing.T) {
+	a := syncMeta{updatedAt: 10, updatedBy: "a"}
+	b := syncMeta{updatedAt: 10, updatedBy: "b"}
+	if lwwNewer(a, b) || !lwwNewer(b, a) {
+		t.Error("時間相同時應比較裝置 ID")
+	}
+	// 刪除時間晚於修改時間，墓碑勝出
+	if !lwwNewer(syncMeta{updatedAt: 5, deletedAt: 11, updatedBy: "a"}, b) {
+		t.Error("較晚的刪除應勝出")
+	}
+}
+
+func jsonInt(n int64) string {
+	data, _ := json.Marshal(n)
+	return string(data)
+}
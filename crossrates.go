@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+)
+
+// ================= 交叉匯率 =================
+
+// crossRatePivots 匯率來源缺少某幣別時，依序嘗試經由這些幣別交叉換算
+var crossRatePivots = []string{"usd", "eur"}
+
+// crossRate 匯率來源的 baseLower 匯率中沒有 cur 時，改用樞紐幣別的匯率換算：
+// 回傳 1 baseLower = rate cur、使用的樞紐幣別與匯率日期。樞紐幣別的匯率優先用快取（不論新舊），
+// cacheOnly 時沒有快取的樞紐幣別直接略過
+func crossRate(ctx context.Context, baseLower, cur string, cacheOnly bool) (rate float64, pivot string, date string, ok bool) {
+	for _, pivot := range crossRatePivots {
+		if pivot == baseLower || pivot == cur {
+			continue
+		}
+		entry, cached := rateCache.Get(pivot)
+		if !cached {
+			if cacheOnly {
+				continue
+			}
+			fetched, err := fetchRates(ctx, pivot)
+			if err != nil {
+				continue
+			}
+			entry = fetched
+		}
+		from, to := entry.Rates[baseLower], entry.Rates[cur]
+		if from > 0 && to > 0 {
+			return to / from, pivot, entry.Date, true
+		}
+	}
+	return 0, "", "", false
+}
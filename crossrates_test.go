@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 交叉匯率測試
+// ==========================================
+func TestConvertBillsWithRates_CrossRate(t *testing.T) {
+	fetcher := &countingFetcher{}
+	useRateFetcher(t, fetcher)
+	// TWD 的匯率沒有越南盾；美元的匯率有，經由美元換算：1 TWD = 0.03 USD = 0.03 × 25000 VND = 750 VND
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03}})
+	rateCache.Set("usd", rateEntry{Date: "2026-04-30", FetchedAt: time.Now(), Rates: map[string]float64{"usd": 1, "twd": 33.3, "vnd": 25000}})
+
+	bills := []Bill{
+		{ID: 1, Title: "Pho", Amount: 75000, Currency: "VND"},
+		{ID: 2, Title: "Hotel", Amount: 100, Currency: "USD"},
+	}
+	converted, rates, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := converted[0].AmountBase; got != 99.9 {
+		t.Errorf("75000 VND ÷ 25000 × 33.3 應為 99.9 TWD, got %v", got)
+	}
+	if rates[0].Pivot != "usd" || rates[0].Source != rateSourceMarket || rates[0].Date != "2026-04-30" {
+		t.Errorf("rate = %+v, want derived via usd", rates[0])
+	}
+	if rates[1].Pivot != "" {
+		t.Errorf("有直接匯率時不交叉換算, got %+v", rates[1])
+	}
+	if fetcher.calls != 0 {
+		t.Errorf("樞紐幣別有快取時不應連網, calls = %d", fetcher.calls)
+	}
+
+	applied := appliedRates(converted, rates)
+	if !applied[0].Derived || applied[0].Pivot != "USD" || applied[1].Derived {
+		t.Errorf("applied = %+v", applied)
+	}
+}
+
+func TestConvertBillsWithRates_CrossRateMissing(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03}})
+
+	// 樞紐幣別也取不到時仍回報缺少幣別
+	bills := []Bill{{ID: 1, Title: "Pho", Amount: 75000, Currency: "VND"}}
+	if _, _, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{}); err == nil || !strings.Contains(err.Error(), "VND") {
+		t.Errorf("err = %v, want 缺少幣別 VND", err)
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ================= 支援的幣別 =================
+
+// Currency 幣別與顯示用的資訊；Decimals 為結算時四捨五入的小數位數
+type Currency struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Symbol   string `json:"symbol"`
+	Decimals int    `json:"decimals"`
+}
+
+// currencyCatalog 常用幣別的名稱與符號，依選單顯示的順序；匯率來源有、但不在這裡的幣別以代碼顯示
+var currencyCatalog = []Currency{
+	{Code: "TWD", Name: "新台幣", Symbol: "NT$"},
+	{Code: "USD", Name: "美金", Symbol: "$"},
+	{Code: "EUR", Name: "歐元", Symbol: "€"},
+	{Code: "JPY", Name: "日圓", Symbol: "¥"},
+	{Code: "KRW", Name: "韓元", Symbol: "₩"},
+	{Code: "HKD", Name: "港幣", Symbol: "HK$"},
+	{Code: "CNY", Name: "人民幣", Symbol: "¥"},
+	{Code: "GBP", Name: "英鎊", Symbol: "£"},
+	{Code: "SGD", Name: "新加坡幣", Symbol: "S$"},
+	{Code: "THB", Name: "泰銖", Symbol: "฿"},
+	{Code: "VND", Name: "越南盾", Symbol: "₫"},
+	{Code: "MYR", Name: "馬幣", Symbol: "RM"},
+	{Code: "PHP", Name: "菲律賓披索", Symbol: "₱"},
+	{Code: "IDR", Name: "印尼盾", Symbol: "Rp"},
+	{Code: "AUD", Name: "澳幣", Symbol: "A$"},
+	{Code: "CAD", Name: "加幣", Symbol: "C$"},
+	{Code: "NZD", Name: "紐西蘭幣", Symbol: "NZ$"},
+	{Code: "CHF", Name: "瑞士法郎", Symbol: "CHF"},
+	{Code: "INR", Name: "印度盧比", Symbol: "₹"},
+	{Code: "MOP", Name: "澳門幣", Symbol: "MOP$"},
+}
+
+// CurrenciesResponse GET /api/currencies 的回應
+type CurrenciesResponse struct {
+	BaseCurrency string     `json:"baseCurrency"`
+	RateDate     string     `json:"rateDate,omitempty"`
+	Currencies   []Currency `json:"currencies"`
+}
+
+// isCurrencyCode 匯率來源也列了加密貨幣（例如 1inch），只保留三個英文字母的代碼
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// supportedCurrencies 目前匯率來源（快取、匯率 API 或內建快照）提供的幣別：常用幣別依 currencyCatalog 的順序在前，
+// 其餘依代碼排序。完全取不到匯率時只列常用幣別
+func supportedCurrencies(ctx context.Context, base string) CurrenciesResponse {
+	baseLower := strings.ToLower(base)
+	entry, ok := rateCache.Get(baseLower)
+	if !ok {
+		fetched, err := fetchRates(ctx, baseLower)
+		if err != nil {
+			fetched, err = offlineRates(baseLower)
+		}
+		if err != nil {
+			log.Printf("currencies: no rates for %s: %v", base, err)
+		}
+		entry = fetched
+	}
+
+	available := make(map[string]bool, len(entry.Rates)+1)
+	available[strings.ToUpper(base)] = true
+	for code := range entry.Rates {
+		if code = strings.ToUpper(code); isCurrencyCode(code) {
+			available[code] = true
+		}
+	}
+
+	resp := CurrenciesResponse{BaseCurrency: strings.ToUpper(base), RateDate: entry.Date, Currencies: []Currency{}}
+	for _, c := range currencyCatalog {
+		if len(entry.Rates) == 0 || available[c.Code] {
+			c.Decimals = currencyDecimalPlaces(c.Code)
+			resp.Currencies = append(resp.Currencies, c)
+			delete(available, c.Code)
+		}
+	}
+	if len(entry.Rates) == 0 {
+		return resp
+	}
+	for _, code := range slices.Sorted(maps.Keys(available)) {
+		resp.Currencies = append(resp.Currencies, Currency{Code: code, Name: code, Symbol: code, Decimals: currencyDecimalPlaces(code)})
+	}
+	return resp
+}
+
+// handleCurrencies GET /api/currencies?base=TWD 列出可以使用的幣別，base 未填時為狀態的本位幣
+func handleCurrencies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	base := strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("base")))
+	if base == "" {
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		base = stateBase(state)
+	}
+	if !isCurrencyCode(base) {
+		writeError(w, http.StatusBadRequest, "invalid base currency")
+		return
+	}
+	writeJSON(w, http.StatusOK, supportedCurrencies(r.Context(), base))
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 支援幣別測試
+// ==========================================
+func TestCurrenciesAPI(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{
+		"twd": 1, "usd": 0.03, "jpy": 4.6, "kwd": 0.009, "xau": 0.00001, "1inch": 0.1,
+	}})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/currencies", handleCurrencies)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/currencies?base=twd")
+	var resp CurrenciesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("查詢失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var codes []string
+	for _, c := range resp.Currencies {
+		codes = append(codes, c.Code)
+	}
+	// 常用幣別依選單順序在前，其餘依代碼排序；加密貨幣代碼不列出
+	if want := []string{"TWD", "USD", "JPY", "KWD", "XAU"}; !sameJSON(codes, want) {
+		t.Errorf("codes = %v, want %v", codes, want)
+	}
+	if c := resp.Currencies[2]; c.Name != "日圓" || c.Symbol != "¥" || c.Decimals != 0 {
+		t.Errorf("JPY = %+v", c)
+	}
+	if c := resp.Currencies[3]; c.Name != "KWD" || c.Decimals != 3 {
+		t.Errorf("沒有中文名稱的幣別以代碼顯示, got %+v", c)
+	}
+	if resp.BaseCurrency != "TWD" || resp.RateDate != "2026-05-01" {
+		t.Errorf("got %+v", resp)
+	}
+
+	// 沒有快取也連不上時改用內建快照
+	rec = get("/api/currencies?base=EUR")
+	resp = CurrenciesResponse{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Currencies) < 10 || resp.Currencies[0].Code != "TWD" {
+		t.Errorf("got %d %+v", rec.Code, resp)
+	}
+
+	if rec := get("/api/currencies?base=dollar"); rec.Code != http.StatusBadRequest {
+		t.Errorf("got %d, want 400", rec.Code)
+	}
+}
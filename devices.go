@@ -0,0 +1,210 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= 裝置識別與在線狀態 =================
+
+const (
+	// deviceCookie 瀏覽器第一次連線時發給的裝置權杖；其他客戶端可改以 deviceTokenHeader 帶回
+	deviceCookie       = "splitter_device"
+	deviceTokenHeader  = "X-Splitter-Device-Token"
+	deviceCookieMaxAge = 365 * 24 * 60 * 60
+	deviceTokenLength  = 32 // 16 bytes 的十六進位
+)
+
+var (
+	// presenceWindow 這段時間內有請求、或開著即時連線的裝置視為在線
+	presenceWindow = time.Minute
+	// maxRoomDevices 每個房間記住的裝置數量上限，超過時忘掉最久沒出現且沒有連線的裝置
+	maxRoomDevices = 200
+)
+
+// DeviceInfo GET /api/devices 的一筆。ID 由權杖雜湊而來可以公開，權杖本身只有該裝置知道；
+// 動態紀錄的 deviceId 與此相同，可以看出每筆變更來自哪台裝置
+type DeviceInfo struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	User      string `json:"user,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	FirstSeen int64  `json:"firstSeen"`
+	LastSeen  int64  `json:"lastSeen"`
+	Online    bool   `json:"online"`
+	// Connections 目前開著的即時連線（WebSocket、SSE）數量
+	Connections int `json:"connections"`
+}
+
+// deviceTracker 一個房間最近出現過的裝置，只保存在記憶體中，伺服器重新啟動後重新累積
+type deviceTracker struct {
+	mu      sync.Mutex
+	devices map[string]*DeviceInfo
+}
+
+func newDeviceTracker() *deviceTracker {
+	return &deviceTracker{devices: make(map[string]*DeviceInfo)}
+}
+
+// seen 記下裝置在 now 送出請求
+func (t *deviceTracker) seen(id string, a Actor, now time.Time) {
+	if id == "" {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	d := t.devices[id]
+	if d == nil {
+		t.evictLocked()
+		d = &DeviceInfo{ID: id, FirstSeen: now.UnixMilli()}
+		t.devices[id] = d
+	}
+	d.IP, d.LastSeen = a.IP, now.UnixMilli()
+	// 沒帶名稱的請求（例如 EventSource 不能自訂表頭）沿用之前的名稱
+	if a.Device != "" {
+		d.Name = a.Device
+	}
+	if a.User != "" {
+		d.User = a.User
+	}
+}
+
+// evictLocked 裝置數量到上限時，忘掉最久沒出現且沒有連線的裝置；呼叫端需持有 t.mu
+func (t *deviceTracker) evictLocked() {
+	if len(t.devices) < maxRoomDevices {
+		return
+	}
+	var oldest *DeviceInfo
+	for _, d := range t.devices {
+		if d.Connections == 0 && (oldest == nil || d.LastSeen < oldest.LastSeen) {
+			oldest = d
+		}
+	}
+	if oldest != nil {
+		delete(t.devices, oldest.ID)
+	}
+}
+
+// connect 記下裝置開了一條即時連線，回傳的函式在連線結束時呼叫
+func (t *deviceTracker) connect(id string) func() {
+	if id == "" {
+		return func() {}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if d := t.devices[id]; d != nil {
+		d.Connections++
+	}
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		if d := t.devices[id]; d != nil && d.Connections > 0 {
+			d.Connections--
+			d.LastSeen = clock.Now().UnixMilli()
+		}
+	}
+}
+
+// list 在線的在前，其餘依最後出現時間由新到舊
+func (t *deviceTracker) list(now time.Time) []DeviceInfo {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]DeviceInfo, 0, len(t.devices))
+	for _, d := range t.devices {
+		info := *d
+		info.Online = info.Connections > 0 || now.UnixMilli()-info.LastSeen <= presenceWindow.Milliseconds()
+		out = append(out, info)
+	}
+	slices.SortFunc(out, func(a, b DeviceInfo) int {
+		if a.Online != b.Online {
+			if a.Online {
+				return -1
+			}
+			return 1
+		}
+		return cmp.Or(cmp.Compare(b.LastSeen, a.LastSeen), strings.Compare(a.ID, b.ID))
+	})
+	return out
+}
+
+func newDeviceToken() string {
+	var b [deviceTokenLength / 2]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validDeviceToken 權杖必須是伺服器發出的格式，其他值一律換發
+func validDeviceToken(token string) bool {
+	if len(token) != deviceTokenLength {
+		return false
+	}
+	_, err := hex.DecodeString(token)
+	return err == nil
+}
+
+// deviceID 權杖的公開代號（雜湊的前 12 個十六進位字元）
+func deviceID(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:6])
+}
+
+type deviceContextKey struct{}
+
+// deviceFromRequest 請求所屬裝置的 ID；沒有經過 withDevice（例如 gRPC、桌面版）時為空字串
+func deviceFromRequest(r *http.Request) string {
+	id, _ := r.Context().Value(deviceContextKey{}).(string)
+	return id
+}
+
+// roomFromPath 依網址找出請求作用的房間；/api/rooms 本身（列出、建立房間）不屬於任何房間
+func roomFromPath(path string) (*room, bool) {
+	rest, ok := strings.CutPrefix(path, "/api/rooms/")
+	if !ok {
+		return defaultRoom, isAPIPath(path) && path != "/api/rooms"
+	}
+	code, _, _ := strings.Cut(rest, "/")
+	return serverRooms.get(code)
+}
+
+// withDevice 第一次連線時發給裝置權杖（cookie 與 X-Splitter-Device-Token 回應標頭），
+// 之後每個 API 請求都記在所屬房間的裝置清單，變更也會記下是哪台裝置
+func withDevice(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 首頁也發權杖：頁面載入後同時送出的 API 請求才會帶同一個權杖
+		if r.URL.Path != "/" && !isAPIPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := strings.TrimSpace(r.Header.Get(deviceTokenHeader))
+		if !validDeviceToken(token) {
+			token = ""
+			if c, err := r.Cookie(deviceCookie); err == nil && validDeviceToken(c.Value) {
+				token = c.Value
+			}
+		}
+		if token == "" {
+			token = newDeviceToken()
+			http.SetCookie(w, &http.Cookie{Name: deviceCookie, Value: token, Path: "/", MaxAge: deviceCookieMaxAge, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+		}
+		w.Header().Set(deviceTokenHeader, token)
+
+		r = r.WithContext(context.WithValue(r.Context(), deviceContextKey{}, deviceID(token)))
+		if rm, ok := roomFromPath(r.URL.Path); ok {
+			rm.devices.seen(deviceFromRequest(r), actorFromRequest(r), clock.Now())
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleDevices GET /api/devices（/api/rooms/{code}/devices）房間裡最近出現過的裝置與是否在線
+func handleDevices(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, roomOf(r).devices.list(clock.Now()))
+}
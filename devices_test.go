@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 裝置識別與在線狀態測試
+// ==========================================
+func TestDevices(t *testing.T) {
+	reg := useRooms(t)
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := withDevice(newServerRouter())
+	do := func(method, path, body string, header map[string]string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	prefix := "/api/rooms/" + rm.code
+
+	// 第一次連線發給權杖
+	rec := do(http.MethodGet, prefix+"/sync", "", nil)
+	token := rec.Header().Get(deviceTokenHeader)
+	if !validDeviceToken(token) || !strings.Contains(rec.Header().Get("Set-Cookie"), deviceCookie+"="+token) {
+		t.Fatalf("應發給裝置權杖, got %q / %q", token, rec.Header().Get("Set-Cookie"))
+	}
+	// 之後以 cookie 或表頭帶回，不再換發
+	rec = do(http.MethodGet, prefix+"/sync", "", map[string]string{"Cookie": deviceCookie + "=" + token})
+	if rec.Header().Get(deviceTokenHeader) != token || rec.Header().Get("Set-Cookie") != "" {
+		t.Errorf("帶回 cookie 時不應換發權杖, got %q", rec.Header().Get(deviceTokenHeader))
+	}
+	if rec := do(http.MethodGet, prefix+"/sync", "", map[string]string{deviceTokenHeader: "forged"}); rec.Header().Get(deviceTokenHeader) == "forged" {
+		t.Error("格式不符的權杖應換發")
+	}
+
+	phone := map[string]string{deviceTokenHeader: token, "X-Splitter-Device": "Pixel 8", "X-Splitter-User": "Alice"}
+	if rec := do(http.MethodPost, prefix+"/people", `{"name":"Alice"}`, phone); rec.Code != http.StatusCreated {
+		t.Fatalf("新增人員失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	list := func(path string, header map[string]string) map[string]DeviceInfo {
+		var devices []DeviceInfo
+		json.Unmarshal(do(http.MethodGet, path, "", header).Body.Bytes(), &devices)
+		byID := make(map[string]DeviceInfo, len(devices))
+		for _, d := range devices {
+			byID[d.ID] = d
+		}
+		return byID
+	}
+	id := deviceID(token)
+	// 查詢清單本身沒帶裝置名稱，仍保留之前的名稱
+	devices := list(prefix+"/devices", map[string]string{deviceTokenHeader: token})
+	if d := devices[id]; len(devices) != 2 || d.Name != "Pixel 8" || d.User != "Alice" || !d.Online {
+		t.Errorf("裝置清單 = %+v", devices)
+	}
+	if strings.Contains(do(http.MethodGet, prefix+"/devices", "", nil).Body.String(), token) {
+		t.Error("裝置清單不應洩漏權杖")
+	}
+	if _, ok := list("/api/devices", nil)[id]; ok {
+		t.Error("其他房間的裝置清單不應出現這台裝置")
+	}
+
+	// 每筆變更記下是哪台裝置
+	state, _ := rm.currentState()
+	if len(state.Activity) != 1 || state.Activity[0].DeviceID != id {
+		t.Errorf("動態紀錄 = %+v", state.Activity)
+	}
+
+	// 超過 presenceWindow 沒有請求就不算在線，開著即時連線則一直算在線
+	fc.Advance(2 * presenceWindow)
+	online := func() bool {
+		for _, d := range rm.devices.list(clock.Now()) {
+			if d.ID == id {
+				return d.Online
+			}
+		}
+		t.Fatal("找不到裝置")
+		return false
+	}
+	if online() {
+		t.Error("超過 presenceWindow 應顯示離線")
+	}
+	done := rm.devices.connect(id)
+	if !online() {
+		t.Error("開著即時連線應顯示在線")
+	}
+	done()
+	fc.Advance(2 * presenceWindow)
+	if online() {
+		t.Error("連線結束後應顯示離線")
+	}
+}
+
+func TestDeviceTracker_Evict(t *testing.T) {
+	saved := maxRoomDevices
+	maxRoomDevices = 2
+	t.Cleanup(func() { maxRoomDevices = saved })
+
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tr := newDeviceTracker()
+	tr.seen("a", Actor{Device: "A"}, now)
+	tr.seen("b", Actor{Device: "B"}, now.Add(time.Second))
+	defer tr.connect("a")()
+	tr.seen("c", Actor{Device: "C"}, now.Add(2*time.Second))
+
+	var ids []string
+	for _, d := range tr.list(now.Add(2 * time.Second)) {
+		ids = append(ids, d.ID)
+	}
+	if strings.Join(ids, ",") != "c,a" {
+		t.Errorf("應忘掉沒有連線、最久沒出現的 b, got %v", ids)
+	}
+}
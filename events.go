@@ -0,0 +1,224 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ================= Server-Sent Events（/api/events） =================
+
+const (
+	eventStateUpdated    = "state-updated"
+	eventBillAdded       = "bill-added"
+	eventCalculationDone = "calculation-done"
+)
+
+var (
+	// eventBacklog 保留最近幾筆事件，客戶端帶 Last-Event-ID 重連時補送
+	eventBacklog = 256
+	// sseHeartbeat 沒有事件時定期送註解行，避免代理伺服器切斷閒置連線
+	sseHeartbeat = 15 * time.Second
+	// sseRetry 告訴瀏覽器斷線後多久重連（毫秒）
+	sseRetry = 2000
+)
+
+// Event 一筆推播事件，ID 從 1 開始遞增
+type Event struct {
+	ID   int64
+	Type string
+	Data []byte
+}
+
+// eventLog 最近的事件；新增事件時喚醒所有等待中的串流
+type eventLog struct {
+	mu      sync.Mutex
+	lastID  int64
+	events  []Event
+	changes *changeNotifier
+}
+
+func newEventLog() *eventLog {
+	return &eventLog{changes: &changeNotifier{ch: make(chan struct{})}}
+}
+
+func (l *eventLog) publish(typ string, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("events: encode %s failed: %v", typ, err)
+		return
+	}
+	l.mu.Lock()
+	l.lastID++
+	l.events = append(l.events, Event{ID: l.lastID, Type: typ, Data: data})
+	if n := len(l.events) - eventBacklog; n > 0 {
+		l.events = slices.Delete(l.events, 0, n)
+	}
+	l.mu.Unlock()
+	l.changes.notify()
+}
+
+// since 回傳 ID 大於 id 的事件；中間有事件已經被丟掉（或 id 來自重新啟動前）時 ok 為 false
+func (l *eventLog) since(id int64) (events []Event, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if id > l.lastID || (len(l.events) > 0 && id < l.events[0].ID-1) {
+		return nil, false
+	}
+	i, _ := slices.BinarySearchFunc(l.events, id+1, func(e Event, id int64) int { return cmp.Compare(e.ID, id) })
+	return slices.Clone(l.events[i:]), true
+}
+
+func (l *eventLog) latestID() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastID
+}
+
+// StateUpdatedEvent state-updated 事件的內容
+type StateUpdatedEvent struct {
+	Revision int64       `json:"revision"`
+	State    GlobalState `json:"state"`
+}
+
+// publishStateEvents 比較前後兩份狀態：新出現的帳單各發一則 bill-added，最後發 state-updated
+func (rm *room) publishStateEvents(prev, next GlobalState) {
+	live := make(map[int]bool, len(prev.Bills))
+	for _, b := range prev.Bills {
+		if b.DeletedAt == 0 {
+			live[b.ID] = true
+		}
+	}
+	for _, b := range next.Bills {
+		if b.DeletedAt == 0 && !live[b.ID] {
+			rm.events.publish(eventBillAdded, b)
+		}
+	}
+	rm.events.publish(eventStateUpdated, StateUpdatedEvent{Revision: next.Revision, State: visibleState(next)})
+}
+
+// runEventLoop 等待房間的狀態變更並發出事件，直到 ctx 結束；共用儲存時也定期重新讀取
+func (rm *room) runEventLoop(ctx context.Context) {
+	recheck := time.NewTicker(syncRecheckInterval)
+	defer recheck.Stop()
+	prev, _ := rm.currentState()
+	for {
+		next := rm.changes.wait()
+		if state, err := rm.currentState(); err != nil {
+			log.Printf("events: load state failed: %v", err)
+		} else if state.Revision != prev.Revision {
+			rm.publishStateEvents(prev, state)
+			prev = state
+		}
+		select {
+		case <-next:
+		case <-recheck.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// publishCalculation /api/calculate 成功時發出 calculation-done，內容為計算結果
+func (rm *room) publishCalculation(resultJSON string) {
+	var resp struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal([]byte(resultJSON), &resp) != nil || resp.Error != "" {
+		return
+	}
+	rm.events.publish(eventCalculationDone, json.RawMessage(resultJSON))
+}
+
+func writeSSE(w http.ResponseWriter, e Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
+
+// handleEvents GET /api/events：以 SSE 串流 state-updated、bill-added、calculation-done。
+// 沒有 Last-Event-ID（或太舊而補不齊）時先送一次目前狀態；之後依序送出新事件
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "streaming not supported")
+		return
+	}
+
+	lastID := int64(-1)
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("lastEventId")
+	}
+	if raw != "" {
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID")
+			return
+		}
+		lastID = id
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", sseRetry)
+
+	rm := roomOf(r)
+	defer rm.devices.connect(deviceFromRequest(r))()
+	next := rm.events.changes.wait()
+	pending, ok := rm.events.since(lastID)
+	if lastID < 0 || !ok {
+		// 先記下事件編號再讀狀態：讀到的狀態不會比編號以前的事件舊
+		lastID = rm.events.latestID()
+		state, err := rm.currentState()
+		if err != nil {
+			return
+		}
+		data, _ := json.Marshal(StateUpdatedEvent{Revision: state.Revision, State: visibleState(state)})
+		pending = []Event{{ID: lastID, Type: eventStateUpdated, Data: data}}
+		// 記下編號後才發生的事件接著送，重複的 state-updated 由客戶端依 revision 略過
+		if more, ok := rm.events.since(lastID); ok {
+			pending = append(pending, more...)
+		}
+	}
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		for _, e := range pending {
+			if err := writeSSE(w, e); err != nil {
+				return
+			}
+			lastID = max(lastID, e.ID)
+		}
+		flusher.Flush()
+
+		select {
+		case <-next:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+		next = rm.events.changes.wait()
+		if pending, ok = rm.events.since(lastID); !ok {
+			// 跟不上（積了超過 eventBacklog 筆）：斷線讓瀏覽器帶 Last-Event-ID 重連，拿最新狀態
+			return
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type sseMessage struct {
+	id, event, data string
+}
+
+// readSSE 讀下一則有 event 的訊息，略過 retry 與 heartbeat
+func readSSE(t *testing.T, br *bufio.Reader) sseMessage {
+	t.Helper()
+	var msg sseMessage
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("讀取事件失敗: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		if line == "" {
+			if msg.event != "" {
+				return msg
+			}
+			continue
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			msg.id = value
+		case "event":
+			msg.event = value
+		case "data":
+			msg.data = value
+		}
+	}
+}
+
+func openSSE(t *testing.T, srv *httptest.Server, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/events", nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d %v", resp.StatusCode, resp.Header)
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// ==========================================
+// Server-Sent Events 測試
+// ==========================================
+func TestHandleEvents(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	withRoomState(t, state)
+	savedEvents := defaultRoom.events
+	defaultRoom.events = newEventLog()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defaultRoom.runEventLoop(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		defaultRoom.events = savedEvents
+	})
+
+	// 在各串流關閉之後才關伺服器（Cleanup 後註冊的先執行）
+	srv := httptest.NewServer(http.HandlerFunc(handleEvents))
+	t.Cleanup(srv.Close)
+
+	// 第一次連線先收到目前狀態
+	br := openSSE(t, srv, "")
+	if msg := readSSE(t, br); msg.event != eventStateUpdated || msg.id != "0" || !strings.Contains(msg.data, `"Alice"`) {
+		t.Fatalf("msg = %+v", msg)
+	}
+
+	if _, err := updateState(func(s *GlobalState) error {
+		s.Bills = append(s.Bills, Bill{ID: 1, Title: "Taxi", Amount: 100, PaidBy: 1, Participants: []int{1}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if msg := readSSE(t, br); msg.event != eventBillAdded || msg.id != "1" || !strings.Contains(msg.data, `"Taxi"`) {
+		t.Errorf("msg = %+v", msg)
+	}
+	if msg := readSSE(t, br); msg.event != eventStateUpdated || msg.id != "2" {
+		t.Errorf("msg = %+v", msg)
+	}
+
+	// 計算失敗不發事件
+	defaultRoom.publishCalculation(`{"settlements":null,"error":"缺少幣別"}`)
+	defaultRoom.publishCalculation(`{"settlements":[{"from":1,"to":2,"amount":50}]}`)
+	if msg := readSSE(t, br); msg.event != eventCalculationDone || msg.id != "3" || !strings.Contains(msg.data, `"amount":50`) {
+		t.Errorf("msg = %+v", msg)
+	}
+
+	// 帶 Last-Event-ID 重連：補送之後的事件
+	br = openSSE(t, srv, "1")
+	if msg := readSSE(t, br); msg.id != "2" || msg.event != eventStateUpdated {
+		t.Errorf("msg = %+v", msg)
+	}
+	if msg := readSSE(t, br); msg.id != "3" || msg.event != eventCalculationDone {
+		t.Errorf("msg = %+v", msg)
+	}
+
+	// 伺服器重新啟動過（編號比目前大）：改送目前狀態
+	br = openSSE(t, srv, "99")
+	if msg := readSSE(t, br); msg.id != "3" || msg.event != eventStateUpdated || !strings.Contains(msg.data, `"Taxi"`) {
+		t.Errorf("msg = %+v", msg)
+	}
+}
+
+func TestEventLog_Backlog(t *testing.T) {
+	old := eventBacklog
+	eventBacklog = 2
+	t.Cleanup(func() { eventBacklog = old })
+
+	l := newEventLog()
+	for range 3 {
+		l.publish(eventStateUpdated, nil)
+	}
+	if events, ok := l.since(1); !ok || len(events) != 2 || events[0].ID != 2 {
+		t.Errorf("since(1) = %+v, %v", events, ok)
+	}
+	if _, ok := l.since(0); ok {
+		t.Error("第 1 筆已被丟掉，since(0) 應回報補不齊")
+	}
+}
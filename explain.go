@@ -0,0 +1,209 @@
+package main
+
+import (
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ================= 帳單分攤明細 =================
+
+const (
+	rateSourceBase       = "base"       // 本位幣，不需要換算
+	rateSourceManual     = "manual"     // 帳單上填寫的手動匯率或自訂匯率表
+	rateSourceMarket     = "market"     // 匯率 API 的最新匯率
+	rateSourceHistorical = "historical" // 匯率 API 在帳單日期當天的匯率
+	rateSourceOffline    = "offline"    // 沒有網路時的內建匯率快照
+	rateSourceLocked     = "locked"     // 鎖定在狀態中的匯率
+)
+
+// billRate 換算帳單時使用的匯率：1 單位帳單幣別 = Rate 本位幣，另外加上 FeePercent% 的手續費
+// Pivot 不為空時為經由該幣別交叉換算的匯率
+type billRate struct {
+	Rate       float64
+	Source     string
+	Date       string
+	FeePercent float64
+	Pivot      string
+	// Warning 這個幣別的匯率資料不合理而被捨棄時的提醒
+	Warning *RateWarning
+}
+
+// AppliedRate 某張外幣帳單換算時實際使用的匯率：1 單位 Currency = Rate 本位幣，
+// 再加上 FXFeePercent% 的手續費，得到回應中帳單的 amountBase
+type AppliedRate struct {
+	BillID       int     `json:"billId"`
+	Currency     string  `json:"currency"`
+	Rate         float64 `json:"rate"`
+	RateSource   string  `json:"rateSource"`
+	RateDate     string  `json:"rateDate,omitempty"`
+	FXFeePercent float64 `json:"fxFeePercent,omitempty"`
+	// Derived 匯率來源沒有直接的匯率，經由 Pivot 幣別交叉換算
+	Derived bool   `json:"derived,omitempty"`
+	Pivot   string `json:"pivot,omitempty"`
+}
+
+// appliedRates 列出外幣帳單用的匯率（本位幣帳單不列），rates 與 bills 同順序
+func appliedRates(bills []Bill, rates []billRate) []AppliedRate {
+	var out []AppliedRate
+	for i, bill := range bills {
+		if rates[i].Source == rateSourceBase {
+			continue
+		}
+		out = append(out, AppliedRate{
+			BillID:       bill.ID,
+			Currency:     strings.ToUpper(strings.TrimSpace(bill.Currency)),
+			Rate:         rates[i].Rate,
+			RateSource:   rates[i].Source,
+			RateDate:     rates[i].Date,
+			FXFeePercent: rates[i].FeePercent,
+			Derived:      rates[i].Pivot != "",
+			Pivot:        strings.ToUpper(rates[i].Pivot),
+		})
+	}
+	return out
+}
+
+// BillExplanation 一張帳單怎麼換算、怎麼拆給每個人
+type BillExplanation struct {
+	BillID   int     `json:"billId"`
+	Title    string  `json:"title"`
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+	// Rate 1 單位帳單幣別換成多少本位幣，RateSource 為 base、manual、market、historical、offline 或 locked
+	Rate       float64 `json:"rate"`
+	RateSource string  `json:"rateSource"`
+	RateDate   string  `json:"rateDate,omitempty"`
+	// FXFeePercent 海外交易手續費（%），已含在 AmountBase 內
+	FXFeePercent float64 `json:"fxFeePercent,omitempty"`
+	// Derived 經由 Pivot 幣別交叉換算的匯率
+	Derived      bool    `json:"derived,omitempty"`
+	Pivot        string  `json:"pivot,omitempty"`
+	AmountBase   float64 `json:"amountBase"`
+	BaseCurrency string  `json:"baseCurrency"`
+	// Total 含小費、稅、服務費後實際分攤的總額（本位幣）
+	Total float64 `json:"total"`
+	// Treat 請客的帳單由付款人全額負擔，不影響結算，Shares 為空
+	Treat bool `json:"treat,omitempty"`
+	// Personal 只有付款人自己參與的個人花費，不影響結算，Shares 為空
+	Personal bool               `json:"personal,omitempty"`
+	Shares   []ShareExplanation `json:"shares"`
+}
+
+// ShareExplanation 某人在這張帳單付出與分攤的金額（本位幣）；
+// Rounding 為除不盡時多負擔（正數）或少負擔（負數）的量，已含在 Owed 內
+type ShareExplanation struct {
+	PersonID int     `json:"personId"`
+	Person   string  `json:"person"`
+	Paid     float64 `json:"paid"`
+	Owed     float64 `json:"owed"`
+	Rounding float64 `json:"rounding,omitempty"`
+	Net      float64 `json:"net"`
+}
+
+// explainBills 依與結算相同的順序與餘數政策拆分每張帳單（rotate 需要從第一張依序累計），
+// rates 與 bills 同順序
+func explainBills(people []Person, bills []Bill, rates []billRate, base, remainder string) []BillExplanation {
+	nameMap := make(map[int]string, len(people))
+	for _, p := range people {
+		nameMap[p.ID] = p.Name
+	}
+	allocator := &remainderAllocator{policy: remainder}
+	explanations := make([]BillExplanation, 0, len(bills))
+	for i, bill := range bills {
+		ex := BillExplanation{
+			BillID:       bill.ID,
+			Title:        bill.Title,
+			Amount:       bill.Amount,
+			Currency:     bill.Currency,
+			Rate:         rates[i].Rate,
+			RateSource:   rates[i].Source,
+			RateDate:     rates[i].Date,
+			FXFeePercent: rates[i].FeePercent,
+			Derived:      rates[i].Pivot != "",
+			Pivot:        strings.ToUpper(rates[i].Pivot),
+			AmountBase:   bill.AmountBase,
+			BaseCurrency: base,
+			Treat:        bill.Treat,
+			Personal:     bill.isPersonal(),
+			Shares:       []ShareExplanation{},
+		}
+		if ex.Currency == "" {
+			ex.Currency = base
+		}
+		split, ok := allocator.splitBill(bill, base)
+		if ok {
+			ex.Total = split.total.Float(base)
+			ids := slices.Collect(maps.Keys(split.paid))
+			for id := range split.owed {
+				if _, dup := split.paid[id]; !dup {
+					ids = append(ids, id)
+				}
+			}
+			slices.Sort(ids)
+			for _, id := range ids {
+				ex.Shares = append(ex.Shares, ShareExplanation{
+					PersonID: id,
+					Person:   nameMap[id],
+					Paid:     split.paid[id].Float(base),
+					Owed:     split.owed[id].Float(base),
+					Rounding: split.adjusted[id].Float(base),
+					Net:      (split.paid[id] - split.owed[id]).Float(base),
+				})
+			}
+		}
+		explanations = append(explanations, ex)
+	}
+	return explanations
+}
+
+// handleExplain GET /api/explain/{billId} 以伺服器上的狀態說明某張帳單的分攤方式
+func handleExplain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("billId"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		log.Printf("load state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	if findLiveBill(&state, id) == nil {
+		writeError(w, http.StatusNotFound, "bill not found")
+		return
+	}
+	state = visibleState(state)
+	resp := runCalculate(r.Context(), CalculateRequest{
+		BaseCurrency:    state.BaseCurrency,
+		People:          state.People,
+		Bills:           state.Bills,
+		OpeningBalances: state.OpeningBalances,
+		Groups:          state.Groups,
+		Budgets:         state.Budgets,
+		Constraints:     state.Constraints,
+		RateTable:       state.RateTable,
+		LockedRates:     state.LockedRates,
+		FXFeePercent:    state.FXFeePercent,
+		Explain:         true,
+	})
+	if resp.ErrorInfo != nil {
+		writeAPIError(w, http.StatusBadRequest, resp.ErrorInfo)
+		return
+	}
+	for _, ex := range resp.Explanations {
+		if ex.BillID == id {
+			writeJSON(w, http.StatusOK, ex)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "bill not found")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 帳單分攤明細測試
+// ==========================================
+func explainTestState() GlobalState {
+	s := newGlobalState()
+	s.BaseCurrency = "TWD"
+	s.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	s.Bills = []Bill{
+		{ID: 1, Title: "Dinner", Amount: 100, Currency: "TWD", PaidBy: 3, Participants: []int{1, 2, 3}},
+		{ID: 2, Title: "Taxi", Amount: 10, Currency: "USD", ManualRate: 32.5, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 3, Title: "Cake", Amount: 300, Currency: "TWD", PaidBy: 2, Participants: []int{1, 2, 3}, Treat: true},
+	}
+	return s
+}
+
+func TestProcessCalculate_Explain(t *testing.T) {
+	s := explainTestState()
+	data, _ := json.Marshal(CalculateRequest{BaseCurrency: s.BaseCurrency, People: s.People, Bills: s.Bills, Explain: true})
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" || len(resp.Explanations) != 3 {
+		t.Fatalf("每張帳單都應有明細, got %+v", resp)
+	}
+
+	// 100 三人分：Alice 多負擔 0.01
+	dinner := resp.Explanations[0]
+	want := []ShareExplanation{
+		{PersonID: 1, Person: "Alice", Owed: 33.34, Rounding: 0.01, Net: -33.34},
+		{PersonID: 2, Person: "Bob", Owed: 33.33, Net: -33.33},
+		{PersonID: 3, Person: "Charlie", Paid: 100, Owed: 33.33, Net: 66.67},
+	}
+	if dinner.RateSource != rateSourceBase || dinner.Rate != 1 || !sameJSON(dinner.Shares, want) {
+		t.Errorf("Dinner 明細不符: %+v", dinner)
+	}
+
+	taxi := resp.Explanations[1]
+	if taxi.RateSource != rateSourceManual || taxi.Rate != 32.5 || taxi.AmountBase != 325 || taxi.Shares[1].Owed != 162.5 {
+		t.Errorf("Taxi 應以手動匯率 32.5 換算: %+v", taxi)
+	}
+	if cake := resp.Explanations[2]; !cake.Treat || len(cake.Shares) != 0 {
+		t.Errorf("請客的帳單不應有分攤: %+v", cake)
+	}
+
+	// 沒有帶 explain 時不附明細
+	data, _ = json.Marshal(CalculateRequest{BaseCurrency: s.BaseCurrency, People: s.People, Bills: s.Bills})
+	resp = CalculateResponse{}
+	json.Unmarshal([]byte(processCalculate(string(data))), &resp)
+	if len(resp.Explanations) != 0 {
+		t.Error("未要求時不應回傳明細")
+	}
+}
+
+func TestProcessCalculate_AppliedRates(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"jpy": 5}})
+
+	s := explainTestState()
+	s.Bills = append(s.Bills, Bill{ID: 4, Title: "Ramen", Amount: 1000, Currency: "jpy", PaidBy: 2, Participants: []int{1, 2}})
+	data, _ := json.Marshal(CalculateRequest{BaseCurrency: s.BaseCurrency, People: s.People, Bills: s.Bills, FXFeePercent: 1.5})
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+		t.Fatal(err)
+	}
+	// 不需要 explain 也會列出每張外幣帳單的匯率；本位幣帳單不列
+	want := []AppliedRate{
+		{BillID: 2, Currency: "USD", Rate: 32.5, RateSource: rateSourceManual},
+		{BillID: 4, Currency: "JPY", Rate: 0.2, RateSource: rateSourceMarket, RateDate: "2026-05-01", FXFeePercent: 1.5},
+	}
+	if resp.Error != "" || !sameJSON(resp.Rates, want) {
+		t.Errorf("rates = %+v (%s), want %+v", resp.Rates, resp.Error, want)
+	}
+	if resp.Bills[3].AmountBase != 203 {
+		t.Errorf("1000 JPY × 0.2 × 1.015 應為 203, got %v", resp.Bills[3].AmountBase)
+	}
+}
+
+func TestExplainAPI(t *testing.T) {
+	withRoomState(t, explainTestState())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/explain/{billId}", handleExplain)
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec
+	}
+
+	rec := get("/api/explain/2")
+	var ex BillExplanation
+	if err := json.Unmarshal(rec.Body.Bytes(), &ex); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("取得明細失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if ex.BillID != 2 || ex.Currency != "USD" || len(ex.Shares) != 2 || ex.Shares[0].Net != 162.5 {
+		t.Errorf("Taxi 明細不符: %+v", ex)
+	}
+
+	if rec := get("/api/explain/9"); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的帳單應回傳 404, got %d", rec.Code)
+	}
+	if rec := get("/api/explain/abc"); rec.Code != http.StatusBadRequest {
+		t.Errorf("無效的 ID 應回傳 400, got %d", rec.Code)
+	}
+}
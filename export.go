@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+)
+
+// ================= 匯出 / 匯入完整狀態 =================
+
+// exportedState 匯出（下載或匯入的回應）的內容：webhook 帶著簽章金鑰，不離開伺服器
+func exportedState(state GlobalState) GlobalState {
+	state.Webhooks = nil
+	return state
+}
+
+// handleExport 以附件形式下載目前的完整狀態
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	data, err := json.MarshalIndent(exportedState(state), "", "  ")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encode state failed")
+		return
+	}
+
+	filename := fmt.Sprintf("bill-splitter-%s.json", clock.Now().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if _, err := w.Write(data); err != nil {
+		log.Printf("/api/export write failed: %v", err)
+	}
+}
+
+// handleImport 以上傳的檔案取代目前狀態（舊版格式會先遷移）
+func handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+
+	imported, err := decodeState(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid state file: "+err.Error())
+		return
+	}
+	if err := checkLimits(len(imported.People), len(imported.Bills)); err != nil {
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		return importState(s, imported)
+	})
+	if errors.Is(err, errBillLocked) {
+		writeErrorFor(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		log.Printf("import state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(exportedState(state)); err != nil {
+		log.Printf("encode state failed: %v", err)
+	}
+}
+
+// runStateCommand 處理 export / import 子指令，直接讀寫 -state 指定的狀態檔
+//
+//	go run . -state state.json export [輸出檔]
+//	go run . -state state.json import <匯入檔>
+func runStateCommand(store Store, args []string) error {
+	if store == nil {
+		return errors.New("請用 -state、-journal、-webdav 或 -pg 指定狀態來源")
+	}
+
+	switch args[0] {
+	case "export":
+		state, err := store.Load()
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(state, "", "  ")
+		if err != nil {
+			return err
+		}
+		if len(args) < 2 || args[1] == "-" {
+			_, err = os.Stdout.Write(append(data, '\n'))
+			return err
+		}
+		return os.WriteFile(args[1], data, 0o600)
+
+	case "import":
+		if len(args) < 2 {
+			return errors.New("用法: import <檔案>")
+		}
+		data, err := os.ReadFile(args[1])
+		if err != nil {
+			return err
+		}
+		imported, err := decodeState(data)
+		if err != nil {
+			return fmt.Errorf("匯入檔格式錯誤: %w", err)
+		}
+		if err := checkLimits(len(imported.People), len(imported.Bills)); err != nil {
+			return err
+		}
+		replace := func(s *GlobalState) error {
+			return importState(s, imported)
+		}
+		if ts, ok := store.(TxStore); ok {
+			_, err := ts.Update(replace)
+			return err
+		}
+		state, err := store.Load()
+		if err != nil {
+			return err
+		}
+		if err := replace(&state); err != nil {
+			return err
+		}
+		return store.Save(state)
+	}
+	return fmt.Errorf("未知的指令 %q", args[0])
+}
+
+// importState 以匯入檔取代 s（POST /api/import 與 import 子指令共用）：已鎖定的帳單不能改，
+// webhook 與封存只透過各自的 API 管理，沿用目前的值。版本號接著目前與匯入檔較大的一版往上加，
+// 匯入較舊的檔案時版本才不會倒退，讓舊裝置的 If-Match 又對得上
+func importState(s *GlobalState, imported GlobalState) error {
+	if err := keepLockedBills(*s, &imported); err != nil {
+		return err
+	}
+	imported.Webhooks, imported.ArchivedAt = s.Webhooks, s.ArchivedAt
+	imported.Revision = max(s.Revision, imported.Revision) + 1
+	imported.LastUpdated = clock.Now().UnixMilli()
+	*s = imported
+	return nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 匯出 / 匯入 API 測試
+// ==========================================
+func TestImportThenExport(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	body := `{"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"bills":null}`
+	rec := httptest.NewRecorder()
+	handleImport(rec, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("匯入失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "attachment") {
+		t.Error("匯出應以附件形式下載")
+	}
+	if !strings.Contains(rec.Body.String(), `"Bob"`) || !strings.Contains(rec.Body.String(), `"bills": []`) {
+		t.Errorf("匯出內容不正確: %s", rec.Body.String())
+	}
+}
+
+func TestExport_OmitsWebhookSecrets(t *testing.T) {
+	state := newGlobalState()
+	state.Webhooks = []Webhook{{ID: 1, URL: "https://example.com/hook", Secret: "s3cret"}}
+	withRoomState(t, state)
+
+	rec := httptest.NewRecorder()
+	handleExport(rec, httptest.NewRequest(http.MethodGet, "/api/export", nil))
+	if strings.Contains(rec.Body.String(), "s3cret") || strings.Contains(rec.Body.String(), "webhooks") {
+		t.Errorf("匯出不應包含 webhook 與簽章金鑰: %s", rec.Body.String())
+	}
+
+	// 匯入檔夾帶的 webhook 不會取代伺服器上的，回應也不回傳金鑰
+	body := `{"people":[{"id":1,"name":"Alice"}],"webhooks":[{"id":9,"url":"https://attacker.example","secret":"evil"}]}`
+	rec = httptest.NewRecorder()
+	handleImport(rec, httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body)))
+	if rec.Code != http.StatusOK || strings.Contains(rec.Body.String(), "s3cret") || strings.Contains(rec.Body.String(), "evil") {
+		t.Errorf("匯入的回應 = %d %s", rec.Code, rec.Body.String())
+	}
+	if state, _ := currentState(); len(state.Webhooks) != 1 || state.Webhooks[0].ID != 1 {
+		t.Errorf("匯入後應保留原本的 webhook, got %+v", state.Webhooks)
+	}
+}
+
+func TestStateCommand_Import(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(filepath.Join(dir, "state.json"), "")
+	cur := newGlobalState()
+	cur.Revision = 10
+	cur.Webhooks = []Webhook{{ID: 1, URL: "https://example.com/hook", Secret: "keep"}}
+	if err := store.Save(cur); err != nil {
+		t.Fatal(err)
+	}
+
+	// 匯入較舊的檔案：版本號不倒退，webhook 沿用目前的，不被檔案取代
+	file := newGlobalState()
+	file.Revision = 2
+	file.People = []Person{{ID: 1, Name: "Alice"}}
+	file.Webhooks = []Webhook{{ID: 1, URL: "https://evil.example/hook", Secret: "injected"}}
+	file.ArchivedAt = 123
+	data, _ := json.Marshal(file)
+	path := filepath.Join(dir, "import.json")
+	os.WriteFile(path, data, 0o600)
+	if err := runStateCommand(store, []string{"import", path}); err != nil {
+		t.Fatalf("匯入失敗: %v", err)
+	}
+	got, _ := store.Load()
+	if got.Revision != 11 || len(got.People) != 1 || got.ArchivedAt != 0 {
+		t.Errorf("匯入後 revision %d、%d 人、archivedAt %d, want 11、1、0", got.Revision, len(got.People), got.ArchivedAt)
+	}
+	if len(got.Webhooks) != 1 || got.Webhooks[0].Secret != "keep" {
+		t.Errorf("webhook 應沿用目前的值, got %+v", got.Webhooks)
+	}
+
+	// 超過數量上限與 API 一樣拒絕，狀態檔不變
+	file.People = make([]Person, maxPeople+1)
+	for i := range file.People {
+		file.People[i] = Person{ID: i + 1, Name: "P"}
+	}
+	data, _ = json.Marshal(file)
+	os.WriteFile(path, data, 0o600)
+	var limit *limitError
+	if err := runStateCommand(store, []string{"import", path}); !errors.As(err, &limit) {
+		t.Errorf("超過人數上限應拒絕, got %v", err)
+	}
+	if after, _ := store.Load(); after.Revision != 11 || len(after.People) != 1 {
+		t.Errorf("拒絕的匯入不應寫入, got revision %d、%d 人", after.Revision, len(after.People))
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ================= 結算鎖定 =================
+
+// adminTokenEnvVar 解除鎖定用的管理者權杖（也可用 -admin-token 指定）
+const adminTokenEnvVar = "SPLITTER_ADMIN_TOKEN"
+
+// adminToken 為空時不開放解除鎖定
+var adminToken string
+
+var errBillLocked = errors.New("bill is locked")
+
+// FinalizeRequest POST /api/finalize，By 記錄是誰按下結算
+type FinalizeRequest struct {
+	By string `json:"by,omitempty"`
+}
+
+// UnlockRequest POST /api/unlock，BillIDs 為空代表解除全部
+type UnlockRequest struct {
+	BillIDs []int `json:"billIds,omitempty"`
+}
+
+// finalizeTrip 鎖定目前所有帳單；之後新增的帳單不受影響
+func finalizeTrip(s *GlobalState, by string, now time.Time) {
+	for i := range s.Bills {
+		if s.Bills[i].DeletedAt == 0 {
+			s.Bills[i].Locked = true
+		}
+	}
+	s.FinalizedAt = now.UnixMilli()
+	s.FinalizedBy = by
+}
+
+// checkLockedBills 客戶端推送的狀態不能修改或刪除已鎖定的帳單。
+// AmountBase 是畫面計算後暫存的顯示值，不算修改
+func checkLockedBills(cur, incoming GlobalState) error {
+	next := make(map[int]Bill, len(incoming.Bills))
+	for _, b := range incoming.Bills {
+		next[b.ID] = b
+	}
+	normalize := func(b Bill) Bill {
+		b.AmountBase = 0
+		b.Locked = false
+		b.Attachments, b.Comments = nil, nil
+		return b
+	}
+	for _, b := range cur.Bills {
+		if !b.Locked || b.DeletedAt != 0 {
+			continue
+		}
+		nb, ok := next[b.ID]
+		if !ok {
+			return fmt.Errorf("%w: 帳單「%s」已結算鎖定，不能刪除", errBillLocked, b.Title)
+		}
+		if !sameJSON(normalize(b), normalize(nb)) {
+			return fmt.Errorf("%w: 帳單「%s」已結算鎖定，不能修改", errBillLocked, b.Title)
+		}
+	}
+	return nil
+}
+
+// keepLockedBills 整份取代狀態（匯入、還原快照）前的檢查：已鎖定的帳單必須原樣保留，
+// 通過後把鎖定狀態帶到 incoming，取代之後仍然是鎖定的
+func keepLockedBills(cur GlobalState, incoming *GlobalState) error {
+	if err := checkLockedBills(cur, *incoming); err != nil {
+		return err
+	}
+	locked := make(map[int]bool)
+	for _, b := range cur.Bills {
+		if b.Locked && b.DeletedAt == 0 {
+			locked[b.ID] = true
+		}
+	}
+	for i := range incoming.Bills {
+		if locked[incoming.Bills[i].ID] {
+			incoming.Bills[i].Locked = true
+		}
+	}
+	return nil
+}
+
+// handleFinalize POST /api/finalize：鎖定目前所有帳單
+func handleFinalize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	var req FinalizeRequest
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeJSON(body, &req); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+	}
+
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		finalizeTrip(s, strings.TrimSpace(req.By), clock.Now())
+		return nil
+	})
+	if err != nil {
+		log.Printf("finalize failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, visibleState(state))
+}
+
+// handleUnlock POST /api/unlock：需帶 Authorization: Bearer <admin token>
+func handleUnlock(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if adminToken == "" {
+		writeError(w, http.StatusForbidden, "unlock is disabled (start the server with -admin-token)")
+		return
+	}
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid admin token")
+		return
+	}
+
+	var req UnlockRequest
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeJSON(body, &req); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+	}
+
+	only := make(map[int]bool, len(req.BillIDs))
+	for _, id := range req.BillIDs {
+		only[id] = true
+	}
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		for i := range s.Bills {
+			if len(only) == 0 || only[s.Bills[i].ID] {
+				s.Bills[i].Locked = false
+			}
+		}
+		if len(only) == 0 {
+			s.FinalizedAt, s.FinalizedBy = 0, ""
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("unlock failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, visibleState(state))
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 結算鎖定測試
+// ==========================================
+func TestCheckLockedBills(t *testing.T) {
+	cur := GlobalState{Bills: []Bill{
+		{ID: 1, Title: "Hotel", Amount: 3000, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Taxi", Amount: 400, PaidBy: 2, Participants: []int{1, 2}},
+	}}
+	finalizeTrip(&cur, "Alice", time.Now())
+	if !cur.Bills[0].Locked || !cur.Bills[1].Locked || cur.FinalizedAt == 0 {
+		t.Fatalf("結算後所有帳單應鎖定: %+v", cur)
+	}
+
+	unchanged := cloneState(cur)
+	unchanged.Bills[0].Locked, unchanged.Bills[0].AmountBase = false, 3000
+	unchanged.Bills = append(unchanged.Bills, Bill{ID: 3, Title: "Snacks", Amount: 50, PaidBy: 1, Participants: []int{1}})
+	if err := checkLockedBills(cur, unchanged); err != nil {
+		t.Errorf("未修改鎖定帳單、只新增帳單應允許: %v", err)
+	}
+
+	edited := cloneState(cur)
+	edited.Bills[1].Amount = 40
+	if err := checkLockedBills(cur, edited); !errors.Is(err, errBillLocked) {
+		t.Errorf("修改鎖定帳單應被拒絕, got %v", err)
+	}
+
+	removed := cloneState(cur)
+	removed.Bills = removed.Bills[:1]
+	if err := checkLockedBills(cur, removed); !errors.Is(err, errBillLocked) {
+		t.Errorf("刪除鎖定帳單應被拒絕, got %v", err)
+	}
+}
+
+func TestFinalizeAndUnlockAPI(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 3000, PaidBy: 1, Participants: []int{1, 2}}}
+	withRoomState(t, state)
+	savedToken := adminToken
+	adminToken = ""
+	t.Cleanup(func() { adminToken = savedToken })
+
+	do := func(h http.HandlerFunc, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		ifMatchCurrent(req)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		return rec
+	}
+
+	if rec := do(handleFinalize, "/api/finalize", `{"by":"Alice"}`, ""); rec.Code != http.StatusOK {
+		t.Fatalf("結算失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	edit := `{"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"bills":[{"id":1,"title":"Hotel","amount":1,"paidBy":1,"participants":[1,2]}]}`
+	if rec := do(handleSync, "/api/sync", edit, ""); rec.Code != http.StatusConflict {
+		t.Errorf("同步修改鎖定帳單應回傳 409, got %d", rec.Code)
+	}
+
+	if rec := do(handleUnlock, "/api/unlock", "", "anything"); rec.Code != http.StatusForbidden {
+		t.Errorf("未設定管理者權杖時應回傳 403, got %d", rec.Code)
+	}
+	adminToken = "s3cret"
+	if rec := do(handleUnlock, "/api/unlock", "", "wrong"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("權杖錯誤應回傳 401, got %d", rec.Code)
+	}
+	if rec := do(handleUnlock, "/api/unlock", `{"billIds":[1]}`, "s3cret"); rec.Code != http.StatusOK {
+		t.Fatalf("解除鎖定失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(handleSync, "/api/sync", edit, ""); rec.Code != http.StatusOK {
+		t.Errorf("解除鎖定後應可修改, got %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLockedBills_RestoreImportDesktop(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	// 快照時還沒有 Taxi，之後才新增並結算
+	takeSnapshot(&state, "出發前", time.Now())
+	state.Bills = []Bill{{ID: 1, Title: "Taxi", Amount: 400, PaidBy: 2, Participants: []int{1, 2}}}
+	finalizeTrip(&state, "Alice", time.Now())
+	withRoomState(t, state)
+	rt := newServerRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	locked := func() {
+		t.Helper()
+		cur, _ := currentState()
+		if len(cur.Bills) != 1 || cur.Bills[0].Amount != 400 || !cur.Bills[0].Locked || cur.Bills[0].DeletedAt != 0 {
+			t.Fatalf("鎖定的帳單不應被改動: %+v", cur.Bills)
+		}
+	}
+
+	// 還原到結算前的快照會刪掉鎖定的帳單
+	if rec := do(http.MethodPost, "/api/snapshots/1/restore", ""); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), codeBillLocked) {
+		t.Errorf("還原快照應回 409 %s, got %d %s", codeBillLocked, rec.Code, rec.Body.String())
+	}
+	locked()
+
+	// 匯入的檔案修改了鎖定的帳單
+	edited := `{"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"bills":[{"id":1,"title":"Taxi","amount":40,"paidBy":2,"participants":[1,2]}]}`
+	if rec := do(http.MethodPost, "/api/import", edited); rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), codeBillLocked) {
+		t.Errorf("匯入應回 409 %s, got %d %s", codeBillLocked, rec.Code, rec.Body.String())
+	}
+	locked()
+
+	// 匯入檔保留鎖定的帳單原樣、只新增帳單：允許，而且匯入後仍然鎖定
+	same := `{"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"bills":[{"id":1,"title":"Taxi","amount":400,"paidBy":2,"participants":[1,2]},{"id":2,"title":"Snacks","amount":50,"paidBy":1,"participants":[1]}]}`
+	if rec := do(http.MethodPost, "/api/import", same); rec.Code != http.StatusOK {
+		t.Fatalf("未改動鎖定帳單的匯入應成功, got %d %s", rec.Code, rec.Body.String())
+	}
+	if cur, _ := currentState(); len(cur.Bills) != 2 || !cur.Bills[0].Locked {
+		t.Errorf("匯入後 Taxi 應仍鎖定: %+v", cur.Bills)
+	}
+
+	// 桌面版存檔與 /api/sync 相同，不能刪掉鎖定的帳單
+	if _, err := desktopSaveState(`{"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],"bills":[]}`); !errors.Is(err, errBillLocked) {
+		t.Errorf("桌面版刪除鎖定帳單應被拒絕, got %v", err)
+	}
+}
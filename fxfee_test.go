@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 海外交易手續費測試
+// ==========================================
+func TestRunCalculate_FXFee(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"usd": 0.03125}})
+
+	zero, three := 0.0, 3.0
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Dinner", Amount: 1000, Currency: "TWD", PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 3, Title: "Card", Amount: 100, Currency: "USD", ManualRate: 32, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 4, Title: "Cash", Amount: 100, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}, FXFeePercent: &zero},
+		{ID: 5, Title: "Card abroad", Amount: 100, Currency: "USD", ManualRate: 32, PaidBy: 1, Participants: []int{1, 2}, FXFeePercent: &three},
+		{ID: 6, Type: billTypeTransfer, Title: "Bob 還給 Alice", Amount: 10, Currency: "USD", PaidBy: 2, Participants: []int{1}},
+	}
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, FXFeePercent: 1.5, Explain: true})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	// 只有一般的外幣帳單加手續費；本位幣、手動匯率、指定 0 的帳單與還款不加，帳單指定的手續費優先
+	want := []float64{3248, 1000, 3200, 3200, 3296, 320}
+	for i, b := range resp.Bills {
+		if b.AmountBase != want[i] {
+			t.Errorf("bill %d: AmountBase = %v, want %v", b.ID, b.AmountBase, want[i])
+		}
+	}
+	if ex := resp.Explanations[0]; ex.FXFeePercent != 1.5 || ex.Rate != 32 {
+		t.Errorf("明細應列出手續費, got %+v", ex)
+	}
+	if ex := resp.Explanations[1]; ex.FXFeePercent != 0 {
+		t.Errorf("本位幣帳單不應有手續費, got %+v", ex)
+	}
+
+	if resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, FXFeePercent: -1}); resp.Error == "" {
+		t.Error("負的手續費應報錯")
+	}
+	negative := -2.0
+	bills[0].FXFeePercent = &negative
+	resp = runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills})
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "bills[0].fxFeePercent" {
+		t.Errorf("got %+v", resp.Errors)
+	}
+}
@@ -2,4 +2,7 @@ module localAPI
 
 go 1.25.4
 
-require github.com/webview/webview_go v0.0.0-20240831120633-6173450d4dd6
+require (
+	github.com/lib/pq v1.10.9
+	github.com/webview/webview_go v0.0.0-20240831120633-6173450d4dd6
+)
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ================= 人員群組 =================
+
+// Group 一組常一起分帳的人（「A 家」、「第二台車」），帳單可直接引用群組而不用逐一勾選
+type Group struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	Members []int  `json:"members"`
+}
+
+var (
+	errGroupNotFound = errors.New("group not found")
+	errGroupInUse    = errors.New("group is used by bills")
+	errInvalidGroup  = errors.New("invalid group")
+)
+
+// expandGroups 將帳單引用的群組展開成參與者（與原本勾選的人取聯集，不重複）
+func expandGroups(groups []Group, bills []Bill) ([]Bill, error) {
+	byID := make(map[int]Group, len(groups))
+	for _, g := range groups {
+		byID[g.ID] = g
+	}
+	out := make([]Bill, len(bills))
+	for i, bill := range bills {
+		if len(bill.Groups) > 0 {
+			seen := make(map[int]bool, len(bill.Participants))
+			participants := make([]int, 0, len(bill.Participants))
+			add := func(pid int) {
+				if !seen[pid] {
+					seen[pid] = true
+					participants = append(participants, pid)
+				}
+			}
+			for _, pid := range bill.Participants {
+				add(pid)
+			}
+			for _, gid := range bill.Groups {
+				g, ok := byID[gid]
+				if !ok {
+					return nil, fmt.Errorf("帳單「%s」引用的群組 %d 不存在", bill.Title, gid)
+				}
+				for _, pid := range g.Members {
+					add(pid)
+				}
+			}
+			bill.Participants = participants
+		}
+		out[i] = bill
+	}
+	return out, nil
+}
+
+func validateGroup(s *GlobalState, g *Group) error {
+	g.Name = strings.TrimSpace(g.Name)
+	if g.Name == "" {
+		return fmt.Errorf("群組名稱不能是空白")
+	}
+	if len(g.Members) == 0 {
+		return fmt.Errorf("群組「%s」至少要有一位成員", g.Name)
+	}
+	live := make(map[int]bool, len(s.People))
+	for _, p := range s.People {
+		if p.DeletedAt == 0 {
+			live[p.ID] = true
+		}
+	}
+	for _, pid := range g.Members {
+		if !live[pid] {
+			return fmt.Errorf("群組「%s」的成員 %d 不存在", g.Name, pid)
+		}
+	}
+	return nil
+}
+
+// handleGroups GET 列出、POST 新增 /api/groups
+func handleGroups(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		groups := state.Groups
+		if groups == nil {
+			groups = []Group{}
+		}
+		writeJSON(w, http.StatusOK, groups)
+
+	case http.MethodPost:
+		var g Group
+		if !decodeGroup(w, r, &g) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			if err := validateGroup(s, &g); err != nil {
+				return fmt.Errorf("%w: %v", errInvalidGroup, err)
+			}
+			g.ID = 1
+			for _, existing := range s.Groups {
+				if existing.ID >= g.ID {
+					g.ID = existing.ID + 1
+				}
+			}
+			s.Groups = append(s.Groups, g)
+			return nil
+		})
+		if !groupUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, g)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleGroup PUT 修改、DELETE 刪除 /api/groups/{id}
+func handleGroup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid group id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var g Group
+		if !decodeGroup(w, r, &g) {
+			return
+		}
+		g.ID = id
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			for i := range s.Groups {
+				if s.Groups[i].ID == id {
+					if err := validateGroup(s, &g); err != nil {
+						return fmt.Errorf("%w: %v", errInvalidGroup, err)
+					}
+					s.Groups[i] = g
+					return nil
+				}
+			}
+			return errGroupNotFound
+		})
+		if !groupUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, g)
+
+	case http.MethodDelete:
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			for _, b := range s.Bills {
+				for _, gid := range b.Groups {
+					if b.DeletedAt == 0 && gid == id {
+						return errGroupInUse
+					}
+				}
+			}
+			for i := range s.Groups {
+				if s.Groups[i].ID == id {
+					s.Groups = append(s.Groups[:i], s.Groups[i+1:]...)
+					return nil
+				}
+			}
+			return errGroupNotFound
+		})
+		if !groupUpdateOK(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func decodeGroup(w http.ResponseWriter, r *http.Request, g *Group) bool {
+	body, err := readBody(w, r)
+	if err != nil {
+		return false
+	}
+	if err := decodeJSON(body, g); err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	return true
+}
+
+// groupUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func groupUpdateOK(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errGroupNotFound):
+		writeError(w, http.StatusNotFound, "group not found")
+	case errors.Is(err, errGroupInUse):
+		writeErrorCode(w, http.StatusConflict, codeInUse, "group is used by bills")
+	case errors.Is(err, errInvalidGroup):
+		writeErrorFor(w, http.StatusBadRequest, err)
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
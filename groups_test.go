@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 人員群組測試
+// ==========================================
+func TestExpandGroups(t *testing.T) {
+	groups := []Group{
+		{ID: 1, Name: "Family A", Members: []int{1, 2}},
+		{ID: 2, Name: "Car 2", Members: []int{2, 3, 4}},
+	}
+	bills := []Bill{
+		{ID: 1, Title: "Gas", PaidBy: 3, Participants: []int{5}, Groups: []int{1, 2}},
+		{ID: 2, Title: "Lunch", PaidBy: 1, Participants: []int{1, 2}},
+	}
+
+	expanded, err := expandGroups(groups, bills)
+	if err != nil {
+		t.Fatalf("展開失敗: %v", err)
+	}
+	if got := expanded[0].Participants; len(got) != 5 {
+		t.Errorf("群組成員應與勾選的人合併且不重複, got %v", got)
+	}
+	if len(bills[0].Participants) != 1 {
+		t.Error("不應修改呼叫端的帳單")
+	}
+	if len(expanded[1].Participants) != 2 {
+		t.Errorf("沒有引用群組的帳單不應改變, got %v", expanded[1].Participants)
+	}
+
+	if _, err := expandGroups(groups, []Bill{{Title: "Taxi", Groups: []int{9}}}); err == nil {
+		t.Error("引用不存在的群組應報錯")
+	}
+}
+
+func TestGroupCRUD(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/groups", handleGroups)
+	mux.HandleFunc("/api/groups/{id}", handleGroup)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	if rec := do(http.MethodPost, "/api/groups", `{"name":"Family A","members":[1,2]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("新增失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/groups", `{"name":"Ghosts","members":[7]}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("成員不存在應回傳 400, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/api/groups/1", `{"name":"Family","members":[1]}`); rec.Code != http.StatusOK {
+		t.Errorf("修改失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	defaultRoom.mu.Lock()
+	defaultRoom.state.Bills = []Bill{{ID: 1, Title: "Hotel", PaidBy: 1, Groups: []int{1}}}
+	defaultRoom.mu.Unlock()
+	if rec := do(http.MethodDelete, "/api/groups/1", ""); rec.Code != http.StatusConflict {
+		t.Errorf("仍被帳單引用的群組不能刪除, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/groups/9", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("刪除不存在的群組應回傳 404, got %d", rec.Code)
+	}
+}
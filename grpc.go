@@ -0,0 +1,304 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= gRPC（HTTP/2 明文，只實作伺服器端的 unary 與伺服器串流） =================
+
+const (
+	grpcPackage     = "splitter.v1"
+	grpcServiceName = "Splitter"
+	// grpcRoomHeader 以 metadata 指定房間的加入代碼，沒有時操作預設房間
+	grpcRoomHeader = "x-room-code"
+)
+
+// gRPC 狀態碼（https://grpc.github.io/grpc/core/md_doc_statuscodes.html）
+const (
+	grpcOK                 = 0
+	grpcCanceled           = 1
+	grpcInvalidArgument    = 3
+	grpcNotFound           = 5
+	grpcAlreadyExists      = 6
+	grpcPermissionDenied   = 7
+	grpcResourceExhausted  = 8
+	grpcFailedPrecondition = 9
+	grpcAborted            = 10
+	grpcUnimplemented      = 12
+	grpcInternal           = 13
+	grpcUnavailable        = 14
+	grpcUnauthenticated    = 16
+)
+
+// grpcCodes APIError 的 Code 對應的 gRPC 狀態碼，沒列出的為 INTERNAL
+var grpcCodes = map[string]int{
+	codeInvalidRequest:    grpcInvalidArgument,
+	codeInvalidBody:       grpcInvalidArgument,
+	codeInvalidJSON:       grpcInvalidArgument,
+	codeValidation:        grpcInvalidArgument,
+	codeInvalidRevision:   grpcInvalidArgument,
+	codeInvalidPatch:      grpcInvalidArgument,
+	codeCalculationFailed: grpcInvalidArgument,
+	codeUnauthorized:      grpcUnauthenticated,
+	codeForbidden:         grpcPermissionDenied,
+	codeNotFound:          grpcNotFound,
+	codeAlreadyExists:     grpcAlreadyExists,
+	codeConflict:          grpcFailedPrecondition,
+	codeInUse:             grpcFailedPrecondition,
+	codeBillLocked:        grpcFailedPrecondition,
+	codeRoomArchived:      grpcFailedPrecondition,
+	codeRevisionRequired:  grpcFailedPrecondition,
+	codeSettlementChanged: grpcFailedPrecondition,
+	codePatchTestFailed:   grpcFailedPrecondition,
+	codeMissingRate:       grpcFailedPrecondition,
+	codeNoHistoricalRates: grpcFailedPrecondition,
+	codeStaleRevision:     grpcAborted,
+	codePayloadTooLarge:   grpcResourceExhausted,
+	codeTooManyItems:      grpcResourceExhausted,
+	codeRatesUnavailable:  grpcUnavailable,
+}
+
+// grpcStatus 回給客戶端的 gRPC 狀態
+type grpcStatus struct {
+	Code    int
+	Message string
+}
+
+func (s *grpcStatus) Error() string {
+	return fmt.Sprintf("grpc status %d: %s", s.Code, s.Message)
+}
+
+// grpcStatusFrom 依錯誤種類決定狀態碼；不認得的錯誤記在 log，只回 INTERNAL
+func grpcStatusFrom(method string, err error) *grpcStatus {
+	var st *grpcStatus
+	switch {
+	case err == nil:
+		return &grpcStatus{Code: grpcOK}
+	case errors.As(err, &st):
+		return st
+	case errors.Is(err, context.Canceled):
+		return &grpcStatus{Code: grpcCanceled, Message: "canceled"}
+	}
+	apiErr := apiErrorFrom(err, codeInternal)
+	code, ok := grpcCodes[apiErr.Code]
+	if !ok {
+		log.Printf("grpc %s failed: %v", method, err)
+		return &grpcStatus{Code: grpcInternal, Message: "internal error"}
+	}
+	return &grpcStatus{Code: code, Message: apiErr.Message}
+}
+
+// grpcMethod 服務的一個方法：Request、Response 為訊息型別的零值，Stream 代表伺服器串流
+type grpcMethod struct {
+	Name     string
+	Summary  string
+	Request  any
+	Response any
+	Stream   bool
+	// call 處理一次呼叫：req 為解碼後的請求（指標），每則回應交給 send
+	call func(r *http.Request, req any, send func(any) error) error
+}
+
+// GetStateRequest GetState 不需要參數
+type GetStateRequest struct{}
+
+// UpdateStateRequest 同 POST /api/sync：State 為完整狀態，Revision 為客戶端依據的版本（-1 代表不檢查）
+type UpdateStateRequest struct {
+	State    GlobalState `json:"state"`
+	Revision *int64      `json:"revision,omitempty"`
+}
+
+// StreamChangesRequest SinceRevision 為客戶端已有的版本，0 代表先送一次目前狀態
+type StreamChangesRequest struct {
+	SinceRevision int64 `json:"sinceRevision,omitempty"`
+}
+
+var grpcMethods = []grpcMethod{
+	{Name: "Calculate", Summary: "同 POST /api/calculate，計算失敗時回傳錯誤狀態", Request: CalculateRequest{}, Response: CalculateResponse{}, call: grpcCalculate},
+	{Name: "GetState", Summary: "取得目前狀態（不含垃圾桶）", Request: GetStateRequest{}, Response: GlobalState{}, call: grpcGetState},
+	{Name: "UpdateState", Summary: "同 POST /api/sync，版本落後時回 ABORTED", Request: UpdateStateRequest{}, Response: GlobalState{}, call: grpcUpdateState},
+	{Name: "StreamChanges", Summary: "每次狀態變更推送一次，同 /api/ws", Request: StreamChangesRequest{}, Response: StateEvent{}, Stream: true, call: grpcStreamChanges},
+}
+
+func grpcCalculate(r *http.Request, in any, send func(any) error) error {
+	req := in.(*CalculateRequest)
+	if err := checkLimits(len(req.People), len(req.Bills)); err != nil {
+		return err
+	}
+	resp := runCalculate(r.Context(), *req)
+	if resp.ErrorInfo != nil {
+		return resp.ErrorInfo
+	}
+	if !req.DryRun {
+		roomOf(r).publishCalculation(marshalCalculateResponse(resp))
+	}
+	return send(resp)
+}
+
+func grpcGetState(r *http.Request, _ any, send func(any) error) error {
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		return err
+	}
+	return send(visibleState(state))
+}
+
+func grpcUpdateState(r *http.Request, in any, send func(any) error) error {
+	req := in.(*UpdateStateRequest)
+	if req.Revision == nil {
+		return errRevisionRequired
+	}
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		if err := checkRevision(*s, *req.Revision); err != nil {
+			return err
+		}
+		return applySyncedState(s, req.State)
+	})
+	if err != nil {
+		return err
+	}
+	return send(visibleState(state))
+}
+
+// grpcStreamChanges 與 wsHub.run 相同：先取得 channel 再讀狀態，之間的變更才不會漏掉
+func grpcStreamChanges(r *http.Request, in any, send func(any) error) error {
+	req := in.(*StreamChangesRequest)
+	recheck := time.NewTicker(syncRecheckInterval)
+	defer recheck.Stop()
+	last, first := req.SinceRevision, req.SinceRevision == 0
+	for {
+		next := roomOf(r).changes.wait()
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			return err
+		}
+		if first || state.Revision != last {
+			if err := send(StateEvent{Type: "state", Revision: state.Revision, State: visibleState(state)}); err != nil {
+				return err
+			}
+			last, first = state.Revision, false
+		}
+		select {
+		case <-next:
+		case <-recheck.C:
+		case <-r.Context().Done():
+			return nil
+		}
+	}
+}
+
+// handleGRPC 處理 /splitter.v1.Splitter/{方法} 的呼叫；狀態一律放在 trailer 的 grpc-status、grpc-message
+func handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ProtoMajor != 2 {
+		http.Error(w, "gRPC requires an HTTP/2 POST", http.StatusBadRequest)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/grpc" && ct != "application/grpc+proto" {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	name, _ := strings.CutPrefix(r.URL.Path, "/"+grpcPackage+"."+grpcServiceName+"/")
+	i := slices.IndexFunc(grpcMethods, func(m grpcMethod) bool { return m.Name == name })
+	if i < 0 {
+		writeGRPCStatus(w, &grpcStatus{Code: grpcUnimplemented, Message: "unknown method " + r.URL.Path})
+		return
+	}
+	m := grpcMethods[i]
+	if code := r.Header.Get(grpcRoomHeader); code != "" {
+		rm, ok := serverRooms.get(code)
+		if !ok {
+			writeGRPCStatus(w, &grpcStatus{Code: grpcNotFound, Message: errRoomNotFound.Error()})
+			return
+		}
+		r = withRoom(r, rm)
+	}
+
+	req := reflect.New(reflect.TypeOf(m.Request)).Interface()
+	if err := readGRPCMessage(r.Body, req); err != nil {
+		writeGRPCStatus(w, grpcStatusFrom(m.Name, err))
+		return
+	}
+	err := m.call(r, req, func(v any) error { return writeGRPCMessage(w, v) })
+	writeGRPCStatus(w, grpcStatusFrom(m.Name, err))
+}
+
+// readGRPCMessage 讀取一則 length-prefixed 訊息（1 byte 壓縮旗標 + 4 bytes 長度）
+func readGRPCMessage(body io.Reader, v any) error {
+	var hdr [5]byte
+	if _, err := io.ReadFull(body, hdr[:]); err != nil {
+		return &grpcStatus{Code: grpcInvalidArgument, Message: "missing request message"}
+	}
+	if hdr[0] != 0 {
+		return &grpcStatus{Code: grpcUnimplemented, Message: "compressed messages are not supported"}
+	}
+	size := binary.BigEndian.Uint32(hdr[1:])
+	if int64(size) > maxRequestBody {
+		return &grpcStatus{Code: grpcResourceExhausted, Message: fmt.Sprintf("message larger than %d bytes", maxRequestBody)}
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return &grpcStatus{Code: grpcInvalidArgument, Message: "truncated request message"}
+	}
+	if err := unmarshalProto(data, v); err != nil {
+		return &grpcStatus{Code: grpcInvalidArgument, Message: err.Error()}
+	}
+	return nil
+}
+
+func writeGRPCMessage(w http.ResponseWriter, v any) error {
+	data, err := marshalProto(v)
+	if err != nil {
+		return err
+	}
+	frame := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(data)))
+	if _, err := w.Write(append(frame, data...)); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+func writeGRPCStatus(w http.ResponseWriter, st *grpcStatus) {
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(st.Code))
+	if st.Message != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcEncodeMessage(st.Message))
+	}
+}
+
+// grpcEncodeMessage grpc-message 以百分比編碼，ASCII 可見字元之外（例如中文）都要編碼
+func grpcEncodeMessage(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// runGRPCServer 在 port 上以 HTTP/2 明文（h2c，不經 Upgrade）提供 gRPC
+func runGRPCServer(port string) {
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{Addr: ":" + port, Handler: http.HandlerFunc(handleGRPC), Protocols: &protocols}
+	log.Printf("gRPC 服務：%s.%s，連接埠 %s", grpcPackage, grpcServiceName, port)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Fatalf("grpc server exit: %v", err)
+	}
+}
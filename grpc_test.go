@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// startGRPCServer 以 HTTP/2 明文啟動測試用的 gRPC 伺服器，回傳只用 HTTP/2 的客戶端
+func startGRPCServer(t *testing.T) (*httptest.Server, *http.Client) {
+	t.Helper()
+	var protocols http.Protocols
+	protocols.SetUnencryptedHTTP2(true)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(handleGRPC))
+	srv.Config.Protocols = &protocols
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv, &http.Client{Transport: &http.Transport{Protocols: &protocols}}
+}
+
+// grpcCall 送出一則請求，回傳 HTTP 回應與之後逐則讀取訊息用的 body
+func grpcCall(t *testing.T, ctx context.Context, srv *httptest.Server, client *http.Client, method string, req any) (*http.Response, io.ReadCloser) {
+	t.Helper()
+	data, err := marshalProto(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(data)))
+	httpReq, _ := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+"/splitter.v1.Splitter/"+method, bytes.NewReader(append(frame, data...)))
+	httpReq.Header.Set("Content-Type", "application/grpc")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, resp.Body
+}
+
+// readGRPCFrame 讀取下一則回應訊息，沒有了回傳 false
+func readGRPCFrame(t *testing.T, body io.Reader, v any) bool {
+	t.Helper()
+	var hdr [5]byte
+	if _, err := io.ReadFull(body, hdr[:]); err != nil {
+		return false
+	}
+	data := make([]byte, binary.BigEndian.Uint32(hdr[1:]))
+	if _, err := io.ReadFull(body, data); err != nil {
+		t.Fatal(err)
+	}
+	if err := unmarshalProto(data, v); err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+// grpcUnary 呼叫 unary 方法，回傳 grpc-status
+func grpcUnary(t *testing.T, srv *httptest.Server, client *http.Client, method string, req, resp any) int {
+	t.Helper()
+	httpResp, body := grpcCall(t, context.Background(), srv, client, method, req)
+	defer body.Close()
+	if httpResp.ProtoMajor != 2 || httpResp.Header.Get("Content-Type") != "application/grpc" {
+		t.Fatalf("%s: 應以 HTTP/2 回應 application/grpc, got %s %v", method, httpResp.Proto, httpResp.Header)
+	}
+	readGRPCFrame(t, body, resp)
+	io.Copy(io.Discard, body)
+	code, err := strconv.Atoi(httpResp.Trailer.Get("Grpc-Status"))
+	if err != nil {
+		t.Fatalf("%s: 缺少 grpc-status, trailer = %v", method, httpResp.Trailer)
+	}
+	return code
+}
+
+// ==========================================
+// gRPC 服務測試
+// ==========================================
+func TestGRPCService(t *testing.T) {
+	initial := newGlobalState()
+	initial.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	withRoomState(t, initial)
+	srv, client := startGRPCServer(t)
+
+	var state GlobalState
+	if code := grpcUnary(t, srv, client, "GetState", GetStateRequest{}, &state); code != grpcOK || len(state.People) != 2 {
+		t.Fatalf("GetState: %d %+v", code, state)
+	}
+
+	update := UpdateStateRequest{State: state}
+	update.State.Bills = []Bill{{ID: 1, Title: "Dinner", Amount: 300, PaidBy: 1, Participants: []int{1, 2}}}
+	if code := grpcUnary(t, srv, client, "UpdateState", update, &GlobalState{}); code != grpcFailedPrecondition {
+		t.Errorf("缺少 revision 應回 FAILED_PRECONDITION, got %d", code)
+	}
+	stale := state.Revision + 5
+	update.Revision = &stale
+	if code := grpcUnary(t, srv, client, "UpdateState", update, &GlobalState{}); code != grpcAborted {
+		t.Errorf("版本落後應回 ABORTED, got %d", code)
+	}
+	update.Revision = &state.Revision
+	var updated GlobalState
+	if code := grpcUnary(t, srv, client, "UpdateState", update, &updated); code != grpcOK || len(updated.Bills) != 1 || updated.Revision != state.Revision+1 {
+		t.Fatalf("UpdateState: %d %+v", code, updated)
+	}
+
+	calc := CalculateRequest{BaseCurrency: "TWD", People: updated.People, Bills: []Bill{
+		{ID: 1, Title: "Taxi", Amount: 10, Currency: "USD", ManualRate: 30, PaidBy: 1, Participants: []int{1, 2}},
+	}}
+	var result CalculateResponse
+	if code := grpcUnary(t, srv, client, "Calculate", calc, &result); code != grpcOK || len(result.Settlements) != 1 || result.Settlements[0].Amount != 150 {
+		t.Errorf("Calculate: %d %+v", code, result)
+	}
+	calc.Bills[0].PaidBy = 9
+	if code := grpcUnary(t, srv, client, "Calculate", calc, &CalculateResponse{}); code != grpcInvalidArgument {
+		t.Errorf("驗證錯誤應回 INVALID_ARGUMENT, got %d", code)
+	}
+	if code := grpcUnary(t, srv, client, "Nope", GetStateRequest{}, &GlobalState{}); code != grpcUnimplemented {
+		t.Errorf("不存在的方法應回 UNIMPLEMENTED, got %d", code)
+	}
+}
+
+func TestGRPCStreamChanges(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	withRoomState(t, state)
+	srv, client := startGRPCServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, body := grpcCall(t, ctx, srv, client, "StreamChanges", StreamChangesRequest{})
+	defer body.Close()
+
+	var event StateEvent
+	if !readGRPCFrame(t, body, &event) || event.Type != "state" || len(event.State.People) != 1 {
+		t.Fatalf("應先收到目前狀態, got %+v", event)
+	}
+	if _, err := updateState(func(s *GlobalState) error {
+		s.Bills = append(s.Bills, Bill{ID: 1, Title: "Taxi", Amount: 100, PaidBy: 1, Participants: []int{1}})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	event = StateEvent{}
+	if !readGRPCFrame(t, body, &event) || len(event.State.Bills) != 1 || event.State.Bills[0].Title != "Taxi" {
+		t.Errorf("變更後應推送新狀態, got %+v", event)
+	}
+}
+
+// roomTransport 每個請求都帶上房間代碼的 metadata
+type roomTransport struct {
+	code string
+	base http.RoundTripper
+}
+
+func (rt roomTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set(grpcRoomHeader, rt.code)
+	return rt.base.RoundTrip(r)
+}
+
+func TestGRPCRoom(t *testing.T) {
+	reg := useRooms(t)
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Alice"}}
+		return nil
+	})
+	srv, client := startGRPCServer(t)
+
+	roomClient := &http.Client{Transport: roomTransport{code: strings.ToLower(rm.code), base: client.Transport}}
+	var state GlobalState
+	if code := grpcUnary(t, srv, roomClient, "GetState", &GetStateRequest{}, &state); code != grpcOK || len(state.People) != 1 {
+		t.Errorf("帶房間代碼時應取得該房間的狀態, got %d %+v", code, state.People)
+	}
+	missing := &http.Client{Transport: roomTransport{code: "ZZZZZZ", base: client.Transport}}
+	if code := grpcUnary(t, srv, missing, "GetState", &GetStateRequest{}, &state); code != grpcNotFound {
+		t.Errorf("房間不存在應回 NOT_FOUND, got %d", code)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ================= 臨時參加者 =================
+
+// expandGuests 把帳單上的臨時參加者（Bill.Guests，只有名字）轉成負數 ID 的 Person 並加入參與者，
+// 讓 calculate 不需要另外處理；同名的臨時參加者跨帳單視為同一人。
+// 同時檢查參與者/付款人 ID 是否都在人員名單內，打錯的 ID 會報錯而不是被當成臨時參加者
+func expandGuests(people []Person, bills []Bill) ([]Person, []Bill, error) {
+	known := make(map[int]bool, len(people))
+	names := make(map[string]bool, len(people))
+	for _, p := range people {
+		known[p.ID] = true
+		names[strings.ToLower(strings.TrimSpace(p.Name))] = true
+	}
+
+	guestIDs := map[string]int{}
+	allPeople := append([]Person(nil), people...)
+	out := make([]Bill, len(bills))
+	for i, bill := range bills {
+		if err := checkBillPeople(bill, known); err != nil {
+			return nil, nil, err
+		}
+		if len(bill.Guests) > 0 && (bill.isTransfer() || len(bill.Payers) > 0) {
+			return nil, nil, fmt.Errorf("帳單「%s」是還款或多人付款，不能加入臨時參加者", bill.Title)
+		}
+
+		participants := append([]int(nil), bill.Participants...)
+		seen := map[string]bool{}
+		for _, g := range bill.Guests {
+			name := strings.TrimSpace(g)
+			key := strings.ToLower(name)
+			if name == "" {
+				return nil, nil, fmt.Errorf("帳單「%s」的臨時參加者名字不能是空白", bill.Title)
+			}
+			if names[key] {
+				return nil, nil, fmt.Errorf("帳單「%s」的臨時參加者「%s」與成員同名，請直接勾選該成員", bill.Title, name)
+			}
+			if seen[key] {
+				return nil, nil, fmt.Errorf("帳單「%s」的臨時參加者「%s」重複", bill.Title, name)
+			}
+			seen[key] = true
+
+			id, ok := guestIDs[key]
+			if !ok {
+				id = -(len(guestIDs) + 1)
+				guestIDs[key] = id
+				allPeople = append(allPeople, Person{ID: id, Name: name})
+			}
+			participants = append(participants, id)
+		}
+		bill.Participants = participants
+		out[i] = bill
+	}
+	return allPeople, out, nil
+}
+
+// checkBillPeople 付款人與參與者必須是名單內的成員
+func checkBillPeople(bill Bill, known map[int]bool) error {
+	if len(bill.Payers) == 0 && !known[bill.PaidBy] {
+		return fmt.Errorf("帳單「%s」的付款人 ID %d 不存在", bill.Title, bill.PaidBy)
+	}
+	for _, p := range bill.Payers {
+		if !known[p.PersonID] {
+			return fmt.Errorf("帳單「%s」的付款人 ID %d 不存在", bill.Title, p.PersonID)
+		}
+	}
+	for _, pid := range bill.Participants {
+		if !known[pid] {
+			return fmt.Errorf("帳單「%s」的參與者 ID %d 不存在（臨時參加的朋友請填在 guests）", bill.Title, pid)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 臨時參加者測試
+// ==========================================
+func TestExpandGuests(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{
+		{ID: 1, Title: "Dinner", AmountBase: 400, PaidBy: 1, Participants: []int{1, 2}, Guests: []string{"Dave", "Eve"}},
+		{ID: 2, Title: "Drinks", AmountBase: 300, PaidBy: 2, Participants: []int{2}, Guests: []string{" dave "}},
+	}
+
+	allPeople, expanded, err := expandGuests(people, bills)
+	if err != nil {
+		t.Fatalf("展開失敗: %v", err)
+	}
+	if len(allPeople) != 4 {
+		t.Fatalf("同名臨時參加者應視為同一人, got %+v", allPeople)
+	}
+	if len(bills[0].Participants) != 2 {
+		t.Error("不應修改呼叫端的帳單")
+	}
+
+	// 結算配對順序不固定，改比對每個人的淨額
+	net := map[string]float64{}
+	for _, s := range calculate(allPeople, expanded) {
+		net[s.From] -= s.Amount
+		net[s.To] += s.Amount
+	}
+	want := map[string]float64{"Alice": 300, "Bob": 50, "Dave": -250, "Eve": -100}
+	for name, w := range want {
+		if d := net[name] - w; d > 0.01 || d < -0.01 {
+			t.Errorf("%s 的淨額 got %.2f, want %.2f", name, net[name], w)
+		}
+	}
+
+	tests := []struct {
+		name string
+		bill Bill
+		want string
+	}{
+		{"打錯的參與者 ID", Bill{Title: "Taxi", PaidBy: 1, Participants: []int{1, 3}}, "參與者 ID 3 不存在"},
+		{"打錯的付款人 ID", Bill{Title: "Taxi", PaidBy: 9, Participants: []int{1}}, "付款人 ID 9 不存在"},
+		{"與成員同名", Bill{Title: "Taxi", PaidBy: 1, Participants: []int{1}, Guests: []string{"bob"}}, "與成員同名"},
+		{"空白名字", Bill{Title: "Taxi", PaidBy: 1, Participants: []int{1}, Guests: []string{" "}}, "不能是空白"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := expandGuests(people, []Bill{tt.bill})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("錯誤訊息應包含 %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
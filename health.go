@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ================= 健康檢查（/healthz、/readyz） =================
+
+// readyRateTimeout 就緒檢查在快取沒有可用匯率時，向匯率 API 試抓的時間上限
+const readyRateTimeout = 3 * time.Second
+
+// ReadyResponse GET /readyz 的回應；Checks 為各項檢查的結果，"ok" 代表通過，否則為失敗原因
+type ReadyResponse struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// handleHealthz GET /healthz：行程還活著就回 200，不檢查任何相依的服務
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// handleReadyz GET /readyz：狀態可以讀取，且匯率快取中有未過期的匯率或匯率 API 連得上時回 200，否則回 503
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	resp := ReadyResponse{Status: "ok", Checks: map[string]string{}}
+	fail := func(check string, err error) {
+		resp.Status = "unavailable"
+		resp.Checks[check] = err.Error()
+	}
+
+	state, err := currentState()
+	if err != nil {
+		log.Printf("readyz: load state failed: %v", err)
+		fail("state", err)
+	} else {
+		resp.Checks["state"] = "ok"
+	}
+
+	if err := checkRatesReady(r.Context(), strings.ToLower(stateBase(state))); err != nil {
+		fail("rates", err)
+	} else {
+		resp.Checks["rates"] = "ok"
+	}
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, resp)
+}
+
+// checkRatesReady 快取中有任何本位幣的最新匯率還沒過期就算就緒（歷史匯率不算）；
+// 否則試抓 baseLower 的匯率，成功時存進快取，之後的檢查不必再連網
+func checkRatesReady(ctx context.Context, baseLower string) error {
+	now := clock.Now()
+	for key, e := range rateCache.entries() {
+		if !strings.Contains(key, "@") && e.fresh(now) {
+			return nil
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, readyRateTimeout)
+	defer cancel()
+	_, err := fetchRates(ctx, baseLower)
+	return err
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 健康檢查測試
+// ==========================================
+func TestHealthz(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newServerRouter().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("healthz = %d, want 200", rec.Code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	fetcher := &countingFetcher{err: errors.New("HTTP 503")}
+	useRateFetcher(t, fetcher)
+	ready := func() (int, ReadyResponse) {
+		rec := httptest.NewRecorder()
+		handleReadyz(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		var resp ReadyResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// 沒有快取、匯率 API 也連不上
+	if code, resp := ready(); code != http.StatusServiceUnavailable || resp.Checks["state"] != "ok" || resp.Checks["rates"] == "ok" {
+		t.Errorf("匯率無法取得時應回 503, got %d %+v", code, resp)
+	}
+
+	// 只有歷史匯率不算
+	rateCache.Set("twd@2026-05-01", rateEntry{Rates: map[string]float64{"usd": 0.03}, FetchedAt: time.Now()})
+	if code, _ := ready(); code != http.StatusServiceUnavailable {
+		t.Errorf("只有歷史匯率時應回 503, got %d", code)
+	}
+
+	// 匯率 API 恢復：試抓成功並存進快取，之後不必再連網
+	fetcher.err = nil
+	if code, resp := ready(); code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("匯率 API 連得上時應回 200, got %d %+v", code, resp)
+	}
+	calls := fetcher.calls
+	if code, _ := ready(); code != http.StatusOK || fetcher.calls != calls {
+		t.Errorf("快取有效時不應再連網, got %d (calls %d → %d)", code, calls, fetcher.calls)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ================= 依帳單日期的歷史匯率 =================
+
+// historicalRates 取得有日期的外幣帳單在當天的匯率，依（本位幣, 日期）快取，歷史匯率不會再變所以不過期。
+// 今天（含）以後的帳單、手動匯率的帳單不需要；某一天抓不到時（例如沒有網路）或斷路器開啟時
+// 其他日期也不再嘗試，這些帳單改用最新匯率。cacheOnly 時只用快取中的歷史匯率
+func historicalRates(ctx context.Context, baseLower string, bills []Bill, now time.Time, cacheOnly bool) map[string]rateEntry {
+	today := now.Format(billDateLayout)
+	dates := make(map[string]bool)
+	for _, bill := range bills {
+		cur := strings.ToLower(strings.TrimSpace(bill.Currency))
+		if cur == "" || cur == baseLower || bill.ManualRate > 0 || bill.Date == "" || bill.Date >= today {
+			continue
+		}
+		if _, err := time.Parse(billDateLayout, bill.Date); err == nil {
+			dates[bill.Date] = true
+		}
+	}
+
+	history := make(map[string]rateEntry, len(dates))
+	failed := false
+	for _, date := range slices.Sorted(maps.Keys(dates)) {
+		if e, ok := rateCache.Get(baseLower + "@" + date); ok {
+			history[date] = e
+			continue
+		}
+		if failed || cacheOnly {
+			continue
+		}
+		e, err := datedRates(ctx, baseLower, date)
+		if err != nil {
+			failed = true
+			continue
+		}
+		history[date] = e
+	}
+	return history
+}
+
+// validateRateDate 請求指定的匯率日期須為 YYYY-MM-DD，且不晚於今天
+func validateRateDate(date string, now time.Time) error {
+	if date == "" {
+		return nil
+	}
+	if _, err := time.Parse(billDateLayout, date); err != nil {
+		return fmt.Errorf("匯率日期 %q 格式錯誤，應為 YYYY-MM-DD", date)
+	}
+	if date > now.Format(billDateLayout) {
+		return fmt.Errorf("匯率日期 %s 還沒到", date)
+	}
+	return nil
+}
+
+// cachedDatedRates 同 datedRates，但只查快取，不連網
+func cachedDatedRates(_ context.Context, baseLower, date string) (rateEntry, error) {
+	if e, ok := rateCache.Get(baseLower + "@" + date); ok {
+		return e, nil
+	}
+	return rateEntry{}, errRatesUnavailable
+}
+
+// datedRates 取得 baseLower 在 date 當天的匯率，依 "本位幣@日期" 快取
+func datedRates(ctx context.Context, baseLower, date string) (rateEntry, error) {
+	key := baseLower + "@" + date
+	if e, ok := rateCache.Get(key); ok {
+		return e, nil
+	}
+	fetcher, ok := rateFetcher.(DatedRateFetcher)
+	if !ok {
+		return rateEntry{}, errNoHistoricalRates
+	}
+	if !rateBreaker.allow() {
+		rateStats.circuitRejected.Add(1)
+		return rateEntry{}, errRateCircuitOpen
+	}
+	rateStats.fetches.Add(1)
+	e, err := fetcher.FetchDate(ctx, baseLower, date)
+	if err != nil {
+		if ctx.Err() == nil {
+			rateBreaker.failure()
+			rateStats.recordFailure(err, clock.Now())
+		}
+		return rateEntry{}, err
+	}
+	rateBreaker.success()
+	e.FetchedAt = clock.Now()
+	rateCache.Set(key, e)
+	return e, nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// datedFetcher 依日期回傳不同的 USD 匯率，並記錄被呼叫的次數
+type datedFetcher struct {
+	rates map[string]float64
+	calls int
+}
+
+func (f *datedFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	return rateEntry{Rates: map[string]float64{"usd": 0.03}, Date: "latest"}, nil
+}
+
+func (f *datedFetcher) FetchDate(ctx context.Context, base, date string) (rateEntry, error) {
+	f.calls++
+	rate, ok := f.rates[date]
+	if !ok {
+		return rateEntry{}, errors.New("not found")
+	}
+	return rateEntry{Rates: map[string]float64{"usd": rate}, Date: date}, nil
+}
+
+// ==========================================
+// 歷史匯率測試
+// ==========================================
+func TestConvertBillsToBase_HistoricalRates(t *testing.T) {
+	fetcher := &datedFetcher{rates: map[string]float64{"2026-03-01": 0.04, "2026-03-02": 0.025}}
+	useRateFetcher(t, fetcher)
+
+	today := time.Now().Format(billDateLayout)
+	bills := []Bill{
+		{ID: 1, Title: "Day 1", Date: "2026-03-01", Amount: 10, Currency: "USD"},
+		{ID: 2, Title: "Day 2", Date: "2026-03-02", Amount: 10, Currency: "USD"},
+		{ID: 3, Title: "Day 2 again", Date: "2026-03-02", Amount: 20, Currency: "USD"},
+	}
+	converted, rates, date, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []float64{250, 400, 800} {
+		if converted[i].AmountBase != want || rates[i].Source != rateSourceHistorical {
+			t.Errorf("bill %d: %v (%s), want %v historical", i+1, converted[i].AmountBase, rates[i].Source, want)
+		}
+	}
+	if date != "2026-03-02" || fetcher.calls != 2 {
+		t.Errorf("date = %q, calls = %d, want 2026-03-02 and one call per date", date, fetcher.calls)
+	}
+
+	// 同一天再算一次直接用快取
+	if _, _, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{}); err != nil || fetcher.calls != 2 {
+		t.Errorf("應使用快取, calls = %d, err = %v", fetcher.calls, err)
+	}
+
+	// 今天的帳單與抓不到歷史匯率的日期改用最新匯率
+	more := []Bill{
+		{ID: 4, Title: "Today", Date: today, Amount: 3, Currency: "USD"},
+		{ID: 5, Title: "Missing", Date: "2026-01-01", Amount: 3, Currency: "USD"},
+		bills[0],
+	}
+	converted, rates, date, err = convertBillsWithRates(context.Background(), "TWD", more, conversionOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted[0].AmountBase != 100 || converted[1].AmountBase != 100 || rates[1].Source != rateSourceMarket {
+		t.Errorf("got %+v %+v", converted, rates)
+	}
+	if converted[2].AmountBase != 250 || date != "latest" {
+		t.Errorf("已快取的日期仍用歷史匯率, got %v, date %q", converted[2].AmountBase, date)
+	}
+}
+
+func TestRunCalculate_RateDate(t *testing.T) {
+	fetcher := &datedFetcher{rates: map[string]float64{"2025-05-01": 0.032, "2026-03-01": 0.04}}
+	useRateFetcher(t, fetcher)
+
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Date: "2026-03-01", Amount: 32, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Taxi", Amount: 10, Currency: "EUR", ManualRate: 35, PaidBy: 2, Participants: []int{1, 2}},
+		{ID: 3, Title: "Dinner", Amount: 500, PaidBy: 2, Participants: []int{1, 2}},
+	}
+	// 指定日期時連帳單當天的匯率也改用那一天的：32 USD ÷ 0.032 = 1000 TWD；手動匯率不受影響
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, RateDate: "2025-05-01"})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp.Bills[0].AmountBase != 1000 || resp.Bills[1].AmountBase != 350 || resp.RateDate != "2025-05-01" {
+		t.Errorf("bills = %+v, rateDate = %q", resp.Bills, resp.RateDate)
+	}
+	want := []AppliedRate{
+		{BillID: 1, Currency: "USD", Rate: 31.25, RateSource: rateSourceHistorical, RateDate: "2025-05-01"},
+		{BillID: 2, Currency: "EUR", Rate: 35, RateSource: rateSourceManual},
+	}
+	if !sameJSON(resp.Rates, want) {
+		t.Errorf("rates = %+v, want %+v", resp.Rates, want)
+	}
+	if _, ok := rateCache.Get("twd@2025-05-01"); !ok || fetcher.calls != 1 {
+		t.Errorf("指定日期的匯率應分開快取, calls = %d", fetcher.calls)
+	}
+
+	// 抓不到那一天的匯率時回報錯誤，不悄悄改用其他匯率
+	resp = runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, RateDate: "2024-01-01"})
+	if !strings.Contains(resp.Error, "2024-01-01") {
+		t.Errorf("error = %q", resp.Error)
+	}
+
+	tomorrow := time.Now().AddDate(0, 0, 1).Format(billDateLayout)
+	for _, date := range []string{"2025/05/01", tomorrow} {
+		if resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, RateDate: date}); resp.Error == "" {
+			t.Errorf("rateDate %q 應該失敗", date)
+		}
+	}
+}
+
+func TestDatedRates_Unsupported(t *testing.T) {
+	useRateFetcher(t, &countingFetcher{})
+	if _, err := datedRates(context.Background(), "twd", "2025-05-01"); !errors.Is(err, errNoHistoricalRates) {
+		t.Errorf("err = %v, want errNoHistoricalRates", err)
+	}
+}
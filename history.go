@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// ================= 帳單版本紀錄 =================
+
+// maxBillHistory 每張帳單保留的舊版本數量，更早的版本無法再逐欄位合併
+const maxBillHistory = 20
+
+// billMetaFields 由伺服器填寫或透過專屬 API 管理的欄位，逐欄位合併時不比較
+var billMetaFields = map[string]bool{
+	"id": true, "amountBase": true, "attachments": true, "comments": true, "locked": true,
+	"deletedAt": true, "revision": true, "updatedAt": true, "updatedBy": true, "version": true,
+}
+
+// recordBillHistory 這次有變動的帳單把變動前的版本附加到 history 後寫回 s.BillHistory；
+// 已從垃圾桶永久刪除的帳單不再保留舊版本，每張帳單只留最近 maxBillHistory 版
+func recordBillHistory(s *GlobalState, history, before []Bill) {
+	prev := make(map[int]Bill, len(before))
+	for _, b := range before {
+		prev[b.ID] = b
+	}
+	exists := make(map[int]bool, len(s.Bills))
+	for _, b := range s.Bills {
+		exists[b.ID] = true
+	}
+	out := make([]Bill, 0, len(history)+1)
+	for _, h := range history {
+		if exists[h.ID] {
+			out = append(out, h)
+		}
+	}
+	for _, b := range s.Bills {
+		if old, ok := prev[b.ID]; ok && old.Version != b.Version {
+			// 留言與收據不隨版本保存
+			old.Comments, old.Attachments = nil, nil
+			out = append(out, old)
+		}
+	}
+
+	kept := make(map[int]int, len(exists))
+	trimmed := out[:0:0]
+	for i := len(out) - 1; i >= 0; i-- {
+		if kept[out[i].ID] < maxBillHistory {
+			kept[out[i].ID]++
+			trimmed = append(trimmed, out[i])
+		}
+	}
+	slices.Reverse(trimmed)
+	if len(trimmed) == 0 {
+		trimmed = nil
+	}
+	s.BillHistory = trimmed
+}
+
+// billHistoryOf 查詢 s 中某張帳單的某一個舊版本
+func billHistoryOf(s GlobalState) func(id, version int) (Bill, bool) {
+	return func(id, version int) (Bill, bool) {
+		for _, h := range s.BillHistory {
+			if h.ID == id && h.Version == version {
+				return h, true
+			}
+		}
+		return Bill{}, false
+	}
+}
+
+// mergeBillFields 三方合併：與共同的舊版本 base 比較，只有一方改的欄位採用該方的值，
+// 兩方改成不同值的欄位依編輯時間（相同時比較裝置 ID）擇一，並回傳這些欄位的名稱（JSON 欄位名）
+func mergeBillFields(base, cur, in Bill) (Bill, []string) {
+	fields := func(b Bill) map[string]json.RawMessage {
+		var m map[string]json.RawMessage
+		data, _ := json.Marshal(b)
+		json.Unmarshal(data, &m)
+		return m
+	}
+	bm, cm, im := fields(base), fields(cur), fields(in)
+	inWins := lwwNewer(syncMeta{updatedAt: in.UpdatedAt, updatedBy: in.UpdatedBy}, syncMeta{updatedAt: cur.UpdatedAt, updatedBy: cur.UpdatedBy})
+	keys := maps.Clone(bm)
+	maps.Copy(keys, cm)
+	maps.Copy(keys, im)
+
+	var conflicts []string
+	for _, key := range slices.Sorted(maps.Keys(keys)) {
+		if billMetaFields[key] {
+			continue
+		}
+		b, c, i := bm[key], cm[key], im[key]
+		switch {
+		case bytes.Equal(i, b) || bytes.Equal(i, c):
+			continue
+		case !bytes.Equal(c, b):
+			conflicts = append(conflicts, key)
+			if !inWins {
+				continue
+			}
+		}
+		if i == nil {
+			delete(cm, key)
+		} else {
+			cm[key] = i
+		}
+	}
+
+	var merged Bill
+	data, _ := json.Marshal(cm)
+	json.Unmarshal(data, &merged)
+	// 換算後的金額跟著金額、幣別與手動匯率走，三者都不是同一方時交給下次計算
+	switch {
+	case merged.Amount == cur.Amount && merged.Currency == cur.Currency && merged.ManualRate == cur.ManualRate:
+	case merged.Amount == in.Amount && merged.Currency == in.Currency && merged.ManualRate == in.ManualRate:
+		merged.AmountBase = in.AmountBase
+	default:
+		merged.AmountBase = 0
+	}
+	merged.UpdatedAt = max(cur.UpdatedAt, in.UpdatedAt)
+	return merged, conflicts
+}
+
+// handleBillHistory GET /api/bills/{id}/history 帳單的各個版本，由新到舊；第一筆是目前的版本（刪除後仍可查詢），
+// 每一版都帶著版本號（version）、編輯時間（updatedAt）與編輯的裝置（updatedBy）
+func handleBillHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	billID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid bill id")
+		return
+	}
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		log.Printf("load state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	var versions []Bill
+	for _, b := range state.Bills {
+		if b.ID == billID {
+			versions = append(versions, b)
+		}
+	}
+	if len(versions) == 0 {
+		writeError(w, http.StatusNotFound, "bill not found")
+		return
+	}
+	for i := len(state.BillHistory) - 1; i >= 0; i-- {
+		if h := state.BillHistory[i]; h.ID == billID {
+			versions = append(versions, h)
+		}
+	}
+	writeJSON(w, http.StatusOK, versions)
+}
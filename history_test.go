@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 帳單版本紀錄測試
+// ==========================================
+func TestBillHistory_ConcurrentEdits(t *testing.T) {
+	reg := useRooms(t)
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	rm, _ := reg.create()
+	handler := withDevice(newServerRouter())
+	do := func(method, path, token, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/rooms/"+rm.code+path, strings.NewReader(body))
+		req.Header.Set(deviceTokenHeader, strings.Repeat(token, deviceTokenLength))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	people := `"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]`
+	hotel := func(fields string) string {
+		return `{` + people + `,"bills":[{"id":1,"title":"Hotel","amount":300,"paidBy":1,"participants":[1,2]` + fields + `}]}`
+	}
+	if rec := do(http.MethodPost, "/sync", "a", `"0"`, hotel("")); rec.Code != http.StatusOK {
+		t.Fatalf("同步失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 手機 A 依據第 1 版改了分類；手機 B 也依據第 1 版改了金額，兩邊的修改都應保留
+	fc.Advance(time.Minute)
+	do(http.MethodPost, "/sync", "a", `"1"`, hotel(`,"category":"住宿","version":1`))
+	fc.Advance(time.Minute)
+	rec := do(http.MethodPost, "/sync", "b", `"1"`, strings.Replace(hotel(`,"version":1`), `"amount":300`, `"amount":500`, 1))
+	var resp SyncResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if rec.Code != http.StatusOK || len(resp.Conflicts) != 1 || resp.Conflicts[0].Resolution != resolutionMerged || len(resp.Conflicts[0].Fields) != 0 {
+		t.Fatalf("應逐欄位合併且沒有衝突的欄位: %d %s", rec.Code, rec.Body.String())
+	}
+	if b := resp.Bills[0]; b.Category != "住宿" || b.Amount != 500 || b.Version != 3 || b.UpdatedBy != deviceID(strings.Repeat("b", deviceTokenLength)) {
+		t.Errorf("合併後的帳單 = %+v", b)
+	}
+
+	// 離線的手機 C 依據第 2 版也改了金額：同一個欄位兩邊都改，採用編輯時間較新的並標示出來
+	fc.Advance(time.Minute)
+	rec = do(http.MethodPost, "/crdt", "c", "", `{"bills":[{"id":1,"title":"Hotel","amount":450,"category":"住宿","paidBy":1,"participants":[1],"version":2,"updatedAt":`+jsonInt(fc.Now().Add(-90*time.Second).UnixMilli())+`}]}`)
+	var delta CRDTState
+	json.Unmarshal(rec.Body.Bytes(), &delta)
+	if rec.Code != http.StatusOK || len(delta.Conflicts) != 1 || strings.Join(delta.Conflicts[0].Fields, ",") != "amount" {
+		t.Fatalf("兩邊都改的欄位應列出: %d %s", rec.Code, rec.Body.String())
+	}
+	state, _ := rm.currentState()
+	if b := state.Bills[0]; b.Amount != 500 || len(b.Participants) != 1 || b.Version != 4 {
+		t.Errorf("金額應保留較新的 500、參與者採用 C 的修改, got %+v", b)
+	}
+
+	// 版本紀錄由新到舊，不隨同步送給客戶端
+	var versions []Bill
+	rec = do(http.MethodGet, "/bills/1/history", "a", "", "")
+	json.Unmarshal(rec.Body.Bytes(), &versions)
+	var got []int
+	for _, v := range versions {
+		got = append(got, v.Version)
+	}
+	if rec.Code != http.StatusOK || len(got) != 4 || got[0] != 4 || got[3] != 1 || versions[2].Category != "住宿" {
+		t.Errorf("版本紀錄 = %v %s", got, rec.Body.String())
+	}
+	if strings.Contains(do(http.MethodGet, "/sync", "a", "", "").Body.String(), "billHistory") {
+		t.Error("版本紀錄不應隨同步下發")
+	}
+	if rec := do(http.MethodGet, "/bills/9/history", "a", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的帳單應回 404, got %d", rec.Code)
+	}
+}
+
+func TestRecordBillHistory_Limit(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	for i := 1; i <= maxBillHistory+5; i++ {
+		updateState(func(s *GlobalState) error {
+			s.People = []Person{{ID: 1, Name: "Alice"}}
+			s.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: float64(i), PaidBy: 1, Participants: []int{1}}}
+			return nil
+		})
+	}
+	state, _ := currentState()
+	if len(state.BillHistory) != maxBillHistory || state.BillHistory[0].Version != 5 || state.Bills[0].Version != maxBillHistory+5 {
+		t.Errorf("只保留最近 %d 版, got %d 版，最舊為第 %d 版", maxBillHistory, len(state.BillHistory), state.BillHistory[0].Version)
+	}
+
+	// 從垃圾桶永久刪除後不再保留
+	updateState(func(s *GlobalState) error {
+		s.Bills = nil
+		return nil
+	})
+	if state, _ := currentState(); state.BillHistory != nil {
+		t.Errorf("帳單不存在時應清掉版本紀錄, got %d 版", len(state.BillHistory))
+	}
+}
+
+func TestMergeBillFields(t *testing.T) {
+	base := Bill{ID: 1, Title: "Dinner", Amount: 300, Currency: "JPY", Tags: []string{"拉麵"}, PaidBy: 1, Participants: []int{1, 2}}
+	cur, in := base, base
+	cur.Amount, cur.AmountBase, cur.UpdatedAt = 350, 70, 2000
+	in.Tags, in.Title, in.UpdatedAt = nil, "Ramen", 1000
+
+	merged, fields := mergeBillFields(base, cur, in)
+	if merged.Amount != 350 || merged.Title != "Ramen" || merged.Tags != nil || len(fields) != 0 {
+		t.Errorf("只有一方改的欄位應各自保留, got %+v %v", merged, fields)
+	}
+	if merged.AmountBase != 70 || merged.UpdatedAt != 2000 {
+		t.Errorf("換算金額應跟著伺服器的金額, got %+v", merged)
+	}
+
+	in.Amount = 400
+	if merged, fields := mergeBillFields(base, cur, in); merged.Amount != 350 || strings.Join(fields, ",") != "amount" {
+		t.Errorf("兩邊都改的欄位應採用較新的, got %v %v", merged.Amount, fields)
+	}
+}
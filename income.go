@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// ================= 依收入比例分攤 =================
+
+// personWeight 成員的收入比例，未設定時算 1；臨時參加者也算 1
+func personWeight(weights map[int]float64, pid int) float64 {
+	if w, ok := weights[pid]; ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+// applyIncomeWeights 把 SplitMode 為 "income" 的帳單換成以成員 Weight 為份數的 Shares，
+// 之後就和一般依份數分攤的帳單一樣計算
+func applyIncomeWeights(people []Person, bills []Bill) ([]Bill, error) {
+	weights := make(map[int]float64, len(people))
+	for _, p := range people {
+		if p.Weight < 0 || math.IsNaN(p.Weight) || math.IsInf(p.Weight, 0) {
+			return nil, fmt.Errorf("成員「%s」的收入比例必須是非負數", p.Name)
+		}
+		weights[p.ID] = p.Weight
+	}
+
+	out := make([]Bill, len(bills))
+	for i, bill := range bills {
+		switch bill.SplitMode {
+		case "":
+		case splitModeIncome:
+			if bill.isTransfer() {
+				return nil, fmt.Errorf("還款「%s」不能依收入比例分攤", bill.Title)
+			}
+			if len(bill.Shares) > 0 || len(bill.ExactAmounts) > 0 || len(bill.LineItems) > 0 {
+				return nil, fmt.Errorf("帳單「%s」依收入比例分攤時不能再指定份數、金額或品項", bill.Title)
+			}
+			bill.Shares = make(map[int]float64, len(bill.Participants))
+			for _, pid := range bill.Participants {
+				bill.Shares[pid] = personWeight(weights, pid)
+			}
+		default:
+			return nil, fmt.Errorf("帳單「%s」的分攤方式 %q 不支援", bill.Title, bill.SplitMode)
+		}
+		out[i] = bill
+	}
+	return out, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 依收入比例分攤測試
+// ==========================================
+func TestProcessCalculate_IncomeSplit(t *testing.T) {
+	// Alice 收入是 Bob 的兩倍；Charlie 沒有設定，算 1
+	people := []Person{{ID: 1, Name: "Alice", Weight: 2}, {ID: 2, Name: "Bob", Weight: 1}, {ID: 3, Name: "Charlie"}}
+	calc := func(bills []Bill) CalculateResponse {
+		t.Helper()
+		data, _ := json.Marshal(CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills})
+		var resp CalculateResponse
+		if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 房租 12000 由 Alice 付，依 2:1:1 分攤
+	resp := calc([]Bill{{ID: 1, Title: "Rent", Amount: 12000, Currency: "TWD", PaidBy: 1, Participants: []int{1, 2, 3}, SplitMode: splitModeIncome}})
+	want := []Settlement{{From: "Bob", To: "Alice", Amount: 3000}, {From: "Charlie", To: "Alice", Amount: 3000}}
+	if resp.Error != "" || !sameJSON(resp.Settlements, want) {
+		t.Errorf("got %+v (%s), want %+v", resp.Settlements, resp.Error, want)
+	}
+
+	// 只有 Alice、Bob 參與時依 2:1
+	resp = calc([]Bill{{ID: 1, Title: "Utilities", Amount: 900, Currency: "TWD", PaidBy: 2, Participants: []int{1, 2}, SplitMode: splitModeIncome}})
+	if want := []Settlement{{From: "Alice", To: "Bob", Amount: 600}}; !sameJSON(resp.Settlements, want) {
+		t.Errorf("got %+v, want %+v", resp.Settlements, want)
+	}
+
+	bad := []Bill{{ID: 1, Title: "Rent", Amount: 100, Currency: "TWD", PaidBy: 1, Participants: []int{1, 2}, SplitMode: splitModeIncome, Shares: map[int]float64{1: 3}}}
+	if resp := calc(bad); !strings.Contains(resp.Error, "收入比例") {
+		t.Errorf("同時指定份數應報錯, got %q", resp.Error)
+	}
+	bad[0].Shares, bad[0].SplitMode = nil, "salary"
+	if resp := calc(bad); resp.Error == "" || len(resp.Errors) != 1 || resp.Errors[0].Field != "bills[0].splitMode" {
+		t.Errorf("不支援的分攤方式應報錯, got %+v", resp)
+	}
+}
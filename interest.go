@@ -0,0 +1,188 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"time"
+)
+
+// ================= 逾期利息 =================
+
+// InterestOptions 欠款超過 GraceDays 天還沒還清的部分，依年利率 AnnualRate（%）計算單利，算到 AsOf（預設今天）為止
+type InterestOptions struct {
+	AnnualRate float64 `json:"annualRate"`
+	GraceDays  int     `json:"graceDays,omitempty"`
+	AsOf       string  `json:"asOf,omitempty"`
+}
+
+// InterestEntry 某人在某張帳單的欠款（Principal）逾期 Days 天累積的利息，金額皆為本位幣
+type InterestEntry struct {
+	BillID    int     `json:"billId"`
+	Bill      string  `json:"bill"`
+	Person    string  `json:"person"`
+	Principal float64 `json:"principal"`
+	Days      int     `json:"days"`
+	Amount    float64 `json:"amount"`
+}
+
+func validateInterest(opts InterestOptions) (time.Time, error) {
+	if opts.AnnualRate < 0 || math.IsNaN(opts.AnnualRate) || math.IsInf(opts.AnnualRate, 0) {
+		return time.Time{}, fmt.Errorf("年利率 %v 無效", opts.AnnualRate)
+	}
+	if opts.GraceDays < 0 {
+		return time.Time{}, fmt.Errorf("寬限天數不能是負數")
+	}
+	if opts.AsOf == "" {
+		return clock.Now().UTC().Truncate(24 * time.Hour), nil
+	}
+	asOf, err := time.Parse(billDateLayout, opts.AsOf)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("計息日期格式錯誤 %q，請使用 YYYY-MM-DD", opts.AsOf)
+	}
+	return asOf, nil
+}
+
+// debtChunk 某張帳單讓某人欠下、還沒被抵銷的金額
+type debtChunk struct {
+	bill   Bill
+	date   time.Time
+	amount Money
+}
+
+// accrueInterest 依帳單日期計算逾期利息。每個人的欠款依日期排隊，之後應收的款項（別人替他付的、
+// 他還的錢）先抵銷最早的欠款；每筆欠款從帳單日期加上寬限天數起算，到被抵銷或 AsOf 為止。
+// 每個人的利息再依最後應收金額的比例付給其他債權人。
+// 回傳代表利息的還款帳單（只在計算時使用）與逐筆明細；沒有日期的帳單不計息
+func accrueInterest(people []Person, bills []Bill, base, remainder string, opts InterestOptions) ([]Bill, []InterestEntry, error) {
+	asOf, err := validateInterest(opts)
+	if err != nil || opts.AnnualRate == 0 {
+		return nil, nil, err
+	}
+	perDay := opts.AnnualRate / 100 / 365
+
+	nameMap := make(map[int]string, len(people))
+	for _, p := range people {
+		nameMap[p.ID] = p.Name
+	}
+	dated := make([]Bill, 0, len(bills))
+	for _, bill := range bills {
+		if bill.Date != "" {
+			dated = append(dated, bill)
+		}
+	}
+	slices.SortStableFunc(dated, func(a, b Bill) int { return cmp.Compare(a.Date, b.Date) })
+
+	open := map[int][]debtChunk{}
+	credit := map[int]Money{}
+	owes := map[int]Money{}
+	entries := map[int][]InterestEntry{}
+	accrue := func(pid int, c debtChunk, amount Money, end time.Time) {
+		days := int(end.Sub(c.date).Hours()/24) - opts.GraceDays
+		if days <= 0 {
+			return
+		}
+		interest := Money(math.Round(float64(amount) * perDay * float64(days)))
+		if interest == 0 {
+			return
+		}
+		owes[pid] += interest
+		entries[pid] = append(entries[pid], InterestEntry{
+			BillID: c.bill.ID, Bill: c.bill.Title, Person: nameMap[pid],
+			Principal: amount.Float(base), Days: days, Amount: interest.Float(base),
+		})
+	}
+
+	allocator := &remainderAllocator{policy: remainder}
+	for _, bill := range dated {
+		split, ok := allocator.splitBill(bill, base)
+		if !ok {
+			continue
+		}
+		date, err := time.Parse(billDateLayout, bill.Date)
+		if err != nil {
+			return nil, nil, fmt.Errorf("帳單「%s」的日期 %q 格式錯誤", bill.Title, bill.Date)
+		}
+		net := maps.Clone(split.paid)
+		for pid, amt := range split.owed {
+			net[pid] -= amt
+		}
+		for _, pid := range slices.Sorted(maps.Keys(net)) {
+			switch amt := net[pid]; {
+			case amt < 0:
+				debt := -amt
+				use := min(debt, credit[pid])
+				credit[pid] -= use
+				if debt -= use; debt > 0 {
+					open[pid] = append(open[pid], debtChunk{bill: bill, date: date, amount: debt})
+				}
+			case amt > 0:
+				for amt > 0 && len(open[pid]) > 0 {
+					c := &open[pid][0]
+					take := min(amt, c.amount)
+					accrue(pid, *c, take, date)
+					c.amount -= take
+					amt -= take
+					if c.amount == 0 {
+						open[pid] = open[pid][1:]
+					}
+				}
+				credit[pid] += amt
+			}
+		}
+	}
+	for _, pid := range slices.Sorted(maps.Keys(open)) {
+		for _, c := range open[pid] {
+			accrue(pid, c, c.amount, asOf)
+		}
+	}
+
+	// 利息付給最後仍應收的人，依應收金額的比例
+	balance, _, _ := computeBalances(people, bills, base, remainder)
+	var interestBills []Bill
+	var out []InterestEntry
+	for _, debtor := range slices.Sorted(maps.Keys(owes)) {
+		var credit Money
+		for pid, amt := range balance {
+			if pid != debtor && amt > 0 {
+				credit += amt
+			}
+		}
+		if credit == 0 {
+			continue
+		}
+		shares := make(map[int]float64)
+		for pid, amt := range balance {
+			if pid != debtor && amt > 0 {
+				shares[pid] = owes[debtor].Float(base) * float64(amt) / float64(credit)
+			}
+		}
+		portions := allocate(owes[debtor], shares, base)
+		for _, creditor := range slices.Sorted(maps.Keys(portions)) {
+			if portions[creditor] == 0 {
+				continue
+			}
+			amt := portions[creditor].Float(base)
+			interestBills = append(interestBills, Bill{
+				Type:         billTypeTransfer,
+				Title:        "利息",
+				Amount:       amt,
+				AmountBase:   amt,
+				PaidBy:       creditor,
+				Participants: []int{debtor},
+			})
+		}
+		out = append(out, entries[debtor]...)
+	}
+	return interestBills, out, nil
+}
+
+func interestTotal(entries []InterestEntry, base string) float64 {
+	var total Money
+	for _, e := range entries {
+		total += toMoney(e.Amount, base)
+	}
+	return total.Float(base)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 逾期利息測試
+// ==========================================
+func TestProcessCalculate_Interest(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	dinner := Bill{ID: 1, Title: "Dinner", Date: "2026-01-01", Amount: 1000, Currency: "TWD", PaidBy: 1, Participants: []int{2}}
+	calc := func(bills []Bill, opts *InterestOptions) CalculateResponse {
+		t.Helper()
+		data, _ := json.Marshal(CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, Interest: opts})
+		var resp CalculateResponse
+		if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	opts := &InterestOptions{AnnualRate: 36.5, GraceDays: 10, AsOf: "2026-01-31"}
+
+	// 寬限 10 天後逾期 20 天：1000 × 0.1% × 20 = 20
+	resp := calc([]Bill{dinner}, opts)
+	if want := []Settlement{{From: "Bob", To: "Alice", Amount: 1020}}; resp.Error != "" || !sameJSON(resp.Settlements, want) {
+		t.Errorf("got %+v (%s), want %+v", resp.Settlements, resp.Error, want)
+	}
+	wantEntries := []InterestEntry{{BillID: 1, Bill: "Dinner", Person: "Bob", Principal: 1000, Days: 20, Amount: 20}}
+	if !sameJSON(resp.Interest, wantEntries) || resp.InterestTotal != 20 {
+		t.Errorf("interest = %+v (total %v), want %+v", resp.Interest, resp.InterestTotal, wantEntries)
+	}
+
+	// 第 21 天還了 600：600 只算到還款日（10 天 = 6），剩下 400 算滿 20 天（8）
+	repay := Bill{ID: 2, Type: billTypeTransfer, Title: "Bob 還給 Alice", Date: "2026-01-21", Amount: 600, Currency: "TWD", PaidBy: 2, Participants: []int{1}}
+	resp = calc([]Bill{dinner, repay}, opts)
+	if want := []Settlement{{From: "Bob", To: "Alice", Amount: 414}}; resp.Error != "" || !sameJSON(resp.Settlements, want) {
+		t.Errorf("got %+v (%s), want %+v", resp.Settlements, resp.Error, want)
+	}
+	if resp.InterestTotal != 14 || len(resp.Interest) != 2 {
+		t.Errorf("interest = %+v (total %v), want 6 + 8", resp.Interest, resp.InterestTotal)
+	}
+
+	// 寬限期內還清不計息
+	repay.Date, repay.Amount = "2026-01-05", 1000
+	if resp := calc([]Bill{dinner, repay}, opts); len(resp.Settlements) != 0 || len(resp.Interest) != 0 {
+		t.Errorf("寬限期內還清不應計息, got %+v", resp)
+	}
+
+	// 沒有日期的帳單不計息；年利率 0 等同關閉
+	undated := dinner
+	undated.Date = ""
+	if resp := calc([]Bill{undated}, opts); len(resp.Interest) != 0 || resp.Settlements[0].Amount != 1000 {
+		t.Errorf("沒有日期的帳單不應計息, got %+v", resp)
+	}
+	if resp := calc([]Bill{dinner}, &InterestOptions{AsOf: "2026-12-31"}); len(resp.Interest) != 0 {
+		t.Errorf("年利率 0 不應計息, got %+v", resp.Interest)
+	}
+
+	for _, bad := range []InterestOptions{{AnnualRate: -1}, {AnnualRate: 5, GraceDays: -1}, {AnnualRate: 5, AsOf: "2026/01/31"}} {
+		if resp := calc([]Bill{dinner}, &bad); resp.Error == "" {
+			t.Errorf("%+v 應報錯", bad)
+		}
+	}
+	if resp := calc([]Bill{dinner}, &InterestOptions{AnnualRate: -1}); !strings.Contains(resp.Error, "年利率") {
+		t.Errorf("got %q", resp.Error)
+	}
+}
+
+func TestAccrueInterest_SplitsAmongCreditors(t *testing.T) {
+	// Charlie 欠 Alice 600、欠 Bob 300，利息依 2:1 付給兩人
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Date: "2026-03-01", AmountBase: 600, PaidBy: 1, Participants: []int{3}},
+		{ID: 2, Title: "Taxi", Date: "2026-03-01", AmountBase: 300, PaidBy: 2, Participants: []int{3}},
+	}
+	interestBills, entries, err := accrueInterest(people, bills, "TWD", "", InterestOptions{AnnualRate: 36.5, AsOf: "2026-03-31"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interestTotal(entries, "TWD") != 27 {
+		t.Errorf("total = %v, want 27", interestTotal(entries, "TWD"))
+	}
+	got := map[int]float64{}
+	for _, b := range interestBills {
+		if b.Participants[0] != 3 {
+			t.Errorf("利息應由 Charlie 付, got %+v", b)
+		}
+		got[b.PaidBy] += b.Amount
+	}
+	if got[1] != 18 || got[2] != 9 {
+		t.Errorf("got %v, want Alice 18、Bob 9", got)
+	}
+}
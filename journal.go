@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ================= 狀態變更日誌 (append-only journal) =================
+
+// 每一次 Save 會與上次的狀態比對，把差異逐筆附加到日誌檔（JSON Lines），
+// 啟動時依序重播即可還原狀態，也方便用 grep/tail 追查「誰的修改不見了」
+const (
+	opCheckpoint   = "checkpoint"
+	opMeta         = "meta"
+	opPersonPut    = "person.put"
+	opPersonDelete = "person.delete"
+	opBillPut      = "bill.put"
+	opBillDelete   = "bill.delete"
+	opActivity     = "activity.splice"
+	opSnapshots    = "snapshots.splice"
+	opBillHistory  = "billHistory.splice"
+)
+
+// journalList 只在尾端附加、舊項目只會被刪掉的清單（動態、快照、帳單舊版本）：
+// 不隨 meta 整包記錄，每次只記下刪掉哪些、附加了哪些，日誌才不會隨清單長度平方成長
+type journalList struct {
+	op    string
+	field func(s *GlobalState) any
+}
+
+var journalLists = []journalList{
+	{opActivity, func(s *GlobalState) any { return &s.Activity }},
+	{opSnapshots, func(s *GlobalState) any { return &s.Snapshots }},
+	{opBillHistory, func(s *GlobalState) any { return &s.BillHistory }},
+}
+
+// listSplice 清單的變動：先刪掉舊清單的 Drop 區間（索引，左閉右開），再把 Add 附加到尾端
+type listSplice struct {
+	Drop [][2]int          `json:"drop,omitempty"`
+	Add  []json.RawMessage `json:"add,omitempty"`
+}
+
+// journalCompactAfter 重播時超過這個筆數就改寫成單一 checkpoint
+const journalCompactAfter = 5000
+
+type JournalEntry struct {
+	Seq  int64           `json:"seq"`
+	At   int64           `json:"at"`
+	Op   string          `json:"op"`
+	ID   int             `json:"id,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+type JournalStore struct {
+	mu     sync.Mutex
+	path   string
+	seq    int64
+	last   GlobalState
+	loaded bool
+}
+
+func NewJournalStore(path string) *JournalStore {
+	return &JournalStore{path: path}
+}
+
+func (js *JournalStore) Load() (GlobalState, error) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+	return js.loadLocked()
+}
+
+func (js *JournalStore) loadLocked() (GlobalState, error) {
+	state := newGlobalState()
+	js.seq = 0
+
+	f, err := os.Open(js.path)
+	if errors.Is(err, os.ErrNotExist) {
+		js.last, js.loaded = cloneState(state), true
+		return state, nil
+	}
+	if err != nil {
+		return GlobalState{}, err
+	}
+	defer f.Close()
+
+	// good 是最後一筆完整項目結束的位置；當機時寫了一半的最後一行要截掉，
+	// 否則之後以 O_APPEND 附加的項目會接在那半行後面，下次重播時全部讀不到
+	count := 0
+	var off, good int64
+	torn, unterminated := false, false
+	r := bufio.NewReader(f)
+	for {
+		line, readErr := r.ReadBytes('\n')
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return GlobalState{}, readErr
+		}
+		off += int64(len(line))
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var e JournalEntry
+			if err := json.Unmarshal(trimmed, &e); err != nil {
+				// 只有最後一行可能寫了一半；後面還有內容代表日誌中段損毀，不能默默丟掉
+				if rest, _ := io.ReadAll(r); len(bytes.TrimSpace(rest)) > 0 {
+					return GlobalState{}, fmt.Errorf("日誌 seq %d 之後的項目損毀: %w", js.seq, err)
+				}
+				torn = true
+				break
+			}
+			if err := applyJournalEntry(&state, e); err != nil {
+				return GlobalState{}, fmt.Errorf("重播日誌 seq %d 失敗: %w", e.Seq, err)
+			}
+			js.seq = e.Seq
+			count++
+			unterminated = readErr != nil
+		}
+		good = off
+		if readErr != nil {
+			break
+		}
+	}
+	switch {
+	case torn:
+		if err := os.Truncate(js.path, good); err != nil {
+			return GlobalState{}, err
+		}
+	case unterminated:
+		// 項目完整但少了換行，補上後才能接著附加
+		if err := appendFile(js.path, []byte{'\n'}); err != nil {
+			return GlobalState{}, err
+		}
+	}
+	ensureBillCategories(&state)
+
+	js.last, js.loaded = cloneState(state), true
+	if count > journalCompactAfter {
+		if err := js.compactLocked(state); err != nil {
+			return GlobalState{}, err
+		}
+	}
+	return state, nil
+}
+
+func (js *JournalStore) Save(state GlobalState) error {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	if !js.loaded {
+		if _, err := js.loadLocked(); err != nil {
+			return err
+		}
+	}
+
+	entries, err := diffStates(js.last, state)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	if err := js.appendLocked(entries); err != nil {
+		return err
+	}
+	js.last = cloneState(state)
+	return nil
+}
+
+func (js *JournalStore) appendLocked(entries []JournalEntry) error {
+	var buf bytes.Buffer
+	seq, now := js.seq, clock.Now().UnixMilli()
+	for _, e := range entries {
+		seq++
+		e.Seq, e.At = seq, now
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	if err := appendFile(js.path, buf.Bytes()); err != nil {
+		return err
+	}
+	js.seq = seq
+	return nil
+}
+
+// appendFile 附加 data 並 fsync；寫入失敗時截回原本的長度，不留下半行
+func appendFile(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Truncate(info.Size())
+		return err
+	}
+	return f.Sync()
+}
+
+// compactLocked 將整份日誌改寫成一筆 checkpoint
+func (js *JournalStore) compactLocked(state GlobalState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	js.seq++
+	line, err := json.Marshal(JournalEntry{Seq: js.seq, At: clock.Now().UnixMilli(), Op: opCheckpoint, Data: data})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(js.path, append(line, '\n'), 0o600)
+}
+
+// diffStates 產生把 old 變成 cur 所需的日誌項目
+func diffStates(old, cur GlobalState) ([]JournalEntry, error) {
+	var entries []JournalEntry
+	add := func(op string, id int, v any) error {
+		var data json.RawMessage
+		if v != nil {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			data = b
+		}
+		entries = append(entries, JournalEntry{Op: op, ID: id, Data: data})
+		return nil
+	}
+
+	// 人員、帳單與 journalLists 以外的欄位（幣別、版本等）整包記錄
+	oldMeta, curMeta := old, cur
+	oldMeta.People, oldMeta.Bills, oldMeta.LastUpdated = nil, nil, 0
+	curMeta.People, curMeta.Bills, curMeta.LastUpdated = nil, nil, 0
+	for _, l := range journalLists {
+		for _, m := range []*GlobalState{&oldMeta, &curMeta} {
+			if err := json.Unmarshal([]byte("null"), l.field(m)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if !sameJSON(oldMeta, curMeta) {
+		if err := add(opMeta, 0, curMeta); err != nil {
+			return nil, err
+		}
+	}
+	for _, l := range journalLists {
+		splice, err := diffList(l.field(&old), l.field(&cur))
+		if err != nil {
+			return nil, err
+		}
+		if splice != nil {
+			if err := add(l.op, 0, splice); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	oldPeople := make(map[int]Person, len(old.People))
+	for _, p := range old.People {
+		oldPeople[p.ID] = p
+	}
+	seenPeople := make(map[int]bool, len(cur.People))
+	for _, p := range cur.People {
+		seenPeople[p.ID] = true
+		if prev, ok := oldPeople[p.ID]; !ok || !sameJSON(prev, p) {
+			if err := add(opPersonPut, p.ID, p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, p := range old.People {
+		if !seenPeople[p.ID] {
+			if err := add(opPersonDelete, p.ID, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	oldBills := make(map[int]Bill, len(old.Bills))
+	for _, b := range old.Bills {
+		oldBills[b.ID] = b
+	}
+	seenBills := make(map[int]bool, len(cur.Bills))
+	for _, b := range cur.Bills {
+		seenBills[b.ID] = true
+		if prev, ok := oldBills[b.ID]; !ok || !sameJSON(prev, b) {
+			if err := add(opBillPut, b.ID, b); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, b := range old.Bills {
+		if !seenBills[b.ID] {
+			if err := add(opBillDelete, b.ID, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return entries, nil
+}
+
+// diffList 依序比對新舊清單：舊項目沒出現在新清單的記為刪除，比對完剩下的新項目記為附加；沒有變動時回傳 nil
+func diffList(old, cur any) (*listSplice, error) {
+	a, err := listItems(old)
+	if err != nil {
+		return nil, err
+	}
+	b, err := listItems(cur)
+	if err != nil {
+		return nil, err
+	}
+	var splice listSplice
+	j := 0
+	for i := range a {
+		if j < len(b) && bytes.Equal(a[i], b[j]) {
+			j++
+			continue
+		}
+		if n := len(splice.Drop); n > 0 && splice.Drop[n-1][1] == i {
+			splice.Drop[n-1][1] = i + 1
+		} else {
+			splice.Drop = append(splice.Drop, [2]int{i, i + 1})
+		}
+	}
+	splice.Add = b[j:]
+	if len(splice.Drop) == 0 && len(splice.Add) == 0 {
+		return nil, nil
+	}
+	return &splice, nil
+}
+
+func listItems(list any) ([]json.RawMessage, error) {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var items []json.RawMessage
+	err = json.Unmarshal(data, &items)
+	return items, err
+}
+
+// applyListSplice 把 diffList 的結果套用到 list（指向清單的指標）
+func applyListSplice(list any, data json.RawMessage) error {
+	var splice listSplice
+	if err := json.Unmarshal(data, &splice); err != nil {
+		return err
+	}
+	items, err := listItems(list)
+	if err != nil {
+		return err
+	}
+	for i := len(splice.Drop) - 1; i >= 0; i-- {
+		from, to := splice.Drop[i][0], splice.Drop[i][1]
+		if from < 0 || from > to || to > len(items) {
+			return fmt.Errorf("刪除區間 [%d, %d) 超出清單長度 %d", from, to, len(items))
+		}
+		items = append(items[:from], items[to:]...)
+	}
+	items = append(items, splice.Add...)
+	if len(items) == 0 {
+		return json.Unmarshal([]byte("null"), list)
+	}
+	merged, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(merged, list)
+}
+
+func applyJournalEntry(state *GlobalState, e JournalEntry) error {
+	for _, l := range journalLists {
+		if e.Op == l.op {
+			if err := applyListSplice(l.field(state), e.Data); err != nil {
+				return err
+			}
+			state.LastUpdated = e.At
+			return nil
+		}
+	}
+
+	switch e.Op {
+	case opCheckpoint:
+		s, err := decodeState(e.Data)
+		if err != nil {
+			return err
+		}
+		*state = s
+	case opMeta:
+		// 舊版寫下的 meta 也要經過遷移（例如 v1 沒有分類清單）
+		prev := *state
+		meta, err := decodeState(e.Data)
+		if err != nil {
+			return err
+		}
+		*state = meta
+		state.People, state.Bills = prev.People, prev.Bills
+		// 舊版的 meta 帶著整份 journalLists；新版的不帶，沿用重播到目前的清單
+		if meta.Activity == nil && meta.Snapshots == nil && meta.BillHistory == nil {
+			state.Activity, state.Snapshots, state.BillHistory = prev.Activity, prev.Snapshots, prev.BillHistory
+		}
+	case opPersonPut:
+		var p Person
+		if err := json.Unmarshal(e.Data, &p); err != nil {
+			return err
+		}
+		for i := range state.People {
+			if state.People[i].ID == p.ID {
+				state.People[i] = p
+				return nil
+			}
+		}
+		state.People = append(state.People, p)
+	case opPersonDelete:
+		for i := range state.People {
+			if state.People[i].ID == e.ID {
+				state.People = append(state.People[:i], state.People[i+1:]...)
+				break
+			}
+		}
+	case opBillPut:
+		var b Bill
+		if err := json.Unmarshal(e.Data, &b); err != nil {
+			return err
+		}
+		for i := range state.Bills {
+			if state.Bills[i].ID == b.ID {
+				state.Bills[i] = b
+				return nil
+			}
+		}
+		state.Bills = append(state.Bills, b)
+	case opBillDelete:
+		for i := range state.Bills {
+			if state.Bills[i].ID == e.ID {
+				state.Bills = append(state.Bills[:i], state.Bills[i+1:]...)
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("未知的日誌操作 %q", e.Op)
+	}
+	state.LastUpdated = e.At
+	return nil
+}
+
+func sameJSON(a, b any) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ja, jb)
+}
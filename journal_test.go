@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 變更日誌重播測試
+// ==========================================
+func TestJournalStore_Replay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.journal")
+	js := NewJournalStore(path)
+
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{{ID: 1, Title: "Taxi", Amount: 300, PaidBy: 1, Participants: []int{1, 2}}}
+	if err := js.Save(state); err != nil {
+		t.Fatalf("寫入日誌失敗: %v", err)
+	}
+
+	state.People[1].Name = "Bobby"
+	state.Bills = []Bill{{ID: 2, Title: "Museum", Amount: 500, PaidBy: 2, Participants: []int{1, 2}}}
+	state.BaseCurrency = "JPY"
+	if err := js.Save(state); err != nil {
+		t.Fatalf("寫入日誌失敗: %v", err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if !strings.Contains(string(raw), `"op":"bill.delete","id":1`) {
+		t.Errorf("日誌應記錄刪除的帳單:\n%s", raw)
+	}
+
+	// 模擬當機時寫了一半的最後一行
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString(`{"seq":99,"op":"bill.pu`)
+	f.Close()
+
+	restarted := NewJournalStore(path)
+	got, err := restarted.Load()
+	if err != nil {
+		t.Fatalf("重播失敗: %v", err)
+	}
+	if got.BaseCurrency != "JPY" || len(got.People) != 2 || got.People[1].Name != "Bobby" {
+		t.Errorf("重播後狀態錯誤: %+v", got)
+	}
+	if len(got.Bills) != 1 || got.Bills[0].Title != "Museum" {
+		t.Errorf("重播後帳單錯誤: %+v", got.Bills)
+	}
+
+	// 半行已被截掉：當機後新增的資料在下一次重新啟動後仍然存在
+	got.People = append(got.People, Person{ID: 3, Name: "Carol"})
+	if err := restarted.Save(got); err != nil {
+		t.Fatalf("寫入日誌失敗: %v", err)
+	}
+	again, err := NewJournalStore(path).Load()
+	if err != nil {
+		t.Fatalf("再次重播失敗: %v", err)
+	}
+	if len(again.People) != 3 || again.People[2].Name != "Carol" {
+		t.Errorf("當機後新增的人員遺失: %+v", again.People)
+	}
+	if raw, _ := os.ReadFile(path); strings.Contains(string(raw), `"bill.pu{`) {
+		t.Errorf("新項目不應接在半行後面:\n%s", raw)
+	}
+}
+
+func TestJournalStore_CorruptMiddle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.journal")
+	js := NewJournalStore(path)
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	if err := js.Save(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// 損毀的一行後面還有項目：不是當機留下的半行，應回傳錯誤而不是丟掉後面的資料
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	f.WriteString("{\"seq\":99,\"op\":\"bill.pu\n")
+	f.Close()
+	state.People = append(state.People, Person{ID: 2, Name: "Bob"})
+	if err := js.Save(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJournalStore(path).Load(); err == nil {
+		t.Error("日誌中段損毀應回傳錯誤")
+	}
+}
+
+func TestJournalStore_AppendOnlyLists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.journal")
+	js := NewJournalStore(path)
+
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	for i := 1; i <= 80; i++ {
+		prev := state.Bills
+		state.Bills = []Bill{{ID: 1, Title: "Taxi", Amount: float64(i), PaidBy: 1, Participants: []int{1}, Version: i}}
+		state.BillHistory = append(state.BillHistory, prev...)
+		state.Activity = append(state.Activity, Activity{At: int64(i), Action: "update", Target: "bill", TargetID: 1, Message: strings.Repeat("改了計程車的金額", 5)})
+		// 動態只保留最近 30 筆，版本紀錄從中間刪掉一筆
+		if len(state.Activity) > 30 {
+			state.Activity = state.Activity[len(state.Activity)-30:]
+		}
+		if i == 40 {
+			state.BillHistory = append(state.BillHistory[:10:10], state.BillHistory[11:]...)
+		}
+		if err := js.Save(state); err != nil {
+			t.Fatalf("寫入日誌失敗: %v", err)
+		}
+	}
+
+	// 每次只記下新增與刪除的部分，不會整份清單重寫
+	raw, _ := os.ReadFile(path)
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		if len(line) > 1024 {
+			t.Fatalf("日誌單筆過長（%d bytes）: %.200s", len(line), line)
+		}
+	}
+
+	got, err := NewJournalStore(path).Load()
+	if err != nil {
+		t.Fatalf("重播失敗: %v", err)
+	}
+	if !sameJSON(got.Activity, state.Activity) || !sameJSON(got.BillHistory, state.BillHistory) || len(got.BillHistory) != 78 {
+		t.Errorf("重播後的清單不同: 動態 %d 筆、版本紀錄 %d 筆", len(got.Activity), len(got.BillHistory))
+	}
+}
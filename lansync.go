@@ -0,0 +1,536 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= 區網桌面版同步 =================
+
+// 兩台以上的桌面版在同一個區網、使用相同的配對碼（-lan-sync）時，透過 mDNS 找到彼此後直接同步，
+// 不需要任何一台跑 -server。ID 最小的一台當彙整者：其他台把與上次同步結果不同的人員與帳單送過去，
+// 由它以離線同步（mergeCRDT）相同的規則合併，再帶回合併後的完整狀態取代本機的。
+// 往返的內容都以配對碼推導的金鑰加密（AES-GCM），不知道配對碼的裝置無法讀取或寫入。
+
+const (
+	lanService       = "_billsplitter._tcp.local."
+	lanQueryInterval = 10 * time.Second
+	lanPeerTTL       = 3 * lanQueryInterval
+	// lanMaxClockSkew 請求的送出時間與本機相差超過這個值就拒絕，被錄下來的請求無法事後重播
+	lanMaxClockSkew = 5 * time.Minute
+	lanMaxBody      = 64 << 20
+)
+
+// lanSyncInterval 跟隨者向彙整者同步的間隔
+var lanSyncInterval = 3 * time.Second
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+var (
+	errLANAuth  = errors.New("區網同步驗證失敗（配對碼不同或請求已過期）")
+	errLANStale = errors.New("本機狀態在同步期間有變動")
+)
+
+// lanPeer 透過 mDNS 找到、配對碼相同的另一台桌面版
+type lanPeer struct {
+	id       string
+	addr     string // host:port
+	lastSeen time.Time
+	gone     bool // 對方關閉時送出的 TTL 0 公告
+}
+
+// lanEnvelope 加密前的請求與回應
+type lanEnvelope struct {
+	From    string       `json:"from"`
+	SentAt  int64        `json:"sentAt"`
+	Changes *CRDTChanges `json:"changes,omitempty"`
+	State   *CRDTState   `json:"state,omitempty"`
+}
+
+type lanSync struct {
+	id       string
+	group    string // 由金鑰算出的標籤，公告在 TXT 記錄裡，用來略過其他組的桌面版
+	aead     cipher.AEAD
+	rm       *room
+	port     int
+	onChange func(GlobalState) // 其他台的修改併入本機後呼叫（更新畫面）
+
+	mu    sync.Mutex
+	peers map[string]lanPeer
+
+	// 只由同步迴圈使用：上次從彙整者 baseFrom 取得的人員與帳單，用來找出本機之後改了什麼
+	base     GlobalState
+	baseFrom string
+	client   *http.Client
+
+	conn   *net.UDPConn
+	srv    *http.Server
+	cancel context.CancelFunc
+}
+
+func newLANSync(rm *room, code string) (*lanSync, error) {
+	aead, group, err := lanKeys(code)
+	if err != nil {
+		return nil, err
+	}
+	return &lanSync{
+		id:     deviceID(newDeviceToken()),
+		group:  group,
+		aead:   aead,
+		rm:     rm,
+		peers:  make(map[string]lanPeer),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// startLANSync 在區網上公告自己、尋找配對碼相同的桌面版並開始同步 rm
+func startLANSync(rm *room, code string, onChange func(GlobalState)) (*lanSync, error) {
+	l, err := newLANSync(rm, code)
+	if err != nil {
+		return nil, err
+	}
+	l.onChange = onChange
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	l.port = ln.Addr().(*net.TCPAddr).Port
+	l.conn, err = net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		ln.Close()
+		return nil, fmt.Errorf("mDNS: %w", err)
+	}
+	l.srv = &http.Server{Handler: l.handler(), ReadHeaderTimeout: 10 * time.Second}
+	ctx, cancel := context.WithCancel(context.Background())
+	l.cancel = cancel
+	go l.srv.Serve(ln)
+	go l.listenMDNS()
+	go l.run(ctx)
+	return l, nil
+}
+
+// close 通知其他台自己要離開並停止同步
+func (l *lanSync) close() {
+	l.cancel()
+	bye := l.announcement()
+	for i := range bye.records {
+		bye.records[i].ttl = 0
+	}
+	l.conn.WriteToUDP(bye.pack(), mdnsGroup)
+	l.conn.Close()
+	l.srv.Close()
+}
+
+func (l *lanSync) run(ctx context.Context) {
+	query := lanQuery().pack()
+	l.conn.WriteToUDP(l.announcement().pack(), mdnsGroup)
+	l.conn.WriteToUDP(query, mdnsGroup)
+	queryTick := time.NewTicker(lanQueryInterval)
+	defer queryTick.Stop()
+	syncTick := time.NewTicker(lanSyncInterval)
+	defer syncTick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-queryTick.C:
+			l.conn.WriteToUDP(query, mdnsGroup)
+		case <-syncTick.C:
+			if leader, ok := l.leader(clock.Now()); ok {
+				if err := l.syncWith(ctx, leader); err != nil && ctx.Err() == nil {
+					log.Printf("lan sync with %s failed: %v", leader.addr, err)
+				}
+			}
+		}
+	}
+}
+
+func (l *lanSync) listenMDNS() {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := l.conn.ReadFromUDP(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+		m, err := parseDNSMessage(buf[:n])
+		if err != nil {
+			continue
+		}
+		if reply := l.handleMDNS(m, from.IP, clock.Now()); reply != nil {
+			l.conn.WriteToUDP(reply.pack(), mdnsGroup)
+		}
+	}
+}
+
+func lanQuery() dnsMessage {
+	return dnsMessage{questions: []dnsQuestion{{name: lanService, qtype: dnsTypePTR}}}
+}
+
+// announcement 本機的服務公告：實例名稱、HTTP 連接埠，以及 ID 與配對碼的標籤
+func (l *lanSync) announcement() dnsMessage {
+	instance := l.id + "." + lanService
+	host := "bill-splitter-" + l.id + ".local."
+	m := dnsMessage{response: true, records: []dnsRecord{
+		{name: lanService, rtype: dnsTypePTR, ttl: 120, target: instance},
+		{name: instance, rtype: dnsTypeSRV, ttl: 120, target: host, port: uint16(l.port)},
+		{name: instance, rtype: dnsTypeTXT, ttl: 120, txt: []string{"id=" + l.id, "group=" + l.group}},
+	}}
+	if ip := net.ParseIP(getLocalIP()).To4(); ip != nil {
+		m.records = append(m.records, dnsRecord{name: host, rtype: dnsTypeA, ttl: 120, ip: ip})
+	}
+	return m
+}
+
+// handleMDNS 處理收到的 mDNS 封包：有人查詢本服務時回傳要送出的公告，收到公告時記下對方
+func (l *lanSync) handleMDNS(m dnsMessage, from net.IP, now time.Time) *dnsMessage {
+	if !m.response {
+		for _, q := range m.questions {
+			if strings.EqualFold(q.name, lanService) && (q.qtype == dnsTypePTR || q.qtype == dnsTypeANY) {
+				reply := l.announcement()
+				return &reply
+			}
+		}
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, p := range discoverLANPeers(m, from, l.group) {
+		switch {
+		case p.id == l.id:
+		case p.gone:
+			delete(l.peers, p.id)
+		default:
+			p.lastSeen = now
+			l.peers[p.id] = p
+		}
+	}
+	return nil
+}
+
+// discoverLANPeers 從公告中找出同一組（配對碼相同）的桌面版；位址用封包的來源，不依賴 A 記錄
+func discoverLANPeers(m dnsMessage, from net.IP, group string) []lanPeer {
+	srv := make(map[string]dnsRecord)
+	txt := make(map[string][]string)
+	for _, r := range m.records {
+		switch r.rtype {
+		case dnsTypeSRV:
+			srv[strings.ToLower(r.name)] = r
+		case dnsTypeTXT:
+			txt[strings.ToLower(r.name)] = r.txt
+		}
+	}
+	var out []lanPeer
+	for _, r := range m.records {
+		if r.rtype != dnsTypePTR || !strings.EqualFold(r.name, lanService) {
+			continue
+		}
+		key := strings.ToLower(r.target)
+		s, ok := srv[key]
+		if !ok {
+			continue
+		}
+		var id, g string
+		for _, kv := range txt[key] {
+			switch k, v, _ := strings.Cut(kv, "="); k {
+			case "id":
+				id = v
+			case "group":
+				g = v
+			}
+		}
+		if id == "" || g != group {
+			continue
+		}
+		out = append(out, lanPeer{id: id, addr: net.JoinHostPort(from.String(), strconv.Itoa(int(s.port))), gone: r.ttl == 0})
+	}
+	return out
+}
+
+// leader 目前的彙整者；自己的 ID 最小（或還沒找到其他台）時回傳 false
+func (l *lanSync) leader(now time.Time) (lanPeer, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var best lanPeer
+	for id, p := range l.peers {
+		if now.Sub(p.lastSeen) > lanPeerTTL {
+			delete(l.peers, id)
+			continue
+		}
+		if best.id == "" || id < best.id {
+			best = p
+		}
+	}
+	if best.id == "" || l.id < best.id {
+		return lanPeer{}, false
+	}
+	return best, true
+}
+
+// lanKeys 由配對碼推導加密金鑰與公告用的標籤。配對碼只經過 PBKDF2 使用：標籤是金鑰的 HMAC，
+// 從 mDNS 公告或錄下的封包猜配對碼，每猜一次都得付出與解開狀態檔相同的成本。
+// 雙方事先沒有交換過資料，salt 只能固定；收到請求時不再推導金鑰，送來亂數也耗不了 CPU
+func lanKeys(code string) (cipher.AEAD, string, error) {
+	key, err := pbkdf2.Key(sha256.New, code, []byte("bill-splitter-lan"), stateKDFRounds, stateKeySize)
+	if err != nil {
+		return nil, "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, "", err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("mdns-group"))
+	return aead, hex.EncodeToString(mac.Sum(nil)[:8]), nil
+}
+
+// sealEnvelope 加密格式：nonce | ciphertext
+func (l *lanSync) sealEnvelope(env lanEnvelope) ([]byte, error) {
+	env.From, env.SentAt = l.id, clock.Now().UnixMilli()
+	data, err := json.Marshal(env)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, l.aead.NonceSize(), l.aead.NonceSize()+len(data)+l.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return l.aead.Seal(nonce, nonce, data, []byte(lanService)), nil
+}
+
+func (l *lanSync) openEnvelope(data []byte) (lanEnvelope, error) {
+	ns := l.aead.NonceSize()
+	if len(data) < ns {
+		return lanEnvelope{}, errLANAuth
+	}
+	plaintext, err := l.aead.Open(nil, data[:ns], data[ns:], []byte(lanService))
+	if err != nil {
+		return lanEnvelope{}, fmt.Errorf("%w: %v", errLANAuth, err)
+	}
+
+	var env lanEnvelope
+	if err := json.Unmarshal(plaintext, &env); err != nil {
+		return lanEnvelope{}, err
+	}
+	if clock.Now().Sub(time.UnixMilli(env.SentAt)).Abs() > lanMaxClockSkew {
+		return lanEnvelope{}, errLANAuth
+	}
+	return env, nil
+}
+
+func (l *lanSync) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /lan/sync", l.handleSync)
+	return mux
+}
+
+// handleSync POST /lan/sync 併入跟隨者的修改，回應合併後的完整人員與帳單
+func (l *lanSync) handleSync(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, lanMaxBody))
+	if err != nil {
+		http.Error(w, "request too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	env, err := l.openEnvelope(body)
+	if err != nil || env.Changes == nil {
+		log.Printf("lan sync from %s rejected: %v", r.RemoteAddr, err)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var conflicts []SyncConflict
+	state, err := l.rm.currentState()
+	if len(env.Changes.People)+len(env.Changes.Bills) > 0 && err == nil {
+		state, err = l.rm.updateStateAs(Actor{Device: "lan", DeviceID: env.From}, func(s *GlobalState) error {
+			var err error
+			conflicts, err = mergeCRDT(s, *env.Changes, env.From, clock.Now())
+			return err
+		})
+		if err == nil && l.onChange != nil {
+			l.onChange(state)
+		}
+	}
+	var invalid ValidationErrors
+	var limit *limitError
+	switch {
+	case err == nil:
+	case errors.As(err, &invalid), errors.As(err, &limit):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	default:
+		log.Printf("lan sync merge failed: %v", err)
+		http.Error(w, "merge failed", http.StatusInternalServerError)
+		return
+	}
+
+	data, err := l.sealEnvelope(lanEnvelope{State: &CRDTState{
+		Revision: state.Revision, People: state.People, Bills: state.Bills, Conflicts: conflicts,
+	}})
+	if err != nil {
+		log.Printf("lan sync seal failed: %v", err)
+		http.Error(w, "seal failed", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// syncWith 把本機的修改送給彙整者，再以合併後的狀態取代本機的人員與帳單；
+// 送出後本機又有修改時先不取代，下一輪會連同新的修改一起送出
+func (l *lanSync) syncWith(ctx context.Context, leader lanPeer) error {
+	local, err := l.rm.currentState()
+	if err != nil {
+		return err
+	}
+	changes := lanChanges(l.base, local, l.baseFrom == leader.id)
+	body, err := l.sealEnvelope(lanEnvelope{Changes: &changes})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+leader.addr+"/lan/sync", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, lanMaxBody))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	env, err := l.openEnvelope(data)
+	if err != nil {
+		return err
+	}
+	if env.State == nil || env.From != leader.id {
+		return errLANAuth
+	}
+	for _, c := range env.State.Conflicts {
+		log.Printf("lan sync: %s", c.Message)
+	}
+
+	remote := GlobalState{People: env.State.People, Bills: env.State.Bills}
+	l.base, l.baseFrom = remote, leader.id
+	if sameEntities(local, remote) {
+		return nil
+	}
+	state, err := l.rm.updateStateAs(Actor{Device: "lan", DeviceID: leader.id}, func(s *GlobalState) error {
+		if s.Revision != local.Revision {
+			return errLANStale
+		}
+		// 寫入時會蓋上本機的版本資訊，不能改到 l.base
+		s.People, s.Bills = slices.Clone(remote.People), slices.Clone(remote.Bills)
+		ensureBillCategories(s)
+		return nil
+	})
+	switch {
+	case errors.Is(err, errLANStale):
+		return nil
+	case err != nil:
+		return err
+	}
+	if l.onChange != nil {
+		l.onChange(state)
+	}
+	return nil
+}
+
+// lanChanges 本機與上次同步結果 base 不同的人員與帳單，帶上 base 的版本資訊，讓彙整者知道是依據哪一版修改的；
+// 本機新增的不帶版本資訊，撞到其他台新增的 ID 時改用新 ID。sameLeader 為 false 時 base 來自之前的彙整者，
+// 版本號對現在的彙整者沒有意義，只標示「看過」，改為逐筆比較編輯時間
+func lanChanges(base, local GlobalState, sameLeader bool) CRDTChanges {
+	var out CRDTChanges
+	people := make(map[int]Person, len(base.People))
+	for _, p := range base.People {
+		people[p.ID] = p
+	}
+	for _, p := range local.People {
+		b, ok := people[p.ID]
+		switch {
+		case !ok:
+			p.Revision = 0
+		case personChanged(b, p):
+			p.Revision = max(b.Revision, 1)
+		default:
+			continue
+		}
+		out.People = append(out.People, p)
+	}
+
+	bills := make(map[int]Bill, len(base.Bills))
+	for _, b := range base.Bills {
+		bills[b.ID] = b
+	}
+	for _, b := range local.Bills {
+		old, ok := bills[b.ID]
+		switch {
+		case !ok:
+			b.Revision, b.Version = 0, 0
+		case billChanged(old, b):
+			b.Revision, b.Version = max(old.Revision, 1), old.Version
+			if !sameLeader {
+				b.Version = 0
+			}
+		default:
+			continue
+		}
+		out.Bills = append(out.Bills, b)
+	}
+	return out
+}
+
+// sameEntities a、b 的人員與帳單內容（不含版本資訊）是否相同
+func sameEntities(a, b GlobalState) bool {
+	if len(a.People) != len(b.People) || len(a.Bills) != len(b.Bills) {
+		return false
+	}
+	people := make(map[int]Person, len(b.People))
+	for _, p := range b.People {
+		people[p.ID] = p
+	}
+	for _, p := range a.People {
+		if q, ok := people[p.ID]; !ok || personChanged(p, q) {
+			return false
+		}
+	}
+	bills := make(map[int]Bill, len(b.Bills))
+	for _, bl := range b.Bills {
+		bills[bl.ID] = bl
+	}
+	for _, bl := range a.Bills {
+		if q, ok := bills[bl.ID]; !ok || billChanged(bl, q) {
+			return false
+		}
+	}
+	return true
+}
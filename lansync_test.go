@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 區網桌面版同步測試
+// ==========================================
+func TestLANSync_LeaderMerges(t *testing.T) {
+	reg := useRooms(t)
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	r1, _ := reg.create()
+	r2, _ := reg.create()
+	leader, follower := newTestLANSync(t, r1, "pair-1234"), newTestLANSync(t, r2, "pair-1234")
+	leader.id, follower.id = "aaaa", "bbbb"
+	var updates int
+	follower.onChange = func(GlobalState) { updates++ }
+	srv := httptest.NewServer(leader.handler())
+	defer srv.Close()
+	peer := lanPeer{id: leader.id, addr: srv.Listener.Addr().String()}
+
+	edit := func(l *lanSync, fn func(s *GlobalState)) {
+		l.rm.updateStateAs(Actor{Device: "desktop", DeviceID: l.id}, func(s *GlobalState) error {
+			fn(s)
+			return nil
+		})
+	}
+	sync := func() {
+		t.Helper()
+		if err := follower.syncWith(context.Background(), peer); err != nil {
+			t.Fatalf("同步失敗: %v", err)
+		}
+	}
+	bills := func(rm *room) map[string]Bill {
+		state, _ := rm.currentState()
+		out := map[string]Bill{}
+		for _, b := range state.Bills {
+			out[b.Title] = b
+		}
+		return out
+	}
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+
+	// 兩台各自新增了 ID 1 的帳單：跟隨者的改用新 ID，兩台都看得到兩張
+	edit(leader, func(s *GlobalState) {
+		s.People = people
+		s.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1, 2}}}
+	})
+	edit(follower, func(s *GlobalState) {
+		s.People = people
+		s.Bills = []Bill{{ID: 1, Title: "Taxi", Amount: 100, PaidBy: 2, Participants: []int{1, 2}}}
+	})
+	sync()
+	s1, _ := r1.currentState()
+	s2, _ := r2.currentState()
+	if len(s1.Bills) != 2 || !sameEntities(s1, s2) || bills(r2)["Taxi"].ID != 2 || updates != 1 {
+		t.Fatalf("同步後兩台應相同: %+v / %+v", s1.Bills, s2.Bills)
+	}
+
+	// 同一張帳單兩台同時修改不同欄位，兩邊的修改都保留
+	fc.Advance(time.Minute)
+	edit(follower, func(s *GlobalState) { s.Bills[0].Amount = 500 })
+	edit(leader, func(s *GlobalState) { s.Bills[0].Category = "住宿" })
+	sync()
+	for _, rm := range []*room{r1, r2} {
+		if h := bills(rm)["Hotel"]; h.Amount != 500 || h.Category != "住宿" {
+			t.Errorf("逐欄位合併後 = %+v", h)
+		}
+	}
+
+	// 彙整者刪除的帳單跟著進跟隨者的垃圾桶
+	fc.Advance(time.Minute)
+	edit(leader, func(s *GlobalState) { s.Bills[1].DeletedAt = fc.Now().UnixMilli() })
+	sync()
+	if bills(r2)["Taxi"].DeletedAt == 0 {
+		t.Error("刪除應同步到跟隨者")
+	}
+
+	// 兩邊都沒有變動時不寫入狀態
+	before, _ := r2.currentState()
+	leaderBefore, _ := r1.currentState()
+	sync()
+	after, _ := r2.currentState()
+	leaderAfter, _ := r1.currentState()
+	if after.Revision != before.Revision || leaderAfter.Revision != leaderBefore.Revision || updates != 3 {
+		t.Errorf("沒有變動時不應寫入, revision %d → %d、%d → %d（更新 %d 次）", before.Revision, after.Revision, leaderBefore.Revision, leaderAfter.Revision, updates)
+	}
+}
+
+func TestLANSync_RejectsUnpaired(t *testing.T) {
+	reg := useRooms(t)
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	r1, _ := reg.create()
+	r2, _ := reg.create()
+	leader := newTestLANSync(t, r1, "pair-1234")
+	srv := httptest.NewServer(leader.handler())
+	defer srv.Close()
+	r2.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Mallory"}}
+		return nil
+	})
+
+	// 配對碼不同：無法寫入
+	intruder := newTestLANSync(t, r2, "guess")
+	if err := intruder.syncWith(context.Background(), lanPeer{id: leader.id, addr: srv.Listener.Addr().String()}); err == nil {
+		t.Error("配對碼不同應同步失敗")
+	}
+
+	// 配對碼相同但是被錄下來的舊請求：過期後重播無效
+	paired := newTestLANSync(t, r2, "pair-1234")
+	body, _ := paired.sealEnvelope(lanEnvelope{Changes: &CRDTChanges{People: []Person{{ID: 1, Name: "Mallory"}}}})
+	fc.Advance(lanMaxClockSkew + time.Minute)
+	resp, err := http.Post(srv.URL+"/lan/sync", "application/octet-stream", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("過期的請求應回 403, got %d", resp.StatusCode)
+	}
+	if state, _ := r1.currentState(); len(state.People) != 0 {
+		t.Errorf("彙整者不應被寫入, got %+v", state.People)
+	}
+}
+
+func newTestLANSync(t *testing.T, rm *room, code string) *lanSync {
+	t.Helper()
+	l, err := newLANSync(rm, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ================= 累計淨額（增量結算） =================
+
+// balanceLedger 伺服器端的累計淨額：記住每張帳單對每個人的影響，
+// 狀態變動時只重算新增、修改、刪除的帳單；本位幣、成員、群組、期初餘額、自訂匯率或匯率日期改變時才整個重算。
+// 每張帳單各自拆分，所以只適用預設的餘數政策（rotate 需要從第一張依序累計）
+type balanceLedger struct {
+	mu sync.Mutex
+	// scope 本位幣、成員、群組、期初餘額、自訂與鎖定匯率、手續費的指紋，變動時整個重算
+	scope    uint64
+	rateDate string
+	bills    map[int]ledgerEntry
+	members  map[int]Money
+	// guests 臨時參加者依名字（小寫）累計，guestNames 保留第一次出現時的寫法
+	guests     map[string]Money
+	guestNames map[string]string
+	// recomputed 累計重算過幾張帳單，用來確認只處理了變動的部分
+	recomputed int
+}
+
+// ledgerEntry 一張帳單對每個人淨額的影響（正數為應收）
+type ledgerEntry struct {
+	fingerprint uint64
+	members     map[int]Money
+	guests      map[string]Money
+	guestNames  map[string]string
+}
+
+func fingerprint(v any) uint64 {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// stateBase 狀態的本位幣（大寫），未設定時為預設本位幣
+func stateBase(state GlobalState) string {
+	if base := strings.ToUpper(strings.TrimSpace(state.BaseCurrency)); base != "" {
+		return base
+	}
+	return defaultBase
+}
+
+// balances 把累計淨額更新到 state 後結算
+func (l *balanceLedger) balances(ctx context.Context, state GlobalState) (BalancesResponse, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	base := stateBase(state)
+	if err := l.refresh(ctx, state, base); err != nil {
+		return BalancesResponse{}, err
+	}
+	return l.snapshot(state.People, base)
+}
+
+// refresh 只重算指紋改變的帳單，呼叫端需持有 l.mu
+func (l *balanceLedger) refresh(ctx context.Context, state GlobalState, base string) error {
+	scope := fingerprint([]any{base, state.People, state.Groups, state.OpeningBalances, state.RateTable, state.LockedRates, state.FXFeePercent})
+	if l.bills == nil || scope != l.scope {
+		if err := l.rebuild(ctx, state, base, scope); err != nil {
+			l.bills = nil
+			return err
+		}
+		return nil
+	}
+
+	live := make(map[int]bool, len(state.Bills))
+	for _, bill := range state.Bills {
+		if bill.DeletedAt != 0 {
+			continue
+		}
+		live[bill.ID] = true
+		fp := fingerprint(bill)
+		if old, ok := l.bills[bill.ID]; ok && old.fingerprint == fp {
+			continue
+		}
+		entry, rateDate, err := l.compute(ctx, state, bill, base)
+		if err != nil {
+			return err
+		}
+		if rateDate != "" && l.rateDate != "" && rateDate != l.rateDate {
+			// 匯率更新了，其他外幣帳單也要用新的匯率重算
+			if err := l.rebuild(ctx, state, base, scope); err != nil {
+				l.bills = nil
+				return err
+			}
+			return nil
+		}
+		if rateDate != "" {
+			l.rateDate = rateDate
+		}
+		entry.fingerprint = fp
+		l.remove(bill.ID)
+		l.add(bill.ID, entry)
+	}
+	for id := range l.bills {
+		if !live[id] {
+			l.remove(id)
+		}
+	}
+	return nil
+}
+
+func (l *balanceLedger) rebuild(ctx context.Context, state GlobalState, base string, scope uint64) error {
+	l.scope = scope
+	l.rateDate = ""
+	l.bills = make(map[int]ledgerEntry)
+	l.members = make(map[int]Money)
+	l.guests = make(map[string]Money)
+	l.guestNames = make(map[string]string)
+	for _, p := range state.People {
+		l.members[p.ID] = 0
+	}
+	opening, _, _ := computeBalances(nil, openingBalanceBills(state.OpeningBalances), base, remainderFraction)
+	for id, amt := range opening {
+		l.members[id] += amt
+	}
+	for _, bill := range state.Bills {
+		if bill.DeletedAt != 0 {
+			continue
+		}
+		entry, rateDate, err := l.compute(ctx, state, bill, base)
+		if err != nil {
+			return err
+		}
+		if rateDate != "" {
+			l.rateDate = rateDate
+		}
+		entry.fingerprint = fingerprint(bill)
+		l.add(bill.ID, entry)
+	}
+	return nil
+}
+
+// compute 依 processCalculate 相同的步驟（群組、臨時參加者、品項、換匯）拆分一張帳單
+func (l *balanceLedger) compute(ctx context.Context, state GlobalState, bill Bill, base string) (ledgerEntry, string, error) {
+	l.recomputed++
+	if errs := validatePeopleAndBills(state.People, []Bill{bill}); len(errs) > 0 {
+		return ledgerEntry{}, "", fmt.Errorf("帳單 %d：%w", bill.ID, errs)
+	}
+	bills, err := expandGroups(state.Groups, []Bill{bill})
+	if err != nil {
+		return ledgerEntry{}, "", err
+	}
+	people, bills, err := expandGuests(state.People, bills)
+	if err != nil {
+		return ledgerEntry{}, "", err
+	}
+	if bills, err = applyIncomeWeights(people, bills); err != nil {
+		return ledgerEntry{}, "", err
+	}
+	bills = rollUpLineItems(bills)
+	if err := validateSplits(bills); err != nil {
+		return ledgerEntry{}, "", err
+	}
+	converted, rates, rateDate, err := convertBillsWithRates(ctx, base, bills, conversionOptions{
+		Table:        state.RateTable,
+		Locked:       state.LockedRates,
+		FXFeePercent: state.FXFeePercent,
+	})
+	if err != nil {
+		return ledgerEntry{}, "", err
+	}
+	if src := rates[0].Source; src != rateSourceMarket && src != rateSourceOffline {
+		rateDate = ""
+	}
+
+	entry := ledgerEntry{members: map[int]Money{}, guests: map[string]Money{}, guestNames: map[string]string{}}
+	split, ok := (&remainderAllocator{}).splitBill(converted[0], base)
+	if !ok {
+		return entry, rateDate, nil
+	}
+	guestName := make(map[int]string)
+	for _, p := range people[len(state.People):] {
+		guestName[p.ID] = p.Name
+	}
+	apply := func(id int, amt Money) {
+		if name, ok := guestName[id]; ok {
+			key := strings.ToLower(name)
+			entry.guests[key] += amt
+			entry.guestNames[key] = name
+			return
+		}
+		entry.members[id] += amt
+	}
+	for id, amt := range split.paid {
+		apply(id, amt)
+	}
+	for id, amt := range split.owed {
+		apply(id, -amt)
+	}
+	return entry, rateDate, nil
+}
+
+func (l *balanceLedger) add(id int, entry ledgerEntry) {
+	l.bills[id] = entry
+	for pid, amt := range entry.members {
+		l.members[pid] += amt
+	}
+	for key, amt := range entry.guests {
+		l.guests[key] += amt
+		if _, ok := l.guestNames[key]; !ok {
+			l.guestNames[key] = entry.guestNames[key]
+		}
+	}
+}
+
+func (l *balanceLedger) remove(id int) {
+	entry, ok := l.bills[id]
+	if !ok {
+		return
+	}
+	delete(l.bills, id)
+	for pid, amt := range entry.members {
+		l.members[pid] -= amt
+	}
+	for key, amt := range entry.guests {
+		l.guests[key] -= amt
+		if l.guests[key] == 0 {
+			delete(l.guests, key)
+			delete(l.guestNames, key)
+		}
+	}
+}
+
+// PersonBalance 某人目前的淨額（本位幣），正數為應收、負數為應付
+type PersonBalance struct {
+	PersonID int     `json:"personId"`
+	Person   string  `json:"person"`
+	Amount   float64 `json:"amount"`
+}
+
+// BalancesResponse GET /api/balances 的回應
+type BalancesResponse struct {
+	BaseCurrency string          `json:"baseCurrency"`
+	Balances     []PersonBalance `json:"balances"`
+	Settlements  []Settlement    `json:"settlements"`
+}
+
+// snapshot 以目前的累計淨額結算
+func (l *balanceLedger) snapshot(people []Person, base string) (BalancesResponse, error) {
+	balance, nameMap, transfers, err := l.settle(people, base)
+	resp := BalancesResponse{BaseCurrency: base, Balances: []PersonBalance{}, Settlements: []Settlement{}}
+	if err != nil {
+		return resp, err
+	}
+	for _, id := range slices.Sorted(maps.Keys(balance)) {
+		resp.Balances = append(resp.Balances, PersonBalance{PersonID: id, Person: nameMap[id], Amount: balance[id].Float(base)})
+	}
+	if s := toSettlements(transfers, nameMap, base); s != nil {
+		resp.Settlements = s
+	}
+	return resp, nil
+}
+
+// settle 回傳目前的淨額、ID 對應的名字與建議的轉帳，呼叫端需持有 l.mu。
+// 臨時參加者依名字排序，給負數 ID（與 expandGuests 相同）
+func (l *balanceLedger) settle(people []Person, base string) (map[int]Money, map[int]string, []transfer, error) {
+	balance := maps.Clone(l.members)
+	nameMap := make(map[int]string, len(people)+len(l.guests))
+	for _, p := range people {
+		nameMap[p.ID] = p.Name
+	}
+	for i, key := range slices.Sorted(maps.Keys(l.guests)) {
+		balance[-(i + 1)] = l.guests[key]
+		nameMap[-(i + 1)] = l.guestNames[key]
+	}
+	settler, err := newSettler(SettleOptions{Base: base})
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remaining := maps.Clone(balance)
+	settleDust(remaining, 1)
+	return balance, nameMap, settler.Settle(remaining), nil
+}
+
+// pending 把累計淨額更新到 state 後回傳建議的轉帳（ID 表示）
+func (l *balanceLedger) pending(ctx context.Context, state GlobalState) ([]transfer, map[int]string, string, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	base := stateBase(state)
+	if err := l.refresh(ctx, state, base); err != nil {
+		return nil, nil, base, err
+	}
+	_, nameMap, transfers, err := l.settle(state.People, base)
+	return transfers, nameMap, base, err
+}
+
+// handleBalances GET /api/balances 目前每個人的淨額與建議的轉帳，只重算上次查詢後變動的帳單
+func handleBalances(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	rm := roomOf(r)
+	state, err := rm.currentState()
+	if err != nil {
+		log.Printf("load state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	resp, err := rm.ledger.balances(r.Context(), visibleState(state))
+	if err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
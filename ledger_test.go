@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ==========================================
+// 累計淨額（增量結算）測試
+// ==========================================
+func TestBalanceLedger_Incremental(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Dinner", Amount: 100, PaidBy: 3, Participants: []int{1, 2, 3}},
+		{ID: 2, Title: "Taxi", Amount: 10, Currency: "USD", ManualRate: 32, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 3, Title: "Bar", Amount: 400, PaidBy: 2, Participants: []int{2}, Guests: []string{"Dave"}},
+	}
+
+	// 與完整計算的結果比對
+	check := func(l *balanceLedger) {
+		t.Helper()
+		got, err := l.balances(context.Background(), state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := json.Marshal(CalculateRequest{BaseCurrency: state.BaseCurrency, People: state.People, Bills: visibleState(state).Bills})
+		var want CalculateResponse
+		json.Unmarshal([]byte(processCalculate(string(data))), &want)
+		if want.Error != "" || !sameJSON(got.Settlements, want.Settlements) {
+			t.Errorf("累計淨額的結算與完整計算不同:\n got %+v\nwant %+v (%s)", got.Settlements, want.Settlements, want.Error)
+		}
+	}
+
+	l := &balanceLedger{}
+	check(l)
+	if l.recomputed != 3 {
+		t.Fatalf("第一次應算 3 張帳單, got %d", l.recomputed)
+	}
+
+	// 沒有變動時不重算
+	check(l)
+	if l.recomputed != 3 {
+		t.Errorf("沒有變動不應重算, got %d", l.recomputed)
+	}
+
+	// 修改一張、刪除一張、新增一張：只重算修改與新增的兩張
+	state.Bills[0].Amount = 90
+	state.Bills[2].DeletedAt = 1
+	state.Bills = append(state.Bills, Bill{ID: 4, Title: "Museum", Amount: 600, PaidBy: 2, Participants: []int{1, 2, 3}})
+	check(l)
+	if l.recomputed != 5 {
+		t.Errorf("應只重算 2 張, got %d", l.recomputed-3)
+	}
+
+	// 成員或本位幣改變時整個重算
+	state.People = append(state.People, Person{ID: 4, Name: "Dave"})
+	check(l)
+	if l.recomputed != 8 {
+		t.Errorf("成員改變應整個重算 3 張, got %d", l.recomputed-5)
+	}
+}
+
+func TestBalancesAPI(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{{ID: 1, Title: "Lunch", Amount: 300, PaidBy: 1, Participants: []int{1, 2}}}
+	withRoomState(t, state)
+
+	rec := httptest.NewRecorder()
+	handleBalances(rec, httptest.NewRequest(http.MethodGet, "/api/balances", nil))
+	var resp BalancesResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("取得淨額失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	want := []PersonBalance{{PersonID: 1, Person: "Alice", Amount: 150}, {PersonID: 2, Person: "Bob", Amount: -150}}
+	if !sameJSON(resp.Balances, want) || len(resp.Settlements) != 1 || resp.Settlements[0].Amount != 150 {
+		t.Errorf("got %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handleBalances(rec, httptest.NewRequest(http.MethodPost, "/api/balances", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST 應回傳 405, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// ================= 請求大小限制與 JSON 解析 =================
+
+var (
+	// maxRequestBody 一般 API 請求內容的上限（收據上傳另有 maxAttachmentSize）
+	maxRequestBody int64 = 4 << 20
+	// strictJSON 開啟時 JSON 不能有結構中沒有的欄位，方便串接的程式及早發現打錯的欄位名稱
+	strictJSON bool
+	// maxPeople、maxBills 一次送來的人員、帳單數量上限，超過回 422
+	maxPeople = 500
+	maxBills  = 10000
+)
+
+var errTooManyItems = errors.New("too many items")
+
+// limitError 陣列長度超過上限；errors.Is(err, errTooManyItems) 成立
+type limitError struct {
+	Field string
+	Count int
+	Max   int
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s 有 %d 筆，超過上限 %d 筆", e.Field, e.Count, e.Max)
+}
+
+func (e *limitError) Unwrap() error {
+	return errTooManyItems
+}
+
+// checkLimits 人員或帳單數量超過上限時回傳 *limitError
+func checkLimits(people, bills int) error {
+	if people > maxPeople {
+		return &limitError{Field: "people", Count: people, Max: maxPeople}
+	}
+	if bills > maxBills {
+		return &limitError{Field: "bills", Count: bills, Max: maxBills}
+	}
+	return nil
+}
+
+// readLimitedBody 讀取請求內容，最多 maxRequestBody 位元組；失敗時回傳應回應的狀態碼與錯誤
+func readLimitedBody(w http.ResponseWriter, r *http.Request) ([]byte, int, *APIError) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return nil, http.StatusRequestEntityTooLarge, &APIError{
+			Code:    codePayloadTooLarge,
+			Message: fmt.Sprintf("請求內容超過 %d bytes", tooLarge.Limit),
+		}
+	case err != nil:
+		return nil, http.StatusBadRequest, &APIError{Code: codeInvalidBody, Message: "invalid body"}
+	}
+	return body, http.StatusOK, nil
+}
+
+// readBody 同 readLimitedBody，失敗時已回應錯誤
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, status, apiErr := readLimitedBody(w, r)
+	if apiErr != nil {
+		writeAPIError(w, status, apiErr)
+		return nil, apiErr
+	}
+	return body, nil
+}
+
+// decodeJSON 解析 JSON；strictJSON 時拒絕未知欄位與多餘的內容
+func decodeJSON(data []byte, v any) error {
+	if !strictJSON {
+		return json.Unmarshal(data, v)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("JSON 之後還有多餘的內容")
+	}
+	return nil
+}
+
+func writeInvalidJSON(w http.ResponseWriter, err error) {
+	writeErrorCode(w, http.StatusBadRequest, codeInvalidJSON, "invalid json: "+err.Error())
+}
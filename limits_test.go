@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useLimits 暫時調整請求限制，測試結束時還原
+func useLimits(t *testing.T, body int64, strict bool, people, bills int) {
+	t.Helper()
+	oldBody, oldStrict, oldPeople, oldBills := maxRequestBody, strictJSON, maxPeople, maxBills
+	maxRequestBody, strictJSON, maxPeople, maxBills = body, strict, people, bills
+	t.Cleanup(func() {
+		maxRequestBody, strictJSON, maxPeople, maxBills = oldBody, oldStrict, oldPeople, oldBills
+	})
+}
+
+// ==========================================
+// 請求大小與嚴格 JSON 測試
+// ==========================================
+func TestReadBodyAndStrictJSON(t *testing.T) {
+	withRoomState(t, newGlobalState())
+	useLimits(t, 64, false, 2, 2)
+
+	post := func(body string) (*httptest.ResponseRecorder, APIError) {
+		rec := httptest.NewRecorder()
+		handlePeople(rec, httptest.NewRequest(http.MethodPost, "/api/people", strings.NewReader(body)))
+		var e APIError
+		json.Unmarshal(rec.Body.Bytes(), &e)
+		return rec, e
+	}
+
+	if rec, e := post(`{"name":"` + strings.Repeat("a", 100) + `"}`); rec.Code != http.StatusRequestEntityTooLarge || e.Code != codePayloadTooLarge {
+		t.Errorf("超過上限應回 413, got %d %+v", rec.Code, e)
+	}
+	// 預設忽略未知欄位
+	if rec, _ := post(`{"name":"Alice","nickname":"A"}`); rec.Code != http.StatusCreated {
+		t.Errorf("未知欄位預設應忽略, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	strictJSON = true
+	if rec, e := post(`{"name":"Bob","nickname":"B"}`); rec.Code != http.StatusBadRequest || e.Code != codeInvalidJSON || !strings.Contains(e.Message, "nickname") {
+		t.Errorf("嚴格模式應拒絕未知欄位, got %d %+v", rec.Code, e)
+	}
+	if rec, _ := post(`{"name":"Bob"} {"name":"Eve"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("嚴格模式應拒絕多餘的內容, got %d", rec.Code)
+	}
+	if rec, _ := post(`{"name":"Bob"}`); rec.Code != http.StatusCreated {
+		t.Errorf("正確的內容應可新增, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 人員已達上限 2 人
+	if rec, e := post(`{"name":"Carol"}`); rec.Code != http.StatusUnprocessableEntity || e.Code != codeTooManyItems || e.Field != "people" {
+		t.Errorf("超過人數上限應回 422, got %d %+v", rec.Code, e)
+	}
+}
+
+// ==========================================
+// 數量上限測試（同步與計算）
+// ==========================================
+func TestLimits_SyncAndCalculate(t *testing.T) {
+	withRoomState(t, newGlobalState())
+	useLimits(t, 1<<20, false, 5, 2)
+
+	bills := make([]string, 3)
+	for i := range bills {
+		bills[i] = fmt.Sprintf(`{"id":%d,"title":"B%d","amount":10,"currency":"TWD","paidBy":1,"participants":[1]}`, i+1, i+1)
+	}
+	body := `{"baseCurrency":"TWD","people":[{"id":1,"name":"Alice"}],"bills":[` + strings.Join(bills, ",") + `]}`
+
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+	ifMatchCurrent(req)
+	rec := httptest.NewRecorder()
+	handleSync(rec, req)
+	var e APIError
+	json.Unmarshal(rec.Body.Bytes(), &e)
+	if rec.Code != http.StatusUnprocessableEntity || e.Code != codeTooManyItems || e.Field != "bills" {
+		t.Errorf("同步超過帳單上限應回 422, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	calc := func(body string) (*httptest.ResponseRecorder, CalculateResponse) {
+		rec := httptest.NewRecorder()
+		handleCalculate(rec, httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body)))
+		var resp CalculateResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+	if rec, resp := calc(body); rec.Code != http.StatusUnprocessableEntity || resp.Error == "" || resp.ErrorInfo == nil || resp.ErrorInfo.Code != codeTooManyItems {
+		t.Errorf("計算超過帳單上限應回 422, got %d %+v", rec.Code, resp)
+	}
+	if rec, resp := calc(`{`); rec.Code != http.StatusBadRequest || resp.ErrorInfo == nil || resp.ErrorInfo.Code != codeInvalidJSON {
+		t.Errorf("格式錯誤應回 400, got %d %+v", rec.Code, resp)
+	}
+	if rec, resp := calc(`{"baseCurrency":"TWD","people":[{"id":1,"name":"Alice"}],"bills":[` + bills[0] + `]}`); rec.Code != http.StatusOK || resp.Error != "" {
+		t.Errorf("正常的請求應可計算, got %d %+v", rec.Code, resp)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ================= 長輪詢同步 =================
+
+var (
+	// defaultSyncWait / maxSyncWait ?wait= 的預設值與上限
+	defaultSyncWait = 25 * time.Second
+	maxSyncWait     = 60 * time.Second
+	// syncRecheckInterval 共用儲存時其他實例的修改不會通知這裡，等待期間定期重新讀取
+	syncRecheckInterval = 2 * time.Second
+)
+
+// changeNotifier 狀態變更時喚醒所有等待中的請求：每次變更關閉目前的 channel 並換一個新的
+type changeNotifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait 回傳下一次變更時會被關閉的 channel
+func (n *changeNotifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+func (n *changeNotifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// parseSyncWait 解析 GET /api/sync?since=<lastUpdated>&wait=25s；沒有 since 時 ok 為 false（一般 GET）。
+// wait 可寫成 25s 或 25（秒），超過 maxSyncWait 以上限計
+func parseSyncWait(q url.Values) (since int64, wait time.Duration, ok bool, err error) {
+	if !q.Has("since") {
+		return 0, 0, false, nil
+	}
+	if since, err = strconv.ParseInt(q.Get("since"), 10, 64); err != nil {
+		return 0, 0, false, fmt.Errorf("since 必須是 lastUpdated 的毫秒數")
+	}
+	wait = defaultSyncWait
+	if s := q.Get("wait"); s != "" {
+		if n, err := strconv.Atoi(s); err == nil {
+			wait = time.Duration(n) * time.Second
+		} else if wait, err = time.ParseDuration(s); err != nil {
+			return 0, 0, false, fmt.Errorf("wait 格式錯誤，例如 25s")
+		}
+		if wait < 0 {
+			return 0, 0, false, fmt.Errorf("wait 不能是負數")
+		}
+	}
+	return since, min(wait, maxSyncWait), true, nil
+}
+
+// waitForStateChange 等到狀態的 LastUpdated 晚於 since、逾時或客戶端離開；changed 表示是否有新的狀態
+func (rm *room) waitForStateChange(ctx context.Context, since int64, wait time.Duration) (state GlobalState, changed bool, err error) {
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	recheck := time.NewTicker(syncRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		// 先取得 channel 再讀狀態，讀完到開始等待之間的變更才不會漏掉
+		next := rm.changes.wait()
+		if state, err = rm.currentState(); err != nil {
+			return GlobalState{}, false, err
+		}
+		if state.LastUpdated > since {
+			return state, true, nil
+		}
+		select {
+		case <-next:
+		case <-recheck.C:
+		case <-timeout.C:
+			return state, false, nil
+		case <-ctx.Done():
+			return state, false, ctx.Err()
+		}
+	}
+}
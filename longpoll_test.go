@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 長輪詢同步測試
+// ==========================================
+func TestParseSyncWait(t *testing.T) {
+	tests := []struct {
+		query   string
+		since   int64
+		wait    time.Duration
+		ok      bool
+		wantErr bool
+	}{
+		{"", 0, 0, false, false},
+		{"since=100", 100, defaultSyncWait, true, false},
+		{"since=100&wait=5s", 100, 5 * time.Second, true, false},
+		{"since=100&wait=10", 100, 10 * time.Second, true, false},
+		{"since=100&wait=10m", 100, maxSyncWait, true, false},
+		{"since=abc", 0, 0, false, true},
+		{"since=1&wait=soon", 0, 0, false, true},
+		{"since=1&wait=-5s", 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		q, _ := url.ParseQuery(tt.query)
+		since, wait, ok, err := parseSyncWait(q)
+		if since != tt.since || wait != tt.wait || ok != tt.ok || (err != nil) != tt.wantErr {
+			t.Errorf("parseSyncWait(%q) = %d, %v, %v, %v", tt.query, since, wait, ok, err)
+		}
+	}
+}
+
+func TestHandleSync_LongPoll(t *testing.T) {
+	state := newGlobalState()
+	state.LastUpdated = 1000
+	withRoomState(t, state)
+
+	get := func(query string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleSync(rec, httptest.NewRequest(http.MethodGet, "/api/sync?"+query, nil))
+		return rec
+	}
+
+	// 已經有比 since 新的狀態：立刻回應
+	if rec := get("since=999&wait=5s"); rec.Code != http.StatusOK {
+		t.Errorf("有新狀態應立即回傳 200, got %d", rec.Code)
+	}
+
+	// 沒有變更：逾時回 304
+	start := time.Now()
+	if rec := get("since=1000&wait=50ms"); rec.Code != http.StatusNotModified {
+		t.Errorf("逾時應回傳 304, got %d", rec.Code)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("應等到逾時才回應")
+	}
+
+	// 等待期間有人修改：立刻喚醒並回傳新狀態
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- get("since=1000&wait=5s") }()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := updateState(func(s *GlobalState) error {
+		s.BaseCurrency = "JPY"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case rec := <-done:
+		var state GlobalState
+		json.Unmarshal(rec.Body.Bytes(), &state)
+		if rec.Code != http.StatusOK || state.BaseCurrency != "JPY" {
+			t.Errorf("got %d %+v", rec.Code, state)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("修改後等待中的請求應被喚醒")
+	}
+
+	if rec := get("since=x"); rec.Code != http.StatusBadRequest {
+		t.Errorf("since 格式錯誤應回傳 400, got %d", rec.Code)
+	}
+}
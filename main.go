@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	_ "embed"
 	"encoding/json"
 	"errors"
@@ -8,10 +9,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
+	"math"
 	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -27,36 +33,187 @@ var indexHTML string
 type Person struct {
 	ID   int    `json:"id"`
 	Name string `json:"name"`
+	// Weight 收入比例（例如 2 代表收入是別人的兩倍），SplitMode 為 "income" 的帳單依此分攤；0 代表 1
+	Weight float64 `json:"weight,omitempty"`
+	// PreferredCurrency 偏好的幣別（例如住在日本的朋友用 JPY），結算時另外以這個幣別列出要付的金額
+	PreferredCurrency string `json:"preferredCurrency,omitempty"`
+	DeletedAt         int64  `json:"deletedAt,omitempty"`
+	// Revision、UpdatedAt、UpdatedBy 同 Bill，合併同步時使用
+	Revision  int64  `json:"revision,omitempty"`
+	UpdatedAt int64  `json:"updatedAt,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty"`
 }
 
 type Bill struct {
 	ID           int     `json:"id"`
+	Type         string  `json:"type,omitempty"` // "" 一般消費；"transfer" 還款/轉帳
 	Title        string  `json:"title"`
+	Date         string  `json:"date,omitempty"` // 消費日期 YYYY-MM-DD
 	Amount       float64 `json:"amount"`
 	Category     string  `json:"category,omitempty"`
 	Currency     string  `json:"currency,omitempty"`
 	AmountBase   float64 `json:"amountBase,omitempty"`
 	PaidBy       int     `json:"paidBy"`
 	Participants []int   `json:"participants"`
+	// Groups 引用的群組 ID，計算時展開成群組成員並與 Participants 合併
+	Groups []int `json:"groups,omitempty"`
+	// Treat 請客：付款人全額負擔、不需要其他人還錢，只計入花費統計，不影響結算
+	Treat bool `json:"treat,omitempty"`
+	// Guests 不在人員名單中的臨時參加者（只有名字，例如只來吃一頓晚餐的朋友）
+	Guests []string `json:"guests,omitempty"`
+	// Shares 依權重分攤（personID → 份數），未列出的參與者算 1 份；空的代表平均分攤
+	Shares map[int]float64 `json:"shares,omitempty"`
+	// SplitMode "income" 依成員的收入比例（Person.Weight）分攤，計算時換成 Shares
+	SplitMode string `json:"splitMode,omitempty"`
+	// ExactAmounts 每位參與者各自應付的金額（以帳單幣別計），總和須等於 Amount
+	ExactAmounts map[int]float64 `json:"exactAmounts,omitempty"`
+	// LineItems 逐項分帳（例如每道菜由不同的人分），計算時總和會取代 Amount
+	LineItems []BillItem `json:"lineItems,omitempty"`
+	// 小費、稅、服務費（帳單幣別，不含在 Amount 內），ExtrasSplit 決定怎麼分攤
+	Tip           float64 `json:"tip,omitempty"`
+	Tax           float64 `json:"tax,omitempty"`
+	ServiceCharge float64 `json:"serviceCharge,omitempty"`
+	ExtrasSplit   string  `json:"extrasSplit,omitempty"`
+	// ManualRate 信用卡帳單上的實際匯率：1 單位帳單幣別 = ManualRate 本位幣，優先於抓取的匯率
+	ManualRate float64 `json:"manualRate,omitempty"`
+	// FXFeePercent 覆寫這筆帳單的海外交易手續費（%），例如付現金時填 0；nil 代表使用團體設定
+	FXFeePercent *float64 `json:"fxFeePercent,omitempty"`
+	// Payers 多人分別付款（例如兩張卡各刷一部分），有值時取代 PaidBy
+	Payers []Payer  `json:"payers,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Notes  string   `json:"notes,omitempty"`
+	// Recurrence 週期規則（房租、串流訂閱），伺服器會自動產生之後的每一期
+	Recurrence *Recurrence `json:"recurrence,omitempty"`
+	// RecurrenceOf 由哪一筆週期帳單自動產生
+	RecurrenceOf int `json:"recurrenceOf,omitempty"`
+	// Attachments 收據照片，只能透過 /api/bills/{id}/attachments 增刪
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Comments 討論串，透過 /api/bills/{id}/comments 新增，隨同步一起下發
+	Comments []Comment `json:"comments,omitempty"`
+	// Locked 結算後鎖定，只有管理者能透過 /api/unlock 解除
+	Locked    bool  `json:"locked,omitempty"`
+	DeletedAt int64 `json:"deletedAt,omitempty"`
+	// Revision 最後一次變更（含刪除）時的狀態版本，由伺服器填寫；UpdatedAt 為該次編輯的時間（Unix 毫秒），
+	// 客戶端可帶上離線編輯當下的時間。兩台裝置各自改了同一張帳單時，合併同步依此判斷
+	Revision  int64 `json:"revision,omitempty"`
+	UpdatedAt int64 `json:"updatedAt,omitempty"`
+	// UpdatedBy 最後修改的裝置（裝置清單的 id），編輯時間相同時用來決定離線合併的勝負
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	// Version 這張帳單的第幾版，每次修改（含刪除）加 1，由伺服器填寫。客戶端送出時保留收到的值，
+	// 伺服器才知道這次修改依據哪一版，與其他裝置同時修改時逐欄位合併
+	Version int `json:"version,omitempty"`
+}
+
+// Payer 某位付款人為帳單付出的金額（帳單幣別，含小費、稅、服務費）
+type Payer struct {
+	PersonID int     `json:"personId"`
+	Amount   float64 `json:"amount"`
+}
+
+// BillItem 帳單中的一個品項，金額以帳單幣別計；Participants 為空時由整張帳單的參與者平分
+type BillItem struct {
+	Name         string  `json:"name"`
+	Amount       float64 `json:"amount"`
+	Participants []int   `json:"participants,omitempty"`
 }
 
 type Settlement struct {
 	From   string  `json:"from"`
 	To     string  `json:"to"`
 	Amount float64 `json:"amount"`
+	// PreferredCurrency、PreferredAmount 以付款人（From）偏好的幣別表示的金額，
+	// 用計算時同一組匯率換算；沒有設定偏好幣別或與本位幣相同時省略
+	PreferredCurrency string  `json:"preferredCurrency,omitempty"`
+	PreferredAmount   float64 `json:"preferredAmount,omitempty"`
 }
 
 type GlobalState struct {
-	People       []Person `json:"people"`
-	Bills        []Bill   `json:"bills"`
-	BaseCurrency string   `json:"baseCurrency"`
-	LastUpdated  int64    `json:"lastUpdated"`
+	SchemaVersion int      `json:"schemaVersion"`
+	People        []Person `json:"people"`
+	Bills         []Bill   `json:"bills"`
+	BaseCurrency  string   `json:"baseCurrency"`
+	LastUpdated   int64    `json:"lastUpdated"`
+	// Revision 每次變更加 1，客戶端推送時以 If-Match 帶上依據的版本，落後就拒絕
+	Revision  int64      `json:"revision"`
+	Snapshots []Snapshot `json:"snapshots,omitempty"`
+	// OpeningBalances 開帳前既有的欠款，計算時一併結清
+	OpeningBalances []OpeningBalance `json:"openingBalances,omitempty"`
+	// Categories 分類清單（名稱、圖示、顏色），透過 /api/categories 管理
+	Categories []Category `json:"categories"`
+	Groups     []Group    `json:"groups,omitempty"`
+	// Templates 快速新增用的帳單範本，透過 /api/templates 管理
+	Templates []BillTemplate `json:"templates,omitempty"`
+	// Budgets 個人或分類的預算上限，超出時計算結果會附上提醒
+	Budgets []Budget `json:"budgets,omitempty"`
+	// Constraints 結算偏好，計算時隨請求送出
+	Constraints []SettlementConstraint `json:"constraints,omitempty"`
+	// FinalizedAt 最近一次結算鎖定的時間（Unix 毫秒），FinalizedBy 為執行者
+	FinalizedAt int64  `json:"finalizedAt,omitempty"`
+	FinalizedBy string `json:"finalizedBy,omitempty"`
+	// Activity 動態紀錄，由伺服器在每次變更時附加，透過 /api/activity 查詢
+	Activity []Activity `json:"activity,omitempty"`
+	// RateTable 團體自訂的匯率，透過 /api/rates 管理，計算時隨請求送出
+	RateTable *RateTable `json:"rateTable,omitempty"`
+	// LockedRates 鎖定的匯率，透過 /api/rates/lock 管理，計算時隨請求送出
+	LockedRates *LockedRates `json:"lockedRates,omitempty"`
+	// FXFeePercent 海外交易手續費（%），計算時隨請求送出
+	FXFeePercent float64 `json:"fxFeePercent,omitempty"`
+	// LastRates 上次計算用的匯率（回應的 rateSnapshot），計算時以 previousRates 送出，匯率大幅變動時提醒
+	LastRates *RateSnapshot `json:"lastRates,omitempty"`
+	// Webhooks 事件通知的對象，透過 /api/webhooks 管理，不隨同步送給客戶端
+	Webhooks []Webhook `json:"webhooks,omitempty"`
+	// ArchivedAt 房間封存的時間（Unix 毫秒），封存後只能檢視；透過 /api/rooms/{code}/archive 管理
+	ArchivedAt int64 `json:"archivedAt,omitempty"`
+	// BillHistory 帳單的舊版本，由伺服器在每次修改時附加，透過 /api/bills/{id}/history 查詢
+	BillHistory []Bill `json:"billHistory,omitempty"`
 }
 
 type CalculateRequest struct {
 	BaseCurrency string   `json:"baseCurrency,omitempty"`
 	People       []Person `json:"people"`
 	Bills        []Bill   `json:"bills"`
+	// From / To (YYYY-MM-DD，含當天) 只結算這段期間內的帳單
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// OpeningBalances 期初欠款；指定了 From 時視為在期間之前，不列入
+	OpeningBalances []OpeningBalance `json:"openingBalances,omitempty"`
+	// Groups 帳單 Groups 欄位引用的群組定義
+	Groups  []Group  `json:"groups,omitempty"`
+	Budgets []Budget `json:"budgets,omitempty"`
+	// SettlementStrategy 結算方式："greedy"、"minimal"（轉帳次數最少，適合人數不多時）或 "hub"（全部透過一個人轉帳）；
+	// 空的代表 -settlement-strategy 指定的預設
+	SettlementStrategy string `json:"settlementStrategy,omitempty"`
+	// SettlementHub "hub" 結算時由誰負責收付（例如財務），留空代表淨額最大的人；只指定這個欄位時自動使用 "hub"
+	SettlementHub int `json:"settlementHub,omitempty"`
+	// SettlementEpsilon 淨額不超過這個金額（本位幣）就視為已結清；0 代表本位幣的最小單位（TWD 0.01、JPY 1）
+	SettlementEpsilon float64 `json:"settlementEpsilon,omitempty"`
+	// RemainderPolicy 除不盡的餘數由誰負擔："payer"、"rotate"、"largest"，空的代表小數部分最大的人
+	RemainderPolicy string `json:"remainderPolicy,omitempty"`
+	// Constraints 結算偏好：哪些人之間盡量（或盡量不要）直接轉帳
+	Constraints []SettlementConstraint `json:"constraints,omitempty"`
+	// ForgiveBelow 低於這個金額（本位幣）的轉帳直接免除，例如 10 代表不到 10 元就不用還
+	ForgiveBelow float64 `json:"forgiveBelow,omitempty"`
+	// CashRounding 現金結算：每筆轉帳湊整到 CashUnit 的倍數，CashUnit 留空時依本位幣（TWD 10、JPY 100）
+	CashRounding bool    `json:"cashRounding,omitempty"`
+	CashUnit     float64 `json:"cashUnit,omitempty"`
+	// Explain 回應附上每張帳單的換算匯率與分攤明細
+	Explain bool `json:"explain,omitempty"`
+	// Interest 逾期利息：欠款超過寬限天數後依年利率計息，利息另列在回應的 interest 並計入結算
+	Interest *InterestOptions `json:"interest,omitempty"`
+	// RateTable 自訂匯率表，優先於抓取的匯率
+	RateTable *RateTable `json:"rateTable,omitempty"`
+	// LockedRates 鎖定的匯率，取代最新匯率
+	LockedRates *LockedRates `json:"lockedRates,omitempty"`
+	// FXFeePercent 海外交易手續費（%，例如 1.5），外幣帳單換算後加上，反映付款人的卡實際被收的金額
+	FXFeePercent float64 `json:"fxFeePercent,omitempty"`
+	// RateDate (YYYY-MM-DD) 指定時一律用那一天的匯率換算（手動匯率與自訂匯率表除外），方便與銀行對帳單核對
+	RateDate string `json:"rateDate,omitempty"`
+	// PreviousRates 上次計算的 rateSnapshot；匯率變動超過 RateAlertPercent%（0 代表 3%）時回應附上 rateAlerts
+	PreviousRates    *RateSnapshot `json:"previousRates,omitempty"`
+	RateAlertPercent float64       `json:"rateAlertPercent,omitempty"`
+	// DryRun 試算（例如輸入時即時預覽）：只用快取、內建快照與請求提供的匯率，不連網，
+	// 也不更新匯率快取、統計或發出 calculation-done 事件
+	DryRun bool `json:"dryRun,omitempty"`
 }
 
 type CalculateResponse struct {
@@ -64,59 +221,142 @@ type CalculateResponse struct {
 	Bills        []Bill       `json:"bills,omitempty"`
 	BaseCurrency string       `json:"baseCurrency,omitempty"`
 	RateDate     string       `json:"rateDate,omitempty"`
-	Error        string       `json:"error,omitempty"`
+	// RateNotice 使用內建離線匯率時的提醒（說明匯率日期）
+	RateNotice string `json:"rateNotice,omitempty"`
+	// ManualRateBills 使用手動匯率換算的帳單 ID
+	ManualRateBills []int `json:"manualRateBills,omitempty"`
+	// Rates 每張外幣帳單換算時用的匯率與來源，方便核對
+	Rates []AppliedRate `json:"rates,omitempty"`
+	// RateWarnings 匯率來源的資料不合理、改用上次匯率（或無法換算）的幣別
+	RateWarnings []RateWarning `json:"rateWarnings,omitempty"`
+	// RateSnapshot 這次計算用的最新匯率，存回狀態的 lastRates；RateAlerts 與 previousRates 相比變動過大的匯率
+	RateSnapshot *RateSnapshot `json:"rateSnapshot,omitempty"`
+	RateAlerts   []RateAlert   `json:"rateAlerts,omitempty"`
+	// BudgetWarnings 超出預算的提醒（不影響結算）
+	BudgetWarnings []BudgetWarning `json:"budgetWarnings,omitempty"`
+	// Rounding 除不盡時每個人多負擔（或少負擔）的金額
+	Rounding []RoundingAdjustment `json:"rounding,omitempty"`
+	// Warnings 無法照結算偏好安排的配對
+	Warnings []string `json:"warnings,omitempty"`
+	// Forgiven 因金額太小而免除的轉帳，ForgivenTotal 為總額
+	Forgiven      []Settlement `json:"forgiven,omitempty"`
+	ForgivenTotal float64      `json:"forgivenTotal,omitempty"`
+	// CashUnit 現金結算湊整的單位，CashAdjustments 為每個人因此多收或少付的金額
+	CashUnit        float64          `json:"cashUnit,omitempty"`
+	CashAdjustments []CashAdjustment `json:"cashAdjustments,omitempty"`
+	// Interest 逐筆的利息明細，InterestTotal 為總額
+	Interest      []InterestEntry `json:"interest,omitempty"`
+	InterestTotal float64         `json:"interestTotal,omitempty"`
+	// Explanations 每張帳單的分攤明細（請求帶 explain 時才有）
+	Explanations []BillExplanation `json:"explanations,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	// Errors 欄位層級的驗證錯誤，Error 為合併後的訊息
+	Errors []FieldError `json:"errors,omitempty"`
+	// ErrorInfo 與 HTTP API 相同的錯誤格式（code、message、field、details）；Error 保留給既有的桌面版介面
+	ErrorInfo *APIError `json:"errorInfo,omitempty"`
 }
 
 type rateEntry struct {
 	Rates     map[string]float64
 	Date      string
 	FetchedAt time.Time
+	// Offline 來自內建的匯率快照，而不是匯率 API
+	Offline bool
+	// Locked 來自狀態中鎖定的匯率
+	Locked bool
+	// Historical 請求指定日期（rateDate）當天的匯率
+	Historical bool
+	// Warnings 匯率來源給了不合理的匯率而被捨棄的幣別
+	Warnings []RateWarning
+	// TTL 匯率來源以 Cache-Control 指定的有效時間，0 代表使用 rateCacheTTL
+	TTL time.Duration
+}
+
+// fresh 在 now 時是否還沒超過有效時間
+func (e rateEntry) fresh(now time.Time) bool {
+	ttl := rateCacheTTL
+	if e.TTL > 0 {
+		ttl = e.TTL
+	}
+	return now.Sub(e.FetchedAt) < ttl
 }
 
 // ================= 全域變數（保留原有功能） =================
 
 var (
-	projectState = GlobalState{
-		People:       []Person{},
-		Bills:        []Bill{},
-		BaseCurrency: "TWD",
-		LastUpdated:  time.Now().UnixMilli(),
-	}
-	stateMutex sync.Mutex
-
-	// exchange API template (unchanged)
+	// exchangeAPIBase currency-api 的預設網址；rateCacheTTL 可用 -rate-ttl 調整
 	exchangeAPIBase = "https://cdn.jsdelivr.net/npm/@fawazahmed0/currency-api@latest/v1/currencies/%s.json"
 	defaultBase     = "TWD"
 	rateCacheTTL    = 30 * time.Minute
+	// rateRefreshTimeout 背景更新匯率的時間上限
+	rateRefreshTimeout = 30 * time.Second
+	// rateFetchAttempts 每次抓取最多嘗試幾次，重試前以 rateRetryBase 為單位指數退避
+	rateFetchAttempts = 3
+	rateRetryBase     = 200 * time.Millisecond
 )
 
 // ================= RateFetcher interface & HTTP implementation =================
 
-// RateFetcher 抽象化外部匯率來源
+// RateFetcher 抽象化外部匯率來源；ctx 取消時（例如客戶端已斷線）應盡快放棄
 type RateFetcher interface {
-	Fetch(base string) (rateEntry, error)
+	Fetch(ctx context.Context, base string) (rateEntry, error)
 }
 
+// DatedRateFetcher 可以取得某一天的匯率（日期格式 YYYY-MM-DD）
+type DatedRateFetcher interface {
+	FetchDate(ctx context.Context, base, date string) (rateEntry, error)
+}
+
+var errNoHistoricalRates = errors.New("匯率來源不支援歷史匯率")
+
 type HTTPRateFetcher struct {
 	baseURL string
 	client  *http.Client
+
+	mu sync.Mutex
+	// validators 每個網址上次的 ETag、Last-Modified 與解析結果，下次以條件式請求詢問是否有更新
+	validators map[string]httpValidator
 }
 
 func NewHTTPRateFetcher(baseURL string) *HTTPRateFetcher {
 	return &HTTPRateFetcher{
-		baseURL: baseURL,
-		client:  &http.Client{Timeout: 5 * time.Second},
+		baseURL:    baseURL,
+		client:     &http.Client{Timeout: 5 * time.Second},
+		validators: make(map[string]httpValidator),
 	}
 }
 
-func (h *HTTPRateFetcher) Fetch(base string) (rateEntry, error) {
-	urlStr := fmt.Sprintf(h.baseURL, base)
-	resp, err := h.client.Get(urlStr)
+func (h *HTTPRateFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	return h.fetchURL(ctx, fmt.Sprintf(h.baseURL, base), base)
+}
+
+// fetchURL 帶上次的 ETag / Last-Modified 發出條件式請求；304 時沿用上次的匯率。
+// 回應的 Cache-Control max-age 記在 rateEntry.TTL，取代固定的 rateCacheTTL
+func (h *HTTPRateFetcher) fetchURL(ctx context.Context, urlStr, base string) (rateEntry, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return rateEntry{}, err
+	}
+	h.mu.Lock()
+	prev, hasPrev := h.validators[urlStr]
+	h.mu.Unlock()
+	if hasPrev {
+		prev.apply(req)
+	}
+	resp, err := h.client.Do(req)
 	if err != nil {
 		return rateEntry{}, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && hasPrev {
+		rateStats.notModified.Add(1)
+		entry := prev.entry
+		if ttl, ok := cacheTTL(resp.Header); ok {
+			entry.TTL = ttl
+		}
+		return entry, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return rateEntry{}, fmt.Errorf("HTTP %d", resp.StatusCode)
 	}
@@ -126,7 +366,25 @@ func (h *HTTPRateFetcher) Fetch(base string) (rateEntry, error) {
 		return rateEntry{}, err
 	}
 
-	return parseRateResponse(base, body)
+	entry, err := parseRateResponse(base, body)
+	if err != nil {
+		return rateEntry{}, err
+	}
+	entry.TTL, _ = cacheTTL(resp.Header)
+	if v, ok := newHTTPValidator(resp.Header, entry); ok {
+		h.mu.Lock()
+		h.validators[urlStr] = v
+		h.mu.Unlock()
+	}
+	return entry, nil
+}
+
+// FetchDate 匯率 API 以 @YYYY-MM-DD 取代網址中的 @latest 取得當天的匯率
+func (h *HTTPRateFetcher) FetchDate(ctx context.Context, base, date string) (rateEntry, error) {
+	if !strings.Contains(h.baseURL, "@latest") {
+		return rateEntry{}, errNoHistoricalRates
+	}
+	return h.fetchURL(ctx, fmt.Sprintf(strings.Replace(h.baseURL, "@latest", "@"+date, 1), base), base)
 }
 
 // ================= RateCache (thread-safe) =================
@@ -149,7 +407,11 @@ func (rc *RateCache) Get(base string) (rateEntry, bool) {
 	return e, ok
 }
 
+// Set 存入匯率；沒有 FetchedAt 時以 clock 的目前時間為準
 func (rc *RateCache) Set(base string, e rateEntry) {
+	if e.FetchedAt.IsZero() {
+		e.FetchedAt = clock.Now()
+	}
 	rc.mu.Lock()
 	defer rc.mu.Unlock()
 	rc.cache[base] = e
@@ -157,7 +419,40 @@ func (rc *RateCache) Set(base string, e rateEntry) {
 
 var rateCache = NewRateCache()
 
-// 供測試或特殊情境外部替換 fetcher
+// ================= 背景更新匯率 =================
+
+// rateRefresher 快取過期時在背景更新匯率，計算不必等待；同一個本位幣同時只會有一個更新在跑。
+// 背景更新不跟著觸發它的請求取消，改以 rateRefreshTimeout 為限
+type rateRefresher struct {
+	mu       sync.Mutex
+	inflight map[string]bool
+	wg       sync.WaitGroup
+}
+
+func (rr *rateRefresher) refresh(base string) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if rr.inflight[base] {
+		return
+	}
+	rr.inflight[base] = true
+	rr.wg.Add(1)
+	go func() {
+		defer rr.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), rateRefreshTimeout)
+		defer cancel()
+		if _, err := fetchRates(ctx, base); err != nil {
+			log.Printf("refresh rates for %s failed: %v", base, err)
+		}
+		rr.mu.Lock()
+		delete(rr.inflight, base)
+		rr.mu.Unlock()
+	}()
+}
+
+var rateRefresh = &rateRefresher{inflight: make(map[string]bool)}
+
+// 供測試或特殊情境外部替換 fetcher；啟動時依 -rate-provider、-rate-url 設定
 var rateFetcher RateFetcher = NewHTTPRateFetcher(exchangeAPIBase)
 
 // ================= 主程式 =================
@@ -165,16 +460,176 @@ var rateFetcher RateFetcher = NewHTTPRateFetcher(exchangeAPIBase)
 func main() {
 	serverMode := flag.Bool("server", false, "啟動 HTTP 伺服器模式")
 	port := flag.String("port", "8080", "HTTP 伺服器連接埠")
+	grpcPort := flag.String("grpc-port", "", "gRPC 服務的連接埠（HTTP/2 明文），空的代表不啟動")
+	statePath := flag.String("state", "", "狀態檔路徑（伺服器模式，留空則只存在記憶體）")
+	passphrase := flag.String("passphrase", "", "狀態檔加密密碼（也可用環境變數 "+passphraseEnvVar+"）")
+	journalPath := flag.String("journal", "", "以 append-only 日誌保存每一次變更（取代 -state 的整檔覆寫）")
+	autosave := flag.Bool("autosave", true, "桌面版自動存檔（未指定 -state 時存到系統設定目錄）")
+	lanCode := flag.String("lan-sync", "", "桌面版：與同一個區網、使用相同配對碼的其他桌面版直接同步（mDNS 探索）")
+	webdavURL := flag.String("webdav", "", "WebDAV 狀態檔網址（帳密用環境變數 WEBDAV_USER、WEBDAV_PASSWORD）")
+	pgDSN := flag.String("pg", "", "PostgreSQL 連線字串，多個伺服器實例共用狀態（也可用環境變數 DATABASE_URL）")
+	var pgPool PGPoolConfig
+	flag.IntVar(&pgPool.MaxOpenConns, "pg-max-open", 10, "PostgreSQL 最大連線數")
+	flag.IntVar(&pgPool.MaxIdleConns, "pg-max-idle", 5, "PostgreSQL 最大閒置連線數")
+	flag.DurationVar(&pgPool.ConnMaxLifetime, "pg-conn-lifetime", 30*time.Minute, "PostgreSQL 連線最長存活時間")
+	flag.DurationVar(&trashRetention, "trash-retention", trashRetention, "垃圾桶保留時間，超過後永久刪除")
+	var s3cfg S3Config
+	flag.StringVar(&s3cfg.Endpoint, "s3-endpoint", "", "S3 相容備份服務網址（AWS、MinIO、R2）")
+	flag.StringVar(&s3cfg.Bucket, "s3-bucket", "", "備份用 bucket")
+	flag.StringVar(&s3cfg.Region, "s3-region", "us-east-1", "S3 區域")
+	flag.StringVar(&s3cfg.Prefix, "s3-prefix", "bill-splitter/", "備份檔案的 key 前綴")
+	backupInterval := flag.Duration("backup-interval", time.Hour, "自動備份間隔（伺服器模式）")
+	flag.StringVar(&dataDir, "data-dir", dataDir, "伺服器存放收據附件的目錄")
+	flag.StringVar(&adminToken, "admin-token", "", "解除結算鎖定用的管理者權杖（也可用環境變數 "+adminTokenEnvVar+"）")
+	recurInterval := flag.Duration("recurrence-interval", time.Hour, "檢查並產生週期帳單的間隔（伺服器模式）")
+	var rateCfg RateConfig
+	flag.StringVar(&rateCfg.Provider, "rate-provider", providerCurrencyAPI, "匯率來源（currency-api、frankfurter）")
+	flag.StringVar(&rateCfg.URL, "rate-url", "", "匯率 API 網址，可指向代理或自架鏡像（留空使用匯率來源的預設網址）")
+	flag.DurationVar(&rateCfg.TTL, "rate-ttl", rateCacheTTL, "匯率快取的有效時間")
+	flag.StringVar(&rateCfg.Mode, "rates", "", "改用本機匯率檔，例如 static:rates.json（展示、無網路環境或端對端測試）")
+	flag.StringVar(&defaultSettlementStrategy, "settlement-strategy", settleGreedy, "請求沒有指定時的結算方式（greedy、minimal、hub）")
+	verifyState := flag.Bool("verify-state", false, "檢查 -state 狀態檔的完整性後結束")
+	var corsCfg CORSConfig
+	flag.StringVar(&corsCfg.Origins, "cors-origins", "", "允許跨來源呼叫 API 的網站，逗號分隔（例如 https://a.example,https://b.example；* 為任何來源）")
+	flag.StringVar(&corsCfg.Methods, "cors-methods", defaultCORSMethods, "跨來源允許的 HTTP 方法")
+	flag.StringVar(&corsCfg.Headers, "cors-headers", defaultCORSHeaders, "跨來源允許的請求標頭")
+	flag.DurationVar(&corsCfg.MaxAge, "cors-max-age", 10*time.Minute, "瀏覽器快取預檢結果的時間")
+	flag.Int64Var(&maxRequestBody, "max-body", maxRequestBody, "API 請求內容的上限（bytes），超過回 413")
+	flag.BoolVar(&strictJSON, "strict-json", false, "JSON 有未知欄位時拒絕（預設忽略）")
+	flag.IntVar(&maxPeople, "max-people", maxPeople, "一次送來的人員數量上限，超過回 422")
+	flag.IntVar(&maxBills, "max-bills", maxBills, "一次送來的帳單數量上限，超過回 422")
 	flag.Parse()
 
+	if *passphrase == "" {
+		*passphrase = os.Getenv(passphraseEnvVar)
+	}
+	if adminToken == "" {
+		adminToken = os.Getenv(adminTokenEnvVar)
+	}
+	if *pgDSN == "" {
+		*pgDSN = os.Getenv("DATABASE_URL")
+	}
+	if err := validateSettlementStrategy(defaultSettlementStrategy); err != nil {
+		log.Fatal(err)
+	}
+	if err := configureRates(rateCfg); err != nil {
+		log.Fatal(err)
+	}
+	cors, err := newCORSPolicy(corsCfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	serverCORS = cors
+
+	if *verifyState {
+		if *statePath == "" {
+			log.Fatal("-verify-state 需要搭配 -state")
+		}
+		problems := verifyStateFile(*statePath, *passphrase)
+		for _, p := range problems {
+			fmt.Println("✗", p)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
+		fmt.Println("✓ 狀態檔完整：", *statePath)
+		return
+	}
+
+	// 其他房間與預設房間使用相同的後端，各自一份狀態
+	var store Store
+	var rooms roomStores
+	switch {
+	case *pgDSN != "":
+		if *passphrase != "" {
+			log.Fatal("-pg 目前不支援加密（狀態以 JSONB 存在資料庫），請拿掉 -passphrase 或改用 -state、-webdav")
+		}
+		pg, err := NewPGStore(*pgDSN, pgPool)
+		if err != nil {
+			log.Fatalf("connect postgres: %v", err)
+		}
+		defer pg.Close()
+		store, rooms = pg, pg.rooms()
+	case *webdavURL != "":
+		user, password := os.Getenv("WEBDAV_USER"), os.Getenv("WEBDAV_PASSWORD")
+		store = NewWebDAVStore(*webdavURL, user, password, *passphrase)
+		// 房間清單沿用本機的房間目錄（建立房間時也會建立，放收據附件）
+		rooms = dirRoomStores(nil)
+		rooms.open = func(code string) Store {
+			return NewWebDAVStore(webdavRoomURL(*webdavURL, code), user, password, *passphrase)
+		}
+	case *journalPath != "":
+		if *passphrase != "" {
+			log.Fatal("-journal 目前不支援加密，請改用 -state")
+		}
+		store = NewJournalStore(*journalPath)
+		rooms = dirRoomStores(func(dir string) Store { return NewJournalStore(filepath.Join(dir, "state.journal")) })
+	case *statePath != "":
+		store = NewFileStore(*statePath, *passphrase)
+		rooms = dirRoomStores(func(dir string) Store { return NewFileStore(filepath.Join(dir, "state.json"), *passphrase) })
+	}
+
+	var backup *S3Backup
+	if s3cfg.Endpoint != "" && s3cfg.Bucket != "" {
+		s3cfg.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		s3cfg.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		backup = NewS3Backup(s3cfg, *passphrase)
+	}
+
+	if flag.Arg(0) == "restore-backup" {
+		if err := restoreLatestBackup(backup, store); err != nil {
+			log.Fatalf("restore-backup: %v", err)
+		}
+		return
+	}
+
+	if cmd := flag.Arg(0); cmd == "export" || cmd == "import" {
+		if err := runStateCommand(store, flag.Args()); err != nil {
+			log.Fatalf("%s: %v", cmd, err)
+		}
+		return
+	}
+
 	if *serverMode {
+		if store != nil {
+			if err := loadStateStore(store); err != nil {
+				log.Fatalf("load state: %v", err)
+			}
+			if err := serverRooms.load(rooms); err != nil {
+				log.Fatalf("load rooms: %v", err)
+			}
+		}
+		if backup != nil {
+			go runBackupLoop(backup, *backupInterval)
+		}
+		go runRecurrenceLoop(*recurInterval)
+		go runRatePrefetchLoop(rateCacheTTL / 3)
+		serverRooms.serve(context.Background())
+		if *grpcPort != "" {
+			go runGRPCServer(*grpcPort)
+		}
 		runServer(*port)
 	} else {
-		runDesktop()
+		switch {
+		case !*autosave:
+			store = nil
+		case store == nil:
+			store = desktopAutosaveStore(*passphrase)
+		}
+		runDesktop(store, *lanCode)
 	}
 }
 
-func runDesktop() {
+// runDesktop 啟動 webview；store 不為 nil 時每次變更都自動存檔，下次開啟時載入；
+// lanCode 不為空時與區網上配對碼相同的桌面版同步
+func runDesktop(store Store, lanCode string) {
+	if store != nil {
+		if err := loadStateStore(store); err != nil {
+			log.Printf("autosave disabled, load state failed: %v", err)
+			store = nil
+		}
+	}
+
 	runtime.LockOSThread()
 	w := webview.New(true)
 	defer w.Destroy()
@@ -184,43 +639,95 @@ func runDesktop() {
 	// 綁定計算函數（desktop 版本仍保持原有行為）
 	// webview 的 Bind 需要函數型態符合條件；我們保持 processCalculate 的簽名
 	w.Bind("calculateSplit", processCalculate)
+	if store != nil {
+		w.Bind("loadState", desktopLoadState)
+		w.Bind("saveState", desktopSaveState)
+	}
+	if lanCode != "" {
+		// 其他台的修改併入後推給畫面；Eval 必須在 UI 執行緒呼叫
+		lan, err := startLANSync(defaultRoom, lanCode, func(state GlobalState) {
+			data, err := json.Marshal(visibleState(state))
+			if err != nil {
+				return
+			}
+			w.Dispatch(func() {
+				w.Eval("window.onLanSync && window.onLanSync(" + string(data) + ")")
+			})
+		})
+		if err != nil {
+			log.Printf("lan sync disabled: %v", err)
+		} else {
+			defer lan.close()
+			desktopDeviceID = lan.id
+			log.Printf("lan sync enabled, device %s", lan.id)
+		}
+	}
 
 	dataURI := "data:text/html;charset=utf-8," + url.PathEscape(indexHTML)
 	w.Navigate(dataURI)
 	w.Run()
 }
 
-func runServer(port string) {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		if _, err := w.Write([]byte(indexHTML)); err != nil {
-			log.Printf("write index failed: %v", err)
-		}
-	})
-
-	http.HandleFunc("/api/calculate", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-
-		body, err := io.ReadAll(r.Body)
-		if err != nil {
-			http.Error(w, "failed read body", http.StatusBadRequest)
-			return
-		}
-		defer r.Body.Close()
-
-		resultJSON := processCalculate(string(body))
-
-		w.Header().Set("Content-Type", "application/json")
-		if _, err := w.Write([]byte(resultJSON)); err != nil {
-			log.Printf("/api/calculate write failed: %v", err)
-		}
-	})
-
-	http.HandleFunc("/api/sync", handleSync)
+// newServerRouter 伺服器模式的所有路由與各自允許的方法
+func newServerRouter() *router {
+	rt := newRouter()
+	rt.handle("/{$}", handleIndex, http.MethodGet, http.MethodHead)
+	rt.handle("/healthz", handleHealthz, http.MethodGet, http.MethodHead)
+	rt.handle("/readyz", handleReadyz, http.MethodGet, http.MethodHead)
+
+	rt.handle("/api/calculate", handleCalculate, http.MethodPost)
+
+	rt.handle("/api/sync", handleSync, http.MethodGet, http.MethodPost, http.MethodPatch)
+	rt.handle("/api/crdt", handleCRDT, http.MethodGet, http.MethodPost)
+	rt.handle("/api/ws", handleWS, http.MethodGet)
+	rt.handle("/api/events", handleEvents, http.MethodGet)
+	rt.handle("/api/bills", handleBills, http.MethodGet, http.MethodPost)
+	rt.handle("/api/bills:batch", handleBillsBatch, http.MethodPost)
+	rt.handle("/api/bills/{id}", handleBill, http.MethodPut, http.MethodDelete)
+	rt.handle("/api/bills/{id}/{rest...}", handleBillSubresource, http.MethodGet, http.MethodPost, http.MethodDelete)
+	rt.handle("/api/bills/from-template/{id}", handleBillFromTemplate, http.MethodPost)
+	rt.handle("/api/people", handlePeople, http.MethodGet, http.MethodPost)
+	rt.handle("/api/people/{id}", handlePerson, http.MethodPut, http.MethodDelete)
+	rt.handle("/api/templates", handleTemplates, http.MethodGet, http.MethodPost)
+	rt.handle("/api/templates/{id}", handleTemplate, http.MethodPut, http.MethodDelete)
+	rt.handle("/api/categories", handleCategories, http.MethodGet, http.MethodPost)
+	rt.handle("/api/categories/{name}", handleCategory, http.MethodPut, http.MethodDelete)
+	rt.handle("/api/groups", handleGroups, http.MethodGet, http.MethodPost)
+	rt.handle("/api/groups/{id}", handleGroup, http.MethodPut, http.MethodDelete)
+	rt.handle("/api/export", handleExport, http.MethodGet)
+	rt.handle("/api/import", handleImport, http.MethodPost)
+	rt.handle("/api/trash", handleTrash, http.MethodGet)
+	rt.handle("/api/trash/restore", handleTrashRestore, http.MethodPost)
+	rt.handle("/api/activity", handleActivity, http.MethodGet)
+	rt.handle("/api/devices", handleDevices, http.MethodGet)
+	rt.handle("/api/explain/{billId}", handleExplain, http.MethodGet)
+	rt.handle("/api/balances", handleBalances, http.MethodGet)
+	rt.handle("/api/summary", handleSummary, http.MethodGet)
+	rt.handle("/api/rates", handleRates, http.MethodGet, http.MethodPut)
+	rt.handle("/api/currencies", handleCurrencies, http.MethodGet)
+	rt.handle("/api/rates/lock", handleRatesLock, http.MethodPost, http.MethodDelete)
+	rt.handle("/api/rates/cache", handleRateCache, http.MethodGet)
+	rt.handle("/api/settlements/{n}/pay", handleSettlementPay, http.MethodPost)
+	rt.handle("/api/finalize", handleFinalize, http.MethodPost)
+	rt.handle("/api/unlock", handleUnlock, http.MethodPost)
+	rt.handle("/api/snapshots", handleSnapshots, http.MethodGet, http.MethodPost)
+	rt.handle("/api/snapshots/{id}/restore", handleSnapshotRestore, http.MethodPost)
+	rt.handle("/api/webhooks", handleWebhooks, http.MethodGet, http.MethodPost)
+	rt.handle("/api/webhooks/{id}", handleWebhook, http.MethodDelete)
+	rt.handle("/api/rooms", handleRooms, http.MethodGet, http.MethodPost)
+	rt.handle("/api/rooms/{code}", handleRoom, http.MethodGet)
+	rt.handle("/api/rooms/{code}/qr.png", handleRoomQR, http.MethodGet)
+	rt.handle("/api/rooms/{code}/archive", handleRoomArchive, http.MethodPost, http.MethodDelete)
+	rt.handle("/api/rooms/{code}/clone", handleRoomClone, http.MethodPost)
+	rt.handle("/api/rooms/{code}/merge", handleRoomMerge, http.MethodPost)
+	rt.mount("/api/rooms/{code}/", handleRoomAPI(rt))
+	rt.handle("/api/docs", handleDocs, http.MethodGet)
+	rt.handle("/api/docs/openapi.json", handleOpenAPI, http.MethodGet)
+
+	return rt
+}
 
+func runServer(port string) {
 	ip := getLocalIP()
 	fmt.Println("========================================")
 	fmt.Printf("分帳器伺服器已啟動 (同步模式)！\n")
@@ -233,7 +740,11 @@ func runServer(port string) {
 	fmt.Println("現在所有連線裝置將會看到相同的帳單資料。")
 	fmt.Println("========================================")
 
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	handler := withDevice(newServerRouter())
+	if serverCORS != nil {
+		handler = serverCORS.wrap(handler)
+	}
+	if err := http.ListenAndServe(":"+port, handler); err != nil {
 		log.Fatalf("server exit: %v", err)
 	}
 }
@@ -242,67 +753,319 @@ func runServer(port string) {
 func handleSync(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
-	stateMutex.Lock()
-	defer stateMutex.Unlock()
-
+	var state GlobalState
+	if r.Method == http.MethodPatch {
+		handleSyncPatch(w, r)
+		return
+	}
 	if r.Method == http.MethodPost {
 		var newState GlobalState
-		body, err := io.ReadAll(r.Body)
+		body, err := readBody(w, r)
 		if err != nil {
-			http.Error(w, "invalid body", http.StatusBadRequest)
 			return
 		}
-		defer r.Body.Close()
 
-		if err := json.Unmarshal(body, &newState); err != nil {
-			http.Error(w, "invalid json", http.StatusBadRequest)
+		if err := decodeJSON(body, &newState); err != nil {
+			writeInvalidJSON(w, err)
 			return
 		}
 
-		projectState = newState
-		projectState.LastUpdated = time.Now().UnixMilli()
+		revs, err := requestRevision(r, body)
+		if err != nil {
+			revisionError(w, r, err)
+			return
+		}
+
+		var invalid ValidationErrors
+		var resp SyncResponse
+		state, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			incoming := overlaySyncedState(*s, body)
+			if err := checkRevision(*s, revs...); err != nil {
+				base, ok := mergeBase(*s, revs)
+				if !ok {
+					return err
+				}
+				// 依據的版本已落後：不整份覆蓋其他裝置的修改，逐筆合併
+				incoming, resp.Conflicts = mergeDivergedState(s, incoming, base)
+				resp.Merged = true
+			}
+			return applySyncedState(s, incoming)
+		})
+		if errors.Is(err, errStaleRevision) {
+			revisionError(w, r, err)
+			return
+		}
+		if errors.As(err, &invalid) {
+			writeErrorFor(w, http.StatusBadRequest, invalid)
+			return
+		}
+		if errors.Is(err, errBillLocked) {
+			writeErrorFor(w, http.StatusConflict, err)
+			return
+		}
+		if errors.Is(err, errTooManyItems) {
+			writeErrorFor(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		if err != nil {
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		setStateValidators(w, state)
+		resp.GlobalState = visibleState(state)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	} else if since, wait, ok, err := parseSyncWait(r.URL.Query()); err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	} else if ok {
+		// 長輪詢：有比 since 新的狀態才回應，逾時仍沒有變更時回 304
+		var changed bool
+		state, changed, err = roomOf(r).waitForStateChange(r.Context(), since, wait)
+		if r.Context().Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		if !changed {
+			setStateValidators(w, state)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	} else {
+		if state, err = roomOf(r).currentState(); err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		// 輪詢的手機帶著上次的 ETag 來問，沒變就不必再下載整份狀態
+		if notModified(r, revisionETag(state.Revision), stateModified(state)) {
+			setStateValidators(w, state)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
 	}
 
+	setStateValidators(w, state)
 	enc := json.NewEncoder(w)
-	if err := enc.Encode(projectState); err != nil {
-		log.Printf("encode projectState failed: %v", err)
+	if err := enc.Encode(visibleState(state)); err != nil {
+		log.Printf("encode state failed: %v", err)
+	}
+}
+
+// applySyncedState 驗證客戶端送來的完整狀態並套用：伺服器管理的帳單欄位沿用原值、
+// 已鎖定的帳單不能改，不再列出的帳單/人員移到垃圾桶
+func applySyncedState(s *GlobalState, incoming GlobalState) error {
+	if err := checkLimits(len(incoming.People), len(incoming.Bills)); err != nil {
+		return err
 	}
+	if invalid := validatePeopleAndBills(incoming.People, incoming.Bills); len(invalid) > 0 {
+		return invalid
+	}
+	keepServerBillFields(*s, incoming)
+	if err := checkLockedBills(*s, incoming); err != nil {
+		return err
+	}
+	*s = mergeWithTrash(*s, incoming, clock.Now())
+	ensureBillCategories(s)
+	return nil
 }
 
-// processCalculate：保持外部介面不變，但內部更嚴謹處理錯誤
+// processCalculate：保持外部介面不變（桌面版綁定），但內部更嚴謹處理錯誤
 func processCalculate(requestJSON string) string {
+	return processCalculateContext(context.Background(), requestJSON)
+}
+
+// processCalculateContext 同 processCalculate，ctx 取消時放棄還在進行的匯率查詢
+func processCalculateContext(ctx context.Context, requestJSON string) string {
 	var req CalculateRequest
 	if err := json.Unmarshal([]byte(requestJSON), &req); err != nil {
-		response := CalculateResponse{Error: "解析資料錯誤"}
+		response := CalculateResponse{Error: "解析資料錯誤", ErrorInfo: &APIError{Code: codeInvalidJSON, Message: "解析資料錯誤"}}
 		if result, err := json.Marshal(response); err == nil {
 			return string(result)
 		}
 		// 若真的 marshal 也失敗，回傳簡單字串
-		return `{"error":"解析資料錯誤"}`
+		return `{"error":"解析資料錯誤","errorInfo":{"code":"invalid_json","message":"解析資料錯誤"}}`
 	}
 
+	return marshalCalculateResponse(runCalculate(ctx, req))
+}
+
+// handleCalculate POST /api/calculate；請求本身有問題（太大、格式錯誤、筆數過多）時
+// 仍以 CalculateResponse 回應（error、errorInfo），但帶上對應的狀態碼
+func handleCalculate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, status, apiErr := readLimitedBody(w, r)
+	var req CalculateRequest
+	if apiErr == nil {
+		if err := decodeJSON(body, &req); err != nil {
+			status, apiErr = http.StatusBadRequest, &APIError{Code: codeInvalidJSON, Message: "解析資料錯誤：" + err.Error()}
+		} else if err := checkLimits(len(req.People), len(req.Bills)); err != nil {
+			status, apiErr = http.StatusUnprocessableEntity, apiErrorFrom(err, codeTooManyItems)
+		}
+	}
+	if apiErr != nil {
+		writeJSON(w, status, CalculateResponse{Error: apiErr.Message, ErrorInfo: apiErr})
+		return
+	}
+
+	resultJSON := marshalCalculateResponse(runCalculate(r.Context(), req))
+	if !req.DryRun {
+		roomOf(r).publishCalculation(resultJSON)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write([]byte(resultJSON)); err != nil {
+		log.Printf("/api/calculate write failed: %v", err)
+	}
+}
+
+// runCalculate 依請求結算；錯誤放在回應的 Error 欄位
+func runCalculate(ctx context.Context, req CalculateRequest) CalculateResponse {
 	base := strings.ToUpper(strings.TrimSpace(req.BaseCurrency))
 	if base == "" {
 		base = defaultBase
 	}
 
-	convertedBills, rateDate, err := convertBillsToBase(base, req.Bills)
+	if req.From != "" || req.To != "" {
+		dr, err := parseDateRange(req.From, req.To)
+		if err != nil {
+			return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+		}
+		req.Bills = filterBillsByDate(req.Bills, dr)
+	}
+
+	if errs := validatePeopleAndBills(req.People, req.Bills); len(errs) > 0 {
+		return CalculateResponse{Error: errs.Error(), Errors: errs, ErrorInfo: apiErrorFrom(errs, codeValidation), BaseCurrency: base}
+	}
+
+	grouped, err := expandGroups(req.Groups, req.Bills)
 	if err != nil {
-		response := CalculateResponse{Error: err.Error(), BaseCurrency: base, RateDate: rateDate}
-		if result, err := json.Marshal(response); err == nil {
-			return string(result)
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+	people, bills, err := expandGuests(req.People, grouped)
+	if err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+	req.People, req.Bills = people, bills
+
+	if req.Bills, err = applyIncomeWeights(req.People, req.Bills); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+
+	req.Bills = rollUpLineItems(req.Bills)
+	if err := validateSplits(req.Bills); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+
+	if req.From != "" {
+		req.OpeningBalances = nil
+	}
+	if err := validateOpeningBalances(req.People, req.OpeningBalances); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+	if err := validateBudgets(req.People, req.Budgets); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+
+	if req.FXFeePercent < 0 || math.IsNaN(req.FXFeePercent) || math.IsInf(req.FXFeePercent, 0) {
+		const msg = "海外交易手續費必須是非負數"
+		return CalculateResponse{Error: msg, ErrorInfo: &APIError{Code: codeValidation, Message: msg, Field: "fxFeePercent"}, BaseCurrency: base}
+	}
+	if err := validateRateAlertPercent(req.RateAlertPercent); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+	if err := validateRateDate(req.RateDate, clock.Now()); err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base}
+	}
+	// 偏好幣別的報價跟帳單一起換算，確保用的是同一組匯率
+	quotes := preferredQuoteBills(req.People, base)
+	convertedBills, rates, rateDate, err := convertBillsWithRates(ctx, base, append(slices.Clip(req.Bills), quotes...), conversionOptions{
+		Table:        req.RateTable,
+		Locked:       req.LockedRates,
+		FXFeePercent: req.FXFeePercent,
+		RateDate:     req.RateDate,
+		CacheOnly:    req.DryRun,
+	})
+	if err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base, RateDate: rateDate}
+	}
+	n := len(convertedBills) - len(quotes)
+	convertedBills, rates, quoteRates := convertedBills[:n], rates[:n], rates[n:]
+
+	var interestBills []Bill
+	var interest []InterestEntry
+	if req.Interest != nil {
+		interestBills, interest, err = accrueInterest(req.People, convertedBills, base, req.RemainderPolicy, *req.Interest)
+		if err != nil {
+			return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base, RateDate: rateDate}
 		}
-		return `{"error":"internal"}` // fallback
 	}
 
-	settlements := calculate(req.People, convertedBills)
+	var unit float64
+	if req.CashRounding {
+		unit = req.CashUnit
+		if unit == 0 {
+			unit = cashUnit(base)
+		}
+	}
+	if req.SettlementHub != 0 && req.SettlementStrategy == "" {
+		req.SettlementStrategy = settleHub
+	}
+	settleBills := append(openingBalanceBills(req.OpeningBalances), convertedBills...)
+	result, err := calculateWithOptions(req.People, append(settleBills, interestBills...), SettleOptions{
+		Base:         base,
+		Strategy:     req.SettlementStrategy,
+		Remainder:    req.RemainderPolicy,
+		Epsilon:      req.SettlementEpsilon,
+		Constraints:  req.Constraints,
+		ForgiveBelow: req.ForgiveBelow,
+		CashUnit:     unit,
+		Hub:          req.SettlementHub,
+	})
+	if err != nil {
+		return CalculateResponse{Error: err.Error(), ErrorInfo: apiErrorFrom(err, codeCalculationFailed), BaseCurrency: base, RateDate: rateDate}
+	}
 
-	response := CalculateResponse{
-		Settlements:  settlements,
-		Bills:        convertedBills,
-		BaseCurrency: base,
-		RateDate:     rateDate,
+	resp := CalculateResponse{
+		Settlements:     withPreferredCurrencies(result.Settlements, req.People, quotes, quoteRates),
+		Bills:           convertedBills,
+		BaseCurrency:    base,
+		RateDate:        rateDate,
+		ManualRateBills: manualRateBills(strings.ToLower(base), convertedBills),
+		Rates:           appliedRates(convertedBills, rates),
+		Rounding:        result.Rounding,
+		Warnings:        result.Warnings,
+		Forgiven:        result.Forgiven,
+		ForgivenTotal:   result.ForgivenTotal,
+		CashUnit:        unit,
+		CashAdjustments: result.Cash,
+		Interest:        interest,
+		InterestTotal:   interestTotal(interest, base),
+		BudgetWarnings:  checkBudgets(req.People, convertedBills, req.Budgets),
 	}
+	isOffline := func(r billRate) bool { return r.Source == rateSourceOffline }
+	if slices.ContainsFunc(rates, isOffline) || slices.ContainsFunc(quoteRates, isOffline) {
+		resp.RateNotice = offlineRateNotice(rateDate)
+	}
+	resp.RateWarnings = collectRateWarnings(append(slices.Clip(rates), quoteRates...))
+	resp.RateSnapshot = rateSnapshot(base, append(slices.Clip(convertedBills), quotes...), append(slices.Clip(rates), quoteRates...))
+	resp.RateAlerts = rateAlerts(req.PreviousRates, resp.RateSnapshot, req.RateAlertPercent)
+	if req.Explain {
+		resp.Explanations = explainBills(req.People, convertedBills, rates, base, req.RemainderPolicy)
+	}
+	return resp
+}
+
+func marshalCalculateResponse(response CalculateResponse) string {
 	if result, err := json.Marshal(response); err == nil {
 		return string(result)
 	}
@@ -374,65 +1137,225 @@ func getLocalIP() string {
 
 // ================= 匯率轉換與 fetch（改用 RateCache 與 RateFetcher） =================
 
-func convertBillsToBase(base string, bills []Bill) ([]Bill, string, error) {
+func convertBillsToBase(ctx context.Context, base string, bills []Bill) ([]Bill, string, error) {
+	converted, _, date, err := convertBillsWithRates(ctx, base, bills, conversionOptions{})
+	return converted, date, err
+}
+
+// conversionOptions 換算時套用的團體設定
+type conversionOptions struct {
+	Table  *RateTable
+	Locked *LockedRates
+	// FXFeePercent 外幣帳單的海外交易手續費（%）
+	FXFeePercent float64
+	// RateDate 不為空時（YYYY-MM-DD）一律用當天的匯率，取代帳單日期的匯率、最新與鎖定的匯率
+	RateDate string
+	// CacheOnly 不連網，也不更新快取與統計：沒有快取時改用內建快照
+	CacheOnly bool
+}
+
+// fxFeePercent 帳單換算後要加上的手續費（%）：只有外幣帳單才收；帳單有指定時以帳單為準，
+// 否則還款與手動匯率（信用卡帳單上的實際匯率，已含手續費）的帳單不收
+func fxFeePercent(bill Bill, cur, baseLower string, groupFee float64) float64 {
+	switch {
+	case cur == baseLower:
+		return 0
+	case bill.FXFeePercent != nil:
+		return *bill.FXFeePercent
+	case bill.isTransfer() || bill.ManualRate > 0:
+		return 0
+	}
+	return groupFee
+}
+
+// convertBillsWithRates 同 convertBillsToBase，另外回傳每張帳單用的匯率（與 bills 同順序）。
+// 匯率的優先順序：帳單上的手動匯率、自訂匯率表、帳單日期當天的匯率、最新匯率（有鎖定的匯率時以它取代）；
+// 指定了 RateDate 時手動匯率與匯率表之外都用那一天的匯率。換算後再加上海外交易手續費
+func convertBillsWithRates(ctx context.Context, base string, bills []Bill, opts conversionOptions) ([]Bill, []billRate, string, error) {
+	table, locked := opts.Table, opts.Locked
 	baseLower := strings.ToLower(base)
+	now := clock.Now()
+	var history map[string]rateEntry
+	if opts.RateDate == "" {
+		history = historicalRates(ctx, baseLower, bills, now, opts.CacheOnly)
+	}
+	dated := func(bill Bill, cur string) (rateEntry, bool) {
+		h, ok := history[bill.Date]
+		return h, ok && h.Rates[cur] != 0
+	}
+	latest := slices.DeleteFunc(slices.Clone(bills), func(bill Bill) bool {
+		cur := strings.ToLower(strings.TrimSpace(bill.Currency))
+		_, pinned := table.rate(cur, base)
+		_, ok := dated(bill, cur)
+		return pinned || ok
+	})
 	entry, ok := rateCache.Get(baseLower)
-	now := time.Now()
 
-	if ok {
-		if now.Sub(entry.FetchedAt) < rateCacheTTL {
+	fixedEntry, isFixed := locked.entry(baseLower)
+	if opts.RateDate != "" && needsFetchedRates(baseLower, latest) {
+		fetch := datedRates
+		if opts.CacheOnly {
+			fetch = cachedDatedRates
+		}
+		forced, err := fetch(ctx, baseLower, opts.RateDate)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("無法取得 %s 的匯率：%w", opts.RateDate, err)
+		}
+		forced.Historical = true
+		fixedEntry, isFixed = forced, true
+	}
+	needsFetch := !isFixed && needsFetchedRates(baseLower, latest)
+	if needsFetch && !opts.CacheOnly {
+		// 伺服器模式會在背景持續更新最近用過的本位幣
+		recentBases.touch(baseLower, now)
+	}
+
+	if isFixed {
+		// 匯率已鎖定或指定了日期，不再抓最新匯率
+		entry = fixedEntry
+	} else if !needsFetch {
+		// 全部是本位幣或手動匯率，不需要連網
+	} else if opts.CacheOnly {
+		// 試算：快取不論新舊都直接用，沒有快取時用內建快照
+		if !ok {
+			offline, err := offlineRates(baseLower)
+			if err != nil {
+				return nil, nil, "", errRatesUnavailable
+			}
+			entry = offline
+		}
+	} else if ok {
+		if entry.fresh(now) {
 			// fresh cache
+			rateStats.hits.Add(1)
 		} else {
-			// stale -> attempt refresh asynchronously (best-effort)
-			// but keep using stale until we get fresh
-			if fetched, err := fetchRates(baseLower); err == nil {
-				entry = fetched
-				rateCache.Set(baseLower, fetched)
-			}
+			// stale -> 先用舊的匯率，背景更新（best-effort）
+			rateStats.staleHits.Add(1)
+			rateRefresh.refresh(baseLower)
 		}
 	} else {
 		// no cache -> fetch synchronously
-		fetched, err := fetchRates(baseLower)
+		rateStats.misses.Add(1)
+		fetched, err := fetchRates(ctx, baseLower)
 		if err != nil {
-			// if nothing cached, surface error
-			return nil, "", err
+			// 沒有網路也沒有快取：改用內建快照（不放進快取，下次仍會先試著連網）；請求已取消時直接放棄
+			offline, offlineErr := offlineRates(baseLower)
+			if ctx.Err() != nil || offlineErr != nil {
+				return nil, nil, "", err
+			}
+			rateStats.offlineUse.Add(1)
+			entry = offline
+		} else {
+			entry = fetched
+			rateCache.Set(baseLower, fetched)
 		}
-		entry = fetched
-		rateCache.Set(baseLower, fetched)
 	}
 
 	rates := entry
 
 	var converted []Bill
+	var applied []billRate
+	// 回應的匯率日期：有帳單用最新匯率時為最新匯率的日期，否則為最近一天的歷史匯率，
+	// 只用了自訂匯率表時為 "manual"
+	var historyDate string
+	usedLatest, usedTable := false, false
 	for _, bill := range bills {
 		cur := strings.ToLower(strings.TrimSpace(bill.Currency))
 		if cur == "" {
 			cur = baseLower
 		}
 		var amountBase float64
+		var br billRate
 		if cur == baseLower {
 			amountBase = bill.Amount
+			br = billRate{Rate: 1, Source: rateSourceBase}
+		} else if bill.ManualRate > 0 {
+			amountBase = bill.Amount * bill.ManualRate
+			br = billRate{Rate: bill.ManualRate, Source: rateSourceManual}
+		} else if rate, ok := table.rate(cur, base); ok {
+			amountBase = bill.Amount * rate
+			br = billRate{Rate: rate, Source: rateSourceManual, Date: rateDateManual}
+			usedTable = true
+		} else if h, ok := dated(bill, cur); ok {
+			amountBase = bill.Amount / h.Rates[cur]
+			br = billRate{Rate: 1 / h.Rates[cur], Source: rateSourceHistorical, Date: h.Date}
+			historyDate = max(historyDate, h.Date)
 		} else {
 			rate, ok := rates.Rates[cur]
+			date, pivot := rates.Date, ""
+			if (!ok || rate == 0) && !rates.Locked && !rates.Offline && !rates.Historical {
+				// 匯率來源沒有這個幣別的直接匯率，經由美元等樞紐幣別交叉換算
+				rate, pivot, date, ok = crossRate(ctx, baseLower, cur, opts.CacheOnly)
+			}
 			if !ok || rate == 0 {
-				return nil, rates.Date, fmt.Errorf("缺少幣別 %s", strings.ToUpper(cur))
+				if w, bad := rates.rateWarningFor(cur); bad {
+					return nil, nil, rates.Date, missingRateError(cur, fmt.Sprintf("缺少幣別 %s（%s）", strings.ToUpper(cur), w.Message))
+				}
+				return nil, nil, rates.Date, missingRateError(cur, fmt.Sprintf("缺少幣別 %s", strings.ToUpper(cur)))
 			}
 			amountBase = bill.Amount / rate
+			br = billRate{Rate: 1 / rate, Source: rateSourceMarket, Date: date, Pivot: pivot}
+			if w, ok := rates.rateWarningFor(cur); ok && pivot == "" {
+				br.Warning = &w
+			}
+			if rates.Offline {
+				br.Source = rateSourceOffline
+			} else if rates.Locked {
+				br.Source = rateSourceLocked
+			} else if rates.Historical {
+				br.Source = rateSourceHistorical
+			}
+			usedLatest = true
+		}
+		if fee := fxFeePercent(bill, cur, baseLower, opts.FXFeePercent); fee != 0 {
+			amountBase *= 1 + fee/100
+			br.FeePercent = fee
 		}
-		bill.AmountBase = amountBase
+		bill.AmountBase = roundMoney(amountBase, base)
 		converted = append(converted, bill)
+		applied = append(applied, br)
+	}
+	switch {
+	case usedLatest:
+	case historyDate != "":
+		return converted, applied, historyDate, nil
+	case usedTable:
+		return converted, applied, rateDateManual, nil
+	}
+	return converted, applied, rates.Date, nil
+}
+
+// needsFetchedRates 是否有外幣帳單沒有手動匯率，需要向匯率 API 取得
+func needsFetchedRates(baseLower string, bills []Bill) bool {
+	for _, bill := range bills {
+		cur := strings.ToLower(strings.TrimSpace(bill.Currency))
+		if cur != "" && cur != baseLower && bill.ManualRate <= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// manualRateBills 列出實際套用了手動匯率的帳單 ID
+func manualRateBills(baseLower string, bills []Bill) []int {
+	var ids []int
+	for _, bill := range bills {
+		cur := strings.ToLower(strings.TrimSpace(bill.Currency))
+		if cur != "" && cur != baseLower && bill.ManualRate > 0 {
+			ids = append(ids, bill.ID)
+		}
 	}
-	return converted, rates.Date, nil
+	return ids
 }
 
-func getRates(base string) (rateEntry, error) {
+func getRates(ctx context.Context, base string) (rateEntry, error) {
 	// legacy helper kept for compatibility (calls the unified path)
 	if e, ok := rateCache.Get(base); ok {
-		if time.Since(e.FetchedAt) < rateCacheTTL {
+		if e.fresh(clock.Now()) {
 			return e, nil
 		}
 	}
-	e, err := fetchRates(base)
+	e, err := fetchRates(ctx, base)
 	if err != nil {
 		if cached, ok := rateCache.Get(base); ok {
 			return cached, nil
@@ -443,19 +1366,41 @@ func getRates(base string) (rateEntry, error) {
 	return e, nil
 }
 
-func fetchRates(base string) (rateEntry, error) {
+// fetchRates 向匯率 API 抓取最新匯率，失敗時退避重試；斷路器開啟時直接回傳 errRateCircuitOpen
+func fetchRates(ctx context.Context, base string) (rateEntry, error) {
+	if !rateBreaker.allow() {
+		rateStats.circuitRejected.Add(1)
+		return rateEntry{}, errRateCircuitOpen
+	}
+	rateStats.fetches.Add(1)
 	var lastErr error
-	for i := 0; i < 2; i++ {
-		entry, err := rateFetcher.Fetch(base)
+	for attempt := range rateFetchAttempts {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return rateEntry{}, ctx.Err()
+			case <-time.After(rateRetryDelay(attempt)):
+			}
+		}
+		entry, err := rateFetcher.Fetch(ctx, base)
 		if err == nil {
+			rateBreaker.success()
+			// 不合理的匯率沿用上次的值
+			prev, hasPrev := rateCache.Get(base)
+			entry = sanitizeRates(entry, prev, hasPrev)
 			// ensure FetchedAt is set
-			entry.FetchedAt = time.Now()
+			entry.FetchedAt = clock.Now()
 			rateCache.Set(base, entry)
 			return entry, nil
 		}
+		if ctx.Err() != nil {
+			// 請求取消不算匯率 API 的失敗
+			return rateEntry{}, ctx.Err()
+		}
 		lastErr = err
-		time.Sleep(time.Duration(i+1) * 200 * time.Millisecond)
 	}
+	rateBreaker.failure()
+	rateStats.recordFailure(lastErr, clock.Now())
 	return rateEntry{}, lastErr
 }
 
@@ -477,69 +1422,47 @@ func parseRateResponse(base string, data []byte) (rateEntry, error) {
 	if err := json.Unmarshal(rateRaw, &rates); err != nil {
 		return rateEntry{}, err
 	}
+	warnings := dropInvalidRates(rates)
 	rates[baseKey] = 1
-	return rateEntry{Rates: rates, Date: date, FetchedAt: time.Now()}, nil
+	return rateEntry{Rates: rates, Date: date, FetchedAt: clock.Now(), Warnings: warnings}, nil
 }
 
 // ================= 核心結算演算法（保留原邏輯） =================
 
 func calculate(people []Person, bills []Bill) []Settlement {
-	balance := make(map[int]float64)
-	nameMap := make(map[int]string)
+	balance, nameMap, _ := computeBalances(people, bills, defaultBase, remainderFraction)
+	settleDust(balance, 1)
+	return toSettlements(GreedySettler{}.Settle(balance), nameMap, defaultBase)
+}
+
+// computeBalances 每個人的淨額（正數為應收、負數為應付，以 base 的最小單位計）與 ID 對應的名字。
+// 每張帳單先拆成整數再累加，付出與分攤的總和恰好相等，所有人的淨額加總必為 0；
+// 除不盡的餘數依 remainder 政策分配，並回傳每一筆調整
+func computeBalances(people []Person, bills []Bill, base, remainder string) (map[int]Money, map[int]string, []RoundingAdjustment) {
+	balance := make(map[int]Money, len(people))
+	nameMap := make(map[int]string, len(people))
 	for _, p := range people {
 		balance[p.ID] = 0
 		nameMap[p.ID] = p.Name
 	}
+	allocator := &remainderAllocator{policy: remainder}
+	var adjustments []RoundingAdjustment
 	for _, bill := range bills {
-		if len(bill.Participants) == 0 {
+		split, ok := allocator.splitBill(bill, base)
+		if !ok {
 			continue
 		}
-		amt := bill.AmountBase
-		if amt == 0 {
-			amt = bill.Amount
-		}
-		perPerson := amt / float64(len(bill.Participants))
-		balance[bill.PaidBy] += amt
-		for _, pid := range bill.Participants {
-			balance[pid] -= perPerson
-		}
-	}
-	var creditors, debtors []struct {
-		id     int
-		amount float64
-	}
-	for id, amt := range balance {
-		if amt > 0.01 {
-			creditors = append(creditors, struct {
-				id     int
-				amount float64
-			}{id, amt})
-		}
-		if amt < -0.01 {
-			debtors = append(debtors, struct {
-				id     int
-				amount float64
-			}{id, -amt})
-		}
-	}
-	var settlements []Settlement
-	i, j := 0, 0
-	for i < len(creditors) && j < len(debtors) {
-		cred := creditors[i]
-		debt := debtors[j]
-		amt := cred.amount
-		if debt.amount < amt {
-			amt = debt.amount
+		for pid, paid := range split.paid {
+			balance[pid] += paid
 		}
-		settlements = append(settlements, Settlement{From: nameMap[debt.id], To: nameMap[cred.id], Amount: amt})
-		creditors[i].amount -= amt
-		debtors[j].amount -= amt
-		if creditors[i].amount < 0.01 {
-			i++
+		for pid, v := range split.owed {
+			balance[pid] -= v
 		}
-		if debtors[j].amount < 0.01 {
-			j++
+		for _, pid := range slices.Sorted(maps.Keys(split.adjusted)) {
+			adjustments = append(adjustments, RoundingAdjustment{
+				BillID: bill.ID, Bill: bill.Title, PersonID: pid, Person: nameMap[pid], Amount: split.adjusted[pid].Float(base),
+			})
 		}
 	}
-	return settlements
+	return balance, nameMap, adjustments
 }
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"maps"
 	"math"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 )
@@ -61,6 +67,150 @@ func TestCalculate(t *testing.T) {
 			bills:    []Bill{},
 			expected: nil,
 		},
+		{
+			name: "Case 4: 依份數分攤 (Alice 夫妻算 2 份)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+				{ID: 3, Name: "Charlie"},
+			},
+			bills: []Bill{
+				{ID: 1, AmountBase: 400, PaidBy: 2, Participants: []int{1, 2, 3}, Shares: map[int]float64{1: 2}},
+			},
+			expected: []Settlement{
+				{From: "Alice", To: "Bob", Amount: 200},
+				{From: "Charlie", To: "Bob", Amount: 100},
+			},
+		},
+		{
+			name: "Case 5: 指定金額 (各點各的，USD 帳單換算為 TWD)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: []Bill{
+				{ID: 1, Amount: 30, AmountBase: 900, Currency: "USD", PaidBy: 1, Participants: []int{1, 2},
+					ExactAmounts: map[int]float64{1: 10, 2: 20}},
+			},
+			expected: []Settlement{
+				{From: "Bob", To: "Alice", Amount: 600},
+			},
+		},
+		{
+			name: "Case 6: 逐項分帳 (牛排 Alice 一人、沙拉兩人分)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: rollUpLineItems([]Bill{
+				{ID: 1, AmountBase: 1000, PaidBy: 2, LineItems: []BillItem{
+					{Name: "Steak", Amount: 800, Participants: []int{1}},
+					{Name: "Salad", Amount: 200, Participants: []int{1, 2}},
+				}},
+			}),
+			expected: []Settlement{
+				{From: "Alice", To: "Bob", Amount: 900},
+			},
+		},
+		{
+			name: "Case 7: 小費與服務費依消費比例分攤",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: []Bill{
+				{ID: 1, Amount: 1000, PaidBy: 2, Participants: []int{1, 2},
+					ExactAmounts: map[int]float64{1: 800, 2: 200}, Tip: 100, ServiceCharge: 100},
+			},
+			expected: []Settlement{
+				{From: "Alice", To: "Bob", Amount: 960},
+			},
+		},
+		{
+			name: "Case 8: 稅金平分",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: []Bill{
+				{ID: 1, Amount: 1000, PaidBy: 2, Participants: []int{1, 2},
+					ExactAmounts: map[int]float64{1: 800, 2: 200}, Tax: 100, ExtrasSplit: extrasEqual},
+			},
+			expected: []Settlement{
+				{From: "Alice", To: "Bob", Amount: 850},
+			},
+		},
+		{
+			name: "Case 9: 多人付款 (Alice、Bob 各刷一部分訂金)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+				{ID: 3, Name: "Charlie"},
+			},
+			bills: []Bill{
+				{ID: 1, Amount: 900, PaidBy: 1, Participants: []int{1, 2, 3},
+					Payers: []Payer{{PersonID: 1, Amount: 600}, {PersonID: 2, Amount: 300}}},
+			},
+			expected: []Settlement{
+				{From: "Charlie", To: "Alice", Amount: 300},
+			},
+		},
+		{
+			name: "Case 10: 還款紀錄直接抵銷 (Bob 已先還 Alice 50)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: []Bill{
+				{ID: 1, AmountBase: 300, PaidBy: 1, Participants: []int{1, 2}},
+				{ID: 2, Type: billTypeTransfer, AmountBase: 50, PaidBy: 2, Participants: []int{1}},
+			},
+			expected: []Settlement{
+				{From: "Bob", To: "Alice", Amount: 100},
+			},
+		},
+		{
+			name: "Case 11: 退款沖回 (Alice 付 300，退回 90 也由 Alice 收)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+				{ID: 3, Name: "Charlie"},
+			},
+			bills: []Bill{
+				{ID: 1, AmountBase: 300, PaidBy: 1, Participants: []int{1, 2, 3}},
+				{ID: 2, Title: "Refund", AmountBase: -90, PaidBy: 1, Participants: []int{1, 2, 3}},
+			},
+			expected: []Settlement{
+				{From: "Bob", To: "Alice", Amount: 70},
+				{From: "Charlie", To: "Alice", Amount: 70},
+			},
+		},
+		{
+			name: "Case 12: 期初欠款 (Charlie 上趟還欠 Alice 800，這趟 Charlie 付 300 兩人分)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 3, Name: "Charlie"},
+			},
+			bills: append(openingBalanceBills([]OpeningBalance{{From: 3, To: 1, Amount: 800}}),
+				Bill{ID: 1, AmountBase: 300, PaidBy: 3, Participants: []int{1, 3}}),
+			expected: []Settlement{
+				{From: "Charlie", To: "Alice", Amount: 650},
+			},
+		},
+		{
+			name: "Case 13: 請客不列入結算 (Bob 請大家喝咖啡)",
+			people: []Person{
+				{ID: 1, Name: "Alice"},
+				{ID: 2, Name: "Bob"},
+			},
+			bills: []Bill{
+				{ID: 1, AmountBase: 600, PaidBy: 1, Participants: []int{1, 2}},
+				{ID: 2, Title: "Coffee", AmountBase: 400, PaidBy: 2, Participants: []int{1, 2}, Treat: true},
+			},
+			expected: []Settlement{
+				{From: "Bob", To: "Alice", Amount: 300},
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -134,7 +284,7 @@ func TestConvertBillsToBase_WithMock(t *testing.T) {
 		{ID: 1, Title: "US Snack", Amount: 10, Currency: "USD"},
 	}
 
-	converted, _, err := convertBillsToBase(mockBase, inputBills)
+	converted, _, err := convertBillsToBase(context.Background(), mockBase, inputBills)
 	if err != nil {
 		t.Fatalf("轉換過程報錯: %v", err)
 	}
@@ -146,6 +296,86 @@ func TestConvertBillsToBase_WithMock(t *testing.T) {
 	}
 }
 
+func TestConvertBillsToBase_ManualRate(t *testing.T) {
+	rateCache.Set("twd", rateEntry{
+		Date:      "2025-01-01",
+		FetchedAt: time.Now(),
+		Rates:     map[string]float64{"usd": 0.1},
+	})
+
+	inputBills := []Bill{
+		{ID: 1, Title: "Card", Amount: 10, Currency: "USD", ManualRate: 31.5},
+		{ID: 2, Title: "Cash", Amount: 10, Currency: "USD"},
+		{ID: 3, Title: "Local", Amount: 10, Currency: "TWD", ManualRate: 2},
+	}
+
+	converted, _, err := convertBillsToBase(context.Background(), "twd", inputBills)
+	if err != nil {
+		t.Fatalf("轉換過程報錯: %v", err)
+	}
+	if math.Abs(converted[0].AmountBase-315) > 0.01 {
+		t.Errorf("手動匯率應優先, got %.2f, want 315", converted[0].AmountBase)
+	}
+	if math.Abs(converted[1].AmountBase-100) > 0.01 {
+		t.Errorf("沒有手動匯率應使用抓取匯率, got %.2f, want 100", converted[1].AmountBase)
+	}
+	if converted[2].AmountBase != 10 {
+		t.Errorf("本位幣帳單不應套用手動匯率, got %.2f", converted[2].AmountBase)
+	}
+	if ids := manualRateBills("twd", converted); len(ids) != 1 || ids[0] != 1 {
+		t.Errorf("manualRateBills got %v, want [1]", ids)
+	}
+}
+
+// TestCalculate_DryRun 試算只用快取或內建快照的匯率，不連網、不寫快取也不發事件
+func TestCalculate_DryRun(t *testing.T) {
+	fetcher := &countingFetcher{}
+	useRateFetcher(t, fetcher)
+	savedEvents := defaultRoom.events
+	defaultRoom.events = newEventLog()
+	t.Cleanup(func() { defaultRoom.events = savedEvents })
+
+	calc := func(extra string) CalculateResponse {
+		body := `{"baseCurrency":"TWD","people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}],` +
+			`"bills":[{"id":1,"title":"Taxi","amount":10,"currency":"USD","paidBy":1,"participants":[1,2]}]` + extra + `}`
+		rec := httptest.NewRecorder()
+		handleCalculate(rec, httptest.NewRequest(http.MethodPost, "/api/calculate", strings.NewReader(body)))
+		var resp CalculateResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	events := func() int {
+		e, _ := defaultRoom.events.since(0)
+		return len(e)
+	}
+
+	// 沒有快取：改用內建快照，不抓匯率也不存進快取
+	resp := calc(`,"dryRun":true`)
+	if resp.Error != "" || len(resp.Rates) == 0 || resp.Rates[0].RateSource != rateSourceOffline {
+		t.Fatalf("沒有快取時應用內建快照, got %+v", resp)
+	}
+	if _, ok := rateCache.Get("twd"); ok || fetcher.calls != 0 || rateStats.misses.Load() != 0 || events() != 0 {
+		t.Errorf("試算不應有副作用: calls = %d, misses = %d, events = %d", fetcher.calls, rateStats.misses.Load(), events())
+	}
+
+	// 一般計算會抓匯率並發出事件；之後的試算沿用快取
+	if resp := calc(""); resp.Error != "" || fetcher.calls != 1 || events() != 1 {
+		t.Fatalf("一般計算: %+v, calls = %d, events = %d", resp, fetcher.calls, events())
+	}
+	rateCache.Set("twd", rateEntry{Rates: map[string]float64{"usd": 0.04}, Date: "2026-05-01", FetchedAt: time.Now().Add(-24 * time.Hour)})
+	resp = calc(`,"dryRun":true`)
+	if resp.Error != "" || resp.Settlements[0].Amount != 125 || fetcher.calls != 1 || rateStats.staleHits.Load() != 0 || events() != 1 {
+		t.Errorf("試算應直接用過期的快取: %+v, calls = %d, events = %d", resp, fetcher.calls, events())
+	}
+
+	// 指定日期但快取中沒有那天的匯率
+	if resp := calc(`,"dryRun":true,"rateDate":"2026-04-01"`); resp.ErrorInfo == nil || resp.ErrorInfo.Code != codeRatesUnavailable {
+		t.Errorf("沒有快取的日期應回 rates_unavailable, got %+v", resp)
+	}
+}
+
 // ==========================================
 // 4. 效能測試
 // ==========================================
@@ -187,3 +417,50 @@ func BenchmarkCalculate(b *testing.B) {
 		calculate(people, bills)
 	}
 }
+
+// BenchmarkCalculate_LargeGroup 10,000 人、100,000 筆帳單（每筆 2～8 人分攤）
+func BenchmarkCalculate_LargeGroup(b *testing.B) {
+	const peopleCount, billCount = 10000, 100000
+	people := make([]Person, 0, peopleCount)
+	for i := 1; i <= peopleCount; i++ {
+		people = append(people, Person{ID: i, Name: fmt.Sprintf("User%d", i)})
+	}
+
+	rng := rand.New(rand.NewSource(42))
+	bills := make([]Bill, 0, billCount)
+	for i := 0; i < billCount; i++ {
+		participants := make([]int, 2+rng.Intn(7))
+		for j := range participants {
+			participants[j] = rng.Intn(peopleCount) + 1
+		}
+		bills = append(bills, Bill{
+			ID:           i,
+			Title:        "Bench Bill",
+			AmountBase:   rng.Float64() * 1000,
+			PaidBy:       participants[0],
+			Participants: participants,
+		})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		calculate(people, bills)
+	}
+}
+
+// BenchmarkGreedySettle_LargeGroup 只量配對：10,000 人的淨額
+func BenchmarkGreedySettle_LargeGroup(b *testing.B) {
+	rng := rand.New(rand.NewSource(42))
+	balance := make(map[int]Money, 10000)
+	var sum Money
+	for i := 1; i < 10000; i++ {
+		balance[i] = Money(rng.Intn(2000000) - 1000000)
+		sum += balance[i]
+	}
+	balance[10000] = -sum
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		GreedySettler{}.Settle(maps.Clone(balance))
+	}
+}
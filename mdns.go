@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+)
+
+// ================= mDNS 訊息（RFC 6762、6763） =================
+
+// 區網同步只需要服務探索：查詢 PTR，回應 PTR、SRV、TXT、A，其餘記錄類型略過
+
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN = 1
+	// mDNS 借用 class 的最高位元：查詢時代表希望單播回應，回應時代表取代快取
+	dnsClassMask = 0x7fff
+
+	dnsFlagResponse = 0x8400 // QR + AA
+)
+
+var errDNSMessage = errors.New("mDNS 訊息格式錯誤")
+
+type dnsQuestion struct {
+	name  string
+	qtype uint16
+}
+
+// dnsRecord 依 rtype 只用到其中幾個欄位：PTR 用 target，SRV 用 target、port，TXT 用 txt，A 用 ip
+type dnsRecord struct {
+	name   string
+	rtype  uint16
+	ttl    uint32
+	target string
+	port   uint16
+	txt    []string
+	ip     net.IP
+}
+
+type dnsMessage struct {
+	response  bool
+	questions []dnsQuestion
+	records   []dnsRecord // 解析時 answer、authority、additional 都放在這裡
+}
+
+// pack 編碼成封包；名稱不壓縮，訊息很小
+func (m dnsMessage) pack() []byte {
+	b := make([]byte, 12, 512)
+	if m.response {
+		binary.BigEndian.PutUint16(b[2:], dnsFlagResponse)
+	}
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.records)))
+	for _, q := range m.questions {
+		b = appendDNSName(b, q.name)
+		b = binary.BigEndian.AppendUint16(b, q.qtype)
+		b = binary.BigEndian.AppendUint16(b, dnsClassIN)
+	}
+	for _, r := range m.records {
+		b = appendDNSName(b, r.name)
+		b = binary.BigEndian.AppendUint16(b, r.rtype)
+		b = binary.BigEndian.AppendUint16(b, dnsClassIN)
+		b = binary.BigEndian.AppendUint32(b, r.ttl)
+		var data []byte
+		switch r.rtype {
+		case dnsTypePTR:
+			data = appendDNSName(nil, r.target)
+		case dnsTypeSRV:
+			data = make([]byte, 6)
+			binary.BigEndian.PutUint16(data[4:], r.port)
+			data = appendDNSName(data, r.target)
+		case dnsTypeTXT:
+			for _, s := range r.txt {
+				data = append(data, byte(len(s)))
+				data = append(data, s...)
+			}
+		case dnsTypeA:
+			data = r.ip.To4()
+		}
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)))
+		b = append(b, data...)
+	}
+	return b
+}
+
+// appendDNSName 以長度前綴的標籤編碼網域名稱，結尾的點可有可無
+func appendDNSName(b []byte, name string) []byte {
+	for label := range strings.SplitSeq(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(min(len(label), 63)))
+		b = append(b, label[:min(len(label), 63)]...)
+	}
+	return append(b, 0)
+}
+
+// readDNSName 從 off 讀出名稱（支援壓縮指標），回傳名稱與名稱之後的位置
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errDNSMessage
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errDNSMessage
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errDNSMessage
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// parseDNSMessage 解析收到的封包；不認得的記錄類型只保留名稱與類型
+func parseDNSMessage(msg []byte) (dnsMessage, error) {
+	if len(msg) < 12 {
+		return dnsMessage{}, errDNSMessage
+	}
+	m := dnsMessage{response: msg[2]&0x80 != 0}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+	off := 12
+	for range qd {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return dnsMessage{}, errDNSMessage
+		}
+		m.questions = append(m.questions, dnsQuestion{name: name, qtype: binary.BigEndian.Uint16(msg[next:])})
+		off = next + 4
+	}
+	for range rr {
+		name, next, err := readDNSName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return dnsMessage{}, errDNSMessage
+		}
+		r := dnsRecord{
+			name:  name,
+			rtype: binary.BigEndian.Uint16(msg[next:]),
+			ttl:   binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		start := next + 10
+		end := start + int(binary.BigEndian.Uint16(msg[next+8:]))
+		if end > len(msg) {
+			return dnsMessage{}, errDNSMessage
+		}
+		if binary.BigEndian.Uint16(msg[next+2:])&dnsClassMask == dnsClassIN {
+			if err := r.unpack(msg, start, end); err != nil {
+				return dnsMessage{}, err
+			}
+		}
+		m.records = append(m.records, r)
+		off = end
+	}
+	return m, nil
+}
+
+// unpack 解析記錄內容 msg[start:end]；名稱可能指回訊息前段，所以傳整個封包
+func (r *dnsRecord) unpack(msg []byte, start, end int) error {
+	var err error
+	switch r.rtype {
+	case dnsTypePTR:
+		r.target, _, err = readDNSName(msg, start)
+	case dnsTypeSRV:
+		if end-start < 7 {
+			return errDNSMessage
+		}
+		r.port = binary.BigEndian.Uint16(msg[start+4:])
+		r.target, _, err = readDNSName(msg, start+6)
+	case dnsTypeTXT:
+		for i := start; i < end; {
+			n := int(msg[i])
+			if i+1+n > end {
+				return errDNSMessage
+			}
+			r.txt = append(r.txt, string(msg[i+1:i+1+n]))
+			i += 1 + n
+		}
+	case dnsTypeA:
+		if end-start == net.IPv4len {
+			r.ip = net.IP(append([]byte(nil), msg[start:end]...))
+		}
+	}
+	return err
+}
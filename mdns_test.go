@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// mDNS 探索測試
+// ==========================================
+func TestMDNS_Discovery(t *testing.T) {
+	a, b := newTestLANSync(t, nil, "pair-1234"), newTestLANSync(t, nil, "pair-1234")
+	a.port = 4567
+	from := net.IPv4(192, 168, 1, 20)
+
+	// 有人查詢本服務時回應公告
+	query, err := parseDNSMessage(lanQuery().pack())
+	if err != nil || query.response {
+		t.Fatalf("查詢解析失敗: %v", err)
+	}
+	reply := a.handleMDNS(query, from, time.Now())
+	if reply == nil {
+		t.Fatal("查詢本服務時應回應公告")
+	}
+
+	ann, err := parseDNSMessage(reply.pack())
+	if err != nil || !ann.response {
+		t.Fatalf("公告解析失敗: %v", err)
+	}
+	peers := discoverLANPeers(ann, from, a.group)
+	if len(peers) != 1 || peers[0].id != a.id || peers[0].addr != "192.168.1.20:4567" {
+		t.Errorf("找到的桌面版 = %+v", peers)
+	}
+	if other := newTestLANSync(t, nil, "other-code"); len(discoverLANPeers(ann, from, other.group)) != 0 {
+		t.Error("配對碼不同的桌面版不應加入")
+	}
+
+	// b 收到公告後記下 a；ID 較小的一台當彙整者
+	now := time.Now()
+	b.handleMDNS(ann, from, now)
+	leader, ok := b.leader(now)
+	if ok != (a.id < b.id) || ok && leader.id != a.id {
+		t.Errorf("彙整者 = %+v %v（a=%s b=%s）", leader, ok, a.id, b.id)
+	}
+	if _, ok := b.leader(now.Add(lanPeerTTL + time.Second)); ok {
+		t.Error("太久沒有公告的桌面版應移除")
+	}
+
+	// 關閉時送出 TTL 0 的公告，其他台立刻移除
+	b.handleMDNS(ann, from, now)
+	for i := range reply.records {
+		reply.records[i].ttl = 0
+	}
+	bye, _ := parseDNSMessage(reply.pack())
+	b.handleMDNS(bye, from, now)
+	if _, ok := b.leader(now); ok {
+		t.Error("離開的桌面版應移除")
+	}
+}
+
+func TestParseDNSMessage_Compression(t *testing.T) {
+	msg := []byte{0, 0, 0x84, 0, 0, 1, 0, 1, 0, 0, 0, 0}
+	msg = appendDNSName(msg, lanService) // 位置 12
+	msg = append(msg, 0, dnsTypePTR, 0, dnsClassIN)
+	msg = append(msg, 0xc0, 12, 0, dnsTypePTR, 0x80, dnsClassIN, 0, 0, 0, 120, 0, 6)
+	msg = append(msg, 3, 'a', 'b', 'c', 0xc0, 12)
+
+	m, err := parseDNSMessage(msg)
+	if err != nil {
+		t.Fatalf("解析失敗: %v", err)
+	}
+	if r := m.records[0]; r.name != lanService || r.target != "abc."+lanService || r.ttl != 120 {
+		t.Errorf("壓縮的名稱 = %+v", r)
+	}
+
+	// 指回自己的指標不能無限循環
+	loop := append([]byte{0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0}, 0xc0, 12, 0, 1, 0, 1)
+	if _, err := parseDNSMessage(loop); err == nil {
+		t.Error("循環的壓縮指標應回傳錯誤")
+	}
+	if _, err := parseDNSMessage(msg[:len(msg)-3]); err == nil {
+		t.Error("截斷的封包應回傳錯誤")
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ================= 合併兩趟旅程 =================
+
+var errInvalidMerge = errors.New("invalid merge")
+
+// MergeRoomsRequest POST /api/rooms/{code}/merge：把 From 房間的人員與帳單併入 {code}。
+// People 指定來源人員對應到哪位目標人員（來源 ID → 目標 ID，0 代表新增為另一個人）；
+// 沒有列出的依名字（不分大小寫）對應，找不到就新增。先以 DryRun 取得對應結果給使用者確認，再正式送出
+type MergeRoomsRequest struct {
+	From   string      `json:"from"`
+	People map[int]int `json:"people,omitempty"`
+	DryRun bool        `json:"dryRun,omitempty"`
+	// ArchiveFrom 合併完成後封存來源房間，避免之後又在兩邊各記一份
+	ArchiveFrom bool `json:"archiveFrom,omitempty"`
+}
+
+// PersonMapping 一位來源人員合併後的去向；Match 為 "manual"（依 People 指定）、"name"（同名）或 "new"（新增）
+type PersonMapping struct {
+	From   int    `json:"from"`
+	Name   string `json:"name"`
+	To     int    `json:"to"`
+	ToName string `json:"toName"`
+	Match  string `json:"match"`
+}
+
+// MergeRoomsResponse 人員對應、併入的帳單數，以及合併後整體重新計算的結算
+type MergeRoomsResponse struct {
+	DryRun     bool             `json:"dryRun,omitempty"`
+	People     []PersonMapping  `json:"people"`
+	BillsAdded int              `json:"billsAdded"`
+	Revision   int64            `json:"revision"`
+	Balances   BalancesResponse `json:"balances"`
+}
+
+// mapMergePeople 決定來源人員在目標房間的 ID，需要新增的人員附加在 dst.People 後面
+func mapMergePeople(dst *GlobalState, src []Person, manual map[int]int) ([]PersonMapping, error) {
+	srcIDs := make(map[int]bool, len(src))
+	for _, p := range src {
+		srcIDs[p.ID] = true
+	}
+	targets := make(map[int]Person, len(dst.People))
+	byName := make(map[string]Person, len(dst.People))
+	for _, p := range visibleState(*dst).People {
+		targets[p.ID] = p
+		if key := strings.ToLower(strings.TrimSpace(p.Name)); byName[key].ID == 0 {
+			byName[key] = p
+		}
+	}
+
+	used := make(map[int]int, len(manual))
+	for _, from := range slices.Sorted(maps.Keys(manual)) {
+		to := manual[from]
+		if !srcIDs[from] {
+			return nil, fmt.Errorf("%w: 來源房間沒有人員 %d", errInvalidMerge, from)
+		}
+		if to == 0 {
+			continue
+		}
+		if _, ok := targets[to]; !ok {
+			return nil, fmt.Errorf("%w: 目標房間沒有人員 %d", errInvalidMerge, to)
+		}
+		if other, ok := used[to]; ok {
+			return nil, fmt.Errorf("%w: 來源人員 %d 與 %d 不能對應到同一位人員 %d", errInvalidMerge, other, from, to)
+		}
+		used[to] = from
+	}
+
+	nextID := maxPersonID(dst.People) + 1
+	mapping := make([]PersonMapping, 0, len(src))
+	for _, p := range src {
+		m := PersonMapping{From: p.ID, Name: p.Name}
+		to, isManual := manual[p.ID]
+		match, byNameOK := byName[strings.ToLower(strings.TrimSpace(p.Name))]
+		switch {
+		case isManual && to != 0:
+			m.To, m.ToName, m.Match = to, targets[to].Name, "manual"
+		case !isManual && byNameOK && used[match.ID] == 0:
+			used[match.ID] = p.ID
+			m.To, m.ToName, m.Match = match.ID, match.Name, "name"
+		default:
+			added := Person{ID: nextID, Name: p.Name, Weight: p.Weight, PreferredCurrency: p.PreferredCurrency}
+			nextID++
+			dst.People = append(dst.People, added)
+			m.To, m.ToName, m.Match = added.ID, added.Name, "new"
+		}
+		mapping = append(mapping, m)
+	}
+	return mapping, nil
+}
+
+// mergeRoomState 把 src 的人員、帳單、期初餘額與用到的分類併入 dst；帳單換成新的 ID，
+// 引用的人員換成對應後的 ID，來源的群組展開成參與者。copyAttachment 不為 nil 時複製收據檔案
+func mergeRoomState(dst *GlobalState, src GlobalState, manual map[int]int, copyAttachment func(oldBill, newBill int, a Attachment) error) ([]PersonMapping, int, error) {
+	src = visibleState(src)
+	mapping, err := mapMergePeople(dst, src.People, manual)
+	if err != nil {
+		return nil, 0, err
+	}
+	ids := make(map[int]int, len(mapping))
+	for _, m := range mapping {
+		ids[m.From] = m.To
+	}
+	person := func(id int) int {
+		if to, ok := ids[id]; ok {
+			return to
+		}
+		return id
+	}
+
+	bills, err := expandGroups(src.Groups, src.Bills)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", errInvalidMerge, err)
+	}
+	srcBase, sameBase := stateBase(src), stateBase(src) == stateBase(*dst)
+	billIDs := make(map[int]int, len(bills))
+	nextID := maxBillID(dst.Bills) + 1
+	for _, b := range bills {
+		billIDs[b.ID] = nextID
+		nextID++
+	}
+	start := len(dst.Bills)
+	for _, b := range bills {
+		b.ID = billIDs[b.ID]
+		b.Groups = nil
+		remapBillPeople(&b, person)
+		b.RecurrenceOf = billIDs[b.RecurrenceOf]
+		if b.Currency == "" {
+			b.Currency = srcBase
+		}
+		if !sameBase {
+			// 換算結果與手動匯率都是對來源房間的本位幣，換了本位幣就要重新換算
+			b.AmountBase, b.ManualRate = 0, 0
+		}
+		dst.Bills = append(dst.Bills, b)
+	}
+
+	for _, ob := range src.OpeningBalances {
+		ob.From, ob.To = person(ob.From), person(ob.To)
+		if ob.From != ob.To {
+			dst.OpeningBalances = append(dst.OpeningBalances, ob)
+		}
+	}
+	for _, c := range src.Categories {
+		if findCategory(dst.Categories, c.Name) < 0 && slices.ContainsFunc(bills, func(b Bill) bool { return strings.EqualFold(strings.TrimSpace(b.Category), c.Name) }) {
+			dst.Categories = append(dst.Categories, c)
+		}
+	}
+	ensureBillCategories(dst)
+
+	live := visibleState(*dst)
+	if err := checkLimits(len(live.People), len(live.Bills)); err != nil {
+		return nil, 0, err
+	}
+	if invalid := validatePeopleAndBills(live.People, live.Bills); len(invalid) > 0 {
+		return nil, 0, invalid
+	}
+
+	// 確認合併結果有效後才複製檔案，避免留下用不到的收據；來源檔案已不存在的收據略過
+	if copyAttachment != nil {
+		for i, b := range bills {
+			merged := &dst.Bills[start+i]
+			kept := merged.Attachments[:0:0]
+			for _, a := range merged.Attachments {
+				err := copyAttachment(b.ID, merged.ID, a)
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return nil, 0, err
+				}
+				kept = append(kept, a)
+			}
+			merged.Attachments = kept
+		}
+	}
+	return mapping, len(bills), nil
+}
+
+// remapBillPeople 把帳單引用的人員（付款人、參與者、分攤權重與金額、品項、多人付款）換成 person(ID)；
+// 對應到同一人的參與者只留一個
+func remapBillPeople(b *Bill, person func(id int) int) {
+	people := func(list []int) []int {
+		if list == nil {
+			return nil
+		}
+		out := make([]int, 0, len(list))
+		for _, id := range list {
+			if to := person(id); !slices.Contains(out, to) {
+				out = append(out, to)
+			}
+		}
+		return out
+	}
+	amounts := func(m map[int]float64) map[int]float64 {
+		if m == nil {
+			return nil
+		}
+		out := make(map[int]float64, len(m))
+		for id, v := range m {
+			out[person(id)] = v
+		}
+		return out
+	}
+	b.PaidBy = person(b.PaidBy)
+	b.Participants = people(b.Participants)
+	b.Shares = amounts(b.Shares)
+	b.ExactAmounts = amounts(b.ExactAmounts)
+	b.LineItems = slices.Clone(b.LineItems)
+	for i := range b.LineItems {
+		b.LineItems[i].Participants = people(b.LineItems[i].Participants)
+	}
+	b.Payers = slices.Clone(b.Payers)
+	for i := range b.Payers {
+		b.Payers[i].PersonID = person(b.Payers[i].PersonID)
+	}
+}
+
+// handleRoomMerge POST /api/rooms/{code}/merge 把另一個房間（兩個小團體各自記的帳）併入這個房間，
+// 回應合併後整體重新計算的結算；來源房間保持不變，除非 archiveFrom 為 true
+func handleRoomMerge(w http.ResponseWriter, r *http.Request) {
+	dst, ok := serverRooms.get(r.PathValue("code"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+		return
+	}
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	var req MergeRoomsRequest
+	if err := decodeJSON(body, &req); err != nil {
+		writeInvalidJSON(w, err)
+		return
+	}
+	src, ok := serverRooms.get(req.From)
+	if !ok {
+		writeError(w, http.StatusNotFound, "source "+errRoomNotFound.Error())
+		return
+	}
+	if src == dst {
+		writeErrorFor(w, http.StatusBadRequest, fmt.Errorf("%w: 不能把房間併入自己", errInvalidMerge))
+		return
+	}
+	srcState, err := src.currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+
+	resp := MergeRoomsResponse{DryRun: req.DryRun}
+	merge := func(s *GlobalState, copyAttachment func(oldBill, newBill int, a Attachment) error) error {
+		mapping, added, err := mergeRoomState(s, srcState, req.People, copyAttachment)
+		resp.People, resp.BillsAdded = mapping, added
+		return err
+	}
+	var merged GlobalState
+	if req.DryRun {
+		merged, err = dst.currentState()
+		if err == nil {
+			merged = cloneState(merged)
+			if merged.ArchivedAt != 0 {
+				err = errRoomArchived
+			} else {
+				err = merge(&merged, nil)
+			}
+		}
+	} else {
+		merged, err = dst.updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			return merge(s, func(oldBill, newBill int, a Attachment) error {
+				data, err := os.ReadFile(attachmentPath(src.dir(), oldBill, a))
+				if err != nil {
+					return err
+				}
+				path := attachmentPath(dst.dir(), newBill, a)
+				if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+					return err
+				}
+				return writeFileAtomic(path, data, 0o600)
+			})
+		})
+	}
+	var invalid ValidationErrors
+	var limit *limitError
+	switch {
+	case err == nil:
+	case errors.Is(err, errInvalidMerge), errors.As(err, &invalid):
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	case errors.As(err, &limit):
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+		return
+	case errors.Is(err, errRoomArchived):
+		writeErrorFor(w, http.StatusConflict, fmt.Errorf("%w: 目標房間已封存，請先取消封存", errRoomArchived))
+		return
+	default:
+		log.Printf("merge rooms failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+
+	if !req.DryRun && req.ArchiveFrom && srcState.ArchivedAt == 0 {
+		if _, err := src.updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			s.ArchivedAt = clock.Now().UnixMilli()
+			return nil
+		}); err != nil && !errors.Is(err, errRoomArchived) {
+			log.Printf("archive merged room failed: %v", err)
+		}
+	}
+
+	resp.Revision = merged.Revision
+	resp.Balances, err = dst.ledger.balances(r.Context(), visibleState(merged))
+	if err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
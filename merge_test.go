@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 合併兩趟旅程測試
+// ==========================================
+func TestRoomMerge(t *testing.T) {
+	savedDir := dataDir
+	dataDir = t.TempDir()
+	t.Cleanup(func() { dataDir = savedDir })
+	reg := useRooms(t)
+
+	// A：Alice、Bob 住飯店；B：bob、Carol、Dave 吃晚餐（Dave 其實就是 Alice 的另一個暱稱）
+	a, _ := reg.create()
+	a.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+		s.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 1000, Currency: "TWD", PaidBy: 1, Participants: []int{1, 2}}}
+		return nil
+	})
+	b, _ := reg.create()
+	receipt := Attachment{ID: "r1", Name: "dinner.png", ContentType: "image/png"}
+	b.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "bob"}, {ID: 2, Name: "Carol"}, {ID: 3, Name: "Dave"}}
+		s.Groups = []Group{{ID: 1, Name: "全部", Members: []int{1, 2, 3}}}
+		s.Categories = append(s.Categories, Category{Name: "宵夜", Icon: "🍜"})
+		s.Bills = []Bill{{ID: 5, Title: "Dinner", Amount: 300, Category: "宵夜", PaidBy: 2, Groups: []int{1}, Attachments: []Attachment{receipt}}}
+		return nil
+	})
+	os.MkdirAll(filepath.Dir(attachmentPath(b.dir(), 5, receipt)), 0o700)
+	os.WriteFile(attachmentPath(b.dir(), 5, receipt), []byte("png"), 0o600)
+
+	rt := newServerRouter()
+	merge := func(body string) (*httptest.ResponseRecorder, MergeRoomsResponse) {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/rooms/"+a.code+"/merge", strings.NewReader(body)))
+		var resp MergeRoomsResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	// 預覽：bob 依名字對應 Bob、Dave 依指定對應 Alice、Carol 新增；不寫入
+	rec, preview := merge(`{"from":"` + b.code + `","people":{"3":1},"dryRun":true}`)
+	if rec.Code != http.StatusOK || !preview.DryRun {
+		t.Fatalf("預覽失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	want := []PersonMapping{
+		{From: 1, Name: "bob", To: 2, ToName: "Bob", Match: "name"},
+		{From: 2, Name: "Carol", To: 3, ToName: "Carol", Match: "new"},
+		{From: 3, Name: "Dave", To: 1, ToName: "Alice", Match: "manual"},
+	}
+	for i, m := range preview.People {
+		if i >= len(want) || m != want[i] {
+			t.Errorf("人員對應 = %+v, want %+v", preview.People, want)
+			break
+		}
+	}
+	if state, _ := a.currentState(); len(state.Bills) != 1 {
+		t.Errorf("預覽不應寫入, got %d 張帳單", len(state.Bills))
+	}
+
+	rec, resp := merge(`{"from":"` + b.code + `","people":{"3":1},"archiveFrom":true}`)
+	if rec.Code != http.StatusOK || resp.BillsAdded != 1 {
+		t.Fatalf("合併失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	// 飯店 Alice +500、Bob -500；晚餐 Carol 付 300 三人平分
+	balances := map[string]float64{}
+	for _, pb := range resp.Balances.Balances {
+		balances[pb.Person] = pb.Amount
+	}
+	if balances["Alice"] != 400 || balances["Bob"] != -600 || balances["Carol"] != 200 {
+		t.Errorf("合併後的淨額 = %v", balances)
+	}
+
+	state, _ := a.currentState()
+	if len(state.People) != 3 || len(state.Bills) != 2 || state.Revision != resp.Revision {
+		t.Fatalf("合併後的狀態 = %+v", state)
+	}
+	dinner := state.Bills[1]
+	if dinner.ID != 2 || dinner.PaidBy != 3 || len(dinner.Groups) != 0 || len(dinner.Participants) != 3 || dinner.Currency != "TWD" {
+		t.Errorf("併入的帳單 = %+v", dinner)
+	}
+	if findCategory(state.Categories, "宵夜") < 0 {
+		t.Error("帳單用到的分類應一併併入")
+	}
+	if data, err := os.ReadFile(attachmentPath(a.dir(), dinner.ID, receipt)); err != nil || string(data) != "png" {
+		t.Errorf("收據應複製到目標房間: %v", err)
+	}
+	if src, _ := b.currentState(); src.ArchivedAt == 0 || len(src.Bills) != 1 {
+		t.Errorf("來源房間應保留並封存, got %+v", src)
+	}
+
+	for body, code := range map[string]int{
+		`{"from":"` + a.code + `"}`:                        http.StatusBadRequest,
+		`{"from":"` + b.code + `","people":{"9":1}}`:       http.StatusBadRequest,
+		`{"from":"` + b.code + `","people":{"1":9}}`:       http.StatusBadRequest,
+		`{"from":"` + b.code + `","people":{"1":1,"3":1}}`: http.StatusBadRequest,
+		`{"from":"ZZZZZZ"}`:                                http.StatusNotFound,
+	} {
+		if rec, _ := merge(body); rec.Code != code {
+			t.Errorf("%s 應回 %d, got %d %s", body, code, rec.Code, rec.Body.String())
+		}
+	}
+}
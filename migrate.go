@@ -0,0 +1,110 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ================= 狀態格式版本與遷移 =================
+
+// currentSchemaVersion 每當存檔格式改變（新增 Bill 欄位、分帳模式等）就加一，
+// 並在 stateMigrations 註冊對應的升級函數
+const currentSchemaVersion = 2
+
+// stateMigration 將 from 版本的原始 JSON 就地升級到 from+1 版本
+type stateMigration func(raw map[string]json.RawMessage) error
+
+var stateMigrations = map[int]stateMigration{}
+
+func registerMigration(from int, m stateMigration) {
+	if _, dup := stateMigrations[from]; dup {
+		panic(fmt.Sprintf("migration from v%d registered twice", from))
+	}
+	stateMigrations[from] = m
+}
+
+func init() {
+	registerMigration(0, migrateV0ToV1)
+	registerMigration(1, migrateV1ToV2)
+}
+
+// decodeState 解析存檔內容，必要時依序套用遷移後再轉成 GlobalState
+func decodeState(data []byte) (GlobalState, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return GlobalState{}, err
+	}
+	if raw == nil {
+		raw = map[string]json.RawMessage{}
+	}
+
+	version := 0
+	if v, ok := raw["schemaVersion"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return GlobalState{}, fmt.Errorf("schemaVersion 格式錯誤: %w", err)
+		}
+	}
+	if version > currentSchemaVersion {
+		return GlobalState{}, fmt.Errorf("存檔版本 v%d 比程式支援的 v%d 新，請更新程式", version, currentSchemaVersion)
+	}
+
+	for version < currentSchemaVersion {
+		m, ok := stateMigrations[version]
+		if !ok {
+			return GlobalState{}, fmt.Errorf("缺少 v%d 的遷移步驟", version)
+		}
+		if err := m(raw); err != nil {
+			return GlobalState{}, fmt.Errorf("v%d 遷移失敗: %w", version, err)
+		}
+		version++
+		raw["schemaVersion"], _ = json.Marshal(version)
+	}
+
+	upgraded, err := json.Marshal(raw)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	var state GlobalState
+	if err := json.Unmarshal(upgraded, &state); err != nil {
+		return GlobalState{}, err
+	}
+	return state, nil
+}
+
+// migrateV0ToV1：沒有 schemaVersion 的舊檔，補上 null 陣列與預設幣別
+func migrateV0ToV1(raw map[string]json.RawMessage) error {
+	for _, key := range []string{"people", "bills"} {
+		if v, ok := raw[key]; !ok || string(v) == "null" {
+			raw[key] = json.RawMessage("[]")
+		}
+	}
+	var base string
+	if v, ok := raw["baseCurrency"]; ok {
+		_ = json.Unmarshal(v, &base)
+	}
+	if base == "" {
+		raw["baseCurrency"], _ = json.Marshal(defaultBase)
+	}
+	return nil
+}
+
+// migrateV1ToV2：分類改由伺服器管理，補上預設分類與帳單已經在用的自訂分類
+func migrateV1ToV2(raw map[string]json.RawMessage) error {
+	if v, ok := raw["categories"]; ok && string(v) != "null" {
+		return nil
+	}
+	var s GlobalState
+	if v, ok := raw["bills"]; ok {
+		if err := json.Unmarshal(v, &s.Bills); err != nil {
+			return err
+		}
+	}
+	s.Categories = defaultCategories()
+	ensureBillCategories(&s)
+	data, err := json.Marshal(s.Categories)
+	if err != nil {
+		return err
+	}
+	raw["categories"] = data
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// ==========================================
+// 狀態檔遷移測試
+// ==========================================
+func TestDecodeState_MigratesV0(t *testing.T) {
+	// 沒有 schemaVersion、bills 為 null 的舊存檔
+	old := []byte(`{"people":[{"id":1,"name":"Alice"}],"bills":null,"lastUpdated":1}`)
+
+	state, err := decodeState(old)
+	if err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+	if state.SchemaVersion != currentSchemaVersion {
+		t.Errorf("版本錯誤, got %d, want %d", state.SchemaVersion, currentSchemaVersion)
+	}
+	if state.Bills == nil || state.BaseCurrency != defaultBase {
+		t.Errorf("預設值未補上: %+v", state)
+	}
+	if len(state.People) != 1 || state.People[0].Name != "Alice" {
+		t.Errorf("人員資料遺失: %+v", state.People)
+	}
+}
+
+func TestDecodeState_RejectsNewerVersion(t *testing.T) {
+	if _, err := decodeState([]byte(`{"schemaVersion":999}`)); err == nil {
+		t.Error("較新版本的存檔應該回傳錯誤")
+	}
+}
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	fs := NewFileStore(filepath.Join(t.TempDir(), "state.json"), "")
+
+	empty, err := fs.Load()
+	if err != nil || len(empty.People) != 0 {
+		t.Fatalf("不存在的檔案應回傳空白狀態, got %+v, %v", empty, err)
+	}
+
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Bob"}}
+	if err := fs.Save(state); err != nil {
+		t.Fatalf("存檔失敗: %v", err)
+	}
+	loaded, err := fs.Load()
+	if err != nil {
+		t.Fatalf("讀檔失敗: %v", err)
+	}
+	if len(loaded.People) != 1 || loaded.People[0].Name != "Bob" {
+		t.Errorf("讀回的資料不一致: %+v", loaded)
+	}
+}
+
+func TestDecodeState_MigratesCategories(t *testing.T) {
+	v1 := []byte(`{"schemaVersion":1,"people":[],"bills":[{"id":1,"title":"Ski pass","category":"滑雪"}]}`)
+
+	state, err := decodeState(v1)
+	if err != nil {
+		t.Fatalf("遷移失敗: %v", err)
+	}
+	if findCategory(state.Categories, "交通") < 0 {
+		t.Errorf("應補上預設分類: %+v", state.Categories)
+	}
+	if i := findCategory(state.Categories, "滑雪"); i < 0 || state.Categories[i].Icon == "" {
+		t.Errorf("帳單已在用的自訂分類應加入清單: %+v", state.Categories)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// ================= 金額（最小貨幣單位） =================
+
+// Money 以幣別的最小單位（例如分）表示的金額。
+// 結算內部一律用整數累加，避免 float64 累積誤差造成 33.333333 或 0.01 的幽靈欠款
+type Money int64
+
+// currencyDecimals 小數位數不是 2 的幣別（ISO 4217）
+var currencyDecimals = map[string]int{
+	"BIF": 0, "CLP": 0, "ISK": 0, "JPY": 0, "KRW": 0, "PYG": 0, "UGX": 0, "VND": 0, "XAF": 0, "XOF": 0,
+	"BHD": 3, "IQD": 3, "JOD": 3, "KWD": 3, "LYD": 3, "OMR": 3, "TND": 3,
+}
+
+// currencyDecimalPlaces 幣別的小數位數，沒有列在 currencyDecimals 的為 2
+func currencyDecimalPlaces(currency string) int {
+	if d, ok := currencyDecimals[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return d
+	}
+	return 2
+}
+
+func currencyScale(currency string) float64 {
+	return math.Pow10(currencyDecimalPlaces(currency))
+}
+
+func toMoney(v float64, currency string) Money {
+	return Money(math.Round(v * currencyScale(currency)))
+}
+
+// Float 換回該幣別的金額，小數位數依幣別而定
+func (m Money) Float(currency string) float64 {
+	return float64(m) / currencyScale(currency)
+}
+
+// minorUnit 該幣別的最小單位（TWD 為 0.01、JPY 為 1、KWD 為 0.001）
+func minorUnit(currency string) float64 {
+	return 1 / currencyScale(currency)
+}
+
+func (m Money) abs() Money {
+	if m < 0 {
+		return -m
+	}
+	return m
+}
+
+// roundMoney 依幣別的小數位數四捨五入
+func roundMoney(v float64, currency string) float64 {
+	return toMoney(v, currency).Float(currency)
+}
+
+// allocate 把 total 依各人的浮點數金額拆成整數，總和恰好等於 total。
+// 先各自無條件捨去，差額依小數部分由大到小逐一補上（同分時 ID 小的優先）
+func allocate(total Money, amounts map[int]float64, currency string) map[int]Money {
+	out, leftover, byFraction := truncateShares(total, amounts, currency)
+	spreadRemainder(out, leftover, byFraction)
+	return out
+}
+
+// truncateShares 各自無條件捨去到最小單位，回傳捨去後的金額、與 total 的差額，
+// 以及依小數部分由大到小（同分時 ID 小的優先）排序的 ID
+func truncateShares(total Money, amounts map[int]float64, currency string) (map[int]Money, Money, []int) {
+	scale := currencyScale(currency)
+	out := make(map[int]Money, len(amounts))
+	fraction := make(map[int]float64, len(amounts))
+	ids := make([]int, 0, len(amounts))
+	var sum Money
+	for id, v := range amounts {
+		exact := v * scale
+		// 5.05*100 = 504.99999…，容許浮點誤差，否則會多出一單位的差額
+		floor := math.Floor(exact + 1e-6)
+		out[id] = Money(floor)
+		sum += Money(floor)
+		fraction[id] = max(exact-floor, 0)
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if fraction[ids[i]] != fraction[ids[j]] {
+			return fraction[ids[i]] > fraction[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return out, total - sum, ids
+}
+
+// spreadRemainder 依 order 輪流把差額一單位一單位補上（差額為負時從 order 尾端扣），
+// 回傳每個人被調整的量
+func spreadRemainder(out map[int]Money, leftover Money, order []int) map[int]Money {
+	adjusted := make(map[int]Money)
+	if len(order) == 0 {
+		return adjusted
+	}
+	for i := 0; leftover > 0; i = (i + 1) % len(order) {
+		out[order[i]]++
+		adjusted[order[i]]++
+		leftover--
+	}
+	for i := len(order) - 1; leftover < 0; i = (i - 1 + len(order)) % len(order) {
+		out[order[i]]--
+		adjusted[order[i]]--
+		leftover++
+	}
+	return adjusted
+}
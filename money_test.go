@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+// ==========================================
+// 最小貨幣單位與拆分測試
+// ==========================================
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name     string
+		total    Money
+		amounts  map[int]float64
+		currency string
+		want     map[int]Money
+	}{
+		{"100 元三人分，多的 1 分給 ID 小的", 10000, map[int]float64{1: 100.0 / 3, 2: 100.0 / 3, 3: 100.0 / 3}, "TWD", map[int]Money{1: 3334, 2: 3333, 3: 3333}},
+		{"日圓沒有小數", 1000, map[int]float64{1: 1000.0 / 3, 2: 1000.0 / 3, 3: 1000.0 / 3}, "JPY", map[int]Money{1: 334, 2: 333, 3: 333}},
+		{"退款為負數", -10000, map[int]float64{1: -100.0 / 3, 2: -100.0 / 3, 3: -100.0 / 3}, "TWD", map[int]Money{1: -3333, 2: -3333, 3: -3334}},
+		{"第納爾有三位小數", 1000, map[int]float64{1: 0.5, 2: 0.5}, "KWD", map[int]Money{1: 500, 2: 500}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := allocate(tt.total, tt.amounts, tt.currency)
+			var sum Money
+			for id, want := range tt.want {
+				if got[id] != want {
+					t.Errorf("ID %d: got %d, want %d", id, got[id], want)
+				}
+				sum += got[id]
+			}
+			if sum != tt.total {
+				t.Errorf("總和應為 %d, got %d", tt.total, sum)
+			}
+		})
+	}
+}
+
+func TestCalculate_NoPhantomCents(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	var bills []Bill
+	// 三人輪流付 10 元平分，理論上彼此不欠
+	for i := 1; i <= 3; i++ {
+		bills = append(bills, Bill{ID: i, AmountBase: 10, PaidBy: i, Participants: []int{1, 2, 3}})
+	}
+	got := calculate(people, bills)
+	for _, s := range got {
+		if s.Amount > 0.01 {
+			t.Errorf("不應出現超過 1 分的欠款: %+v", got)
+		}
+	}
+
+	got = calculate(people, []Bill{{ID: 1, AmountBase: 100, PaidBy: 1, Participants: []int{1, 2, 3}}})
+	for _, s := range got {
+		if s.Amount != 33.33 && s.Amount != 33.34 {
+			t.Errorf("金額應四捨五入到分: %+v", got)
+		}
+	}
+}
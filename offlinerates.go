@@ -0,0 +1,49 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"strings"
+)
+
+// ================= 離線匯率快照 =================
+
+// offlineRatesJSON 內建的匯率快照（格式同匯率 API，以美元為準），沒有網路時用來換算
+//
+//go:embed rates_snapshot.json
+var offlineRatesJSON []byte
+
+const offlineRatesPivot = "usd"
+
+// offlineRates 以內建快照換算出 base 的匯率：快照以美元為準，其他本位幣用交叉匯率
+func offlineRates(base string) (rateEntry, error) {
+	snapshot, err := parseRateResponse(offlineRatesPivot, offlineRatesJSON)
+	if err != nil {
+		return rateEntry{}, fmt.Errorf("內建匯率快照毀損：%w", err)
+	}
+	entry, err := rebaseRates(snapshot, base)
+	if err != nil {
+		return rateEntry{}, fmt.Errorf("內建匯率快照沒有幣別 %s", strings.ToUpper(base))
+	}
+	entry.Offline = true
+	return entry, nil
+}
+
+// rebaseRates 把以某幣別為準的匯率換算成以 base 為準（交叉匯率）
+func rebaseRates(snapshot rateEntry, base string) (rateEntry, error) {
+	baseLower := strings.ToLower(base)
+	pivot, ok := snapshot.Rates[baseLower]
+	if !ok || pivot == 0 {
+		return rateEntry{}, fmt.Errorf("缺少幣別 %s", strings.ToUpper(base))
+	}
+	rates := make(map[string]float64, len(snapshot.Rates))
+	for cur, rate := range snapshot.Rates {
+		rates[cur] = rate / pivot
+	}
+	return rateEntry{Rates: rates, Date: snapshot.Date}, nil
+}
+
+// offlineRateNotice 使用離線匯率時附在回應上的提醒
+func offlineRateNotice(date string) string {
+	return fmt.Sprintf("目前無法取得即時匯率，使用內建的 %s 匯率換算，僅供參考", date)
+}
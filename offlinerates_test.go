@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+)
+
+// failingFetcher 模擬沒有網路
+type failingFetcher struct{}
+
+func (failingFetcher) Fetch(context.Context, string) (rateEntry, error) {
+	return rateEntry{}, errors.New("network unreachable")
+}
+
+// ==========================================
+// 離線匯率快照測試
+// ==========================================
+func TestConvertBillsToBase_OfflineSnapshot(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+
+	snapshot, err := offlineRates("twd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bills := []Bill{{ID: 1, Title: "Sushi", Amount: 3000, Currency: "JPY"}}
+	converted, rates, date, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{})
+	if err != nil {
+		t.Fatalf("沒有網路時應改用內建匯率, got %v", err)
+	}
+	if date != snapshot.Date || rates[0].Source != rateSourceOffline {
+		t.Errorf("date = %q, source = %q, want %q offline", date, rates[0].Source, snapshot.Date)
+	}
+	if want := roundMoney(3000/snapshot.Rates["jpy"], "TWD"); math.Abs(converted[0].AmountBase-want) > 0.01 {
+		t.Errorf("AmountBase = %v, want %v", converted[0].AmountBase, want)
+	}
+	if _, ok := rateCache.Get("twd"); ok {
+		t.Error("離線匯率不應放進快取")
+	}
+
+	resp := runCalculate(context.Background(), CalculateRequest{
+		BaseCurrency: "TWD",
+		People:       []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}},
+		Bills:        []Bill{{ID: 1, Title: "Sushi", Amount: 3000, Currency: "JPY", PaidBy: 1, Participants: []int{1, 2}}},
+	})
+	if resp.Error != "" || !strings.Contains(resp.RateNotice, snapshot.Date) {
+		t.Errorf("應提醒使用離線匯率與日期, got %+v", resp)
+	}
+
+	// 快照沒有的本位幣照樣回報連線錯誤
+	if _, _, _, err := convertBillsWithRates(context.Background(), "XYZ", bills, conversionOptions{}); err == nil || !strings.Contains(err.Error(), "network") {
+		t.Errorf("got %v, want network error", err)
+	}
+}
+
+func TestOfflineRates_CrossRates(t *testing.T) {
+	usd, err := offlineRates("USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	eur, err := offlineRates("EUR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eur.Rates["eur"] != 1 || math.Abs(eur.Rates["usd"]-1/usd.Rates["eur"]) > 1e-9 {
+		t.Errorf("交叉匯率錯誤: %v", eur.Rates)
+	}
+	if !eur.Offline || eur.Date == "" {
+		t.Errorf("got %+v", eur)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= OpenAPI 文件（/api/docs） =================
+
+// apiOperation 一個 API 操作；Request、Response 是範例值，只用來取得型別產生 schema
+type apiOperation struct {
+	Method  string
+	Path    string
+	Summary string
+	Query   []apiParam
+	// Request 請求內容（application/json）；Content 另外指定內容類型時優先使用
+	Request any
+	Content map[string]any
+	Status  int
+	// Response 回應內容；ResponseType 不是 JSON 時指定（例如 text/event-stream）
+	Response     any
+	ResponseType string
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+}
+
+// apiOperations 所有對外的 API；新增路由時一併補上，TestOpenAPI_CoversRoutes 會檢查
+var apiOperations = []apiOperation{
+	{Method: "POST", Path: "/api/calculate", Summary: "計算結算方式（錯誤時 errorInfo 為統一錯誤格式）", Request: CalculateRequest{}, Status: 200, Response: CalculateResponse{}},
+
+	{Method: "GET", Path: "/api/sync", Summary: "取得目前狀態；帶 since 時長輪詢，沒有變更回 304", Query: []apiParam{
+		{"since", "上次取得的 lastUpdated"}, {"wait", "最多等待的時間，例如 25s（上限 60s）"},
+	}, Status: 200, Response: GlobalState{}},
+	{Method: "POST", Path: "/api/sync", Summary: "送出完整狀態；以 If-Match 或 revision 帶上依據的版本，版本落後時逐筆合併並列出衝突", Request: GlobalState{}, Status: 200, Response: SyncResponse{}},
+	{Method: "PATCH", Path: "/api/sync", Summary: "部分更新狀態（merge patch 或 JSON Patch）", Content: map[string]any{
+		mergePatchType: GlobalState{},
+		jsonPatchType:  []PatchOp{},
+	}, Status: 200, Response: GlobalState{}},
+	{Method: "GET", Path: "/api/crdt", Summary: "取得某個版本之後變動過的人員與帳單（包含刪除留下的墓碑）", Query: []apiParam{
+		{"since", "上次取得的 revision，省略時回傳全部"},
+	}, Status: 200, Response: CRDTState{}},
+	{Method: "POST", Path: "/api/crdt", Summary: "送出離線期間改過的人員與帳單，依編輯時間逐筆合併（不需 If-Match）", Query: []apiParam{
+		{"since", "回應只列這個版本之後的變動"},
+	}, Request: CRDTChanges{}, Status: 200, Response: CRDTState{}},
+	{Method: "GET", Path: "/api/ws", Summary: "WebSocket：連上後推送 StateEvent", Status: http.StatusSwitchingProtocols},
+	{Method: "GET", Path: "/api/events", Summary: "SSE 事件串流：state-updated、bill-added、calculation-done", Query: []apiParam{
+		{"lastEventId", "沒有 Last-Event-ID 標頭時，從這個事件編號之後補送"},
+	}, Status: 200, ResponseType: "text/event-stream"},
+
+	{Method: "GET", Path: "/api/bills", Summary: "查詢帳單", Query: []apiParam{
+		{"from", "開始日期 YYYY-MM-DD"}, {"to", "結束日期 YYYY-MM-DD"}, {"tag", "標籤"}, {"q", "關鍵字"},
+		{"category", "分類（不分大小寫）"}, {"paidBy", "付款人 ID"}, {"sort", `date 或 amount，前面加 "-" 由大到小`},
+		{"limit", "每頁筆數（最多 500）"}, {"offset", "略過的筆數"}, {"group", `"day" 時依日期分組（只含這一頁）`},
+	}, Status: 200, Response: BillsResponse{}},
+	{Method: "POST", Path: "/api/bills", Summary: "新增帳單（ID 由伺服器指定）", Request: Bill{}, Status: 201, Response: Bill{}},
+	{Method: "POST", Path: "/api/bills:batch", Summary: "一次新增多筆帳單（全部成功或全部不新增）", Request: []Bill{}, Status: 201, Response: []Bill{}},
+	{Method: "PUT", Path: "/api/bills/{id}", Summary: "修改帳單", Request: Bill{}, Status: 200, Response: Bill{}},
+	{Method: "DELETE", Path: "/api/bills/{id}", Summary: "刪除帳單（移到垃圾桶）", Status: 204},
+	{Method: "POST", Path: "/api/bills/{id}/attachments", Summary: "上傳收據（multipart 欄位 file）", Content: map[string]any{
+		"multipart/form-data": struct {
+			File []byte `json:"file"`
+		}{},
+	}, Status: 201, Response: Attachment{}},
+	{Method: "GET", Path: "/api/bills/{id}/attachments/{attachment}", Summary: "下載收據", Status: 200, ResponseType: "application/octet-stream"},
+	{Method: "DELETE", Path: "/api/bills/{id}/attachments/{attachment}", Summary: "刪除收據", Status: 204},
+	{Method: "GET", Path: "/api/bills/{id}/comments", Summary: "帳單留言", Status: 200, Response: []Comment{}},
+	{Method: "POST", Path: "/api/bills/{id}/comments", Summary: "新增留言", Request: CreateCommentRequest{}, Status: 201, Response: Comment{}},
+	{Method: "GET", Path: "/api/bills/{id}/history", Summary: "帳單的各個版本（由新到舊，第一筆為目前版本）", Status: 200, Response: []Bill{}},
+	{Method: "POST", Path: "/api/bills/from-template/{id}", Summary: "以範本新增帳單", Request: FromTemplateRequest{}, Status: 201, Response: Bill{}},
+
+	{Method: "GET", Path: "/api/people", Summary: "人員清單", Status: 200, Response: []Person{}},
+	{Method: "POST", Path: "/api/people", Summary: "新增人員", Request: Person{}, Status: 201, Response: Person{}},
+	{Method: "PUT", Path: "/api/people/{id}", Summary: "修改人員", Request: Person{}, Status: 200, Response: Person{}},
+	{Method: "DELETE", Path: "/api/people/{id}", Summary: "刪除人員（還有帳單或群組用到時回 409）", Status: 204},
+
+	{Method: "GET", Path: "/api/templates", Summary: "帳單範本清單", Status: 200, Response: []BillTemplate{}},
+	{Method: "POST", Path: "/api/templates", Summary: "新增範本", Request: BillTemplate{}, Status: 201, Response: BillTemplate{}},
+	{Method: "PUT", Path: "/api/templates/{id}", Summary: "修改範本", Request: BillTemplate{}, Status: 200, Response: BillTemplate{}},
+	{Method: "DELETE", Path: "/api/templates/{id}", Summary: "刪除範本", Status: 204},
+
+	{Method: "GET", Path: "/api/categories", Summary: "分類清單", Status: 200, Response: []Category{}},
+	{Method: "POST", Path: "/api/categories", Summary: "新增分類", Request: Category{}, Status: 201, Response: Category{}},
+	{Method: "PUT", Path: "/api/categories/{name}", Summary: "修改分類（改名時帳單一併更新）", Request: Category{}, Status: 200, Response: Category{}},
+	{Method: "DELETE", Path: "/api/categories/{name}", Summary: "刪除分類", Status: 204},
+
+	{Method: "GET", Path: "/api/groups", Summary: "群組清單", Status: 200, Response: []Group{}},
+	{Method: "POST", Path: "/api/groups", Summary: "新增群組", Request: Group{}, Status: 201, Response: Group{}},
+	{Method: "PUT", Path: "/api/groups/{id}", Summary: "修改群組", Request: Group{}, Status: 200, Response: Group{}},
+	{Method: "DELETE", Path: "/api/groups/{id}", Summary: "刪除群組", Status: 204},
+
+	{Method: "GET", Path: "/api/export", Summary: "匯出完整狀態（JSON 檔）", Status: 200, Response: GlobalState{}},
+	{Method: "POST", Path: "/api/import", Summary: "匯入狀態（覆蓋目前資料）；會改動或刪除已鎖定的帳單時回 409 bill_locked", Request: GlobalState{}, Status: 200, Response: GlobalState{}},
+	{Method: "GET", Path: "/api/trash", Summary: "垃圾桶", Status: 200, Response: TrashResponse{}},
+	{Method: "POST", Path: "/api/trash/restore", Summary: "從垃圾桶還原", Request: RestoreRequest{}, Status: 200, Response: GlobalState{}},
+	{Method: "GET", Path: "/api/activity", Summary: "動態紀錄（新的在前）", Query: []apiParam{
+		{"limit", "筆數"}, {"billId", "只看這張帳單"},
+	}, Status: 200, Response: []Activity{}},
+	{Method: "GET", Path: "/api/devices", Summary: "最近出現過的裝置與是否在線（裝置 ID 與動態紀錄的 deviceId 相同）", Status: 200, Response: []DeviceInfo{}},
+	{Method: "GET", Path: "/api/explain/{billId}", Summary: "帳單的分攤明細", Status: 200, Response: BillExplanation{}},
+	{Method: "GET", Path: "/api/balances", Summary: "每個人的淨額與結算方式", Status: 200, Response: BalancesResponse{}},
+	{Method: "GET", Path: "/api/summary", Summary: "統計摘要：總花費、每人付出/分攤、分類、幣別與每日花費", Query: []apiParam{
+		{"from", "開始日期 YYYY-MM-DD"}, {"to", "結束日期 YYYY-MM-DD"},
+	}, Status: 200, Response: SummaryResponse{}},
+
+	{Method: "GET", Path: "/api/rates", Summary: "自訂匯率表", Status: 200, Response: RateTable{}},
+	{Method: "PUT", Path: "/api/rates", Summary: "設定自訂匯率表", Request: RateTable{}, Status: 200, Response: RateTable{}},
+	{Method: "GET", Path: "/api/currencies", Summary: "支援的幣別", Query: []apiParam{{"base", "本位幣"}}, Status: 200, Response: CurrenciesResponse{}},
+	{Method: "POST", Path: "/api/rates/lock", Summary: "鎖定目前的匯率", Query: []apiParam{{"refresh", "不為空時先重新取得匯率"}}, Status: 200, Response: LockedRates{}},
+	{Method: "DELETE", Path: "/api/rates/lock", Summary: "解除匯率鎖定", Status: 204},
+	{Method: "GET", Path: "/api/rates/cache", Summary: "匯率快取狀態", Status: 200, Response: RateCacheResponse{}},
+
+	{Method: "POST", Path: "/api/settlements/{n}/pay", Summary: "記錄第 n 筆結算的付款", Request: PaymentRequest{}, Status: 201, Response: PaymentResponse{}},
+	{Method: "POST", Path: "/api/finalize", Summary: "結算並鎖定所有帳單", Request: FinalizeRequest{}, Status: 200, Response: GlobalState{}},
+	{Method: "POST", Path: "/api/unlock", Summary: "解除鎖定", Request: UnlockRequest{}, Status: 200, Response: GlobalState{}},
+	{Method: "GET", Path: "/api/snapshots", Summary: "快照清單", Status: 200, Response: []SnapshotInfo{}},
+	{Method: "POST", Path: "/api/snapshots", Summary: "建立快照", Request: CreateSnapshotRequest{}, Status: 201, Response: SnapshotInfo{}},
+	{Method: "POST", Path: "/api/snapshots/{id}/restore", Summary: "還原快照；會改動或刪除已鎖定的帳單時回 409 bill_locked", Status: 200, Response: GlobalState{}},
+	{Method: "GET", Path: "/api/rooms", Summary: "房間清單（預設不含封存的房間）", Query: []apiParam{
+		{Name: "archived", Description: "true 時一併列出封存的房間"},
+	}, Status: 200, Response: []RoomInfo{}},
+	{Method: "POST", Path: "/api/rooms", Summary: "建立新房間（一趟獨立的旅程），回傳加入代碼", Status: 201, Response: RoomInfo{}},
+	{Method: "GET", Path: "/api/rooms/{code}", Summary: "以加入代碼取得房間摘要與加入網址", Status: 200, Response: RoomInfo{}},
+	{Method: "GET", Path: "/api/rooms/{code}/qr.png", Summary: "加入網址的 QR Code（PNG），手機掃描即可加入", Query: []apiParam{
+		{Name: "scale", Description: "每個模組的像素數，1–20（預設 8）"},
+	}, Status: 200, ResponseType: "image/png"},
+	{Method: "POST", Path: "/api/rooms/{code}/archive", Summary: "封存房間：之後只能檢視，修改一律回 409 room_archived", Status: 200, Response: RoomInfo{}},
+	{Method: "DELETE", Path: "/api/rooms/{code}/archive", Summary: "取消封存房間", Status: 200, Response: RoomInfo{}},
+	{Method: "POST", Path: "/api/rooms/{code}/clone", Summary: "以同一群人員與分類建立新的空白房間", Status: 201, Response: RoomInfo{}},
+	{Method: "POST", Path: "/api/rooms/{code}/merge", Summary: "把另一個房間的人員與帳單併入（人員依名字或指定的對應合併），回傳合併後的結算；dryRun 只預覽", Request: MergeRoomsRequest{}, Status: 200, Response: MergeRoomsResponse{}},
+	{Method: "GET", Path: "/api/webhooks", Summary: "webhook 清單（不含金鑰）", Status: 200, Response: []Webhook{}},
+	{Method: "POST", Path: "/api/webhooks", Summary: "登記 webhook，事件發生時以 POST 送出並附上 X-Splitter-Signature 簽章", Request: CreateWebhookRequest{}, Status: 201, Response: Webhook{}},
+	{Method: "DELETE", Path: "/api/webhooks/{id}", Summary: "取消登記 webhook", Status: 204},
+
+	{Method: "GET", Path: "/healthz", Summary: "存活檢查", Status: 200, Response: map[string]string{}},
+	{Method: "GET", Path: "/readyz", Summary: "就緒檢查：狀態可讀取且有可用的匯率，否則回 503", Status: 200, Response: ReadyResponse{}},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIJSON []byte
+)
+
+var pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+
+// openAPISpec 依 apiOperations 產生 OpenAPI 3 文件；schema 由 Go 結構的 json 標籤推導
+func openAPISpec() map[string]any {
+	b := &schemaBuilder{schemas: map[string]any{}}
+	errorRef := b.schema(reflect.TypeOf(APIError{}))
+	paths := map[string]any{}
+	for _, op := range apiOperations {
+		item, _ := paths[op.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[op.Path] = item
+		}
+
+		var params []any
+		for _, m := range pathParamPattern.FindAllStringSubmatch(op.Path, -1) {
+			params = append(params, map[string]any{"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"}})
+		}
+		for _, q := range op.Query {
+			params = append(params, map[string]any{"name": q.Name, "in": "query", "description": q.Description, "schema": map[string]any{"type": "string"}})
+		}
+
+		operation := map[string]any{
+			"summary":     op.Summary,
+			"operationId": strings.ToLower(op.Method) + operationName(op.Path),
+			"responses": map[string]any{
+				strconv.Itoa(op.Status): b.response(op),
+				"default": map[string]any{
+					"description": "錯誤（code、message、field、details）",
+					"content":     map[string]any{"application/json": map[string]any{"schema": errorRef}},
+				},
+			},
+		}
+		if params != nil {
+			operation["parameters"] = params
+		}
+		content := op.Content
+		if content == nil && op.Request != nil {
+			content = map[string]any{"application/json": op.Request}
+		}
+		if content != nil {
+			body := map[string]any{}
+			for typ, v := range content {
+				body[typ] = map[string]any{"schema": b.schema(reflect.TypeOf(v))}
+			}
+			operation["requestBody"] = map[string]any{"required": true, "content": body}
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "分帳器 API",
+			"version":     "1.0",
+			"description": "錯誤一律回傳 APIError；寫入 /api/sync 需要 If-Match（revision）。所有 /api/... 路由加上 /api/rooms/{code} 前綴（例如 /api/rooms/{code}/sync）即作用在該房間，沒有前綴的作用在預設房間",
+		},
+		"paths":      paths,
+		"components": map[string]any{"schemas": b.schemas},
+	}
+}
+
+func (b *schemaBuilder) response(op apiOperation) map[string]any {
+	resp := map[string]any{"description": http.StatusText(op.Status)}
+	switch {
+	case op.ResponseType != "":
+		resp["content"] = map[string]any{op.ResponseType: map[string]any{"schema": map[string]any{"type": "string", "format": "binary"}}}
+	case op.Response != nil:
+		resp["content"] = map[string]any{"application/json": map[string]any{"schema": b.schema(reflect.TypeOf(op.Response))}}
+	}
+	return resp
+}
+
+// operationName /api/bills/{id}/comments -> BillsIdComments
+func operationName(path string) string {
+	var sb strings.Builder
+	for _, part := range strings.FieldsFunc(strings.TrimPrefix(path, "/api/"), func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-'
+	}) {
+		sb.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return sb.String()
+}
+
+// schemaBuilder 將 Go 型別轉成 JSON Schema；具名結構放到 components.schemas 並以 $ref 參照
+type schemaBuilder struct {
+	schemas map[string]any
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *schemaBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case rawMessageType:
+		return map[string]any{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "binary"}
+		}
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		ref := map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = nil // 先佔位，遞迴的型別（例如帳單的子項目）才不會無限展開
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return ref
+	}
+	return map[string]any{}
+}
+
+// object 結構的欄位依 json 標籤命名；沒有 omitempty 的欄位列為 required
+func (b *schemaBuilder) object(t reflect.Type) map[string]any {
+	props := map[string]any{}
+	var required []string
+	b.fields(t, props, &required)
+	obj := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		obj["required"] = required
+	}
+	return obj
+}
+
+func (b *schemaBuilder) fields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.fields(ft, props, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schema(f.Type)
+		if !strings.Contains(opts, "omitempty") && f.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// handleOpenAPI GET /api/docs/openapi.json
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	openAPIOnce.Do(func() {
+		openAPIJSON, _ = json.MarshalIndent(openAPISpec(), "", "  ")
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPIJSON)
+}
+
+// swaggerUIHTML /api/docs 的頁面：Swagger UI 的程式從 CDN 載入，文件本身由伺服器提供
+const swaggerUIHTML = `<!DOCTYPE html>
+<html lang="zh-Hant">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>分帳器 API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: '/api/docs/openapi.json', dom_id: '#swagger-ui' });
+  </script>
+</body>
+</html>
+`
+
+// handleDocs GET /api/docs：Swagger UI
+func handleDocs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIHTML))
+}
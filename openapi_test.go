@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// OpenAPI 文件涵蓋所有路由測試
+// ==========================================
+func TestOpenAPI_CoversRoutes(t *testing.T) {
+	src, err := os.ReadFile("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	spec := openAPISpec()
+	paths := spec["paths"].(map[string]any)
+
+	routes := regexp.MustCompile(`rt\.handle\("(/api/[^"]*)"`).FindAllStringSubmatch(string(src), -1)
+	if len(routes) == 0 {
+		t.Fatal("main.go 找不到任何 /api 路由")
+	}
+	for _, m := range routes {
+		route := m[1]
+		if strings.HasPrefix(route, "/api/docs") {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(route, "{rest...}"); ok {
+			found := false
+			for p := range paths {
+				found = found || strings.HasPrefix(p, prefix)
+			}
+			if !found {
+				t.Errorf("文件缺少 %s 底下的路徑", prefix)
+			}
+			continue
+		}
+		if _, ok := paths[route]; !ok {
+			t.Errorf("文件缺少路由 %s", route)
+		}
+	}
+}
+
+// ==========================================
+// OpenAPI 文件內容測試
+// ==========================================
+func TestHandleOpenAPI(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleOpenAPI(rec, httptest.NewRequest(http.MethodGet, "/api/docs/openapi.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("取得文件失敗: %d", rec.Code)
+	}
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+				Required   []string                   `json:"required"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Paths["/api/bills/{id}"]["put"] == nil {
+		t.Errorf("文件內容不正確: openapi=%q", doc.OpenAPI)
+	}
+
+	bill := doc.Components.Schemas["Bill"]
+	if bill.Properties["paidBy"] == nil || bill.Properties["participants"] == nil {
+		t.Errorf("Bill 應依 json 標籤列出欄位, got %v", bill.Properties)
+	}
+	if errSchema := doc.Components.Schemas["APIError"]; len(errSchema.Required) != 2 {
+		t.Errorf("APIError 的 code、message 應為必填, got %v", errSchema.Required)
+	}
+
+	// 每個 $ref 都要指到存在的 schema
+	for _, m := range regexp.MustCompile(`"\$ref": "#/components/schemas/([^"]+)"`).FindAllStringSubmatch(rec.Body.String(), -1) {
+		if _, ok := doc.Components.Schemas[m[1]]; !ok {
+			t.Errorf("$ref 指到不存在的 schema %s", m[1])
+		}
+	}
+}
+
+func TestHandleDocs(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleDocs(rec, httptest.NewRequest(http.MethodGet, "/api/docs", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/docs/openapi.json") {
+		t.Errorf("Swagger UI 頁面應載入文件, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ================= 部分更新（PATCH /api/sync） =================
+
+const (
+	mergePatchType = "application/merge-patch+json" // RFC 7386
+	jsonPatchType  = "application/json-patch+json"  // RFC 6902
+)
+
+var (
+	errInvalidPatch    = errors.New("invalid patch")
+	errPatchTestFailed = errors.New("patch test failed")
+)
+
+// PatchOp RFC 6902 的一個操作
+type PatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// handleSyncPatch PATCH /api/sync：把修補套在前端看到的狀態（不含垃圾桶、快照與紀錄）上，
+// 結果與 POST 完整狀態走同樣的驗證；手機網路不穩時只要送改了的部分
+func handleSyncPatch(w http.ResponseWriter, r *http.Request) {
+	contentType := mergePatchType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			writeError(w, http.StatusUnsupportedMediaType, "invalid content type")
+			return
+		}
+		contentType = mt
+	}
+	var apply func(doc any, patch []byte) (any, error)
+	switch contentType {
+	case mergePatchType, "application/json":
+		apply = applyMergePatch
+	case jsonPatchType:
+		apply = applyJSONPatch
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "content type must be "+mergePatchType+" or "+jsonPatchType)
+		return
+	}
+
+	patch, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+
+	revs, err := requestRevision(r, patch)
+	if err != nil {
+		revisionError(w, r, err)
+		return
+	}
+
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		if err := checkRevision(*s, revs...); err != nil {
+			return err
+		}
+		incoming, err := patchState(*s, patch, apply)
+		if err != nil {
+			return err
+		}
+		return applySyncedState(s, incoming)
+	})
+	var invalid ValidationErrors
+	switch {
+	case err == nil:
+	case errors.Is(err, errStaleRevision):
+		revisionError(w, r, err)
+		return
+	case errors.As(err, &invalid):
+		writeErrorFor(w, http.StatusBadRequest, invalid)
+		return
+	case errors.Is(err, errInvalidPatch):
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	case errors.Is(err, errPatchTestFailed), errors.Is(err, errBillLocked):
+		writeErrorFor(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, errTooManyItems):
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+		return
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	setStateValidators(w, state)
+	writeJSON(w, http.StatusOK, visibleState(state))
+}
+
+// patchState 對 cur 的前端版本套用修補，快照與操作紀錄不開放修改，沿用原值
+func patchState(cur GlobalState, patch []byte, apply func(doc any, patch []byte) (any, error)) (GlobalState, error) {
+	raw, err := json.Marshal(visibleState(cur))
+	if err != nil {
+		return GlobalState{}, err
+	}
+	var doc any
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return GlobalState{}, err
+	}
+	doc, err = apply(doc, patch)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	if raw, err = json.Marshal(doc); err != nil {
+		return GlobalState{}, err
+	}
+	var incoming GlobalState
+	if err := decodeJSON(raw, &incoming); err != nil {
+		return GlobalState{}, fmt.Errorf("%w: 修補後的狀態格式錯誤: %v", errInvalidPatch, err)
+	}
+	incoming.Snapshots, incoming.Activity = cur.Snapshots, cur.Activity
+	return incoming, nil
+}
+
+// applyMergePatch RFC 7386：物件逐欄合併，null 代表刪除，其餘（包含陣列）整個取代
+func applyMergePatch(doc any, patch []byte) (any, error) {
+	var p any
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	return mergePatch(doc, p), nil
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
+
+// applyJSONPatch RFC 6902：依序執行 add、remove、replace、move、copy、test，任何一步失敗整份不套用
+func applyJSONPatch(doc any, patch []byte) (any, error) {
+	var ops []PatchOp
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+	}
+	for i, op := range ops {
+		var err error
+		if doc, err = applyPatchOp(doc, op); err != nil {
+			return nil, fmt.Errorf("第 %d 個操作 %s %s: %w", i+1, op.Op, op.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyPatchOp(doc any, op PatchOp) (any, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	value := func() (any, error) {
+		var v any
+		if len(op.Value) == 0 {
+			return nil, fmt.Errorf("%w: 缺少 value", errInvalidPatch)
+		}
+		if err := json.Unmarshal(op.Value, &v); err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidPatch, err)
+		}
+		return v, nil
+	}
+
+	switch op.Op {
+	case "add":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "remove":
+		doc, _, err := pointerRemove(doc, path)
+		return doc, err
+	case "replace":
+		v, err := value()
+		if err != nil {
+			return nil, err
+		}
+		if doc, _, err = pointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, v)
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var v any
+		if op.Op == "move" {
+			if op.Path == op.From {
+				return doc, nil
+			}
+			if strings.HasPrefix(op.Path, op.From+"/") {
+				return nil, fmt.Errorf("%w: 不能移到自己底下", errInvalidPatch)
+			}
+			if doc, v, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			if v, err = pointerGet(doc, from); err != nil {
+				return nil, err
+			}
+			if v, err = deepCopyJSON(v); err != nil {
+				return nil, err
+			}
+		}
+		return pointerAdd(doc, path, v)
+	case "test":
+		want, err := value()
+		if err != nil {
+			return nil, err
+		}
+		got, err := pointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(got, want) {
+			return nil, errPatchTestFailed
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: 不支援的操作 %q", errInvalidPatch, op.Op)
+}
+
+// parsePointer 解析 RFC 6901 JSON Pointer，"" 代表整份文件
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%w: 路徑 %q 必須以 / 開頭", errInvalidPatch, p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex 解析陣列索引；allowEnd 時可以是 n（或 "-"）代表加在最後
+func arrayIndex(token string, n int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return n, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > n || (i == n && !allowEnd) || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: 陣列索引 %q 超出範圍", errInvalidPatch, token)
+	}
+	return i, nil
+}
+
+func pointerGet(doc any, path []string) (any, error) {
+	for _, t := range path {
+		switch c := doc.(type) {
+		case map[string]any:
+			v, ok := c[t]
+			if !ok {
+				return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, t)
+			}
+			doc = v
+		case []any:
+			i, err := arrayIndex(t, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, t)
+		}
+	}
+	return doc, nil
+}
+
+// updateAt 找到 path 最後一層的容器交給 leaf 修改，陣列長度改變時沿路把新的容器寫回去
+func updateAt(doc any, path []string, leaf func(container any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return leaf(doc, path[0])
+	}
+	switch c := doc.(type) {
+	case map[string]any:
+		child, ok := c[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, path[0])
+		}
+		nc, err := updateAt(child, path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		c[path[0]] = nc
+		return c, nil
+	case []any:
+		i, err := arrayIndex(path[0], len(c), false)
+		if err != nil {
+			return nil, err
+		}
+		nc, err := updateAt(c[i], path[1:], leaf)
+		if err != nil {
+			return nil, err
+		}
+		c[i] = nc
+		return c, nil
+	}
+	return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, path[0])
+}
+
+func pointerAdd(doc any, path []string, v any) (any, error) {
+	if len(path) == 0 {
+		return v, nil
+	}
+	return updateAt(doc, path, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[key] = v
+			return c, nil
+		case []any:
+			i, err := arrayIndex(key, len(c), true)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = v
+			return c, nil
+		}
+		return nil, fmt.Errorf("%w: 無法在 %q 新增", errInvalidPatch, key)
+	})
+}
+
+func pointerRemove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, nil, fmt.Errorf("%w: 不能移除整份文件", errInvalidPatch)
+	}
+	var removed any
+	doc, err := updateAt(doc, path, func(container any, key string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			v, ok := c[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, key)
+			}
+			removed = v
+			delete(c, key)
+			return c, nil
+		case []any:
+			i, err := arrayIndex(key, len(c), false)
+			if err != nil {
+				return nil, err
+			}
+			removed = c[i]
+			return append(c[:i], c[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: 找不到 %q", errInvalidPatch, key)
+	})
+	return doc, removed, err
+}
+
+func deepCopyJSON(v any) (any, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	err = json.Unmarshal(raw, &out)
+	return out, err
+}
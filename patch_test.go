@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// JSON Patch 測試（RFC 6902 範例）
+// ==========================================
+func TestApplyJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		wantErr                bool
+	}{
+		{"新增欄位", `{"foo":"bar"}`, `[{"op":"add","path":"/baz","value":"qux"}]`, `{"baz":"qux","foo":"bar"}`, false},
+		{"插入陣列", `{"foo":["bar","baz"]}`, `[{"op":"add","path":"/foo/1","value":"qux"}]`, `{"foo":["bar","qux","baz"]}`, false},
+		{"加在陣列最後", `{"foo":[1]}`, `[{"op":"add","path":"/foo/-","value":2}]`, `{"foo":[1,2]}`, false},
+		{"移除陣列元素", `{"foo":["bar","qux","baz"]}`, `[{"op":"remove","path":"/foo/1"}]`, `{"foo":["bar","baz"]}`, false},
+		{"取代", `{"baz":"qux","foo":"bar"}`, `[{"op":"replace","path":"/baz","value":"boo"}]`, `{"baz":"boo","foo":"bar"}`, false},
+		{"搬移", `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`, `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`, `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`, false},
+		{"複製", `{"a":{"b":1}}`, `[{"op":"copy","from":"/a","path":"/c"}]`, `{"a":{"b":1},"c":{"b":1}}`, false},
+		{"跳脫字元", `{"a/b":1,"m~n":2}`, `[{"op":"test","path":"/a~1b","value":1},{"op":"remove","path":"/m~0n"}]`, `{"a/b":1}`, false},
+		{"test 不符", `{"baz":"qux"}`, `[{"op":"test","path":"/baz","value":"bar"}]`, "", true},
+		{"路徑不存在", `{"foo":"bar"}`, `[{"op":"add","path":"/baz/bat","value":"qux"}]`, "", true},
+		{"索引超出範圍", `{"foo":[1]}`, `[{"op":"add","path":"/foo/2","value":2}]`, "", true},
+		{"不支援的操作", `{}`, `[{"op":"frobnicate","path":"/a"}]`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc any
+			json.Unmarshal([]byte(tt.doc), &doc)
+			got, err := applyJSONPatch(doc, []byte(tt.patch))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("應該失敗, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if raw, _ := json.Marshal(got); string(raw) != tt.want {
+				t.Errorf("got %s, want %s", raw, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	var doc any
+	json.Unmarshal([]byte(`{"a":"b","c":{"d":"e","f":"g"},"list":[1,2]}`), &doc)
+	got, err := applyMergePatch(doc, []byte(`{"a":"z","c":{"f":null},"list":[3]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := json.Marshal(got); string(raw) != `{"a":"z","c":{"d":"e"},"list":[3]}` {
+		t.Errorf("got %s", raw)
+	}
+}
+
+// ==========================================
+// PATCH /api/sync 測試
+// ==========================================
+func TestHandleSyncPatch(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Museum", Amount: 30, PaidBy: 2, Participants: []int{1, 2}, Locked: true},
+	}
+	state.Snapshots = []Snapshot{{ID: 1}}
+	withRoomState(t, state)
+
+	do := func(contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, "/api/sync", strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		ifMatchCurrent(req)
+		rec := httptest.NewRecorder()
+		handleSync(rec, req)
+		return rec
+	}
+
+	if rec := do(mergePatchType, `{"baseCurrency":"JPY"}`); rec.Code != http.StatusOK {
+		t.Fatalf("merge patch 失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	rec := do(jsonPatchType, `[
+		{"op":"test","path":"/bills/0/id","value":1},
+		{"op":"replace","path":"/bills/0/amount","value":320},
+		{"op":"add","path":"/people/-","value":{"id":3,"name":"Carol"}}
+	]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("json patch 失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp GlobalState
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if resp.BaseCurrency != "JPY" || resp.Bills[0].Amount != 320 || len(resp.People) != 3 {
+		t.Errorf("resp = %+v", resp)
+	}
+
+	// 驗證、test、鎖定與格式錯誤
+	if rec := do(jsonPatchType, `[{"op":"replace","path":"/bills/0/paidBy","value":9}]`); rec.Code != http.StatusBadRequest {
+		t.Errorf("付款人不存在應回傳 400, got %d", rec.Code)
+	}
+	if rec := do(jsonPatchType, `[{"op":"test","path":"/bills/0/amount","value":300}]`); rec.Code != http.StatusConflict {
+		t.Errorf("test 不符應回傳 409, got %d", rec.Code)
+	}
+	if rec := do(jsonPatchType, `[{"op":"remove","path":"/bills/1"}]`); rec.Code != http.StatusConflict {
+		t.Errorf("已鎖定的帳單不能刪除, got %d", rec.Code)
+	}
+	if rec := do(mergePatchType, `{"bills":"oops"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("修補後格式錯誤應回傳 400, got %d", rec.Code)
+	}
+	if rec := do("text/plain", `{}`); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("不支援的格式應回傳 415, got %d", rec.Code)
+	}
+
+	// 快照不受修補影響；刪掉的帳單進垃圾桶
+	if rec := do(mergePatchType, `{"bills":[{"id":2,"title":"Museum","amount":30,"paidBy":2,"participants":[1,2],"locked":true}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("merge patch 失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	state, _ = currentState()
+	if len(state.Snapshots) != 1 || len(trashOf(state).Bills) != 1 {
+		t.Errorf("snapshots = %d, trash = %+v", len(state.Snapshots), trashOf(state).Bills)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 記錄已付款的轉帳 =================
+
+var (
+	errSettlementNotFound = errors.New("settlement not found")
+	errSettlementChanged  = errors.New("settlement changed")
+	errInvalidPayment     = errors.New("invalid payment")
+)
+
+// PaymentRequest 記錄一筆建議轉帳已經付了多少。
+// Amount 為 0 代表全額；From、To 有填時會確認第 n 筆仍是同一對人，避免建議在這段期間改變而記錯
+type PaymentRequest struct {
+	Amount float64 `json:"amount,omitempty"`
+	From   string  `json:"from,omitempty"`
+	To     string  `json:"to,omitempty"`
+	Date   string  `json:"date,omitempty"`
+}
+
+// PaymentResponse 新增的還款紀錄與扣除後剩下的建議轉帳
+type PaymentResponse struct {
+	Bill        Bill         `json:"bill"`
+	Settlements []Settlement `json:"settlements"`
+}
+
+// paymentBill 依房間的累計淨額 ledger，把第 n 筆建議轉帳（GET /api/balances 的 settlements，從 0 開始）的付款記成還款帳單，
+// 之後的計算會把它算進去，剩下的欠款隨之減少
+func paymentBill(ctx context.Context, ledger *balanceLedger, s *GlobalState, n int, req PaymentRequest, today time.Time) (Bill, error) {
+	transfers, nameMap, base, err := ledger.pending(ctx, visibleState(*s))
+	if err != nil {
+		return Bill{}, fmt.Errorf("%w: %v", errInvalidPayment, err)
+	}
+	if n < 0 || n >= len(transfers) {
+		return Bill{}, errSettlementNotFound
+	}
+	t := transfers[n]
+	if (req.From != "" && req.From != nameMap[t.from]) || (req.To != "" && req.To != nameMap[t.to]) {
+		return Bill{}, fmt.Errorf("%w: 第 %d 筆目前是 %s 付給 %s", errSettlementChanged, n, nameMap[t.from], nameMap[t.to])
+	}
+	if t.from < 0 || t.to < 0 {
+		return Bill{}, fmt.Errorf("%w: 臨時參加者的款項請直接修改帳單", errInvalidPayment)
+	}
+
+	amount := t.amount
+	if req.Amount != 0 {
+		amount = toMoney(req.Amount, base)
+		if amount <= 0 {
+			return Bill{}, fmt.Errorf("%w: 金額必須大於 0", errInvalidPayment)
+		}
+		if amount > t.amount {
+			return Bill{}, fmt.Errorf("%w: 金額超過應付的 %v", errInvalidPayment, t.amount.Float(base))
+		}
+	}
+	date := req.Date
+	if date == "" {
+		date = today.Format(billDateLayout)
+	} else if _, err := time.Parse(billDateLayout, date); err != nil {
+		return Bill{}, fmt.Errorf("%w: 日期格式錯誤 %q，請使用 YYYY-MM-DD", errInvalidPayment, date)
+	}
+
+	return Bill{
+		ID:           maxBillID(s.Bills) + 1,
+		Type:         billTypeTransfer,
+		Title:        fmt.Sprintf("%s 還給 %s", nameMap[t.from], nameMap[t.to]),
+		Date:         date,
+		Amount:       amount.Float(base),
+		Currency:     base,
+		PaidBy:       t.from,
+		Participants: []int{t.to},
+	}, nil
+}
+
+// handleSettlementPay POST /api/settlements/{n}/pay 記錄第 n 筆建議轉帳已全額或部分付款
+func handleSettlementPay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	n, err := strconv.Atoi(r.PathValue("n"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid settlement index")
+		return
+	}
+
+	var req PaymentRequest
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeJSON(body, &req); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+	}
+
+	var bill Bill
+	rm := roomOf(r)
+	state, err := rm.updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		b, err := paymentBill(r.Context(), rm.ledger, s, n, req, clock.Now())
+		if err != nil {
+			return err
+		}
+		bill = b
+		s.Bills = append(s.Bills, bill)
+		return nil
+	})
+	switch {
+	case err == nil:
+	case errors.Is(err, errSettlementNotFound):
+		writeError(w, http.StatusNotFound, "settlement not found")
+		return
+	case errors.Is(err, errSettlementChanged):
+		writeErrorFor(w, http.StatusConflict, err)
+		return
+	case errors.Is(err, errInvalidPayment):
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+
+	resp := PaymentResponse{Bill: bill, Settlements: []Settlement{}}
+	if balances, err := rm.ledger.balances(r.Context(), visibleState(state)); err == nil {
+		resp.Settlements = balances.Settlements
+	}
+	writeJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 記錄已付款的轉帳測試
+// ==========================================
+func TestSettlementPayAPI(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	state.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 900, PaidBy: 1, Participants: []int{1, 2, 3}}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/settlements/{n}/pay", handleSettlementPay)
+	pay := func(path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+		return rec
+	}
+
+	// 建議：Bob、Charlie 各付 Alice 300。Bob 先付 100
+	rec := pay("/api/settlements/0/pay", `{"amount":100,"from":"Bob","to":"Alice"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("記錄付款失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var resp PaymentResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	if b := resp.Bill; b.ID != 2 || b.Type != billTypeTransfer || b.PaidBy != 2 || b.Participants[0] != 1 || b.Amount != 100 {
+		t.Errorf("應新增 Bob 還 Alice 100 的紀錄: %+v", b)
+	}
+	want := []Settlement{{From: "Bob", To: "Alice", Amount: 200}, {From: "Charlie", To: "Alice", Amount: 300}}
+	if !sameJSON(resp.Settlements, want) {
+		t.Errorf("剩下的欠款 got %+v, want %+v", resp.Settlements, want)
+	}
+
+	// 同一對人已經不是第 1 筆時拒絕
+	if rec := pay("/api/settlements/1/pay", `{"from":"Bob"}`); rec.Code != http.StatusConflict {
+		t.Errorf("建議已改變應回傳 409, got %d", rec.Code)
+	}
+	if rec := pay("/api/settlements/1/pay", `{"amount":301}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("超過應付金額應回傳 400, got %d", rec.Code)
+	}
+	if rec := pay("/api/settlements/5/pay", ``); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的建議應回傳 404, got %d", rec.Code)
+	}
+
+	// 不指定金額就是全額付清，之後的計算只剩 Bob 的 200
+	if rec := pay("/api/settlements/1/pay", ``); rec.Code != http.StatusCreated {
+		t.Fatalf("全額付款失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	state, _ = currentState()
+	data, _ := json.Marshal(CalculateRequest{People: state.People, Bills: state.Bills})
+	var calc CalculateResponse
+	json.Unmarshal([]byte(processCalculate(string(data))), &calc)
+	if !sameJSON(calc.Settlements, []Settlement{{From: "Bob", To: "Alice", Amount: 200}}) {
+		t.Errorf("計算應扣除已付款的部分, got %+v", calc.Settlements)
+	}
+}
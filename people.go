@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// ================= 人員 API =================
+
+var (
+	errPersonNotFound = errors.New("person not found")
+	errPersonInUse    = errors.New("person is used by bills or groups")
+)
+
+// handlePeople GET 列出、POST 新增 /api/people（ID 由伺服器指定，不會重複使用垃圾桶裡的 ID）
+func handlePeople(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, visibleState(state).People)
+
+	case http.MethodPost:
+		var p Person
+		if !decodeResource(w, r, &p) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			if errs := validatePerson(p); len(errs) > 0 {
+				return errs
+			}
+			if err := checkLimits(len(visibleState(*s).People)+1, 0); err != nil {
+				return err
+			}
+			p.ID = maxPersonID(s.People) + 1
+			p.DeletedAt = 0
+			s.People = append(s.People, p)
+			return nil
+		})
+		if !personUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, p)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handlePerson PUT 修改、DELETE 刪除（移到垃圾桶）/api/people/{id}
+func handlePerson(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid person id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var p Person
+		if !decodeResource(w, r, &p) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := livePersonIndex(*s, id)
+			if i < 0 {
+				return errPersonNotFound
+			}
+			if errs := validatePerson(p); len(errs) > 0 {
+				return errs
+			}
+			p.ID, p.DeletedAt = id, 0
+			s.People[i] = p
+			return nil
+		})
+		if !personUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, p)
+
+	case http.MethodDelete:
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			i := livePersonIndex(*s, id)
+			if i < 0 {
+				return errPersonNotFound
+			}
+			if err := checkPersonUnused(*s, id); err != nil {
+				return err
+			}
+			s.People[i].DeletedAt = clock.Now().UnixMilli()
+			return nil
+		})
+		if !personUpdateOK(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func livePersonIndex(s GlobalState, id int) int {
+	for i, p := range s.People {
+		if p.ID == id && p.DeletedAt == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// validatePerson 檢查單一人員，欄位路徑不帶 people[i] 前綴
+func validatePerson(p Person) ValidationErrors {
+	return fieldsUnder(validatePeopleAndBills([]Person{p}, nil), "people[0].")
+}
+
+// checkPersonUnused 還有帳單或群組用到這個人時不能刪除，否則那些帳單會變成無效
+func checkPersonUnused(s GlobalState, id int) error {
+	for _, b := range visibleState(s).Bills {
+		used := b.PaidBy == id && len(b.Payers) == 0 ||
+			slices.Contains(b.Participants, id) ||
+			slices.ContainsFunc(b.Payers, func(p Payer) bool { return p.PersonID == id }) ||
+			slices.ContainsFunc(b.LineItems, func(item BillItem) bool { return slices.Contains(item.Participants, id) })
+		if used {
+			return fmt.Errorf("%w: 帳單「%s」仍用到這位成員", errPersonInUse, b.Title)
+		}
+	}
+	for _, g := range s.Groups {
+		if slices.Contains(g.Members, id) {
+			return fmt.Errorf("%w: 群組「%s」仍包含這位成員", errPersonInUse, g.Name)
+		}
+	}
+	return nil
+}
+
+// personUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func personUpdateOK(w http.ResponseWriter, err error) bool {
+	var invalid ValidationErrors
+	switch {
+	case err == nil:
+		return true
+	case errors.As(err, &invalid):
+		writeErrorFor(w, http.StatusBadRequest, invalid)
+	case errors.Is(err, errPersonNotFound):
+		writeError(w, http.StatusNotFound, "person not found")
+	case errors.Is(err, errTooManyItems):
+		writeErrorFor(w, http.StatusUnprocessableEntity, err)
+	case errors.Is(err, errPersonInUse):
+		writeErrorFor(w, http.StatusConflict, err)
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
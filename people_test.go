@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 人員 API 測試
+// ==========================================
+func TestPersonCRUD(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Carol", DeletedAt: 1}}
+	state.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1}}}
+	state.Groups = []Group{{ID: 1, Name: "Family", Members: []int{2}}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/people", handlePeople)
+	mux.HandleFunc("/api/people/{id}", handlePerson)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/people", `{"id":1,"name":"Dave","preferredCurrency":"jpy"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("新增失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var created Person
+	json.Unmarshal(rec.Body.Bytes(), &created)
+	if created.ID != 4 {
+		t.Errorf("ID 應跳過垃圾桶裡的 3, got %d", created.ID)
+	}
+
+	rec = do(http.MethodPost, "/api/people", `{"name":"  ","weight":-1}`)
+	var invalid validationErrorBody
+	json.Unmarshal(rec.Body.Bytes(), &invalid)
+	if rec.Code != http.StatusBadRequest || len(invalid.Details) != 2 || invalid.Details[0].Field != "name" {
+		t.Errorf("名字空白與負的比例應回傳 400, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodPut, "/api/people/4", `{"name":"David"}`); rec.Code != http.StatusOK {
+		t.Errorf("修改失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPut, "/api/people/3", `{"name":"Carol"}`); rec.Code != http.StatusNotFound {
+		t.Errorf("垃圾桶裡的人員應回傳 404, got %d", rec.Code)
+	}
+
+	// 仍被帳單或群組用到的人不能刪除
+	if rec := do(http.MethodDelete, "/api/people/1", ""); rec.Code != http.StatusConflict {
+		t.Errorf("付款人不能刪除, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/people/2", ""); rec.Code != http.StatusConflict {
+		t.Errorf("群組成員不能刪除, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/people/4", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("刪除失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodGet, "/api/people", "")
+	var people []Person
+	json.Unmarshal(rec.Body.Bytes(), &people)
+	if len(people) != 2 || people[0].Name != "Alice" || people[1].Name != "Bob" {
+		t.Errorf("people = %+v", people)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// ================= PostgreSQL 儲存（多實例共用） =================
+
+const pgSchema = `CREATE TABLE IF NOT EXISTS splitter_state (
+	id         TEXT PRIMARY KEY,
+	data       JSONB NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+
+// PGPoolConfig 連線池設定，零值代表使用 database/sql 預設
+type PGPoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// PGStore 將整份 GlobalState 存成一列 JSONB，寫入時以 SELECT ... FOR UPDATE 鎖定該列
+type PGStore struct {
+	db *sql.DB
+	id string
+}
+
+func NewPGStore(dsn string, pool PGPoolConfig) (*PGStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if pool.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(pool.MaxOpenConns)
+	}
+	if pool.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(pool.MaxIdleConns)
+	}
+	if pool.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(pool.ConnMaxLifetime)
+	}
+
+	if _, err := db.Exec(pgSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &PGStore{db: db, id: "default"}, nil
+}
+
+// pgRoomPrefix 房間狀態列的 id 前綴，預設房間的 id 為 default
+const pgRoomPrefix = "room:"
+
+// rooms 與 ps 共用連線池的房間儲存，每個房間一列；其他實例建立的房間也查得到
+func (ps *PGStore) rooms() roomStores {
+	return roomStores{
+		open: func(code string) Store { return &PGStore{db: ps.db, id: pgRoomPrefix + code} },
+		list: func() ([]string, error) {
+			rows, err := ps.db.Query(`SELECT id FROM splitter_state WHERE id LIKE $1 ORDER BY id`, pgRoomPrefix+"%")
+			if err != nil {
+				return nil, err
+			}
+			defer rows.Close()
+			var codes []string
+			for rows.Next() {
+				var id string
+				if err := rows.Scan(&id); err != nil {
+					return nil, err
+				}
+				codes = append(codes, strings.TrimPrefix(id, pgRoomPrefix))
+			}
+			return codes, rows.Err()
+		},
+		exists: func(code string) (bool, error) {
+			var found bool
+			err := ps.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM splitter_state WHERE id = $1)`, pgRoomPrefix+code).Scan(&found)
+			return found, err
+		},
+	}
+}
+
+func (ps *PGStore) Load() (GlobalState, error) {
+	var data []byte
+	err := ps.db.QueryRow(`SELECT data FROM splitter_state WHERE id = $1`, ps.id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return newGlobalState(), nil
+	}
+	if err != nil {
+		return GlobalState{}, err
+	}
+	return decodeState(data)
+}
+
+func (ps *PGStore) Save(state GlobalState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	_, err = ps.db.Exec(`INSERT INTO splitter_state (id, data, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (id) DO UPDATE SET data = EXCLUDED.data, updated_at = now()`, ps.id, data)
+	return err
+}
+
+// Update 鎖定狀態列後執行 fn 並寫回，其他實例的寫入會在鎖釋放前等待
+func (ps *PGStore) Update(fn func(state *GlobalState) error) (GlobalState, error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return GlobalState{}, err
+	}
+	defer tx.Rollback()
+
+	// 確保狀態列存在，FOR UPDATE 才有東西可以鎖
+	initial, err := json.Marshal(newGlobalState())
+	if err != nil {
+		return GlobalState{}, err
+	}
+	if _, err := tx.Exec(`INSERT INTO splitter_state (id, data) VALUES ($1, $2) ON CONFLICT (id) DO NOTHING`, ps.id, initial); err != nil {
+		return GlobalState{}, err
+	}
+
+	var data []byte
+	if err := tx.QueryRow(`SELECT data FROM splitter_state WHERE id = $1 FOR UPDATE`, ps.id).Scan(&data); err != nil {
+		return GlobalState{}, err
+	}
+	state, err := decodeState(data)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	if err := fn(&state); err != nil {
+		return GlobalState{}, err
+	}
+
+	data, err = json.Marshal(state)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	if _, err := tx.Exec(`UPDATE splitter_state SET data = $2, updated_at = now() WHERE id = $1`, ps.id, data); err != nil {
+		return GlobalState{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return GlobalState{}, err
+	}
+	return state, nil
+}
+
+func (ps *PGStore) Close() error {
+	return ps.db.Close()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTxStore 模擬多個實例共用的交易儲存：Update 在鎖內讀取、修改並寫回
+type fakeTxStore struct {
+	mu      sync.Mutex
+	state   GlobalState
+	updates int
+	saves   int
+}
+
+func (f *fakeTxStore) Load() (GlobalState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return cloneState(f.state), nil
+}
+
+func (f *fakeTxStore) Save(state GlobalState) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.saves++
+	f.state = cloneState(state)
+	return nil
+}
+
+func (f *fakeTxStore) Update(fn func(state *GlobalState) error) (GlobalState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	next := cloneState(f.state)
+	if err := fn(&next); err != nil {
+		return GlobalState{}, err
+	}
+	f.updates++
+	f.state = next
+	return cloneState(next), nil
+}
+
+// ==========================================
+// 共用儲存（TxStore）測試
+// ==========================================
+func TestUpdateState_TxStore(t *testing.T) {
+	fc := &fakeClock{t: time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)}
+	useClock(t, fc)
+	shared := &fakeTxStore{state: newGlobalState()}
+	a, b := newRoom("", GlobalState{}), newRoom("", GlobalState{})
+	for _, rm := range []*room{a, b} {
+		if err := rm.loadStore(shared); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 其他實例的修改：currentState 每次都重新讀取
+	if _, err := b.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Alice"}}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if state, err := a.currentState(); err != nil || len(state.People) != 1 {
+		t.Fatalf("應看到其他實例的修改, got %+v, %v", state.People, err)
+	}
+
+	// 修改在儲存的交易內完成，不再另外呼叫 Save
+	state, err := a.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.Bills = append(s.Bills, Bill{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1}})
+		return nil
+	})
+	if err != nil || state.Revision != 2 || state.LastUpdated != fc.Now().UnixMilli() {
+		t.Fatalf("修改後 = revision %d, lastUpdated %d, %v", state.Revision, state.LastUpdated, err)
+	}
+	if shared.updates != 2 || shared.saves != 0 || len(shared.state.Bills) != 1 {
+		t.Errorf("應透過 Update 寫入, updates=%d saves=%d bills=%d", shared.updates, shared.saves, len(shared.state.Bills))
+	}
+
+	// fn 失敗時交易不寫回
+	boom := errors.New("boom")
+	if _, err := a.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = nil
+		return boom
+	}); !errors.Is(err, boom) {
+		t.Errorf("應回傳 fn 的錯誤, got %v", err)
+	}
+	if shared.state.Revision != 2 || len(shared.state.People) != 1 {
+		t.Errorf("失敗的修改不應寫回, got revision %d %+v", shared.state.Revision, shared.state.People)
+	}
+
+	// 兩個實例同時寫入：以儲存的鎖排隊，不會互相覆蓋
+	var wg sync.WaitGroup
+	for i := range 20 {
+		rm := []*room{a, b}[i%2]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rm.updateStateAs(Actor{}, func(s *GlobalState) error {
+				s.People = append(s.People, Person{ID: len(s.People) + 1, Name: fmt.Sprintf("P%d", i)})
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+	if state, _ := a.currentState(); len(state.People) != 21 || state.Revision != 22 {
+		t.Errorf("同時寫入後應有 21 人、revision 22, got %d 人、revision %d", len(state.People), state.Revision)
+	}
+}
+
+// 需要實際的 PostgreSQL：設定 SPLITTER_TEST_PG 為連線字串才會執行
+func TestPGStore_Integration(t *testing.T) {
+	dsn := os.Getenv("SPLITTER_TEST_PG")
+	if dsn == "" {
+		t.Skip("未設定 SPLITTER_TEST_PG")
+	}
+	pg, err := NewPGStore(dsn, PGPoolConfig{})
+	if err != nil {
+		t.Fatalf("連線失敗: %v", err)
+	}
+	t.Cleanup(func() { pg.Close() })
+
+	// 用不會與實際資料衝突的 id
+	code := fmt.Sprintf("T%d", time.Now().UnixNano())
+	ps := &PGStore{db: pg.db, id: "test:" + code}
+	t.Cleanup(func() {
+		pg.db.Exec(`DELETE FROM splitter_state WHERE id IN ($1, $2)`, ps.id, pgRoomPrefix+code)
+	})
+
+	if state, err := ps.Load(); err != nil || state.Revision != 0 {
+		t.Fatalf("不存在的列應回傳新狀態, got %+v, %v", state.Revision, err)
+	}
+	state := newGlobalState()
+	state.BaseCurrency = "EUR"
+	if err := ps.Save(state); err != nil {
+		t.Fatalf("寫入失敗: %v", err)
+	}
+
+	// 兩個連線同時 Update：FOR UPDATE 鎖住該列，每次都加到最新的值上
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := ps.Update(func(s *GlobalState) error {
+				s.Revision++
+				return nil
+			}); err != nil {
+				t.Errorf("Update 失敗: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, err := ps.Load(); err != nil || got.Revision != 10 || got.BaseCurrency != "EUR" {
+		t.Errorf("同時 Update 後 = revision %d %s, %v", got.Revision, got.BaseCurrency, err)
+	}
+
+	// 房間各自一列，其他實例也查得到
+	rooms := pg.rooms()
+	if found, err := rooms.exists(code); err != nil || found {
+		t.Fatalf("尚未建立的房間不應存在, got %v, %v", found, err)
+	}
+	if err := rooms.open(code).Save(newGlobalState()); err != nil {
+		t.Fatal(err)
+	}
+	if found, err := rooms.exists(code); err != nil || !found {
+		t.Errorf("建立後應存在, got %v, %v", found, err)
+	}
+	codes, err := rooms.list()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed bool
+	for _, c := range codes {
+		listed = listed || c == code
+	}
+	if !listed {
+		t.Errorf("房間清單應包含 %s, got %v", code, codes)
+	}
+}
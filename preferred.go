@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+)
+
+// ================= 偏好幣別 =================
+
+// preferredQuoteBills 每個與本位幣不同的偏好幣別各一張 1 單位的報價帳單（不加手續費），
+// 跟真正的帳單一起換算，取得該幣別對本位幣的匯率
+func preferredQuoteBills(people []Person, base string) []Bill {
+	var quotes []Bill
+	seen := map[string]bool{strings.ToUpper(base): true}
+	for _, p := range people {
+		cur := strings.ToUpper(strings.TrimSpace(p.PreferredCurrency))
+		if cur == "" || seen[cur] {
+			continue
+		}
+		seen[cur] = true
+		noFee := 0.0
+		quotes = append(quotes, Bill{Title: "匯率報價", Amount: 1, Currency: cur, FXFeePercent: &noFee})
+	}
+	return quotes
+}
+
+// withPreferredCurrencies 把結算金額換算成付款人偏好的幣別；quoteRates 為 quotes 換算時用的匯率
+func withPreferredCurrencies(settlements []Settlement, people []Person, quotes []Bill, quoteRates []billRate) []Settlement {
+	if len(quotes) == 0 {
+		return settlements
+	}
+	rateOf := make(map[string]float64, len(quotes))
+	for i, q := range quotes {
+		rateOf[q.Currency] = quoteRates[i].Rate
+	}
+	preferred := make(map[string]string, len(people))
+	for _, p := range people {
+		if _, ok := preferred[p.Name]; !ok {
+			preferred[p.Name] = strings.ToUpper(strings.TrimSpace(p.PreferredCurrency))
+		}
+	}
+	for i, s := range settlements {
+		cur := preferred[s.From]
+		rate := rateOf[cur]
+		if rate <= 0 {
+			continue
+		}
+		settlements[i].PreferredCurrency = cur
+		settlements[i].PreferredAmount = roundMoney(s.Amount/rate, cur)
+	}
+	return settlements
+}
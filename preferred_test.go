@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 偏好幣別測試
+// ==========================================
+func TestRunCalculate_PreferredCurrency(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03, "jpy": 5}})
+
+	people := []Person{
+		{ID: 1, Name: "Alice"},
+		{ID: 2, Name: "Bob", PreferredCurrency: "usd"},
+		{ID: 3, Name: "Carol", PreferredCurrency: "JPY"},
+		{ID: 4, Name: "Dave", PreferredCurrency: "TWD"},
+	}
+	bills := []Bill{{ID: 1, Title: "Dinner", Amount: 1200, PaidBy: 1, Participants: []int{1, 2, 3, 4}}}
+	// 手續費不套用在偏好幣別的換算上
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, FXFeePercent: 1.5})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	got := map[string]Settlement{}
+	for _, s := range resp.Settlements {
+		got[s.From] = s
+	}
+	if s := got["Bob"]; s.Amount != 300 || s.PreferredCurrency != "USD" || s.PreferredAmount != 9 {
+		t.Errorf("Bob = %+v, want 300 TWD = 9 USD", s)
+	}
+	if s := got["Carol"]; s.PreferredCurrency != "JPY" || s.PreferredAmount != 1500 {
+		t.Errorf("Carol = %+v, want 1500 JPY", s)
+	}
+	if s := got["Dave"]; s.PreferredCurrency != "" || s.PreferredAmount != 0 {
+		t.Errorf("偏好幣別與本位幣相同時不另外列出, got %+v", s)
+	}
+	// 報價帳單不出現在回應中；本位幣帳單不需要匯率，rateDate 來自偏好幣別用的匯率
+	if len(resp.Bills) != 1 || len(resp.Rates) != 0 || resp.RateDate != "2026-05-01" {
+		t.Errorf("bills = %+v, rates = %+v, rateDate = %q", resp.Bills, resp.Rates, resp.RateDate)
+	}
+
+	// 自訂匯率表同樣適用於偏好幣別
+	table := &RateTable{Base: "TWD", Rates: map[string]float64{"USD": 30}}
+	resp = runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people[:2], Bills: []Bill{{ID: 1, Title: "Taxi", Amount: 600, PaidBy: 1, Participants: []int{1, 2}}}, RateTable: table})
+	if len(resp.Settlements) != 1 || resp.Settlements[0].PreferredAmount != 10 {
+		t.Errorf("settlements = %+v, want 300 TWD = 10 USD", resp.Settlements)
+	}
+}
+
+func TestValidatePeople_PreferredCurrency(t *testing.T) {
+	errs := validatePeopleAndBills([]Person{{ID: 1, Name: "Alice", PreferredCurrency: "dollars"}}, nil)
+	if len(errs) != 1 || errs[0].Field != "people[0].preferredCurrency" {
+		t.Errorf("errs = %+v", errs)
+	}
+}
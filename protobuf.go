@@ -0,0 +1,462 @@
+package main
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ================= Protocol Buffers 編碼（gRPC 用，只實作這個服務需要的部分） =================
+
+// 訊息直接由 Go 結構對應：有 json 標籤的匯出欄位依宣告順序編號（從 1 開始），欄位名稱沿用 JSON 名稱，
+// 所以 proto3 的 JSON 對應與 REST API 的格式相同。int 為 int64、float64 為 double，
+// 指向純量的指標為 optional，any 型別的欄位（例如錯誤的 details）保留編號但不傳送。
+// 因為編號來自宣告順序，結構只能在最後面加欄位；splitter.proto 由 protoFile 產生，測試確保兩者一致
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var (
+	errProtoTruncated = errors.New("protobuf: truncated message")
+	errProtoWireType  = errors.New("protobuf: wrong wire type")
+)
+
+// protoField 結構欄位與 protobuf 欄位編號的對應
+type protoField struct {
+	Num   int
+	Name  string
+	Index int
+	Type  reflect.Type
+}
+
+// protoMessage 結構對應的欄位；Reserved 為不傳送的 any 欄位佔用的編號
+type protoMessage struct {
+	Fields   []protoField
+	Reserved []int
+}
+
+var protoMessages sync.Map // reflect.Type → protoMessage
+
+func protoMessageOf(t reflect.Type) protoMessage {
+	if m, ok := protoMessages.Load(t); ok {
+		return m.(protoMessage)
+	}
+	var m protoMessage
+	num := 0
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		num++
+		if f.Type.Kind() == reflect.Interface {
+			m.Reserved = append(m.Reserved, num)
+			continue
+		}
+		m.Fields = append(m.Fields, protoField{Num: num, Name: name, Index: i, Type: f.Type})
+	}
+	protoMessages.Store(t, m)
+	return m
+}
+
+// marshalProto 把結構（或指向結構的指標）編碼成 protobuf
+func marshalProto(v any) ([]byte, error) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("protobuf: cannot marshal %T", v)
+	}
+	return appendMessage(nil, rv)
+}
+
+func appendMessage(b []byte, v reflect.Value) ([]byte, error) {
+	var err error
+	for _, f := range protoMessageOf(v.Type()).Fields {
+		if b, err = appendField(b, f.Num, v.Field(f.Index)); err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	return b, nil
+}
+
+// appendField 依 proto3 的規則編碼一個欄位：純量的零值、空的陣列與 map 不送；optional 有值就送
+func appendField(b []byte, num int, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return b, nil
+		}
+		if v.Elem().Kind() == reflect.Struct {
+			return appendSubmessage(b, num, v.Elem())
+		}
+		return appendScalar(b, num, v.Elem())
+	case reflect.Struct:
+		if v.IsZero() {
+			return b, nil
+		}
+		return appendSubmessage(b, num, v)
+	case reflect.Slice:
+		return appendRepeated(b, num, v)
+	case reflect.Map:
+		return appendMap(b, num, v)
+	}
+	if v.IsZero() {
+		return b, nil
+	}
+	return appendScalar(b, num, v)
+}
+
+func appendTag(b []byte, num, wireType int) []byte {
+	return binary.AppendUvarint(b, uint64(num)<<3|uint64(wireType))
+}
+
+func wireTypeOf(k reflect.Kind) (int, bool) {
+	switch k {
+	case reflect.Int, reflect.Int64, reflect.Bool:
+		return wireVarint, true
+	case reflect.Float64:
+		return wireFixed64, true
+	case reflect.String, reflect.Struct:
+		return wireBytes, true
+	}
+	return 0, false
+}
+
+// appendValue 只編碼純量的值（不含欄位標籤），packed 陣列也用這個
+func appendValue(b []byte, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		return binary.AppendUvarint(b, uint64(v.Int())), nil
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1), nil
+		}
+		return append(b, 0), nil
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(b, math.Float64bits(v.Float())), nil
+	case reflect.String:
+		b = binary.AppendUvarint(b, uint64(v.Len()))
+		return append(b, v.String()...), nil
+	}
+	return nil, fmt.Errorf("protobuf: unsupported type %s", v.Type())
+}
+
+func appendScalar(b []byte, num int, v reflect.Value) ([]byte, error) {
+	wt, ok := wireTypeOf(v.Kind())
+	if !ok || v.Kind() == reflect.Struct {
+		return nil, fmt.Errorf("protobuf: unsupported type %s", v.Type())
+	}
+	return appendValue(appendTag(b, num, wt), v)
+}
+
+func appendSubmessage(b []byte, num int, v reflect.Value) ([]byte, error) {
+	msg, err := appendMessage(nil, v)
+	if err != nil {
+		return nil, err
+	}
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(msg)))
+	return append(b, msg...), nil
+}
+
+// appendRepeated 訊息與字串陣列每個元素各自一個欄位；數值陣列用 packed 編碼
+func appendRepeated(b []byte, num int, v reflect.Value) ([]byte, error) {
+	if v.Len() == 0 {
+		return b, nil
+	}
+	var err error
+	switch v.Type().Elem().Kind() {
+	case reflect.Struct:
+		for i := range v.Len() {
+			if b, err = appendSubmessage(b, num, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.String:
+		for i := range v.Len() {
+			if b, err = appendScalar(b, num, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	}
+	var packed []byte
+	for i := range v.Len() {
+		if packed, err = appendValue(packed, v.Index(i)); err != nil {
+			return nil, err
+		}
+	}
+	b = appendTag(b, num, wireBytes)
+	b = binary.AppendUvarint(b, uint64(len(packed)))
+	return append(b, packed...), nil
+}
+
+// appendMap map 編碼成 key = 1、value = 2 的訊息陣列，依 key 排序讓輸出固定
+func appendMap(b []byte, num int, v reflect.Value) ([]byte, error) {
+	keys := v.MapKeys()
+	slices.SortFunc(keys, func(a, b reflect.Value) int {
+		if a.Kind() == reflect.String {
+			return cmp.Compare(a.String(), b.String())
+		}
+		return cmp.Compare(a.Int(), b.Int())
+	})
+	for _, k := range keys {
+		entry, err := appendField(nil, 1, k)
+		if err != nil {
+			return nil, err
+		}
+		if entry, err = appendField(entry, 2, v.MapIndex(k)); err != nil {
+			return nil, err
+		}
+		b = appendTag(b, num, wireBytes)
+		b = binary.AppendUvarint(b, uint64(len(entry)))
+		b = append(b, entry...)
+	}
+	return b, nil
+}
+
+// unmarshalProto 把 protobuf 解碼到 v（指向結構的指標）；不認得的欄位略過，方便新版的客戶端
+func unmarshalProto(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("protobuf: cannot unmarshal into %T", v)
+	}
+	return decodeMessage(data, rv.Elem())
+}
+
+// eachField 依序取出每個欄位的編號、wire type 與內容（長度前綴的欄位不含長度）
+func eachField(data []byte, fn func(num, wireType int, raw []byte) error) error {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		data = data[n:]
+		wt := int(key & 7)
+		var raw []byte
+		switch wt {
+		case wireVarint:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return errProtoTruncated
+			}
+			raw, data = data[:n], data[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wt == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return errProtoTruncated
+			}
+			raw, data = data[:size], data[size:]
+		case wireBytes:
+			size, n := binary.Uvarint(data)
+			if n <= 0 || size > uint64(len(data)-n) {
+				return errProtoTruncated
+			}
+			raw, data = data[n:n+int(size)], data[n+int(size):]
+		default:
+			return fmt.Errorf("protobuf: unsupported wire type %d", wt)
+		}
+		if err := fn(int(key>>3), wt, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeMessage(data []byte, v reflect.Value) error {
+	fields := protoMessageOf(v.Type()).Fields
+	return eachField(data, func(num, wt int, raw []byte) error {
+		i := slices.IndexFunc(fields, func(f protoField) bool { return f.Num == num })
+		if i < 0 {
+			return nil
+		}
+		if err := decodeField(v.Field(fields[i].Index), wt, raw); err != nil {
+			return fmt.Errorf("%s: %w", fields[i].Name, err)
+		}
+		return nil
+	})
+}
+
+func decodeField(v reflect.Value, wt int, raw []byte) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeField(v.Elem(), wt, raw)
+	case reflect.Struct:
+		if wt != wireBytes {
+			return errProtoWireType
+		}
+		return decodeMessage(raw, v)
+	case reflect.Slice:
+		elem := v.Type().Elem()
+		if ewt, ok := wireTypeOf(elem.Kind()); ok && ewt != wireBytes && wt == wireBytes {
+			return decodePacked(v, ewt, raw)
+		}
+		ev := reflect.New(elem).Elem()
+		if err := decodeField(ev, wt, raw); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, ev))
+		return nil
+	case reflect.Map:
+		if wt != wireBytes {
+			return errProtoWireType
+		}
+		key, val := reflect.New(v.Type().Key()).Elem(), reflect.New(v.Type().Elem()).Elem()
+		err := eachField(raw, func(num, wt int, raw []byte) error {
+			switch num {
+			case 1:
+				return decodeField(key, wt, raw)
+			case 2:
+				return decodeField(val, wt, raw)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		v.SetMapIndex(key, val)
+		return nil
+	}
+	return decodeScalar(v, wt, raw)
+}
+
+func decodePacked(v reflect.Value, wt int, raw []byte) error {
+	for len(raw) > 0 {
+		n := 8
+		if wt == wireVarint {
+			if _, n = binary.Uvarint(raw); n <= 0 {
+				return errProtoTruncated
+			}
+		} else if len(raw) < n {
+			return errProtoTruncated
+		}
+		ev := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeScalar(ev, wt, raw[:n]); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, ev))
+		raw = raw[n:]
+	}
+	return nil
+}
+
+func decodeScalar(v reflect.Value, wt int, raw []byte) error {
+	want, ok := wireTypeOf(v.Kind())
+	if !ok {
+		return fmt.Errorf("protobuf: unsupported type %s", v.Type())
+	}
+	if wt != want {
+		return errProtoWireType
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int64:
+		x, _ := binary.Uvarint(raw)
+		v.SetInt(int64(x))
+	case reflect.Bool:
+		x, _ := binary.Uvarint(raw)
+		v.SetBool(x != 0)
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(raw)))
+	case reflect.String:
+		if !utf8.Valid(raw) {
+			return errors.New("protobuf: invalid UTF-8 string")
+		}
+		v.SetString(string(raw))
+	}
+	return nil
+}
+
+// ================= .proto 定義 =================
+
+// protoFile 產生 gRPC 服務的 .proto 定義（即 splitter.proto），訊息依名稱排序
+func protoFile() string {
+	var b strings.Builder
+	b.WriteString("// 由 protoFile（protobuf.go）產生，請勿手動修改；Go 結構變更後執行 go test -run TestProtoFile -update\n")
+	b.WriteString("syntax = \"proto3\";\n\npackage " + grpcPackage + ";\n\n")
+	b.WriteString("service " + grpcServiceName + " {\n")
+	messages := map[string]reflect.Type{}
+	for _, m := range grpcMethods {
+		in, out := reflect.TypeOf(m.Request), reflect.TypeOf(m.Response)
+		collectProtoMessages(in, messages)
+		collectProtoMessages(out, messages)
+		stream := ""
+		if m.Stream {
+			stream = "stream "
+		}
+		fmt.Fprintf(&b, "  // %s\n  rpc %s(%s) returns (%s%s);\n", m.Summary, m.Name, in.Name(), stream, out.Name())
+	}
+	b.WriteString("}\n")
+
+	for _, name := range slices.Sorted(maps.Keys(messages)) {
+		m := protoMessageOf(messages[name])
+		fmt.Fprintf(&b, "\nmessage %s {\n", name)
+		for _, num := range m.Reserved {
+			fmt.Fprintf(&b, "  reserved %d;\n", num)
+		}
+		for _, f := range m.Fields {
+			fmt.Fprintf(&b, "  %s %s = %d;\n", protoType(f.Type), f.Name, f.Num)
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func collectProtoMessages(t reflect.Type, out map[string]reflect.Type) {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Map:
+		collectProtoMessages(t.Elem(), out)
+	case reflect.Struct:
+		if _, ok := out[t.Name()]; ok {
+			return
+		}
+		out[t.Name()] = t
+		for _, f := range protoMessageOf(t).Fields {
+			collectProtoMessages(f.Type, out)
+		}
+	}
+}
+
+func protoType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return t.Elem().Name()
+		}
+		return "optional " + protoType(t.Elem())
+	case reflect.Slice:
+		return "repeated " + protoType(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map<%s, %s>", protoType(t.Key()), protoType(t.Elem()))
+	case reflect.Struct:
+		return t.Name()
+	case reflect.Int, reflect.Int64:
+		return "int64"
+	case reflect.Float64:
+		return "double"
+	}
+	return t.Kind().String()
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"testing"
+)
+
+var updateProto = flag.Bool("update", false, "重新產生 splitter.proto")
+
+// ==========================================
+// protobuf 編碼測試
+// ==========================================
+func TestProtoRoundTrip(t *testing.T) {
+	fee := 0.0
+	rev := int64(-1)
+	in := UpdateStateRequest{
+		Revision: &rev,
+		State: GlobalState{
+			BaseCurrency: "TWD",
+			Revision:     7,
+			People:       []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "小明"}},
+			Bills: []Bill{
+				{ID: 1, Title: "Taxi", Amount: 12.5, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}, Shares: map[int]float64{1: 2, 2: 1}, Tags: []string{"交通", ""}, FXFeePercent: &fee},
+				{ID: 2, Title: "Refund", Amount: -30, PaidBy: 2, Participants: []int{1}, Locked: true},
+			},
+			RateTable: &RateTable{Rates: map[string]float64{"usd": 32.1}},
+		},
+	}
+	data, err := marshalProto(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out UpdateStateRequest
+	if err := unmarshalProto(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !sameJSON(in, out) {
+		t.Errorf("編碼後解碼不一致:\n got %+v\nwant %+v", out, in)
+	}
+	// optional 的零值也要送，才能和沒有設定區分
+	if out.Revision == nil || *out.Revision != -1 || out.State.Bills[0].FXFeePercent == nil {
+		t.Errorf("optional 欄位遺失: %+v", out)
+	}
+
+	// 不認得的欄位略過；截斷的訊息報錯
+	extra := append(appendTag(nil, 99, wireVarint), 1)
+	if err := unmarshalProto(append(extra, data...), &out); err != nil {
+		t.Errorf("不認得的欄位應略過, got %v", err)
+	}
+	if err := unmarshalProto(data[:len(data)-3], &out); err == nil {
+		t.Error("截斷的訊息應報錯")
+	}
+}
+
+// ==========================================
+// splitter.proto 與 Go 結構一致性測試
+// ==========================================
+func TestProtoFile_UpToDate(t *testing.T) {
+	want := []byte(protoFile())
+	if *updateProto {
+		if err := os.WriteFile("splitter.proto", want, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := os.ReadFile("splitter.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("splitter.proto 與 Go 結構不一致，請執行 go test -run TestProtoFile -update 並確認欄位編號沒有改變")
+	}
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ================= QR Code（位元組模式、錯誤修正等級 M，版本 1–10） =================
+
+// qrBlocks 錯誤修正等級 M 各版本的區塊配置：每塊的修正碼數，以及兩組區塊的（塊數、每塊資料碼數）
+var qrBlocks = [...]struct {
+	ec             int
+	blocks1, data1 int
+	blocks2, data2 int
+	alignment      []int // 對齊圖形中心的座標
+}{
+	1:  {10, 1, 16, 0, 0, nil},
+	2:  {16, 1, 28, 0, 0, []int{6, 18}},
+	3:  {26, 1, 44, 0, 0, []int{6, 22}},
+	4:  {18, 2, 32, 0, 0, []int{6, 26}},
+	5:  {24, 2, 43, 0, 0, []int{6, 30}},
+	6:  {16, 4, 27, 0, 0, []int{6, 34}},
+	7:  {18, 4, 31, 0, 0, []int{6, 22, 38}},
+	8:  {22, 2, 38, 2, 39, []int{6, 24, 42}},
+	9:  {22, 3, 36, 2, 37, []int{6, 26, 46}},
+	10: {26, 4, 43, 1, 44, []int{6, 28, 50}},
+}
+
+const qrMaxVersion = len(qrBlocks) - 1
+
+var errQRTooLong = errors.New("qr: data too long")
+
+// qrCode 編碼完成的 QR Code；modules[y][x] 為 true 代表深色
+type qrCode struct {
+	version int
+	size    int
+	modules [][]bool
+	// function 標記定位圖形、格式資訊等固定區域，遮罩與資料都不會碰到
+	function [][]bool
+}
+
+// encodeQR 以最小可容納的版本把 data 編成 QR Code，並選擇扣分最少的遮罩
+func encodeQR(data []byte) (*qrCode, error) {
+	version := 1
+	for ; version <= qrMaxVersion; version++ {
+		if 4+qrCountBits(version)+8*len(data) <= 8*qrDataCodewords(version) {
+			break
+		}
+	}
+	if version > qrMaxVersion {
+		return nil, errQRTooLong
+	}
+
+	codewords := qrAddErrorCorrection(version, qrDataBits(version, data))
+	var best *qrCode
+	bestPenalty := 0
+	for mask := range 8 {
+		q := newQRCode(version)
+		q.drawCodewords(codewords)
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		if p := q.penalty(); best == nil || p < bestPenalty {
+			best, bestPenalty = q, p
+		}
+	}
+	return best, nil
+}
+
+func qrCountBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+func qrDataCodewords(version int) int {
+	b := qrBlocks[version]
+	return b.blocks1*b.data1 + b.blocks2*b.data2
+}
+
+// qrDataBits 模式指示 0100（位元組）、長度、資料、結束符號，再以 0xEC、0x11 補滿
+func qrDataBits(version int, data []byte) []byte {
+	var bits []bool
+	put := func(v, n int) {
+		for i := n - 1; i >= 0; i-- {
+			bits = append(bits, v>>i&1 == 1)
+		}
+	}
+	put(0b0100, 4)
+	put(len(data), qrCountBits(version))
+	for _, c := range data {
+		put(int(c), 8)
+	}
+	capacity := 8 * qrDataCodewords(version)
+	put(0, min(4, capacity-len(bits)))
+	put(0, (8-len(bits)%8)%8)
+
+	out := make([]byte, 0, capacity/8)
+	for i := 0; i < len(bits); i += 8 {
+		var c byte
+		for _, bit := range bits[i : i+8] {
+			c <<= 1
+			if bit {
+				c |= 1
+			}
+		}
+		out = append(out, c)
+	}
+	for pad := byte(0xEC); len(out) < capacity/8; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+// qrAddErrorCorrection 切成區塊、各自算 Reed-Solomon 修正碼，再交錯排列
+func qrAddErrorCorrection(version int, data []byte) []byte {
+	b := qrBlocks[version]
+	divisor := rsDivisor(b.ec)
+	var blocks, ecs [][]byte
+	for i := range b.blocks1 + b.blocks2 {
+		n := b.data1
+		if i >= b.blocks1 {
+			n = b.data2
+		}
+		blocks = append(blocks, data[:n])
+		ecs = append(ecs, rsRemainder(data[:n], divisor))
+		data = data[n:]
+	}
+	var out []byte
+	for i := range max(b.data1, b.data2) {
+		for _, blk := range blocks {
+			if i < len(blk) {
+				out = append(out, blk[i])
+			}
+		}
+	}
+	for i := range b.ec {
+		for _, ec := range ecs {
+			out = append(out, ec[i])
+		}
+	}
+	return out
+}
+
+// gfMul GF(256) 乘法，既約多項式 x^8+x^4+x^3+x^2+1
+func gfMul(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// rsDivisor 產生 degree 次的生成多項式（最高次項係數 1 省略）
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for range degree {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < degree {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, c := range data {
+		factor := c ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMul(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// newQRCode 畫好定位、時序、對齊圖形與版本資訊，格式資訊的位置先保留
+func newQRCode(version int) *qrCode {
+	size := 17 + 4*version
+	q := &qrCode{version: version, size: size, modules: make([][]bool, size), function: make([][]bool, size)}
+	for i := range size {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+
+	for i := range size {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	for _, c := range [][2]int{{3, 3}, {size - 4, 3}, {3, size - 4}} {
+		for dy := -4; dy <= 4; dy++ {
+			for dx := -4; dx <= 4; dx++ {
+				x, y := c[0]+dx, c[1]+dy
+				if x >= 0 && x < size && y >= 0 && y < size {
+					d := max(abs(dx), abs(dy))
+					q.set(x, y, d != 2 && d != 4)
+				}
+			}
+		}
+	}
+	pos := qrBlocks[version].alignment
+	for i, cy := range pos {
+		for j, cx := range pos {
+			// 與定位圖形重疊的三個角落不畫
+			if (i == 0 && j == 0) || (i == 0 && j == len(pos)-1) || (i == len(pos)-1 && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					q.set(cx+dx, cy+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+	q.drawFormatBits(0)
+
+	if version >= 7 {
+		bits := qrVersionBits(version)
+		for i := range 18 {
+			dark := bits>>i&1 == 1
+			a, b := size-11+i%3, i/3
+			q.set(a, b, dark)
+			q.set(b, a, dark)
+		}
+	}
+	return q
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (q *qrCode) set(x, y int, dark bool) {
+	q.modules[y][x] = dark
+	q.function[y][x] = true
+}
+
+// qrVersionBits 版本 7 以上的版本資訊：BCH(18,6) 碼
+func qrVersionBits(version int) int {
+	rem := version
+	for range 12 {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// qrFormatBits 錯誤修正等級 M（00）與遮罩編號的 BCH(15,5) 碼
+func qrFormatBits(mask int) int {
+	rem := mask
+	for range 10 {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (mask<<10 | rem) ^ 0x5412
+}
+
+// drawFormatBits 格式資訊左上一份、右上與左下合起來一份
+func (q *qrCode) drawFormatBits(mask int) {
+	bits := qrFormatBits(mask)
+	bit := func(i int) bool { return bits>>i&1 == 1 }
+
+	for i := range 6 {
+		q.set(8, i, bit(i))
+	}
+	q.set(8, 7, bit(6))
+	q.set(8, 8, bit(7))
+	q.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(i))
+	}
+	for i := range 8 {
+		q.set(q.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.size-15+i, bit(i))
+	}
+	q.set(8, q.size-8, true)
+}
+
+// drawCodewords 從右下角開始，兩欄一組上下蛇行填入資料
+func (q *qrCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = data[i>>3]>>(7-i&7)&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+func qrMaskBit(mask, x, y int) bool {
+	switch mask {
+	case 0:
+		return (x+y)%2 == 0
+	case 1:
+		return y%2 == 0
+	case 2:
+		return x%3 == 0
+	case 3:
+		return (x+y)%3 == 0
+	case 4:
+		return (x/3+y/2)%2 == 0
+	case 5:
+		return x*y%2+x*y%3 == 0
+	case 6:
+		return (x*y%2+x*y%3)%2 == 0
+	default:
+		return ((x+y)%2+x*y%3)%2 == 0
+	}
+}
+
+func (q *qrCode) applyMask(mask int) {
+	for y := range q.size {
+		for x := range q.size {
+			if !q.function[y][x] && qrMaskBit(mask, x, y) {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 規格的四項扣分：連續同色、2×2 同色、類似定位圖形的 1:1:3:1:1、深淺比例
+func (q *qrCode) penalty() int {
+	score := 0
+	at := func(x, y int, transpose bool) bool {
+		if transpose {
+			return q.modules[x][y]
+		}
+		return q.modules[y][x]
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for _, transpose := range []bool{false, true} {
+		for y := range q.size {
+			run := 1
+			for x := 1; x <= q.size; x++ {
+				if x < q.size && at(x, y, transpose) == at(x-1, y, transpose) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += run - 2
+				}
+				run = 1
+			}
+			for x := 0; x+7 <= q.size; x++ {
+				match := true
+				for k, dark := range finder {
+					if at(x+k, y, transpose) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (qrLightRun(q, x-4, x, y, transpose) || qrLightRun(q, x+7, x+11, y, transpose)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := range q.size {
+		for x := range q.size {
+			if q.modules[y][x] {
+				dark++
+			}
+			if x+1 < q.size && y+1 < q.size {
+				c := q.modules[y][x]
+				if q.modules[y][x+1] == c && q.modules[y+1][x] == c && q.modules[y+1][x+1] == c {
+					score += 3
+				}
+			}
+		}
+	}
+	total := q.size * q.size
+	// 深色比例每偏離 50% 五個百分點扣 10 分
+	score += 10 * ((abs(dark*20-total*10)+total-1)/total - 1)
+	return score
+}
+
+// qrLightRun from..to（不含）之間都是淺色；超出邊界視為淺色（靜區）
+func qrLightRun(q *qrCode, from, to, y int, transpose bool) bool {
+	for x := from; x < to; x++ {
+		if x < 0 || x >= q.size {
+			continue
+		}
+		if (transpose && q.modules[x][y]) || (!transpose && q.modules[y][x]) {
+			return false
+		}
+	}
+	return true
+}
+
+// image 每個模組畫成 scale×scale 像素，四周留 4 個模組寬的靜區
+func (q *qrCode) image(scale int) image.Image {
+	const quiet = 4
+	n := (q.size + 2*quiet) * scale
+	img := image.NewPaletted(image.Rect(0, 0, n, n), color.Palette{color.White, color.Black})
+	for y := range q.size {
+		for x := range q.size {
+			if !q.modules[y][x] {
+				continue
+			}
+			for dy := range scale {
+				for dx := range scale {
+					img.SetColorIndex((x+quiet)*scale+dx, (y+quiet)*scale+dy, 1)
+				}
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// decodeQR 依規格讀回 QR Code：格式資訊、解除遮罩、蛇行讀出碼字、拆回區塊並核對修正碼，最後解析位元組模式的資料
+func decodeQR(t *testing.T, q *qrCode) []byte {
+	t.Helper()
+	bit := func(x, y int) int {
+		if q.modules[y][x] {
+			return 1
+		}
+		return 0
+	}
+	var format, format2 int
+	for i := range 6 {
+		format |= bit(8, i) << i
+	}
+	format |= bit(8, 7)<<6 | bit(8, 8)<<7 | bit(7, 8)<<8
+	for i := 9; i < 15; i++ {
+		format |= bit(14-i, 8) << i
+	}
+	for i := range 8 {
+		format2 |= bit(q.size-1-i, 8) << i
+	}
+	for i := 8; i < 15; i++ {
+		format2 |= bit(8, q.size-15+i) << i
+	}
+	if format != format2 {
+		t.Fatalf("兩份格式資訊不同: %015b / %015b", format, format2)
+	}
+	mask := -1
+	for m := range 8 {
+		if qrFormatBits(m) == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("格式資訊錯誤: %015b", format)
+	}
+
+	ref := newQRCode(q.version)
+	var codewords []byte
+	var cur byte
+	n := 0
+	for right := q.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := range q.size {
+			for j := range 2 {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = q.size - 1 - vert
+				}
+				if ref.function[y][x] {
+					continue
+				}
+				cur = cur<<1 | byte(bit(x, y))
+				if qrMaskBit(mask, x, y) {
+					cur ^= 1
+				}
+				if n++; n%8 == 0 {
+					codewords = append(codewords, cur)
+				}
+			}
+		}
+	}
+
+	b := qrBlocks[q.version]
+	count := b.blocks1 + b.blocks2
+	blocks := make([][]byte, count)
+	i := 0
+	for k := range max(b.data1, b.data2) {
+		for blk := range count {
+			if k < b.data1 || blk >= b.blocks1 {
+				blocks[blk] = append(blocks[blk], codewords[i])
+				i++
+			}
+		}
+	}
+	divisor := rsDivisor(b.ec)
+	for k := range b.ec {
+		for blk := range count {
+			if want := rsRemainder(blocks[blk], divisor)[k]; codewords[i] != want {
+				t.Fatalf("區塊 %d 的修正碼 %d 不符", blk, k)
+			}
+			i++
+		}
+	}
+
+	data := bytes.Join(blocks, nil)
+	bitAt := func(i int) int { return int(data[i/8]>>(7-i%8)) & 1 }
+	read := func(pos, width int) int {
+		v := 0
+		for k := range width {
+			v = v<<1 | bitAt(pos+k)
+		}
+		return v
+	}
+	if mode := read(0, 4); mode != 0b0100 {
+		t.Fatalf("模式 = %04b, want 0100", mode)
+	}
+	length := read(4, qrCountBits(q.version))
+	out := make([]byte, length)
+	for k := range out {
+		out[k] = byte(read(4+qrCountBits(q.version)+8*k, 8))
+	}
+	return out
+}
+
+// ==========================================
+// QR Code 測試
+// ==========================================
+func TestQRReedSolomon(t *testing.T) {
+	// 「HELLO WORLD」1-M 的資料碼字與修正碼字
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+	if got := rsRemainder(data, rsDivisor(10)); !bytes.Equal(got, want) {
+		t.Errorf("修正碼 = %v, want %v", got, want)
+	}
+}
+
+func TestQRFormatAndVersionBits(t *testing.T) {
+	// 規格附錄的等級 M 格式資訊
+	want := []int{0b101010000010010, 0b101000100100101, 0b101111001111100, 0b101101101001011, 0b100010111111001, 0b100000011001110, 0b100111110010111, 0b100101010100000}
+	for mask, w := range want {
+		if got := qrFormatBits(mask); got != w {
+			t.Errorf("遮罩 %d 的格式資訊 = %015b, want %015b", mask, got, w)
+		}
+	}
+	if got := qrVersionBits(7); got != 0x07C94 {
+		t.Errorf("版本 7 的版本資訊 = %#x, want 0x7c94", got)
+	}
+}
+
+func TestEncodeQR(t *testing.T) {
+	for _, text := range []string{
+		"A",
+		"http://192.168.1.105:8080/?room=K7Q2XM",
+		"https://splitter.example.com/?room=K7Q2XM&lang=zh-TW",
+		strings.Repeat("x", 200),
+	} {
+		q, err := encodeQR([]byte(text))
+		if err != nil {
+			t.Fatalf("%q: %v", text, err)
+		}
+		if q.size != 17+4*q.version {
+			t.Errorf("%q: size = %d", text, q.size)
+		}
+		if got := decodeQR(t, q); string(got) != text {
+			t.Errorf("讀回 %q, want %q", got, text)
+		}
+		// 定位圖形：左上角 7×7 外框為深色、內圈為淺色
+		if !q.modules[0][0] || !q.modules[0][6] || q.modules[1][1] || !q.modules[3][3] {
+			t.Errorf("%q: 左上定位圖形錯誤", text)
+		}
+	}
+	if q, _ := encodeQR([]byte("http://192.168.1.105:8080/?room=K7Q2XM")); q.version != 3 {
+		t.Errorf("38 bytes 的網址應使用版本 3, got %d", q.version)
+	}
+	if _, err := encodeQR(make([]byte, 400)); err != errQRTooLong {
+		t.Errorf("超過版本 10 的容量應回 errQRTooLong, got %v", err)
+	}
+}
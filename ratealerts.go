@@ -0,0 +1,92 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ================= 匯率變動提醒 =================
+
+// defaultRateAlertPercent 請求沒有指定 rateAlertPercent 時，匯率變動超過幾 % 就提醒
+const defaultRateAlertPercent = 3.0
+
+// RateSnapshot 某次計算用的最新匯率（1 單位幣別 = 多少 Base），存在狀態中供下次計算比較。
+// 只記錄會隨時間變動的匯率（即時、離線、鎖定），手動與帳單當日的匯率不列入
+type RateSnapshot struct {
+	Base  string             `json:"base"`
+	Date  string             `json:"date"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// RateAlert 與上次計算相比變動超過門檻的匯率
+type RateAlert struct {
+	Currency      string  `json:"currency"`
+	Previous      float64 `json:"previous"`
+	Current       float64 `json:"current"`
+	ChangePercent float64 `json:"changePercent"`
+	PreviousDate  string  `json:"previousDate,omitempty"`
+	Date          string  `json:"date,omitempty"`
+	Message       string  `json:"message"`
+}
+
+// rateSnapshot 整理這次計算用的最新匯率，rates 與 bills 同順序；沒有用到時回傳 nil
+func rateSnapshot(base string, bills []Bill, rates []billRate) *RateSnapshot {
+	snap := &RateSnapshot{Base: base, Rates: map[string]float64{}}
+	for i, bill := range bills {
+		switch rates[i].Source {
+		case rateSourceMarket, rateSourceOffline, rateSourceLocked:
+		default:
+			continue
+		}
+		snap.Rates[strings.ToUpper(strings.TrimSpace(bill.Currency))] = rates[i].Rate
+		snap.Date = max(snap.Date, rates[i].Date)
+	}
+	if len(snap.Rates) == 0 {
+		return nil
+	}
+	return snap
+}
+
+func validateRateAlertPercent(p float64) error {
+	if p < 0 || math.IsNaN(p) || math.IsInf(p, 0) {
+		return fmt.Errorf("匯率變動提醒門檻必須是非負數")
+	}
+	return nil
+}
+
+// rateAlerts 比較上次與這次計算的匯率，變動超過 threshold%（0 代表 defaultRateAlertPercent）的幣別依代碼排序列出。
+// 本位幣不同時無從比較
+func rateAlerts(prev, cur *RateSnapshot, threshold float64) []RateAlert {
+	if prev == nil || cur == nil || !strings.EqualFold(prev.Base, cur.Base) {
+		return nil
+	}
+	if threshold == 0 {
+		threshold = defaultRateAlertPercent
+	}
+	var alerts []RateAlert
+	for currency, rate := range cur.Rates {
+		old := prev.Rates[currency]
+		if old <= 0 {
+			continue
+		}
+		change := (rate - old) / old * 100
+		if math.Abs(change) <= threshold {
+			continue
+		}
+		change = math.Round(change*100) / 100
+		alerts = append(alerts, RateAlert{
+			Currency:      currency,
+			Previous:      old,
+			Current:       rate,
+			ChangePercent: change,
+			PreviousDate:  prev.Date,
+			Date:          cur.Date,
+			Message:       fmt.Sprintf("%s 匯率從 %.4f 變為 %.4f（%+.2f%%），換算金額與上次計算不同", currency, old, rate, change),
+		})
+	}
+	slices.SortFunc(alerts, func(a, b RateAlert) int { return cmp.Compare(a.Currency, b.Currency) })
+	return alerts
+}
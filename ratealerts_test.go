@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 匯率變動提醒測試
+// ==========================================
+func TestRunCalculate_RateAlerts(t *testing.T) {
+	useRateFetcher(t, failingFetcher{})
+	rateCache.Set("twd", rateEntry{Date: "2026-05-02", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03, "jpy": 5}})
+
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Ramen", Amount: 1000, Currency: "jpy", PaidBy: 2, Participants: []int{1, 2}},
+		{ID: 3, Title: "Taxi", Amount: 50, Currency: "EUR", ManualRate: 35, PaidBy: 2, Participants: []int{1, 2}},
+	}
+	// 上次 1 USD = 32 TWD、1 JPY = 0.198 TWD；這次 1 USD ≈ 33.33 TWD（+4.17%）、1 JPY = 0.2 TWD（+1.01%）
+	prev := &RateSnapshot{Base: "TWD", Date: "2026-05-01", Rates: map[string]float64{"USD": 32, "JPY": 0.198}}
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, PreviousRates: prev})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+
+	// 手動匯率不列入快照
+	snap := resp.RateSnapshot
+	if snap == nil || snap.Base != "TWD" || snap.Date != "2026-05-02" || len(snap.Rates) != 2 || snap.Rates["JPY"] != 0.2 {
+		t.Fatalf("snapshot = %+v", snap)
+	}
+	if len(resp.RateAlerts) != 1 {
+		t.Fatalf("alerts = %+v, want USD only", resp.RateAlerts)
+	}
+	if a := resp.RateAlerts[0]; a.Currency != "USD" || a.Previous != 32 || a.ChangePercent != 4.17 || a.PreviousDate != "2026-05-01" || a.Message == "" {
+		t.Errorf("alert = %+v", a)
+	}
+
+	// 門檻調高就不提醒；本位幣不同時無從比較
+	resp = runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, PreviousRates: prev, RateAlertPercent: 5})
+	if len(resp.RateAlerts) != 0 {
+		t.Errorf("alerts = %+v, want none above 5%%", resp.RateAlerts)
+	}
+	prev.Base = "USD"
+	if alerts := rateAlerts(prev, snap, 0); alerts != nil {
+		t.Errorf("alerts = %+v, want none across bases", alerts)
+	}
+
+	if resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills, RateAlertPercent: -1}); resp.Error == "" {
+		t.Error("負的門檻應該失敗")
+	}
+}
+
+func TestRateSnapshot_BaseOnly(t *testing.T) {
+	bills := []Bill{{ID: 1, Amount: 100}}
+	if snap := rateSnapshot("TWD", bills, []billRate{{Rate: 1, Source: rateSourceBase}}); snap != nil {
+		t.Errorf("只有本位幣帳單時不需要快照, got %+v", snap)
+	}
+}
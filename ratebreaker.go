@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// ================= 匯率 API 斷路器與退避 =================
+
+var errRateCircuitOpen = errors.New("匯率 API 暫時無法使用，稍後再試")
+
+// circuitBreaker 連續 threshold 次抓取失敗後，cooldown 期間直接放棄不再連線（呼叫端改用快取或內建匯率）；
+// 冷卻結束後放行一次試探，成功就恢復，失敗就再冷卻一次
+type circuitBreaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openUntil time.Time
+	now       func() time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown, now: func() time.Time { return clock.Now() }}
+}
+
+// allow 是否可以連線；冷卻結束後只放行一個試探，其他呼叫在試探結果出來前仍被擋下
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	now := b.now()
+	if now.Before(b.openUntil) {
+		return false
+	}
+	b.openUntil = now.Add(b.cooldown)
+	return true
+}
+
+// isOpen 是否正在冷卻（不會放行任何連線）
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.failures >= b.threshold && b.now().Before(b.openUntil)
+}
+
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures = 0
+}
+
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
+
+// rateBreaker 所有匯率抓取（最新與歷史匯率）共用的斷路器
+var rateBreaker = newCircuitBreaker(3, time.Minute)
+
+// rateRetryDelay 第 attempt 次重試（從 1 開始）前等待的時間：指數退避加上完整抖動，
+// 避免多台裝置在匯率 API 恢復時同時重試
+func rateRetryDelay(attempt int) time.Duration {
+	return rand.N(rateRetryBase << attempt)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// useRateFetcher 測試期間改用 f 抓匯率，換上空的快取、新的斷路器與統計，並縮短重試間隔
+func useRateFetcher(t *testing.T, f RateFetcher) {
+	t.Helper()
+	oldCache, oldFetcher, oldBreaker, oldStats, oldBase := rateCache, rateFetcher, rateBreaker, rateStats, rateRetryBase
+	rateCache, rateFetcher, rateBreaker, rateStats, rateRetryBase = NewRateCache(), f, newCircuitBreaker(3, time.Minute), &rateCounters{}, time.Millisecond
+	t.Cleanup(func() {
+		rateCache, rateFetcher, rateBreaker, rateStats, rateRetryBase = oldCache, oldFetcher, oldBreaker, oldStats, oldBase
+	})
+}
+
+// countingFetcher 記錄被呼叫的次數，err 為 nil 時成功
+type countingFetcher struct {
+	calls int
+	err   error
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	f.calls++
+	if f.err != nil {
+		return rateEntry{}, f.err
+	}
+	return rateEntry{Rates: map[string]float64{"usd": 0.03}, Date: "2026-05-01"}, nil
+}
+
+// ==========================================
+// 匯率 API 斷路器測試
+// ==========================================
+func TestFetchRates_CircuitBreaker(t *testing.T) {
+	fetcher := &countingFetcher{err: errors.New("HTTP 503")}
+	useRateFetcher(t, fetcher)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	rateBreaker.now = func() time.Time { return now }
+
+	// 每次抓取重試 rateFetchAttempts 次，連續 3 次失敗後斷路
+	for range 3 {
+		if _, err := fetchRates(context.Background(), "twd"); err == nil {
+			t.Fatal("應該失敗")
+		}
+	}
+	if fetcher.calls != 3*rateFetchAttempts {
+		t.Errorf("calls = %d, want %d", fetcher.calls, 3*rateFetchAttempts)
+	}
+	if _, err := fetchRates(context.Background(), "twd"); !errors.Is(err, errRateCircuitOpen) || fetcher.calls != 3*rateFetchAttempts {
+		t.Errorf("斷路期間不應連線, err = %v, calls = %d", err, fetcher.calls)
+	}
+
+	// 斷路期間沒有快取時直接改用內建匯率
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD"}}
+	if _, rates, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{}); err != nil || rates[0].Source != rateSourceOffline {
+		t.Errorf("got %+v %v, want offline", rates, err)
+	}
+
+	// 冷卻結束後放行一次試探：成功就恢復
+	now = now.Add(time.Minute)
+	fetcher.err = nil
+	if _, err := fetchRates(context.Background(), "twd"); err != nil {
+		t.Fatalf("試探應成功, got %v", err)
+	}
+	if !rateBreaker.allow() {
+		t.Error("成功後應恢復連線")
+	}
+}
+
+func TestCircuitBreaker_HalfOpen(t *testing.T) {
+	b := newCircuitBreaker(2, time.Minute)
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	b.failure()
+	if !b.allow() {
+		t.Error("未達門檻前不應斷路")
+	}
+	b.failure()
+	if b.allow() {
+		t.Error("達到門檻後應斷路")
+	}
+	now = now.Add(time.Minute)
+	if !b.allow() || b.allow() {
+		t.Error("冷卻結束後只放行一次試探")
+	}
+	b.failure()
+	now = now.Add(30 * time.Second)
+	if b.allow() {
+		t.Error("試探失敗應再冷卻")
+	}
+}
+
+func TestRateRetryDelay(t *testing.T) {
+	for attempt := 1; attempt <= 4; attempt++ {
+		for range 20 {
+			if d := rateRetryDelay(attempt); d < 0 || d >= rateRetryBase<<attempt {
+				t.Fatalf("attempt %d: delay %v 超出範圍", attempt, d)
+			}
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"cmp"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ================= 匯率快取統計 =================
+
+// rateCounters 換算時快取的使用情形與抓取結果，用來追查「為什麼那次換算失敗」
+type rateCounters struct {
+	hits, staleHits, misses     atomic.Int64
+	fetches, fetchFailures      atomic.Int64
+	notModified                 atomic.Int64
+	circuitRejected, offlineUse atomic.Int64
+
+	mu          sync.Mutex
+	lastError   string
+	lastErrorAt time.Time
+}
+
+func (c *rateCounters) recordFailure(err error, now time.Time) {
+	c.fetchFailures.Add(1)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastError = err.Error()
+	c.lastErrorAt = now
+}
+
+var rateStats = &rateCounters{}
+
+// RateCacheEntry 快取中的一組匯率；Key 為本位幣，歷史匯率為 "本位幣@日期"
+type RateCacheEntry struct {
+	Key        string `json:"key"`
+	Base       string `json:"base"`
+	Historical bool   `json:"historical"`
+	// Date 匯率 API 的資料日期，FetchedAt 為抓取時間（Unix 毫秒）
+	Date       string `json:"date"`
+	FetchedAt  int64  `json:"fetchedAt"`
+	AgeSeconds int64  `json:"ageSeconds"`
+	// Stale 超過 -rate-ttl，下次換算會在背景更新；歷史匯率不會變動，永遠不算過期
+	Stale      bool `json:"stale"`
+	Currencies int  `json:"currencies"`
+	// TTLSeconds 匯率來源以 Cache-Control 指定的有效時間，0 代表使用 -rate-ttl
+	TTLSeconds int64 `json:"ttlSeconds,omitempty"`
+	// Warnings 抓取時捨棄的不合理匯率
+	Warnings []RateWarning `json:"warnings,omitempty"`
+}
+
+// RateCacheCounters 自啟動以來的累計次數
+type RateCacheCounters struct {
+	Hits          int64 `json:"hits"`
+	StaleHits     int64 `json:"staleHits"`
+	Misses        int64 `json:"misses"`
+	Fetches       int64 `json:"fetches"`
+	FetchFailures int64 `json:"fetchFailures"`
+	// NotModified 匯率來源回應 304、沿用上次資料的次數
+	NotModified     int64 `json:"notModified"`
+	CircuitRejected int64 `json:"circuitRejected"`
+	OfflineFallback int64 `json:"offlineFallback"`
+}
+
+// RateCacheResponse GET /api/rates/cache 的回應
+type RateCacheResponse struct {
+	Provider    string            `json:"provider"`
+	TTLSeconds  int64             `json:"ttlSeconds"`
+	CircuitOpen bool              `json:"circuitOpen"`
+	Entries     []RateCacheEntry  `json:"entries"`
+	Counters    RateCacheCounters `json:"counters"`
+	LastError   string            `json:"lastError,omitempty"`
+	LastErrorAt int64             `json:"lastErrorAt,omitempty"`
+}
+
+// entries 快取內容的複本
+func (rc *RateCache) entries() map[string]rateEntry {
+	rc.mu.RLock()
+	defer rc.mu.RUnlock()
+	return maps.Clone(rc.cache)
+}
+
+// rateCacheReport 目前的快取內容與統計，依 Key 排序
+func rateCacheReport(now time.Time) RateCacheResponse {
+	resp := RateCacheResponse{
+		Provider:    rateProviderName,
+		TTLSeconds:  int64(rateCacheTTL / time.Second),
+		CircuitOpen: rateBreaker.isOpen(),
+		Entries:     []RateCacheEntry{},
+		Counters: RateCacheCounters{
+			Hits:            rateStats.hits.Load(),
+			StaleHits:       rateStats.staleHits.Load(),
+			Misses:          rateStats.misses.Load(),
+			Fetches:         rateStats.fetches.Load(),
+			FetchFailures:   rateStats.fetchFailures.Load(),
+			NotModified:     rateStats.notModified.Load(),
+			CircuitRejected: rateStats.circuitRejected.Load(),
+			OfflineFallback: rateStats.offlineUse.Load(),
+		},
+	}
+	for key, e := range rateCache.entries() {
+		base, _, historical := strings.Cut(key, "@")
+		age := now.Sub(e.FetchedAt)
+		resp.Entries = append(resp.Entries, RateCacheEntry{
+			Key:        key,
+			Base:       strings.ToUpper(base),
+			Historical: historical,
+			Date:       e.Date,
+			FetchedAt:  e.FetchedAt.UnixMilli(),
+			AgeSeconds: int64(age / time.Second),
+			Stale:      !historical && !e.fresh(now),
+			Currencies: len(e.Rates),
+			TTLSeconds: int64(e.TTL / time.Second),
+			Warnings:   e.Warnings,
+		})
+	}
+	slices.SortFunc(resp.Entries, func(a, b RateCacheEntry) int { return cmp.Compare(a.Key, b.Key) })
+
+	rateStats.mu.Lock()
+	resp.LastError = rateStats.lastError
+	if !rateStats.lastErrorAt.IsZero() {
+		resp.LastErrorAt = rateStats.lastErrorAt.UnixMilli()
+	}
+	rateStats.mu.Unlock()
+	return resp
+}
+
+// handleRateCache GET /api/rates/cache：查看匯率快取與抓取統計
+func handleRateCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, rateCacheReport(clock.Now()))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 匯率快取統計測試
+// ==========================================
+func TestRateCacheStats(t *testing.T) {
+	fetcher := &countingFetcher{}
+	useRateFetcher(t, fetcher)
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD"}}
+	convert := func(base string) {
+		t.Helper()
+		if _, _, _, err := convertBillsWithRates(context.Background(), base, bills, conversionOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	convert("TWD") // 沒有快取：同步抓取
+	convert("TWD") // 快取有效
+	stale, _ := rateCache.Get("twd")
+	stale.FetchedAt = time.Now().Add(-2 * rateCacheTTL)
+	rateCache.Set("twd", stale)
+	convert("TWD") // 過期：先用舊的，背景更新
+	rateRefresh.wg.Wait()
+
+	// 抓不到匯率時改用內建快照，並記下錯誤
+	fetcher.err = errors.New("HTTP 503")
+	convert("JPY")
+
+	rateCache.Set("twd@2026-04-01", rateEntry{Rates: map[string]float64{"twd": 1, "usd": 0.031}, Date: "2026-04-01", FetchedAt: time.Now().Add(-48 * time.Hour)})
+
+	rec := httptest.NewRecorder()
+	handleRateCache(rec, httptest.NewRequest(http.MethodGet, "/api/rates/cache", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var got RateCacheResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := RateCacheCounters{Hits: 1, StaleHits: 1, Misses: 2, Fetches: 3, FetchFailures: 1, OfflineFallback: 1}
+	if got.Counters != want {
+		t.Errorf("counters = %+v, want %+v", got.Counters, want)
+	}
+	if got.LastError != "HTTP 503" || got.LastErrorAt == 0 {
+		t.Errorf("lastError = %q at %d", got.LastError, got.LastErrorAt)
+	}
+	if got.Provider != rateProviderName || got.TTLSeconds != int64(rateCacheTTL/time.Second) || got.CircuitOpen {
+		t.Errorf("provider = %s, ttl = %d, circuitOpen = %v", got.Provider, got.TTLSeconds, got.CircuitOpen)
+	}
+	// 離線匯率不放進快取，所以只有 twd 與它的歷史匯率
+	if len(got.Entries) != 2 {
+		t.Fatalf("entries = %+v", got.Entries)
+	}
+	if e := got.Entries[0]; e.Key != "twd" || e.Base != "TWD" || e.Historical || e.Stale || e.Currencies != 1 {
+		t.Errorf("latest entry = %+v", e)
+	}
+	if e := got.Entries[1]; e.Key != "twd@2026-04-01" || !e.Historical || e.Stale || e.AgeSeconds < 47*3600 {
+		t.Errorf("historical entry = %+v", e)
+	}
+}
+
+func TestRateCacheAPI_MethodNotAllowed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleRateCache(rec, httptest.NewRequest(http.MethodDelete, "/api/rates/cache", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 匯率 API 的 HTTP 快取 =================
+
+// 匯率來源指定的有效時間限制在這個範圍內：太短會一直連網，太長則一整天都用舊匯率
+const (
+	minProviderTTL = time.Minute
+	maxProviderTTL = 24 * time.Hour
+)
+
+// httpValidator 條件式請求用的驗證資訊與當時解析的匯率
+type httpValidator struct {
+	etag         string
+	lastModified string
+	entry        rateEntry
+}
+
+func newHTTPValidator(h http.Header, entry rateEntry) (httpValidator, bool) {
+	v := httpValidator{etag: h.Get("ETag"), lastModified: h.Get("Last-Modified"), entry: entry}
+	return v, v.etag != "" || v.lastModified != ""
+}
+
+func (v httpValidator) apply(req *http.Request) {
+	if v.etag != "" {
+		req.Header.Set("If-None-Match", v.etag)
+	}
+	if v.lastModified != "" {
+		req.Header.Set("If-Modified-Since", v.lastModified)
+	}
+}
+
+// cacheTTL 依回應的 Cache-Control 算出匯率可以快取多久（max-age 扣掉 Age），限制在
+// minProviderTTL～maxProviderTTL 之間；no-cache、no-store 視為最短。沒有指定時回傳 false
+func cacheTTL(h http.Header) (time.Duration, bool) {
+	cc := h.Get("Cache-Control")
+	if cc == "" {
+		return 0, false
+	}
+	var ttl time.Duration
+	found := false
+	for _, directive := range strings.Split(cc, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(directive), "=")
+		switch strings.ToLower(name) {
+		case "no-cache", "no-store":
+			return minProviderTTL, true
+		case "max-age":
+			secs, err := strconv.Atoi(strings.Trim(value, `"`))
+			if err != nil || secs < 0 {
+				continue
+			}
+			ttl, found = time.Duration(secs)*time.Second, true
+		}
+	}
+	if !found {
+		return 0, false
+	}
+	if age, err := strconv.Atoi(h.Get("Age")); err == nil && age > 0 {
+		ttl -= time.Duration(age) * time.Second
+	}
+	return min(max(ttl, minProviderTTL), maxProviderTTL), true
+}
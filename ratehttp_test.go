@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 匯率 API HTTP 快取測試
+// ==========================================
+func TestHTTPRateFetcher_ConditionalRequests(t *testing.T) {
+	useRateFetcher(t, nil)
+	var gotHeaders []http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeaders = append(gotHeaders, r.Header.Clone())
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Fri, 01 May 2026 00:00:00 GMT")
+		w.Write([]byte(`{"date":"2026-05-01","twd":{"usd":0.031}}`))
+	}))
+	defer srv.Close()
+	f := NewHTTPRateFetcher(srv.URL + "/%s.json")
+
+	first, err := f.Fetch(context.Background(), "twd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.Fetch(context.Background(), "twd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotHeaders[0].Get("If-None-Match") != "" {
+		t.Error("第一次請求不應帶 If-None-Match")
+	}
+	if gotHeaders[1].Get("If-None-Match") != `"v1"` || gotHeaders[1].Get("If-Modified-Since") != "Fri, 01 May 2026 00:00:00 GMT" {
+		t.Errorf("第二次請求 headers = %v", gotHeaders[1])
+	}
+	// 304 沿用上次的匯率
+	if second.Rates["usd"] != 0.031 || second.Date != "2026-05-01" || first.TTL != time.Hour || second.TTL != time.Hour {
+		t.Errorf("first = %+v, second = %+v", first, second)
+	}
+	if rateStats.notModified.Load() != 1 {
+		t.Errorf("notModified = %d", rateStats.notModified.Load())
+	}
+}
+
+func TestRateEntry_ProviderTTL(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	e := rateEntry{FetchedAt: now, TTL: 2 * time.Hour}
+	if !e.fresh(now.Add(rateCacheTTL + time.Minute)) {
+		t.Error("匯率來源允許 2 小時，超過 rateCacheTTL 仍應有效")
+	}
+	if e.fresh(now.Add(2 * time.Hour)) {
+		t.Error("超過匯率來源的有效時間應過期")
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		cacheControl, age string
+		want              time.Duration
+		ok                bool
+	}{
+		{"", "", 0, false},
+		{"public", "", 0, false},
+		{"public, max-age=3600", "", time.Hour, true},
+		{"max-age=3600", "600", 50 * time.Minute, true},
+		{"max-age=5", "", minProviderTTL, true},
+		{"max-age=604800, s-maxage=43200", "", maxProviderTTL, true},
+		{"no-cache", "", minProviderTTL, true},
+		{"max-age=abc", "", 0, false},
+	}
+	for _, tt := range tests {
+		h := http.Header{}
+		if tt.cacheControl != "" {
+			h.Set("Cache-Control", tt.cacheControl)
+		}
+		if tt.age != "" {
+			h.Set("Age", tt.age)
+		}
+		got, ok := cacheTTL(h)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("cacheTTL(%q, age %q) = %v, %v; want %v, %v", tt.cacheControl, tt.age, got, ok, tt.want, tt.ok)
+		}
+	}
+}
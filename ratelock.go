@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ================= 鎖定匯率 =================
+
+// LockedRates 鎖定在狀態中的匯率（格式同匯率 API：1 單位 Base = 多少該幣別，幣別為小寫），
+// 取代最新匯率，下週重算時大家的欠款不會因匯率變動而改變
+type LockedRates struct {
+	Base string `json:"base"`
+	// Date 匯率 API 的資料日期，LockedAt 為鎖定的時間（Unix 毫秒）
+	Date     string             `json:"date"`
+	LockedAt int64              `json:"lockedAt"`
+	Rates    map[string]float64 `json:"rates"`
+}
+
+var errRatesUnavailable = errors.New("rates unavailable")
+
+// entry 以 baseLower 為本位幣的鎖定匯率；本位幣改變時若鎖定的匯率中有新本位幣，以交叉匯率換算
+func (l *LockedRates) entry(baseLower string) (rateEntry, bool) {
+	if l == nil {
+		return rateEntry{}, false
+	}
+	pivot := 1.0
+	if baseLower != l.Base {
+		if pivot = l.Rates[baseLower]; pivot == 0 {
+			return rateEntry{}, false
+		}
+	}
+	rates := make(map[string]float64, len(l.Rates)+1)
+	rates[l.Base] = 1 / pivot
+	for cur, rate := range l.Rates {
+		rates[cur] = rate / pivot
+	}
+	return rateEntry{Rates: rates, Date: l.Date, Locked: true}, true
+}
+
+// lockRates 取得目前使用中的匯率（有快取就用快取），refresh 時重新向匯率 API 抓取
+func lockRates(ctx context.Context, base string, refresh bool, now time.Time) (*LockedRates, error) {
+	baseLower := strings.ToLower(base)
+	entry, ok := rateCache.Get(baseLower)
+	if !ok || refresh {
+		fetched, err := fetchRates(ctx, baseLower)
+		if err != nil {
+			return nil, errRatesUnavailable
+		}
+		entry = fetched
+	}
+	return &LockedRates{Base: baseLower, Date: entry.Date, LockedAt: now.UnixMilli(), Rates: entry.Rates}, nil
+}
+
+// handleRatesLock POST 鎖定、DELETE 解除 /api/rates/lock。
+// POST 鎖定目前使用中的匯率，?refresh=1 先抓最新的匯率再鎖定（已鎖定時用來更新）
+func handleRatesLock(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		locked, err := lockRates(r.Context(), stateBase(state), r.URL.Query().Get("refresh") != "", clock.Now())
+		if err != nil {
+			writeError(w, http.StatusBadGateway, "無法取得匯率，請稍後再試")
+			return
+		}
+		if _, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			s.LockedRates = locked
+			return nil
+		}); err != nil {
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, locked)
+
+	case http.MethodDelete:
+		if _, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			s.LockedRates = nil
+			return nil
+		}); err != nil {
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 鎖定匯率測試
+// ==========================================
+func TestRatesLockAPI(t *testing.T) {
+	withRoomState(t, newGlobalState())
+	useRateFetcher(t, failingFetcher{})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/rates/lock", handleRatesLock)
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	// 沒有網路也沒有快取時無法鎖定
+	if rec := do(http.MethodPost, "/api/rates/lock"); rec.Code != http.StatusBadGateway {
+		t.Errorf("got %d, want 502", rec.Code)
+	}
+
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.03}})
+	rec := do(http.MethodPost, "/api/rates/lock")
+	var locked LockedRates
+	if err := json.Unmarshal(rec.Body.Bytes(), &locked); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("鎖定失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if locked.Date != "2026-05-01" || locked.Rates["usd"] != 0.03 {
+		t.Errorf("got %+v", locked)
+	}
+
+	// 之後匯率變了，用鎖定的匯率計算結果不變
+	rateCache.Set("twd", rateEntry{Date: "2026-05-08", FetchedAt: time.Now(), Rates: map[string]float64{"twd": 1, "usd": 0.025}})
+	state, _ := currentState()
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 300, Currency: "USD"}}
+	converted, rates, date, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{Locked: state.LockedRates})
+	if err != nil || converted[0].AmountBase != 10000 || date != "2026-05-01" || rates[0].Source != rateSourceLocked {
+		t.Errorf("got %v %q %+v %v", converted, date, rates, err)
+	}
+
+	// 本位幣改成 USD 時以交叉匯率換算
+	converted, _, _, err = convertBillsWithRates(context.Background(), "USD", []Bill{{ID: 1, Amount: 3000, Currency: "TWD"}}, conversionOptions{Locked: state.LockedRates})
+	if err != nil || converted[0].AmountBase != 90 {
+		t.Errorf("交叉匯率錯誤, got %v %v", converted, err)
+	}
+
+	// refresh 一定重新抓取，抓不到時維持原本鎖定的匯率
+	if rec := do(http.MethodPost, "/api/rates/lock?refresh=1"); rec.Code != http.StatusBadGateway {
+		t.Errorf("got %d, want 502", rec.Code)
+	}
+	if state, _ := currentState(); state.LockedRates == nil || state.LockedRates.Date != "2026-05-01" {
+		t.Errorf("更新失敗時應保留原本的鎖定, got %+v", state.LockedRates)
+	}
+
+	if rec := do(http.MethodDelete, "/api/rates/lock"); rec.Code != http.StatusNoContent {
+		t.Errorf("解除鎖定 got %d", rec.Code)
+	}
+	if state, _ := currentState(); state.LockedRates != nil {
+		t.Errorf("應已解除鎖定, got %+v", state.LockedRates)
+	}
+	if rec := do(http.MethodGet, "/api/rates/lock"); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d", rec.Code)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ================= 伺服器模式：預先更新匯率 =================
+
+// rateWarmWindow 最近多久內計算用過的本位幣，會在背景持續更新匯率
+var rateWarmWindow = 24 * time.Hour
+
+// baseTracker 記錄每個本位幣最後一次需要抓取匯率的時間
+type baseTracker struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+var recentBases = &baseTracker{seen: make(map[string]time.Time)}
+
+func (bt *baseTracker) touch(base string, now time.Time) {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	bt.seen[base] = now
+}
+
+// recent 回傳 window 內用過的本位幣（排序過），順便清掉太久沒用的
+func (bt *baseTracker) recent(now time.Time, window time.Duration) []string {
+	bt.mu.Lock()
+	defer bt.mu.Unlock()
+	for base, at := range bt.seen {
+		if now.Sub(at) > window {
+			delete(bt.seen, base)
+		}
+	}
+	return slices.Sorted(maps.Keys(bt.seen))
+}
+
+// prefetchRates 最近用過的本位幣若沒有快取、或快取會在下一輪（interval）之前過期，就先在背景更新，
+// 使用者計算時不必等待抓取。回傳這一輪更新了哪些本位幣
+func prefetchRates(now time.Time, interval time.Duration) []string {
+	var refreshed []string
+	for _, base := range recentBases.recent(now, rateWarmWindow) {
+		if e, ok := rateCache.Get(base); ok && e.fresh(now.Add(interval)) {
+			continue
+		}
+		rateRefresh.refresh(base)
+		refreshed = append(refreshed, base)
+	}
+	return refreshed
+}
+
+// runRatePrefetchLoop 伺服器模式下每 interval 檢查一次最近用過的本位幣
+func runRatePrefetchLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		prefetchRates(clock.Now(), interval)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 預先更新匯率測試
+// ==========================================
+func TestPrefetchRates(t *testing.T) {
+	fetcher := &countingFetcher{}
+	useRateFetcher(t, fetcher)
+	oldBases := recentBases
+	recentBases = &baseTracker{seen: make(map[string]time.Time)}
+	t.Cleanup(func() { recentBases = oldBases })
+
+	now := time.Now()
+	interval := rateCacheTTL / 3
+	recentBases.touch("twd", now.Add(-time.Hour))
+	recentBases.touch("jpy", now.Add(-time.Hour))
+	recentBases.touch("usd", now.Add(-2*rateWarmWindow))
+	// TWD 快取剛抓不久；JPY 快取會在下一輪前過期；USD 太久沒用
+	rateCache.Set("twd", rateEntry{FetchedAt: now.Add(-time.Minute)})
+	rateCache.Set("jpy", rateEntry{FetchedAt: now.Add(-rateCacheTTL + interval/2)})
+
+	refreshed := prefetchRates(now, interval)
+	rateRefresh.wg.Wait()
+	if !slices.Equal(refreshed, []string{"jpy"}) || fetcher.calls != 1 {
+		t.Errorf("refreshed = %v, calls = %d, want [jpy] once", refreshed, fetcher.calls)
+	}
+	if e, _ := rateCache.Get("jpy"); e.Date != "2026-05-01" {
+		t.Errorf("JPY 應已更新, got %+v", e)
+	}
+	if got := recentBases.recent(now, rateWarmWindow); !slices.Equal(got, []string{"jpy", "twd"}) {
+		t.Errorf("太久沒用的本位幣應移除, got %v", got)
+	}
+
+	// 計算需要抓匯率時記錄本位幣
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD"}}
+	if _, _, err := convertBillsToBase(t.Context(), "EUR", bills); err != nil {
+		t.Fatal(err)
+	}
+	if got := recentBases.recent(time.Now(), rateWarmWindow); !slices.Contains(got, "eur") {
+		t.Errorf("應記錄 EUR, got %v", got)
+	}
+}
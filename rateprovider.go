@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ================= 匯率來源設定 =================
+
+const (
+	providerCurrencyAPI = "currency-api"
+	providerFrankfurter = "frankfurter"
+)
+
+// rateProvider 可以用 -rate-provider 選擇的匯率來源；defaultURL 為沒有指定 -rate-url 時的網址
+type rateProvider struct {
+	defaultURL string
+	newFetcher func(url string) RateFetcher
+}
+
+var rateProviders = map[string]rateProvider{
+	// currency-api 網址中的 %s 代入小寫的本位幣，@latest 換成日期即為歷史匯率
+	providerCurrencyAPI: {
+		defaultURL: exchangeAPIBase,
+		newFetcher: func(url string) RateFetcher { return NewHTTPRateFetcher(url) },
+	},
+	// frankfurter（歐洲央行資料，幣別較少）網址為 API 根目錄，也可以指向自架的實例
+	providerFrankfurter: {
+		defaultURL: "https://api.frankfurter.app",
+		newFetcher: func(url string) RateFetcher { return NewFrankfurterFetcher(url) },
+	},
+}
+
+// rateProviderName 目前使用的匯率來源名稱
+var rateProviderName = providerCurrencyAPI
+
+// newRateFetcher 依 -rate-provider 與 -rate-url 建立 fetcher；rawURL 留空時使用來源的預設網址
+func newRateFetcher(provider, rawURL string) (RateFetcher, error) {
+	p, ok := rateProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("未知的匯率來源 %q（可用：%s）", provider, strings.Join(slices.Sorted(maps.Keys(rateProviders)), "、"))
+	}
+	if rawURL == "" {
+		rawURL = p.defaultURL
+	}
+	u, err := url.Parse(strings.ReplaceAll(rawURL, "%s", "twd"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("匯率 API 網址 %q 格式錯誤", rawURL)
+	}
+	if provider == providerCurrencyAPI && strings.Count(rawURL, "%s") != 1 {
+		return nil, fmt.Errorf("%s 的網址需要有一個 %%s 代入本位幣", provider)
+	}
+	return p.newFetcher(rawURL), nil
+}
+
+// RateConfig 命令列的匯率設定；Mode 不為空時（例如 "static:rates.json"）取代 Provider 與 URL
+type RateConfig struct {
+	Mode     string
+	Provider string
+	URL      string
+	TTL      time.Duration
+}
+
+// configureRates 套用命令列的匯率設定
+func configureRates(cfg RateConfig) error {
+	if cfg.TTL <= 0 {
+		return errors.New("-rate-ttl 必須大於 0")
+	}
+	var fetcher RateFetcher
+	var err error
+	provider := cfg.Provider
+	if cfg.Mode != "" {
+		fetcher, provider, err = rateFetcherForMode(cfg.Mode)
+	} else {
+		fetcher, err = newRateFetcher(cfg.Provider, cfg.URL)
+	}
+	if err != nil {
+		return err
+	}
+	rateFetcher = fetcher
+	rateProviderName = provider
+	rateCacheTTL = cfg.TTL
+	return nil
+}
+
+// ================= Frankfurter =================
+
+// FrankfurterFetcher 向 Frankfurter API 取得匯率：GET {baseURL}/latest?from=TWD 或 /YYYY-MM-DD?from=TWD
+type FrankfurterFetcher struct {
+	baseURL string
+	client  *http.Client
+}
+
+func NewFrankfurterFetcher(baseURL string) *FrankfurterFetcher {
+	return &FrankfurterFetcher{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (f *FrankfurterFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	return f.get(ctx, base, "latest")
+}
+
+func (f *FrankfurterFetcher) FetchDate(ctx context.Context, base, date string) (rateEntry, error) {
+	return f.get(ctx, base, date)
+}
+
+func (f *FrankfurterFetcher) get(ctx context.Context, base, path string) (rateEntry, error) {
+	urlStr := f.baseURL + "/" + path + "?from=" + url.QueryEscape(strings.ToUpper(base))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlStr, nil)
+	if err != nil {
+		return rateEntry{}, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return rateEntry{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return rateEntry{}, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return rateEntry{}, err
+	}
+	return parseFrankfurterResponse(base, body)
+}
+
+// parseFrankfurterResponse 轉成與 currency-api 相同的格式（幣別小寫、本位幣為 1）
+func parseFrankfurterResponse(base string, data []byte) (rateEntry, error) {
+	var raw struct {
+		Date  string             `json:"date"`
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return rateEntry{}, err
+	}
+	if len(raw.Rates) == 0 {
+		return rateEntry{}, errors.New("無匯率資料")
+	}
+	rates := make(map[string]float64, len(raw.Rates)+1)
+	for cur, rate := range raw.Rates {
+		rates[strings.ToLower(cur)] = rate
+	}
+	warnings := dropInvalidRates(rates)
+	rates[strings.ToLower(base)] = 1
+	return rateEntry{Rates: rates, Date: raw.Date, FetchedAt: clock.Now(), Warnings: warnings}, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 匯率來源設定測試
+// ==========================================
+func TestNewRateFetcher(t *testing.T) {
+	tests := []struct {
+		provider, url string
+		ok            bool
+	}{
+		{providerCurrencyAPI, "", true},
+		{providerCurrencyAPI, "https://mirror.example.com/rates/%s.json", true},
+		{providerCurrencyAPI, "https://mirror.example.com/rates/twd.json", false}, // 沒有 %s
+		{providerFrankfurter, "", true},
+		{providerFrankfurter, "http://10.0.0.5:8080", true},
+		{providerFrankfurter, "ftp://mirror.example.com", false},
+		{"yahoo", "", false},
+	}
+	for _, tt := range tests {
+		_, err := newRateFetcher(tt.provider, tt.url)
+		if (err == nil) != tt.ok {
+			t.Errorf("newRateFetcher(%q, %q) err = %v, want ok = %v", tt.provider, tt.url, err, tt.ok)
+		}
+	}
+}
+
+func TestConfigureRates(t *testing.T) {
+	oldFetcher, oldName, oldTTL := rateFetcher, rateProviderName, rateCacheTTL
+	t.Cleanup(func() { rateFetcher, rateProviderName, rateCacheTTL = oldFetcher, oldName, oldTTL })
+
+	if err := configureRates(RateConfig{Provider: providerFrankfurter}); err == nil {
+		t.Error("TTL 為 0 應該失敗")
+	}
+	if err := configureRates(RateConfig{Provider: providerFrankfurter, URL: "https://rates.example.com/", TTL: 5 * time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	f, ok := rateFetcher.(*FrankfurterFetcher)
+	if !ok || f.baseURL != "https://rates.example.com" {
+		t.Errorf("rateFetcher = %#v", rateFetcher)
+	}
+	if rateProviderName != providerFrankfurter || rateCacheTTL != 5*time.Minute {
+		t.Errorf("provider = %s, ttl = %v", rateProviderName, rateCacheTTL)
+	}
+}
+
+// ==========================================
+// Frankfurter 測試
+// ==========================================
+func TestFrankfurterFetcher(t *testing.T) {
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.RequestURI())
+		w.Write([]byte(`{"amount":1.0,"base":"EUR","date":"2026-05-01","rates":{"USD":1.1,"JPY":160.5}}`))
+	}))
+	defer srv.Close()
+
+	f := NewFrankfurterFetcher(srv.URL)
+	entry, err := f.Fetch(context.Background(), "eur")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Rates["usd"] != 1.1 || entry.Rates["jpy"] != 160.5 || entry.Rates["eur"] != 1 || entry.Date != "2026-05-01" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if _, err := f.FetchDate(context.Background(), "eur", "2026-04-01"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/latest?from=EUR", "/2026-04-01?from=EUR"}
+	if len(paths) != 2 || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("paths = %v, want %v", paths, want)
+	}
+}
+
+func TestParseFrankfurterResponse_Empty(t *testing.T) {
+	if _, err := parseFrankfurterResponse("twd", []byte(`{"message":"not found"}`)); err == nil {
+		t.Error("沒有匯率應該失敗")
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowFetcher 等到 release 關閉才回傳，並記錄被呼叫的次數
+type slowFetcher struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (f *slowFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	f.calls.Add(1)
+	<-f.release
+	return rateEntry{Rates: map[string]float64{"usd": 0.025}, Date: "2026-05-08"}, nil
+}
+
+// ==========================================
+// 背景更新匯率測試
+// ==========================================
+func TestConvertBillsToBase_StaleWhileRevalidate(t *testing.T) {
+	fetcher := &slowFetcher{release: make(chan struct{})}
+	useRateFetcher(t, fetcher)
+
+	stale := time.Now().Add(-2 * rateCacheTTL)
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: stale, Rates: map[string]float64{"usd": 0.03}})
+	bills := []Bill{{ID: 1, Title: "Hotel", Amount: 300, Currency: "USD"}}
+
+	// 過期的快取立即回傳，不等背景更新；同時多次計算只會更新一次
+	for range 5 {
+		converted, date, err := convertBillsToBase(context.Background(), "TWD", bills)
+		if err != nil || converted[0].AmountBase != 10000 || date != "2026-05-01" {
+			t.Fatalf("應先用舊的匯率, got %v %q %v", converted, date, err)
+		}
+	}
+	close(fetcher.release)
+	rateRefresh.wg.Wait()
+	if n := fetcher.calls.Load(); n != 1 {
+		t.Errorf("Fetch 被呼叫 %d 次, want 1", n)
+	}
+
+	converted, date, err := convertBillsToBase(context.Background(), "TWD", bills)
+	if err != nil || converted[0].AmountBase != 12000 || date != "2026-05-08" {
+		t.Errorf("背景更新後應使用新匯率, got %v %q %v", converted, date, err)
+	}
+}
+
+// blockingFetcher 一直等到 ctx 取消
+type blockingFetcher struct{}
+
+func (blockingFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	<-ctx.Done()
+	return rateEntry{}, ctx.Err()
+}
+
+func TestConvertBillsToBase_Canceled(t *testing.T) {
+	useRateFetcher(t, blockingFetcher{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	resp := runCalculate(ctx, CalculateRequest{
+		BaseCurrency: "TWD",
+		People:       []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}},
+		Bills:        []Bill{{ID: 1, Title: "Hotel", Amount: 300, Currency: "USD", PaidBy: 1, Participants: []int{1, 2}}},
+	})
+	// 客戶端斷線後不再等匯率，也不改用離線匯率
+	if resp.Error == "" || resp.RateNotice != "" {
+		t.Errorf("取消後應回傳錯誤, got %+v", resp)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("取消後應立即結束, took %v", elapsed)
+	}
+}
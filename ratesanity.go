@@ -0,0 +1,114 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strings"
+)
+
+// ================= 匯率資料檢查 =================
+
+// maxRateChange 與上次抓到的匯率相比，變動超過這個倍數就視為資料錯誤
+const maxRateChange = 1e6
+
+const (
+	rateRejectInvalid = "invalid" // 0、負數、NaN 或無限大
+	rateRejectAbsurd  = "absurd"  // 與上次相比變動超過 maxRateChange 倍
+)
+
+// RateWarning 匯率來源給了不合理的匯率而被捨棄；有上次的匯率時改用 Previous
+type RateWarning struct {
+	Currency string  `json:"currency"`
+	Value    float64 `json:"value"`
+	Previous float64 `json:"previous,omitempty"`
+	Reason   string  `json:"reason"`
+	Message  string  `json:"message"`
+}
+
+func newRateWarning(cur string, value, previous float64, reason string) RateWarning {
+	var msg string
+	if reason == rateRejectAbsurd {
+		msg = fmt.Sprintf("匯率來源的 %s 匯率 %g 與上次的 %g 差距過大，已捨棄", strings.ToUpper(cur), value, previous)
+	} else {
+		msg = fmt.Sprintf("匯率來源的 %s 匯率 %g 無效，已捨棄", strings.ToUpper(cur), value)
+	}
+	if previous > 0 {
+		msg += "，改用上次的匯率"
+	}
+	return RateWarning{Currency: strings.ToUpper(cur), Value: value, Previous: previous, Reason: reason, Message: msg}
+}
+
+func validRate(v float64) bool {
+	return v > 0 && !math.IsInf(v, 0)
+}
+
+// dropInvalidRates 從剛解析的匯率中移除 0、負數、NaN 與無限大，回傳被移除的項目
+func dropInvalidRates(rates map[string]float64) []RateWarning {
+	var warnings []RateWarning
+	for cur, v := range rates {
+		if !validRate(v) {
+			delete(rates, cur)
+			warnings = append(warnings, newRateWarning(cur, v, 0, rateRejectInvalid))
+		}
+	}
+	sortRateWarnings(warnings)
+	return warnings
+}
+
+// sanitizeRates 與快取中上次的匯率比較：變動超過 maxRateChange 倍的幣別捨棄，
+// 被捨棄（包含解析時已移除）的幣別有上次的匯率時沿用
+func sanitizeRates(entry rateEntry, prev rateEntry, hasPrev bool) rateEntry {
+	if !hasPrev {
+		return entry
+	}
+	// 304 時的匯率與快取共用同一份 map，改動前先複製
+	entry.Rates, entry.Warnings = maps.Clone(entry.Rates), slices.Clone(entry.Warnings)
+	for cur, v := range entry.Rates {
+		old := prev.Rates[cur]
+		if !validRate(old) {
+			continue
+		}
+		if ratio := v / old; ratio > maxRateChange || ratio < 1/maxRateChange {
+			entry.Rates[cur] = old
+			entry.Warnings = append(entry.Warnings, newRateWarning(cur, v, old, rateRejectAbsurd))
+		}
+	}
+	for i, w := range entry.Warnings {
+		cur := strings.ToLower(w.Currency)
+		if _, ok := entry.Rates[cur]; ok || !validRate(prev.Rates[cur]) {
+			continue
+		}
+		entry.Rates[cur] = prev.Rates[cur]
+		entry.Warnings[i] = newRateWarning(cur, w.Value, prev.Rates[cur], w.Reason)
+	}
+	sortRateWarnings(entry.Warnings)
+	return entry
+}
+
+func sortRateWarnings(warnings []RateWarning) {
+	slices.SortFunc(warnings, func(a, b RateWarning) int { return cmp.Compare(a.Currency, b.Currency) })
+}
+
+// rateWarningFor 這組匯率中 cur 被捨棄時的提醒
+func (e rateEntry) rateWarningFor(cur string) (RateWarning, bool) {
+	i := slices.IndexFunc(e.Warnings, func(w RateWarning) bool { return strings.EqualFold(w.Currency, cur) })
+	if i < 0 {
+		return RateWarning{}, false
+	}
+	return e.Warnings[i], true
+}
+
+// collectRateWarnings 換算時實際用到、資料不合理的匯率，每個幣別只列一次
+func collectRateWarnings(rates []billRate) []RateWarning {
+	var warnings []RateWarning
+	for _, r := range rates {
+		if r.Warning != nil && !slices.ContainsFunc(warnings, func(w RateWarning) bool { return w.Currency == r.Warning.Currency }) {
+			warnings = append(warnings, *r.Warning)
+		}
+	}
+	sortRateWarnings(warnings)
+	return warnings
+}
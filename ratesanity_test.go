@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sequenceFetcher 依序回傳 entries 中的匯率
+type sequenceFetcher struct {
+	entries []map[string]float64
+	calls   int
+}
+
+func (f *sequenceFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	rates := map[string]float64{}
+	for cur, v := range f.entries[min(f.calls, len(f.entries)-1)] {
+		rates[cur] = v
+	}
+	f.calls++
+	warnings := dropInvalidRates(rates)
+	rates[base] = 1
+	return rateEntry{Rates: rates, Date: "2026-05-01", Warnings: warnings}, nil
+}
+
+// ==========================================
+// 匯率資料檢查測試
+// ==========================================
+func TestParseRateResponse_RejectsInvalidRates(t *testing.T) {
+	entry, err := parseRateResponse("twd", []byte(`{"date":"2026-05-01","twd":{"usd":0.031,"jpy":0,"krw":-40,"eur":null}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entry.Rates) != 2 || entry.Rates["usd"] != 0.031 {
+		t.Errorf("rates = %v, want only usd and twd", entry.Rates)
+	}
+	var got []string
+	for _, w := range entry.Warnings {
+		got = append(got, w.Currency+":"+w.Reason)
+	}
+	if strings.Join(got, ",") != "EUR:invalid,JPY:invalid,KRW:invalid" {
+		t.Errorf("warnings = %v", got)
+	}
+}
+
+func TestFetchRates_FallsBackToPreviousRate(t *testing.T) {
+	fetcher := &sequenceFetcher{entries: []map[string]float64{
+		{"usd": 0.03, "jpy": 5, "krw": 42},
+		// JPY 變成 0、USD 暴增一千萬倍；KRW 正常
+		{"usd": 300000, "jpy": 0, "krw": 43},
+	}}
+	useRateFetcher(t, fetcher)
+	if _, err := fetchRates(context.Background(), "twd"); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := fetchRates(context.Background(), "twd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Rates["usd"] != 0.03 || entry.Rates["jpy"] != 5 || entry.Rates["krw"] != 43 {
+		t.Errorf("rates = %v, want usd/jpy from previous fetch", entry.Rates)
+	}
+	if len(entry.Warnings) != 2 || entry.Warnings[0].Reason != rateRejectInvalid || entry.Warnings[0].Previous != 5 ||
+		entry.Warnings[1].Reason != rateRejectAbsurd || entry.Warnings[1].Previous != 0.03 {
+		t.Errorf("warnings = %+v", entry.Warnings)
+	}
+
+	// 計算結果附上實際用到的幣別的提醒
+	stale, _ := rateCache.Get("twd")
+	stale.FetchedAt = time.Now()
+	rateCache.Set("twd", stale)
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{{ID: 1, Title: "Ramen", Amount: 1000, Currency: "JPY", PaidBy: 1, Participants: []int{1, 2}}}
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills})
+	if resp.Error != "" || len(resp.RateWarnings) != 1 || resp.RateWarnings[0].Currency != "JPY" || resp.Bills[0].AmountBase != 200 {
+		t.Errorf("resp = %+v", resp)
+	}
+	if got := rateCacheReport(time.Now()).Entries[0].Warnings; len(got) != 2 {
+		t.Errorf("cache warnings = %+v", got)
+	}
+}
+
+func TestConvertBillsWithRates_RejectedWithoutPrevious(t *testing.T) {
+	useRateFetcher(t, &sequenceFetcher{entries: []map[string]float64{{"usd": 0.03, "jpy": -5}}})
+	rateCache.Set("usd", rateEntry{FetchedAt: time.Now(), Rates: map[string]float64{"usd": 1, "twd": 33}})
+	bills := []Bill{{ID: 1, Title: "Ramen", Amount: 1000, Currency: "JPY"}}
+	_, _, _, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{})
+	if err == nil || !strings.Contains(err.Error(), "無效") {
+		t.Errorf("err = %v, want 缺少幣別 with the rejected rate", err)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+// ================= 自訂匯率表 =================
+
+// rateDateManual 全部外幣帳單都用自訂匯率表換算時回應的 rateDate
+const rateDateManual = "manual"
+
+// RateTable 團體約定的匯率（「這趟旅行就算 1 USD = 32 TWD」）：1 單位 Rates 的幣別 = 多少 Base。
+// 優先於抓取的匯率，但帳單上的手動匯率仍最優先；本位幣改變時若表中有新本位幣，以交叉匯率換算
+type RateTable struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+var errInvalidRateTable = errors.New("invalid rate table")
+
+// rate 1 單位 currency 換成多少 base；表中查不到時回傳 false
+func (t *RateTable) rate(currency, base string) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	inTable := func(cur string) (float64, bool) {
+		cur = strings.ToUpper(cur)
+		if cur == t.Base {
+			return 1, true
+		}
+		r, ok := t.Rates[cur]
+		return r, ok && r > 0
+	}
+	from, ok := inTable(currency)
+	if !ok {
+		return 0, false
+	}
+	to, ok := inTable(base)
+	if !ok {
+		return 0, false
+	}
+	return from / to, true
+}
+
+// normalizeRateTable 幣別轉成大寫並檢查匯率；Base 未填時為 base。回傳 nil 代表清除
+func normalizeRateTable(t RateTable, base string) (*RateTable, error) {
+	if len(t.Rates) == 0 {
+		return nil, nil
+	}
+	out := &RateTable{Base: strings.ToUpper(strings.TrimSpace(t.Base)), Rates: make(map[string]float64, len(t.Rates))}
+	if out.Base == "" {
+		out.Base = base
+	}
+	for cur, rate := range t.Rates {
+		cur = strings.ToUpper(strings.TrimSpace(cur))
+		if len(cur) != 3 {
+			return nil, fmt.Errorf("幣別代碼 %q 格式錯誤", cur)
+		}
+		if cur == out.Base {
+			return nil, fmt.Errorf("不需要設定本位幣 %s 的匯率", cur)
+		}
+		if !(rate > 0) || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("%s 的匯率 %v 無效", cur, rate)
+		}
+		out.Rates[cur] = rate
+	}
+	return out, nil
+}
+
+// handleRates GET 查看、PUT 設定 /api/rates 的自訂匯率表；PUT 空的 rates 代表清除
+func handleRates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			log.Printf("load state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, rateTableOrEmpty(state.RateTable))
+
+	case http.MethodPut:
+		var t RateTable
+		body, err := readBody(w, r)
+		if err != nil {
+			return
+		}
+		if err := decodeJSON(body, &t); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+		var table *RateTable
+		_, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			normalized, err := normalizeRateTable(t, stateBase(*s))
+			if err != nil {
+				return fmt.Errorf("%w: %v", errInvalidRateTable, err)
+			}
+			table = normalized
+			s.RateTable = normalized
+			return nil
+		})
+		switch {
+		case err == nil:
+		case errors.Is(err, errInvalidRateTable):
+			writeErrorFor(w, http.StatusBadRequest, err)
+			return
+		default:
+			log.Printf("update state failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, rateTableOrEmpty(table))
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+func rateTableOrEmpty(t *RateTable) RateTable {
+	if t == nil {
+		return RateTable{Rates: map[string]float64{}}
+	}
+	return *t
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 自訂匯率表測試
+// ==========================================
+func TestConvertBillsToBase_RateTable(t *testing.T) {
+	oldCache := rateCache
+	rateCache = NewRateCache()
+	rateCache.Set("twd", rateEntry{Date: "2026-05-01", FetchedAt: time.Now(), Rates: map[string]float64{"usd": 0.03, "jpy": 5}})
+	t.Cleanup(func() { rateCache = oldCache })
+
+	table := &RateTable{Base: "TWD", Rates: map[string]float64{"USD": 32}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Amount: 100, Currency: "USD"},
+		{ID: 2, Title: "Card", Amount: 100, Currency: "USD", ManualRate: 31},
+	}
+	converted, rates, date, err := convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{Table: table})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if converted[0].AmountBase != 3200 || converted[1].AmountBase != 3100 {
+		t.Errorf("自訂匯率應優先於抓取的匯率、帳單手動匯率最優先, got %v %v", converted[0].AmountBase, converted[1].AmountBase)
+	}
+	if date != rateDateManual || rates[0].Source != rateSourceManual {
+		t.Errorf("date = %q, source = %q, want manual", date, rates[0].Source)
+	}
+
+	// 表中沒有的幣別仍用抓取的匯率，rateDate 為抓取的日期
+	bills = append(bills, Bill{ID: 3, Title: "Ramen", Amount: 1000, Currency: "JPY"})
+	converted, _, date, err = convertBillsWithRates(context.Background(), "TWD", bills, conversionOptions{Table: table})
+	if err != nil || converted[2].AmountBase != 200 || date != "2026-05-01" {
+		t.Errorf("got %v, %q, %v", converted[2].AmountBase, date, err)
+	}
+
+	// 本位幣改成 USD：表中有 USD，以交叉匯率換算
+	if rate, ok := table.rate("TWD", "USD"); !ok || rate != 1.0/32 {
+		t.Errorf("交叉匯率 = %v, %v", rate, ok)
+	}
+	if _, ok := table.rate("JPY", "TWD"); ok {
+		t.Error("表中沒有的幣別不應有匯率")
+	}
+}
+
+func TestRatesAPI(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/rates", handleRates)
+	do := func(method, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, "/api/rates", strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPut, `{"rates":{"usd":32}}`)
+	var got RateTable
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("設定失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if got.Base != "TWD" || got.Rates["USD"] != 32 {
+		t.Errorf("got %+v", got)
+	}
+	state, _ := currentState()
+	if state.RateTable == nil || state.RateTable.Rates["USD"] != 32 {
+		t.Errorf("應存進狀態, got %+v", state.RateTable)
+	}
+
+	for _, body := range []string{`{"rates":{"USD":-1}}`, `{"rates":{"TWD":1}}`, `{"rates":{"DOLLAR":32}}`, `{`} {
+		if rec := do(http.MethodPut, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s 應回傳 400, got %d", body, rec.Code)
+		}
+	}
+
+	if rec := do(http.MethodPut, `{"rates":{}}`); rec.Code != http.StatusOK {
+		t.Errorf("清除失敗: %d", rec.Code)
+	}
+	rec = do(http.MethodGet, "")
+	if rec.Code != http.StatusOK || strings.TrimSpace(rec.Body.String()) != `{"base":"","rates":{}}` {
+		t.Errorf("清除後應為空, got %s", rec.Body.String())
+	}
+	if rec := do(http.MethodDelete, ""); rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("got %d", rec.Code)
+	}
+}
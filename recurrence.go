@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// ================= 週期性帳單 =================
+
+const (
+	recurDaily   = "daily"
+	recurWeekly  = "weekly"
+	recurMonthly = "monthly"
+	recurYearly  = "yearly"
+)
+
+// maxRecurrenceCatchUp 伺服器停機很久時，單次最多補產生的期數，避免設錯規則塞爆帳單
+const maxRecurrenceCatchUp = 366
+
+// Recurrence 週期規則：以帳單的 Date 為第一期，每 Interval 個 Frequency 產生一筆
+type Recurrence struct {
+	Frequency string `json:"frequency"`
+	Interval  int    `json:"interval,omitempty"` // 0 視為 1
+	Until     string `json:"until,omitempty"`    // 最後可產生的日期 YYYY-MM-DD，空的代表不結束
+}
+
+func validateRecurrence(bill Bill) error {
+	r := bill.Recurrence
+	if bill.Date == "" {
+		return fmt.Errorf("週期帳單「%s」需要設定第一期的日期", bill.Title)
+	}
+	switch r.Frequency {
+	case recurDaily, recurWeekly, recurMonthly, recurYearly:
+	default:
+		return fmt.Errorf("週期帳單「%s」的頻率 %q 不支援", bill.Title, r.Frequency)
+	}
+	if r.Interval < 0 {
+		return fmt.Errorf("週期帳單「%s」的間隔不可為負數", bill.Title)
+	}
+	if r.Until != "" {
+		if _, err := time.Parse(billDateLayout, r.Until); err != nil {
+			return fmt.Errorf("週期帳單「%s」的結束日期 %q 格式錯誤，請使用 YYYY-MM-DD", bill.Title, r.Until)
+		}
+	}
+	return nil
+}
+
+// occurrence 第 n 期的日期（第 0 期為 start）。
+// 每月/每年一律從 start 推算並夾到月底，1/31 的下一期是 2/28 而不是 3/3，之後仍回到 31 日
+func (r Recurrence) occurrence(start time.Time, n int) time.Time {
+	step := r.Interval
+	if step <= 0 {
+		step = 1
+	}
+	switch r.Frequency {
+	case recurDaily:
+		return start.AddDate(0, 0, n*step)
+	case recurWeekly:
+		return start.AddDate(0, 0, 7*n*step)
+	case recurYearly:
+		return addMonthsClamped(start, 12*n*step)
+	default:
+		return addMonthsClamped(start, n*step)
+	}
+}
+
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month()+time.Month(months), 1, 0, 0, 0, 0, time.UTC)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, time.UTC)
+}
+
+// materializeRecurringBills 為到 today 為止尚未產生的期數新增帳單，回傳新增筆數。
+// 已產生的期數以 RecurrenceOf 判斷（垃圾桶裡的也算），刪掉某一期不會被重新補回
+func materializeRecurringBills(s *GlobalState, today time.Time) int {
+	todayStr := today.Format(billDateLayout)
+	generated := make(map[int]map[string]bool)
+	nextID := 0
+	for _, b := range s.Bills {
+		if b.ID > nextID {
+			nextID = b.ID
+		}
+		if b.RecurrenceOf != 0 {
+			if generated[b.RecurrenceOf] == nil {
+				generated[b.RecurrenceOf] = make(map[string]bool)
+			}
+			generated[b.RecurrenceOf][b.Date] = true
+		}
+	}
+	nextID++
+
+	added := 0
+	for _, src := range s.Bills {
+		if src.Recurrence == nil || src.DeletedAt != 0 || validateRecurrence(src) != nil {
+			continue
+		}
+		start, _ := time.Parse(billDateLayout, src.Date)
+		for n := 1; n <= maxRecurrenceCatchUp; n++ {
+			date := src.Recurrence.occurrence(start, n).Format(billDateLayout)
+			if date > todayStr || (src.Recurrence.Until != "" && date > src.Recurrence.Until) {
+				break
+			}
+			if generated[src.ID][date] {
+				continue
+			}
+			s.Bills = append(s.Bills, recurrenceInstance(src, nextID, date))
+			nextID++
+			added++
+		}
+	}
+	return added
+}
+
+// recurrenceInstance 複製來源帳單成為某一期；附件與留言屬於原始那一筆，不跟著複製
+func recurrenceInstance(src Bill, id int, date string) Bill {
+	inst := cloneBill(src)
+	inst.ID = id
+	inst.Date = date
+	inst.Recurrence = nil
+	inst.RecurrenceOf = src.ID
+	inst.Attachments = nil
+	inst.Comments = nil
+	inst.AmountBase = 0
+	return inst
+}
+
+// cloneBill 深拷貝帳單，避免新產生的期數與來源共用 slice/map
+func cloneBill(b Bill) Bill {
+	s := cloneState(GlobalState{Bills: []Bill{b}})
+	return s.Bills[0]
+}
+
+// runRecurrenceLoop 伺服器模式下定期補產生週期帳單；沒有新期數時不寫入狀態
+func runRecurrenceLoop(interval time.Duration) {
+	materialize := func(rm *room) {
+		state, err := rm.currentState()
+		if err != nil {
+			log.Printf("recurrence: load state failed: %v", err)
+			return
+		}
+		if state.ArchivedAt != 0 {
+			return
+		}
+		// 先在副本上試算，沒有新期數就不寫入
+		probe := cloneState(state)
+		if materializeRecurringBills(&probe, clock.Now()) == 0 {
+			return
+		}
+		var added int
+		if _, err := rm.updateStateAs(systemActor, func(s *GlobalState) error {
+			added = materializeRecurringBills(s, clock.Now())
+			return nil
+		}); err != nil {
+			log.Printf("recurrence: update state failed: %v", err)
+			return
+		}
+		log.Printf("recurrence: added %d bill(s)", added)
+	}
+
+	materializeAll := func() {
+		for _, rm := range serverRooms.all() {
+			materialize(rm)
+		}
+	}
+	materializeAll()
+	for range time.Tick(interval) {
+		materializeAll()
+	}
+}
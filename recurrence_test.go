@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 週期帳單產生測試
+// ==========================================
+func TestMaterializeRecurringBills(t *testing.T) {
+	state := newGlobalState()
+	state.Bills = []Bill{
+		{ID: 1, Title: "Rent", Date: "2025-01-31", Amount: 20000, PaidBy: 1, Participants: []int{1, 2},
+			Recurrence: &Recurrence{Frequency: recurMonthly}},
+		{ID: 2, Title: "Cleaning", Date: "2025-03-01", Amount: 800, PaidBy: 2, Participants: []int{1, 2},
+			Recurrence: &Recurrence{Frequency: recurWeekly, Interval: 2, Until: "2025-03-20"}},
+	}
+	today := time.Date(2025, 4, 30, 12, 0, 0, 0, time.Local)
+
+	if n := materializeRecurringBills(&state, today); n != 4 {
+		t.Fatalf("應新增 4 筆 (房租 3 期 + 打掃 1 期), got %d: %+v", n, state.Bills)
+	}
+	var rentDates []string
+	for _, b := range state.Bills {
+		if b.RecurrenceOf == 1 {
+			rentDates = append(rentDates, b.Date)
+			if b.Recurrence != nil || b.Amount != 20000 {
+				t.Errorf("產生的帳單內容不正確: %+v", b)
+			}
+		}
+	}
+	want := []string{"2025-02-28", "2025-03-31", "2025-04-30"}
+	if len(rentDates) != len(want) {
+		t.Fatalf("房租期數錯誤: %v", rentDates)
+	}
+	for i := range want {
+		if rentDates[i] != want[i] {
+			t.Errorf("第 %d 期日期 got %s, want %s（月底應夾住而非溢位）", i+1, rentDates[i], want[i])
+		}
+	}
+
+	// 刪除某一期（進垃圾桶）後不應被重新補回，再跑一次也不應重複產生
+	state.Bills[2].DeletedAt = today.UnixMilli()
+	if n := materializeRecurringBills(&state, today); n != 0 {
+		t.Errorf("重跑不應再新增, got %d", n)
+	}
+
+	if err := validateSplits([]Bill{{Title: "X", Amount: 1, PaidBy: 1, Participants: []int{1},
+		Recurrence: &Recurrence{Frequency: recurMonthly}}}); err == nil {
+		t.Error("沒有日期的週期帳單應驗證失敗")
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ================= 除不盡的餘數 =================
+
+// 除不盡時多出來的最小單位（例如 100 元三人分多出的 1 分）由誰負擔
+const (
+	remainderFraction = ""        // 小數部分最大的人（預設）
+	remainderPayer    = "payer"   // 付款人；付款人沒有參與分攤時退回預設
+	remainderRotate   = "rotate"  // 參與者依 ID 輪流，跨帳單累計，長期下來每人負擔差不多
+	remainderLargest  = "largest" // 分攤金額最多的人
+)
+
+// RoundingAdjustment 某人在某張帳單因除不盡而多負擔（或少負擔）的金額（本位幣）
+type RoundingAdjustment struct {
+	BillID   int     `json:"billId"`
+	Bill     string  `json:"bill"`
+	PersonID int     `json:"personId"`
+	Person   string  `json:"person"`
+	Amount   float64 `json:"amount"`
+}
+
+func validateRemainderPolicy(policy string) error {
+	switch policy {
+	case remainderFraction, remainderPayer, remainderRotate, remainderLargest:
+		return nil
+	}
+	return fmt.Errorf("不支援的餘數分配方式 %q（可用 payer、rotate、largest）", policy)
+}
+
+// remainderAllocator 依政策拆分每張帳單的分攤金額；rotate 需要跨帳單記住輪到誰
+type remainderAllocator struct {
+	policy string
+	turn   int
+}
+
+// split 把 total 拆給 owed 的每個人，回傳拆分結果與每個人被調整的量
+func (a *remainderAllocator) split(bill Bill, total Money, owed map[int]float64, currency string) (map[int]Money, map[int]Money) {
+	out, leftover, order := truncateShares(total, owed, currency)
+	if leftover == 0 {
+		return out, nil
+	}
+
+	switch a.policy {
+	case remainderPayer:
+		if _, ok := owed[bill.PaidBy]; ok && len(bill.Payers) == 0 {
+			order = []int{bill.PaidBy}
+		}
+	case remainderLargest:
+		sort.SliceStable(order, func(i, j int) bool {
+			if owed[order[i]] != owed[order[j]] {
+				return owed[order[i]] > owed[order[j]]
+			}
+			return order[i] < order[j]
+		})
+	case remainderRotate:
+		sort.Ints(order)
+		start := a.turn % len(order)
+		order = append(order[start:], order[:start]...)
+		a.turn += int(leftover.abs())
+	}
+	return out, spreadRemainder(out, leftover, order)
+}
+
+// billSplit 一張帳單拆成整數（base 的最小單位）後每個人付出、分攤的金額，
+// 以及分攤時因除不盡而被調整的量
+type billSplit struct {
+	total    Money
+	paid     map[int]Money
+	owed     map[int]Money
+	adjusted map[int]Money
+}
+
+// splitBill 拆分一張帳單；沒有參與者、請客或只有付款人自己的帳單不影響結算，回傳 false
+func (a *remainderAllocator) splitBill(bill Bill, base string) (billSplit, bool) {
+	if len(bill.Participants) == 0 || bill.Treat || bill.isPersonal() {
+		return billSplit{}, false
+	}
+	amt := bill.AmountBase
+	if amt == 0 {
+		amt = bill.Amount
+	}
+	paidBy, owedBy := billCharges(bill, amt)
+	var totalPaid float64
+	for _, paid := range paidBy {
+		totalPaid += paid
+	}
+	total := toMoney(totalPaid, base)
+	owed, adjusted := a.split(bill, total, owedBy, base)
+	return billSplit{total: total, paid: allocate(total, paidBy, base), owed: owed, adjusted: adjusted}, true
+}
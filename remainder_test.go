@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+)
+
+// ==========================================
+// 餘數分配政策測試
+// ==========================================
+func TestRemainderPolicies(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	var rounds []Bill
+	for i := 1; i <= 3; i++ {
+		rounds = append(rounds, Bill{ID: i, Title: "Round", AmountBase: 10, PaidBy: i, Participants: []int{1, 2, 3}})
+	}
+
+	owedBy := func(bills []Bill, policy string) map[int]Money {
+		t.Helper()
+		balance, _, _ := computeBalances(people, bills, "TWD", policy)
+		return balance
+	}
+
+	// 預設每張都由 ID 最小的人多付 1 分，三輪下來 Alice 多付 2 分
+	if b := owedBy(rounds, remainderFraction); b[1] != -2 || b[2] != 1 || b[3] != 1 {
+		t.Errorf("預設政策結果不符: %v", b)
+	}
+	// 輪流負擔：三輪剛好每人各 1 分，彼此不欠
+	if b := owedBy(rounds, remainderRotate); b[1] != 0 || b[2] != 0 || b[3] != 0 {
+		t.Errorf("輪流負擔後不應有人欠錢: %v", b)
+	}
+
+	// Charlie 付 100 三人分，付款人吸收多出的 1 分
+	dinner := []Bill{{ID: 9, Title: "Dinner", AmountBase: 100, PaidBy: 3, Participants: []int{1, 2, 3}}}
+	balance, _, adjustments := computeBalances(people, dinner, "TWD", remainderPayer)
+	if balance[1] != -3333 || balance[2] != -3333 {
+		t.Errorf("其他人應各付 33.33: %v", balance)
+	}
+	if len(adjustments) != 1 || adjustments[0].Person != "Charlie" || adjustments[0].Amount != 0.01 || adjustments[0].BillID != 9 {
+		t.Errorf("應回報 Charlie 多負擔 0.01: %+v", adjustments)
+	}
+
+	// 依份數 2:1:1 分 100.01，多出的 1 分給分攤最多的 Alice
+	weighted := []Bill{{ID: 1, AmountBase: 100.01, PaidBy: 3, Participants: []int{1, 2, 3}, Shares: map[int]float64{1: 2}}}
+	if b := owedBy(weighted, remainderLargest); b[1] != -5001 || b[2] != -2500 {
+		t.Errorf("分攤最多的人應吸收餘數: %v", b)
+	}
+
+	if _, err := calculateWithOptions(people, dinner, SettleOptions{Base: "TWD", Remainder: "coinflip"}); err == nil {
+		t.Error("不支援的政策應報錯")
+	}
+}
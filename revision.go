@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ================= 樂觀鎖定（版本號） =================
+
+// anyRevision If-Match: * 表示不論伺服器目前是哪一版都覆蓋
+const anyRevision = -1
+
+var (
+	errRevisionRequired = errors.New("revision required")
+	errInvalidRevision  = errors.New("invalid revision")
+	errStaleRevision    = errors.New("stale revision")
+)
+
+// SyncConflictDetails 客戶端的版本落後時放在錯誤的 details，附上伺服器目前的狀態讓客戶端重新套用修改
+type SyncConflictDetails struct {
+	State GlobalState `json:"state"`
+}
+
+// requestRevision 客戶端這次修改所依據的版本：If-Match 標頭（"12"、W/"12" 或 12，可列多個），
+// 沒有標頭時看內容中的 revision 欄位；兩者都沒有就拒絕，避免舊手機悄悄蓋掉新資料
+func requestRevision(r *http.Request, body []byte) ([]int64, error) {
+	if h := strings.TrimSpace(r.Header.Get("If-Match")); h != "" {
+		if h == "*" {
+			return []int64{anyRevision}, nil
+		}
+		// 列了多個版本時全部保留，符合其中一個即可（RFC 9110 13.1.1）
+		var revs []int64
+		for _, tag := range strings.Split(h, ",") {
+			tag = strings.Trim(strings.TrimPrefix(strings.TrimSpace(tag), "W/"), `"`)
+			n, err := strconv.ParseInt(tag, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("%w: If-Match %q", errInvalidRevision, h)
+			}
+			revs = append(revs, n)
+		}
+		return revs, nil
+	}
+	var v struct {
+		Revision *int64 `json:"revision"`
+	}
+	if json.Unmarshal(body, &v) == nil && v.Revision != nil {
+		return []int64{*v.Revision}, nil
+	}
+	return nil, errRevisionRequired
+}
+
+// checkRevision 客戶端依據的版本必須是伺服器目前的版本；列了多個時符合其中一個即可
+func checkRevision(s GlobalState, revs ...int64) error {
+	tags := make([]string, len(revs))
+	for i, rev := range revs {
+		if rev == anyRevision || rev == s.Revision {
+			return nil
+		}
+		tags[i] = strconv.FormatInt(rev, 10)
+	}
+	return fmt.Errorf("%w: 伺服器已是第 %d 版，客戶端依據第 %s 版", errStaleRevision, s.Revision, strings.Join(tags, "、"))
+}
+
+// mergeBase 版本落後時逐筆合併的基準：列出的版本中不超過伺服器目前版本的最新一版，
+// 全都比伺服器新（不存在的版本）時回傳 false
+func mergeBase(s GlobalState, revs []int64) (int64, bool) {
+	base, ok := int64(0), false
+	for _, rev := range revs {
+		if rev <= s.Revision && (!ok || rev > base) {
+			base, ok = rev, true
+		}
+	}
+	return base, ok
+}
+
+// revisionError 將版本相關的錯誤對應成 HTTP 回應；落後時附上目前的狀態
+func revisionError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, errRevisionRequired):
+		writeError(w, http.StatusPreconditionRequired, "If-Match or revision required")
+	case errors.Is(err, errInvalidRevision):
+		writeErrorFor(w, http.StatusBadRequest, err)
+	default:
+		state, loadErr := roomOf(r).currentState()
+		if loadErr != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeAPIError(w, http.StatusConflict, &APIError{
+			Code:    codeStaleRevision,
+			Message: "資料已被其他裝置更新，請以最新版本重新修改",
+			Details: SyncConflictDetails{State: visibleState(state)},
+		})
+	}
+}
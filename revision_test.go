@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ifMatchCurrent 以伺服器目前的版本送出請求
+func ifMatchCurrent(req *http.Request) {
+	state, _ := currentState()
+	req.Header.Set("If-Match", fmt.Sprintf(`"%d"`, state.Revision))
+}
+
+// ==========================================
+// 樂觀鎖定測試
+// ==========================================
+func TestSync_Revision(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	post := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		handleSync(rec, req)
+		return rec
+	}
+	people := `"people":[{"id":1,"name":"Alice"},{"id":2,"name":"Bob"}]`
+
+	// 手機 A 與手機 B 都依據第 0 版
+	if rec := post(`"0"`, `{`+people+`,"bills":[{"id":1,"title":"Hotel","amount":300,"paidBy":1,"participants":[1,2]}]}`); rec.Code != http.StatusOK {
+		t.Fatalf("同步失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	// 手機 B 沒看過 Hotel，不算它刪除的：逐筆合併而不是整份覆蓋
+	rec := post(`"0"`, `{`+people+`,"bills":[]}`)
+	var merged SyncResponse
+	json.Unmarshal(rec.Body.Bytes(), &merged)
+	if rec.Code != http.StatusOK || !merged.Merged || merged.Revision != 2 || len(merged.Bills) != 1 {
+		t.Fatalf("版本落後應逐筆合併, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 依據的版本比伺服器還新仍回 409
+	rec = post(`"99"`, `{`+people+`,"bills":[]}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("版本不存在應回傳 409, got %d %s", rec.Code, rec.Body.String())
+	}
+	var conflict struct {
+		Code    string              `json:"code"`
+		Message string              `json:"message"`
+		Details SyncConflictDetails `json:"details"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &conflict)
+	if conflict.Code != codeStaleRevision || conflict.Details.State.Revision != 2 || len(conflict.Details.State.Bills) != 1 || conflict.Message == "" {
+		t.Errorf("409 應附上目前的狀態, got %+v", conflict)
+	}
+
+	// 內容中的 revision 也可以；If-Match: * 強制覆蓋
+	if rec := post("", `{"revision":2,`+people+`,"bills":[]}`); rec.Code != http.StatusOK {
+		t.Errorf("以 revision 欄位同步失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("*", `{`+people+`,"bills":[]}`); rec.Code != http.StatusOK {
+		t.Errorf("If-Match: * 應可覆蓋: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := post("", `{`+people+`,"bills":[]}`); rec.Code != http.StatusPreconditionRequired {
+		t.Errorf("沒有版本應回傳 428, got %d", rec.Code)
+	}
+	if rec := post(`"abc"`, `{`+people+`}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("版本格式錯誤應回傳 400, got %d", rec.Code)
+	}
+
+	state, _ := currentState()
+	if state.Revision != 4 {
+		t.Errorf("revision = %d, want 4", state.Revision)
+	}
+}
+
+func TestSync_IfMatchList(t *testing.T) {
+	state := newGlobalState()
+	state.Revision = 3
+	withRoomState(t, state)
+
+	post := func(ifMatch string) (int, SyncResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(`{"people":[{"id":1,"name":"Alice"}],"bills":[]}`))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		handleSync(rec, req)
+		var resp SyncResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec.Code, resp
+	}
+
+	// 列出的版本中有一個是目前的版本就直接套用，不論順序、也不當成落後
+	if code, resp := post(`"3", "5"`); code != http.StatusOK || resp.Merged || resp.Revision != 4 {
+		t.Errorf(`If-Match "3", "5" 對第 3 版應成功, got %d merged=%v revision %d`, code, resp.Merged, resp.Revision)
+	}
+	if code, resp := post(`W/"9", "4"`); code != http.StatusOK || resp.Merged || resp.Revision != 5 {
+		t.Errorf(`If-Match W/"9", "4" 對第 4 版應成功, got %d merged=%v revision %d`, code, resp.Merged, resp.Revision)
+	}
+	// 都不符合：以不超過目前版本的最新一版為基準逐筆合併
+	if code, resp := post(`"2", "9"`); code != http.StatusOK || !resp.Merged {
+		t.Errorf("有落後的版本時應逐筆合併, got %d merged=%v", code, resp.Merged)
+	}
+	// 全都比伺服器新：409
+	if code, _ := post(`"98", "99"`); code != http.StatusConflict {
+		t.Errorf("版本都不存在應回 409, got %d", code)
+	}
+}
+
+func TestUpdateState_RevisionMonotonic(t *testing.T) {
+	state := newGlobalState()
+	state.Revision = 7
+	withRoomState(t, state)
+
+	// 整份換掉（例如匯入舊檔）也不會讓版本倒退
+	state, err := updateState(func(s *GlobalState) error {
+		*s = newGlobalState()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Revision != 8 {
+		t.Errorf("revision = %d, want 8", state.Revision)
+	}
+}
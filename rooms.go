@@ -0,0 +1,515 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"image/png"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ================= 房間（一台伺服器同時服務多趟旅程） =================
+
+const (
+	// roomCodeAlphabet 去掉容易看錯的 0、O、1、I，方便口頭或手寫分享
+	roomCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	roomCodeLength   = 6
+)
+
+// maxRooms 可建立的房間數量上限（不含預設房間）
+var maxRooms = 1000
+
+// roomQRScale QR Code 每個模組的像素數，可用 ?scale= 調整（上限 maxRoomQRScale）
+const (
+	roomQRScale    = 8
+	maxRoomQRScale = 20
+)
+
+var (
+	errRoomNotFound = errors.New("room not found")
+	errTooManyRooms = errors.New("too many rooms")
+	errRoomArchived = errors.New("room is archived")
+)
+
+// room 一趟旅程：各自的狀態、儲存位置、推播與事件，互不影響
+type room struct {
+	code    string
+	mu      sync.Mutex
+	state   GlobalState
+	store   Store // nil 時僅保存在記憶體中
+	changes *changeNotifier
+	events  *eventLog
+	hub     *wsHub
+	devices *deviceTracker
+	// ledger 房間的累計淨額，由 GET /api/balances 使用
+	ledger *balanceLedger
+}
+
+func newRoom(code string, state GlobalState) *room {
+	rm := &room{code: code, state: state, changes: &changeNotifier{ch: make(chan struct{})}, events: newEventLog(), devices: newDeviceTracker(), ledger: &balanceLedger{}}
+	rm.hub = newWSHub(rm)
+	return rm
+}
+
+// defaultRoom 桌面版與沒有加上 /api/rooms/{code} 前綴的 /api 路由使用的房間，
+// 也就是加入房間功能以前唯一的那一份狀態
+var defaultRoom = newRoom("", newGlobalState())
+
+// start 啟動房間的背景工作（WebSocket 推播、SSE 事件、webhook），直到 ctx 結束
+func (rm *room) start(ctx context.Context) {
+	go rm.hub.run(ctx)
+	go rm.runEventLoop(ctx)
+	go rm.runWebhookLoop(ctx, rm.events.latestID())
+}
+
+// dir 房間的檔案（狀態檔、收據附件）存放的目錄；預設房間沿用 dataDir
+func (rm *room) dir() string {
+	if rm.code == "" {
+		return dataDir
+	}
+	return filepath.Join(dataDir, "rooms", rm.code)
+}
+
+// RoomInfo POST /api/rooms、GET /api/rooms/{code} 的回應；JoinURL 為手機加入用的網址，
+// 與 /api/rooms/{code}/qr.png 的內容相同
+type RoomInfo struct {
+	Code        string `json:"code"`
+	JoinURL     string `json:"joinUrl"`
+	Revision    int64  `json:"revision"`
+	LastUpdated int64  `json:"lastUpdated"`
+	People      int    `json:"people"`
+	Bills       int    `json:"bills"`
+	// ArchivedAt 封存的時間（Unix 毫秒），0 代表進行中
+	ArchivedAt int64 `json:"archivedAt,omitempty"`
+}
+
+func (rm *room) info() (RoomInfo, error) {
+	state, err := rm.currentState()
+	if err != nil {
+		return RoomInfo{}, err
+	}
+	visible := visibleState(state)
+	return RoomInfo{Code: rm.code, Revision: state.Revision, LastUpdated: state.LastUpdated, People: len(visible.People), Bills: len(visible.Bills), ArchivedAt: state.ArchivedAt}, nil
+}
+
+// roomRegistry 依加入代碼找房間
+type roomRegistry struct {
+	mu    sync.Mutex
+	rooms map[string]*room
+	// ctx 不為 nil 時（伺服器已啟動）新房間建立後立即啟動背景工作
+	ctx context.Context
+	// stores.open 不為 nil 時，房間的狀態存在與預設房間相同的後端
+	stores roomStores
+}
+
+// roomStores 房間狀態的儲存方式，與預設房間使用相同的後端（狀態檔、日誌、WebDAV 或 PostgreSQL），
+// 每個房間各自一份（檔案或資料列）
+type roomStores struct {
+	// open 開啟房間 code 的儲存
+	open func(code string) Store
+	// list 已存在的房間代碼
+	list func() ([]string, error)
+	// exists 不為 nil 時（多個實例共用儲存），找不到的代碼會再到儲存查一次，其他實例建立的房間也能加入
+	exists func(code string) (bool, error)
+}
+
+// dirRoomStores 房間的狀態存在 dataDir/rooms/<代碼> 目錄裡由 open 開啟的儲存
+func dirRoomStores(open func(dir string) Store) roomStores {
+	return roomStores{
+		open: func(code string) Store { return open(filepath.Join(dataDir, "rooms", code)) },
+		list: func() ([]string, error) {
+			entries, err := os.ReadDir(filepath.Join(dataDir, "rooms"))
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, nil
+			}
+			var codes []string
+			for _, e := range entries {
+				if e.IsDir() {
+					codes = append(codes, e.Name())
+				}
+			}
+			return codes, err
+		},
+	}
+}
+
+var serverRooms = &roomRegistry{rooms: make(map[string]*room)}
+
+// normalizeRoomCode 加入代碼不分大小寫
+func normalizeRoomCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func (reg *roomRegistry) get(code string) (*room, bool) {
+	code = normalizeRoomCode(code)
+	reg.mu.Lock()
+	rm, ok := reg.rooms[code]
+	exists := reg.stores.exists
+	reg.mu.Unlock()
+	if ok || exists == nil || !validRoomCode(code) {
+		return rm, ok
+	}
+
+	// 其他實例建立的房間：從共用的儲存載入
+	if found, err := exists(code); err != nil || !found {
+		if err != nil {
+			log.Printf("look up room %s failed: %v", code, err)
+		}
+		return nil, false
+	}
+	rm = newRoom(code, GlobalState{})
+	if err := rm.loadStore(reg.stores.open(code)); err != nil {
+		log.Printf("load room %s failed: %v", code, err)
+		return nil, false
+	}
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if existing, ok := reg.rooms[code]; ok {
+		return existing, true
+	}
+	reg.rooms[code] = rm
+	if reg.ctx != nil {
+		rm.start(reg.ctx)
+	}
+	return rm, true
+}
+
+// validRoomCode 代碼只能由 roomCodeAlphabet 組成，其他字串不必到儲存查詢
+func validRoomCode(code string) bool {
+	if len(code) != roomCodeLength {
+		return false
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(roomCodeAlphabet, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// all 預設房間在前，其餘依代碼排序
+func (reg *roomRegistry) all() []*room {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	rooms := make([]*room, 0, len(reg.rooms)+1)
+	for _, code := range slices.Sorted(maps.Keys(reg.rooms)) {
+		rooms = append(rooms, reg.rooms[code])
+	}
+	return append([]*room{defaultRoom}, rooms...)
+}
+
+// create 以新的加入代碼建立空白房間
+func (reg *roomRegistry) create() (*room, error) {
+	return reg.createWith(newGlobalState())
+}
+
+// createWith 以新的加入代碼建立狀態為 state 的房間
+func (reg *roomRegistry) createWith(state GlobalState) (*room, error) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if len(reg.rooms) >= maxRooms {
+		return nil, errTooManyRooms
+	}
+	code := newRoomCode()
+	for reg.rooms[code] != nil {
+		code = newRoomCode()
+	}
+	rm := newRoom(code, state)
+	if reg.stores.open != nil {
+		// 收據附件一律放在本機的房間目錄
+		if err := os.MkdirAll(rm.dir(), 0o700); err != nil {
+			return nil, err
+		}
+		rm.store = reg.stores.open(code)
+		if err := rm.store.Save(rm.state); err != nil {
+			return nil, err
+		}
+	}
+	reg.rooms[code] = rm
+	if reg.ctx != nil {
+		rm.start(reg.ctx)
+	}
+	return rm, nil
+}
+
+// load 設定新房間的儲存方式，並載入儲存裡既有的房間
+func (reg *roomRegistry) load(stores roomStores) error {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.stores = stores
+	codes, err := stores.list()
+	if err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if code != normalizeRoomCode(code) {
+			continue
+		}
+		rm := newRoom(code, GlobalState{})
+		if err := rm.loadStore(stores.open(code)); err != nil {
+			return err
+		}
+		reg.rooms[code] = rm
+	}
+	return nil
+}
+
+// serve 啟動所有房間（含預設房間）的背景工作，之後建立的房間也會立即啟動
+func (reg *roomRegistry) serve(ctx context.Context) {
+	for _, rm := range reg.all() {
+		rm.start(ctx)
+	}
+	reg.mu.Lock()
+	reg.ctx = ctx
+	reg.mu.Unlock()
+}
+
+func newRoomCode() string {
+	buf := make([]byte, roomCodeLength)
+	rand.Read(buf)
+	for i, b := range buf {
+		// 字母表剛好 32 個字，取餘數不會偏向某些字
+		buf[i] = roomCodeAlphabet[int(b)%len(roomCodeAlphabet)]
+	}
+	return string(buf)
+}
+
+type roomContextKey struct{}
+
+// withRoom 複製一份請求，之後的處理都作用在 rm 上
+func withRoom(r *http.Request, rm *room) *http.Request {
+	return r.Clone(context.WithValue(r.Context(), roomContextKey{}, rm))
+}
+
+// roomOf 請求所屬的房間；沒有經過 /api/rooms/{code} 的請求屬於預設房間
+func roomOf(r *http.Request) *room {
+	if rm, ok := r.Context().Value(roomContextKey{}).(*room); ok {
+		return rm
+	}
+	return defaultRoom
+}
+
+// handleRooms GET /api/rooms 列出房間（預設不含封存的，?archived=true 才列出）；POST 建立新房間，回傳加入代碼
+func handleRooms(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		archived := r.URL.Query().Get("archived") == "true"
+		infos := []RoomInfo{}
+		for _, rm := range serverRooms.all() {
+			if rm == defaultRoom {
+				continue
+			}
+			info, err := rm.info()
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, "load state failed")
+				return
+			}
+			if info.ArchivedAt != 0 && !archived {
+				continue
+			}
+			info.JoinURL = roomJoinURL(r, rm.code)
+			infos = append(infos, info)
+		}
+		writeJSON(w, http.StatusOK, infos)
+		return
+	}
+	createRoom(w, r, newGlobalState())
+}
+
+// createRoom 建立狀態為 state 的新房間，回應 201 與房間摘要
+func createRoom(w http.ResponseWriter, r *http.Request, state GlobalState) {
+	rm, err := serverRooms.createWith(state)
+	if errors.Is(err, errTooManyRooms) {
+		writeError(w, http.StatusServiceUnavailable, "room limit reached")
+		return
+	}
+	if err != nil {
+		log.Printf("create room failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "create room failed")
+		return
+	}
+	info, err := rm.info()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	info.JoinURL = roomJoinURL(r, rm.code)
+	w.Header().Set("Location", "/api/rooms/"+rm.code)
+	writeJSON(w, http.StatusCreated, info)
+}
+
+// handleRoom GET /api/rooms/{code}：確認加入代碼並取得房間摘要
+func handleRoom(w http.ResponseWriter, r *http.Request) {
+	rm, ok := serverRooms.get(r.PathValue("code"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+		return
+	}
+	info, err := rm.info()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	info.JoinURL = roomJoinURL(r, rm.code)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleRoomArchive POST /api/rooms/{code}/archive 封存結束的旅程（之後只能檢視，也不列在 GET /api/rooms）；
+// DELETE 取消封存
+func handleRoomArchive(w http.ResponseWriter, r *http.Request) {
+	rm, ok := serverRooms.get(r.PathValue("code"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+		return
+	}
+	archive := r.Method == http.MethodPost
+	state, err := rm.currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	// 已經是要求的狀態就不寫入，重複呼叫不會多出版本
+	if (state.ArchivedAt != 0) != archive {
+		_, err = rm.updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			s.ArchivedAt = 0
+			if archive {
+				s.ArchivedAt = clock.Now().UnixMilli()
+			}
+			return nil
+		})
+		// 同時有另一個請求先封存了，結果相同
+		if err != nil && !errors.Is(err, errRoomArchived) {
+			log.Printf("archive room failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+	}
+	info, err := rm.info()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	info.JoinURL = roomJoinURL(r, rm.code)
+	writeJSON(w, http.StatusOK, info)
+}
+
+// handleRoomClone POST /api/rooms/{code}/clone 以同一群人員與分類開新的空白旅程，適合固定出遊的團體；
+// 帳單、付款等紀錄不複製，封存的房間也可以複製
+func handleRoomClone(w http.ResponseWriter, r *http.Request) {
+	rm, ok := serverRooms.get(r.PathValue("code"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+		return
+	}
+	state, err := rm.currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	visible := visibleState(state)
+	clone := newGlobalState()
+	clone.People = visible.People
+	clone.Categories = slices.Clone(visible.Categories)
+	createRoom(w, r, clone)
+}
+
+// roomJoinURL 首頁加上 ?room=代碼；在伺服器本機開啟時（localhost）改用區域網路 IP，手機才連得到
+func roomJoinURL(r *http.Request, code string) string {
+	host := r.Host
+	hostname, port, err := net.SplitHostPort(host)
+	if err != nil {
+		hostname, port = host, ""
+	}
+	if ip := net.ParseIP(hostname); hostname == "localhost" || (ip != nil && ip.IsLoopback()) {
+		if lan := getLocalIP(); lan != "" {
+			host = lan
+			if port != "" {
+				host = net.JoinHostPort(lan, port)
+			}
+		}
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	u := url.URL{Scheme: scheme, Host: host, Path: "/", RawQuery: url.Values{"room": {code}}.Encode()}
+	return u.String()
+}
+
+// handleRoomQR GET /api/rooms/{code}/qr.png：加入網址的 QR Code，讓手機掃描加入而不必輸入 IP
+func handleRoomQR(w http.ResponseWriter, r *http.Request) {
+	rm, ok := serverRooms.get(r.PathValue("code"))
+	if !ok {
+		writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+		return
+	}
+	scale := roomQRScale
+	if s := r.URL.Query().Get("scale"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxRoomQRScale {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("scale 必須是 1 到 %d 的整數", maxRoomQRScale))
+			return
+		}
+		scale = n
+	}
+	qr, err := encodeQR([]byte(roomJoinURL(r, rm.code)))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "encode qr code failed")
+		return
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, qr.image(scale)); err != nil {
+		writeError(w, http.StatusInternalServerError, "encode qr code failed")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
+
+// isRoomWrite 會修改房間狀態的請求；/calculate 只計算不寫入
+func isRoomWrite(method, rest string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return rest != "/calculate"
+}
+
+// handleRoomAPI /api/rooms/{code}/... 轉給 api 的 /api/...，並把請求綁到該房間；
+// 例如 /api/rooms/K7Q2XM/sync 同 /api/sync，但讀寫的是房間 K7Q2XM 的狀態
+func handleRoomAPI(api http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		code := r.PathValue("code")
+		rm, ok := serverRooms.get(code)
+		if !ok {
+			writeError(w, http.StatusNotFound, errRoomNotFound.Error())
+			return
+		}
+		rest := strings.TrimPrefix(r.URL.Path, "/api/rooms/"+code)
+		if rest == "/" || rest == "/rooms" || strings.HasPrefix(rest, "/rooms/") {
+			handleNotFound(w, r)
+			return
+		}
+		if isRoomWrite(r.Method, rest) {
+			if state, err := rm.currentState(); err == nil && state.ArchivedAt != 0 {
+				writeErrorFor(w, http.StatusConflict, fmt.Errorf("%w: 房間已封存，只能檢視", errRoomArchived))
+				return
+			}
+		}
+		r = withRoom(r, rm)
+		r.URL.Path, r.URL.RawPath = "/api"+rest, ""
+		api.ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useRooms 以空的房間清單執行測試，結束後還原
+func useRooms(t *testing.T) *roomRegistry {
+	t.Helper()
+	saved := serverRooms
+	serverRooms = &roomRegistry{rooms: make(map[string]*room)}
+	t.Cleanup(func() { serverRooms = saved })
+	return serverRooms
+}
+
+// withRoomState 讓預設房間在測試期間使用 state 且不寫入儲存，測試結束後還原
+func withRoomState(t *testing.T, state GlobalState) {
+	t.Helper()
+	defaultRoom.mu.Lock()
+	saved, savedStore := defaultRoom.state, defaultRoom.store
+	defaultRoom.state, defaultRoom.store = state, nil
+	defaultRoom.mu.Unlock()
+	t.Cleanup(func() {
+		defaultRoom.mu.Lock()
+		defaultRoom.state, defaultRoom.store = saved, savedStore
+		defaultRoom.mu.Unlock()
+	})
+}
+
+// ==========================================
+// 房間測試
+// ==========================================
+func TestRooms(t *testing.T) {
+	useRooms(t)
+	withRoomState(t, newGlobalState())
+
+	rt := newServerRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/rooms", "")
+	var info RoomInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("建立房間失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if len(info.Code) != roomCodeLength || strings.ContainsAny(info.Code, "0O1I") || rec.Header().Get("Location") != "/api/rooms/"+info.Code {
+		t.Errorf("加入代碼 = %q, Location = %q", info.Code, rec.Header().Get("Location"))
+	}
+	other := do(http.MethodPost, "/api/rooms", "")
+	var otherInfo RoomInfo
+	json.Unmarshal(other.Body.Bytes(), &otherInfo)
+	if otherInfo.Code == info.Code {
+		t.Fatalf("兩個房間的代碼不應相同: %s", info.Code)
+	}
+
+	// 房間內的修改不影響預設房間與其他房間；代碼不分大小寫
+	prefix := "/api/rooms/" + strings.ToLower(info.Code)
+	if rec := do(http.MethodPost, prefix+"/people", `{"name":"Alice"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("在房間內新增人員失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var state GlobalState
+	json.Unmarshal(do(http.MethodGet, prefix+"/sync", "").Body.Bytes(), &state)
+	if len(state.People) != 1 || state.People[0].Name != "Alice" || state.Revision != 1 {
+		t.Errorf("房間狀態 = %+v", state)
+	}
+	for _, path := range []string{"/api/sync", "/api/rooms/" + otherInfo.Code + "/sync"} {
+		json.Unmarshal(do(http.MethodGet, path, "").Body.Bytes(), &state)
+		if len(state.People) != 0 {
+			t.Errorf("%s 不應看到其他房間的人員, got %+v", path, state.People)
+		}
+	}
+
+	rec = do(http.MethodGet, "/api/rooms/"+info.Code, "")
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || info.People != 1 || info.Revision != 1 {
+		t.Errorf("房間摘要 = %d %+v", rec.Code, info)
+	}
+
+	// 房間內的計算事件只發在該房間
+	before := defaultRoom.events.latestID()
+	if rec := do(http.MethodPost, prefix+"/calculate", `{"people":[{"id":1,"name":"A"}],"bills":[]}`); rec.Code != http.StatusOK {
+		t.Fatalf("房間內計算失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	rm, _ := serverRooms.get(info.Code)
+	if rm.events.latestID() != 1 || defaultRoom.events.latestID() != before {
+		t.Errorf("計算事件應發在房間內, room = %d, default = %d -> %d", rm.events.latestID(), before, defaultRoom.events.latestID())
+	}
+
+	for _, path := range []string{"/api/rooms/ZZZZZZ", "/api/rooms/ZZZZZZ/sync", prefix + "/rooms", prefix + "/nope"} {
+		if rec := do(http.MethodGet, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("GET %s 應回 404, got %d", path, rec.Code)
+		}
+	}
+	if rec := do(http.MethodDelete, prefix+"/sync", ""); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") == "" {
+		t.Errorf("房間內的路由也應檢查方法, got %d (Allow %q)", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestRoomRegistry_Persist(t *testing.T) {
+	savedDir := dataDir
+	dataDir = t.TempDir()
+	t.Cleanup(func() { dataDir = savedDir })
+	stores := dirRoomStores(func(dir string) Store { return NewFileStore(filepath.Join(dir, "state.json"), "") })
+
+	reg := useRooms(t)
+	if err := reg.load(stores); err != nil {
+		t.Fatal(err)
+	}
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rm.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = append(s.People, Person{ID: 1, Name: "Alice"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新啟動後從 data-dir/rooms 載入
+	reg = useRooms(t)
+	if err := reg.load(stores); err != nil {
+		t.Fatal(err)
+	}
+	loaded, ok := reg.get(rm.code)
+	if !ok {
+		t.Fatalf("重新載入後找不到房間 %s", rm.code)
+	}
+	if state, _ := loaded.currentState(); len(state.People) != 1 || state.People[0].Name != "Alice" {
+		t.Errorf("重新載入的狀態 = %+v", state.People)
+	}
+	if len(reg.all()) != 2 || reg.all()[0] != defaultRoom {
+		t.Errorf("all() 應包含預設房間與載入的房間, got %d", len(reg.all()))
+	}
+
+	savedMax := maxRooms
+	maxRooms = 1
+	t.Cleanup(func() { maxRooms = savedMax })
+	if _, err := reg.create(); !errors.Is(err, errTooManyRooms) {
+		t.Errorf("超過房間上限應回 errTooManyRooms, got %v", err)
+	}
+}
+
+// memStore 記憶體中的儲存，模擬多個實例共用的後端
+type memStore struct {
+	mu    sync.Mutex
+	state *GlobalState
+}
+
+func (m *memStore) Load() (GlobalState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.state == nil {
+		return newGlobalState(), nil
+	}
+	return cloneState(*m.state), nil
+}
+
+func (m *memStore) Save(state GlobalState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state = cloneState(state)
+	m.state = &state
+	return nil
+}
+
+func TestRoomRegistry_SharedStore(t *testing.T) {
+	savedDir := dataDir
+	dataDir = t.TempDir()
+	t.Cleanup(func() { dataDir = savedDir })
+	var mu sync.Mutex
+	backend := map[string]*memStore{}
+	stores := roomStores{
+		open: func(code string) Store {
+			mu.Lock()
+			defer mu.Unlock()
+			if backend[code] == nil {
+				backend[code] = &memStore{}
+			}
+			return backend[code]
+		},
+		list: func() ([]string, error) { return nil, nil },
+		exists: func(code string) (bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return backend[code] != nil, nil
+		},
+	}
+
+	// 兩個實例共用後端：A 建立的房間，B 不必重新啟動就找得到
+	a, b := &roomRegistry{rooms: map[string]*room{}}, &roomRegistry{rooms: map[string]*room{}}
+	a.load(stores)
+	b.load(stores)
+	rm, err := a.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rm.updateStateAs(Actor{}, func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Alice"}}
+		return nil
+	})
+	got, ok := b.get(strings.ToLower(rm.code))
+	if !ok {
+		t.Fatalf("另一個實例應找得到房間 %s", rm.code)
+	}
+	if state, _ := got.currentState(); len(state.People) != 1 {
+		t.Errorf("另一個實例載入的狀態 = %+v", state.People)
+	}
+	if again, _ := b.get(rm.code); again != got {
+		t.Error("載入後應沿用同一個房間")
+	}
+	if _, ok := b.get("ZZZZZZ"); ok {
+		t.Error("不存在的房間應找不到")
+	}
+}
+
+func TestWebDAVRoomURL(t *testing.T) {
+	for in, want := range map[string]string{
+		"https://dav.example/splitter/state.json":    "https://dav.example/splitter/state-ABC234.json",
+		"https://dav.example/splitter/state.enc?x=1": "https://dav.example/splitter/state-ABC234.enc?x=1",
+		"https://dav.example/splitter/state":         "https://dav.example/splitter/state-ABC234",
+	} {
+		if got := webdavRoomURL(in, "ABC234"); got != want {
+			t.Errorf("webdavRoomURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRoomQR(t *testing.T) {
+	reg := useRooms(t)
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := newServerRouter()
+	get := func(path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Host = "192.168.1.5:8080"
+		rt.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/rooms/" + rm.code + "/qr.png?scale=4")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/png" {
+		t.Fatalf("QR Code 回應 = %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	img, err := png.Decode(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "http://192.168.1.5:8080/?room=" + rm.code
+	q, _ := encodeQR([]byte(want))
+	if size := img.Bounds().Dx(); size != (q.size+8)*4 || img.Bounds().Dy() != size {
+		t.Errorf("圖片大小 = %v, want %d（含四格留白）", img.Bounds(), (q.size+8)*4)
+	}
+
+	var info RoomInfo
+	json.Unmarshal(get("/api/rooms/"+rm.code).Body.Bytes(), &info)
+	if info.JoinURL != want {
+		t.Errorf("joinUrl = %q, want %q", info.JoinURL, want)
+	}
+
+	for path, code := range map[string]int{
+		"/api/rooms/" + rm.code + "/qr.png?scale=0":  http.StatusBadRequest,
+		"/api/rooms/" + rm.code + "/qr.png?scale=99": http.StatusBadRequest,
+		"/api/rooms/ZZZZZZ/qr.png":                   http.StatusNotFound,
+	} {
+		if rec := get(path); rec.Code != code {
+			t.Errorf("GET %s 應回 %d, got %d", path, code, rec.Code)
+		}
+	}
+}
+
+func TestRoomArchiveAndClone(t *testing.T) {
+	reg := useRooms(t)
+	rt := newServerRouter()
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+	rm, err := reg.create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	prefix := "/api/rooms/" + rm.code
+	for _, body := range []string{`{"name":"Alice"}`, `{"name":"Bob"}`} {
+		if rec := do(http.MethodPost, prefix+"/people", body); rec.Code != http.StatusCreated {
+			t.Fatalf("新增人員失敗: %d %s", rec.Code, rec.Body.String())
+		}
+	}
+	if rec := do(http.MethodPost, prefix+"/categories", `{"name":"滑雪","icon":"⛷️"}`); rec.Code != http.StatusCreated {
+		t.Fatalf("新增分類失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, prefix+"/bills", `{"title":"Taxi","amount":300,"currency":"TWD","paidBy":1,"participants":[1,2]}`); rec.Code != http.StatusCreated {
+		t.Fatalf("新增帳單失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodPost, prefix+"/archive", "")
+	var info RoomInfo
+	json.Unmarshal(rec.Body.Bytes(), &info)
+	if rec.Code != http.StatusOK || info.ArchivedAt == 0 {
+		t.Fatalf("封存失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	// 重複封存不會多出版本
+	json.Unmarshal(do(http.MethodPost, prefix+"/archive", "").Body.Bytes(), &info)
+	if archived, _ := rm.currentState(); info.Revision != archived.Revision || info.ArchivedAt != archived.ArchivedAt {
+		t.Errorf("重複封存 = %+v", info)
+	}
+
+	// 封存後只能檢視
+	for _, req := range [][3]string{
+		{http.MethodPost, "/people", `{"name":"Carol"}`},
+		{http.MethodDelete, "/people/1", ""},
+		{http.MethodPost, "/sync", `{"people":[],"bills":[],"revision":-1}`},
+	} {
+		rec := do(req[0], prefix+req[1], req[2])
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), codeRoomArchived) {
+			t.Errorf("%s %s 在封存的房間應回 409 room_archived, got %d %s", req[0], req[1], rec.Code, rec.Body.String())
+		}
+	}
+	if _, err := rm.updateStateAs(Actor{}, func(s *GlobalState) error { s.People = nil; return nil }); !errors.Is(err, errRoomArchived) {
+		t.Errorf("直接修改封存的房間應回 errRoomArchived, got %v", err)
+	}
+	for _, path := range []string{"/sync", "/people"} {
+		if rec := do(http.MethodGet, prefix+path, ""); rec.Code != http.StatusOK {
+			t.Errorf("封存的房間仍可檢視 %s, got %d", path, rec.Code)
+		}
+	}
+	if rec := do(http.MethodPost, prefix+"/calculate", `{"people":[{"id":1,"name":"A"}],"bills":[]}`); rec.Code != http.StatusOK {
+		t.Errorf("封存的房間仍可計算, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 預設清單不含封存的房間
+	active, _ := reg.create()
+	list := func(query string) []string {
+		var infos []RoomInfo
+		json.Unmarshal(do(http.MethodGet, "/api/rooms"+query, "").Body.Bytes(), &infos)
+		codes := []string{}
+		for _, info := range infos {
+			codes = append(codes, info.Code)
+		}
+		return codes
+	}
+	if got := list(""); len(got) != 1 || got[0] != active.code {
+		t.Errorf("預設清單 = %v, want [%s]", got, active.code)
+	}
+	if got := list("?archived=true"); len(got) != 2 {
+		t.Errorf("?archived=true 應列出全部房間, got %v", got)
+	}
+
+	// 複製人員與分類到新的空白房間
+	rec = do(http.MethodPost, prefix+"/clone", "")
+	var cloned RoomInfo
+	json.Unmarshal(rec.Body.Bytes(), &cloned)
+	if rec.Code != http.StatusCreated || cloned.Code == rm.code || rec.Header().Get("Location") != "/api/rooms/"+cloned.Code {
+		t.Fatalf("複製失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var state GlobalState
+	json.Unmarshal(do(http.MethodGet, "/api/rooms/"+cloned.Code+"/sync", "").Body.Bytes(), &state)
+	if len(state.People) != 2 || state.People[1].Name != "Bob" || len(state.Bills) != 0 || state.ArchivedAt != 0 {
+		t.Errorf("複製的房間 = %+v", state)
+	}
+	if !slices.ContainsFunc(state.Categories, func(c Category) bool { return c.Name == "滑雪" }) {
+		t.Errorf("複製的房間應有自訂分類, got %+v", state.Categories)
+	}
+
+	// 取消封存後可以再修改
+	if rec := do(http.MethodDelete, prefix+"/archive", ""); rec.Code != http.StatusOK {
+		t.Fatalf("取消封存失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, prefix+"/people", `{"name":"Carol"}`); rec.Code != http.StatusCreated {
+		t.Errorf("取消封存後應可修改, got %d %s", rec.Code, rec.Body.String())
+	}
+	for _, path := range []string{"/api/rooms/ZZZZZZ/archive", "/api/rooms/ZZZZZZ/clone"} {
+		if rec := do(http.MethodPost, path, ""); rec.Code != http.StatusNotFound {
+			t.Errorf("POST %s 應回 404, got %d", path, rec.Code)
+		}
+	}
+}
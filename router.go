@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ================= 路由 =================
+
+// router 以 http.ServeMux 比對路徑，再依每條路由登記的方法分派：
+// 路徑不存在回 404，方法不允許回 405 並附上 Allow，OPTIONS 直接回 204 與 Allow。
+// 不再把所有不認得的網址都當成首頁
+type router struct {
+	mux *http.ServeMux
+}
+
+func newRouter() *router {
+	rt := &router{mux: http.NewServeMux()}
+	rt.mux.HandleFunc("/", handleNotFound)
+	return rt
+}
+
+// handle 登記 pattern（http.ServeMux 的路徑語法）允許的方法
+func (rt *router) handle(pattern string, h http.HandlerFunc, methods ...string) {
+	allow := strings.Join(append(slices.Clone(methods), http.MethodOptions), ", ")
+	rt.mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case slices.Contains(methods, r.Method):
+			h(w, r)
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allow)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", allow)
+			if isAPIPath(r.URL.Path) {
+				writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+				return
+			}
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// mount 把 pattern 底下的所有路徑交給 h，方法由 h 自己檢查
+func (rt *router) mount(pattern string, h http.Handler) {
+	rt.mux.Handle(pattern, h)
+}
+
+func (rt *router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+func isAPIPath(path string) bool {
+	return path == "/api" || strings.HasPrefix(path, "/api/")
+}
+
+// handleNotFound 沒有符合的路由：API 回 JSON 錯誤，其他網址回一般的 404
+func handleNotFound(w http.ResponseWriter, r *http.Request) {
+	if isAPIPath(r.URL.Path) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	http.NotFound(w, r)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 路由測試（404、405 與 Allow）
+// ==========================================
+func TestServerRouter(t *testing.T) {
+	rt := newServerRouter()
+	do := func(method, path string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/"); rec.Code != http.StatusOK || !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/html") {
+		t.Errorf("首頁應回 200, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/favicon.ico"); rec.Code != http.StatusNotFound {
+		t.Errorf("不認得的網址不應回首頁, got %d", rec.Code)
+	}
+	rec := do(http.MethodGet, "/api/nope")
+	var e APIError
+	json.Unmarshal(rec.Body.Bytes(), &e)
+	if rec.Code != http.StatusNotFound || e.Code != codeNotFound {
+		t.Errorf("不存在的 API 應回 JSON 404, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	rec = do(http.MethodDelete, "/api/summary")
+	e = APIError{}
+	json.Unmarshal(rec.Body.Bytes(), &e)
+	if rec.Code != http.StatusMethodNotAllowed || e.Code != codeMethodNotAllowed || rec.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("不允許的方法應回 405 與 Allow, got %d %v %s", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/"); rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET, HEAD, OPTIONS" {
+		t.Errorf("首頁只接受 GET, got %d %v", rec.Code, rec.Header())
+	}
+	if rec := do(http.MethodOptions, "/api/bills"); rec.Code != http.StatusNoContent || rec.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("OPTIONS 應回 204 與 Allow, got %d %v", rec.Code, rec.Header())
+	}
+}
+
+// TestServerRouter_MatchesOpenAPI 文件中的每個操作，路由都要允許該方法
+func TestServerRouter_MatchesOpenAPI(t *testing.T) {
+	rt := newServerRouter()
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for _, op := range apiOperations {
+		path := param.ReplaceAllString(op.Path, "1")
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, path, nil))
+		if !strings.Contains(", "+rec.Header().Get("Allow")+",", ", "+op.Method+",") {
+			t.Errorf("%s %s 不在路由允許的方法內（Allow: %q）", op.Method, op.Path, rec.Header().Get("Allow"))
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"cmp"
+	"container/heap"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ================= 結算方式 =================
+
+const (
+	settleGreedy  = "greedy"
+	settleMinimal = "minimal"
+	settleHub     = "hub"
+)
+
+// minimalSettleMaxPeople 最少轉帳次數要列舉所有子集合（2^n），超過這個人數就退回 greedy
+const minimalSettleMaxPeople = 20
+
+// minimalSettleBudget 最少轉帳次數的計算時間上限，超過就退回 greedy
+var minimalSettleBudget = 200 * time.Millisecond
+
+// defaultSettlementStrategy 請求沒有指定結算方式時使用（-settlement-strategy）
+var defaultSettlementStrategy = settleGreedy
+
+// Settler 結算演算法：把每個人的淨額配成轉帳，可以直接修改 balance
+type Settler interface {
+	Settle(balance map[int]Money) []transfer
+}
+
+// settlers 依名稱註冊的結算演算法；每次結算用 opts 建一個新的 Settler
+var settlers = map[string]func(opts SettleOptions) Settler{}
+
+// registerSettler 新增結算演算法，名稱即為 settlementStrategy 可用的值
+func registerSettler(name string, newSettler func(opts SettleOptions) Settler) {
+	if _, dup := settlers[name]; dup {
+		panic("結算方式重複註冊: " + name)
+	}
+	settlers[name] = newSettler
+}
+
+func init() {
+	registerSettler(settleGreedy, func(SettleOptions) Settler { return GreedySettler{} })
+	registerSettler(settleMinimal, func(SettleOptions) Settler {
+		return MinTransactionSettler{Deadline: time.Now().Add(minimalSettleBudget)}
+	})
+	registerSettler(settleHub, func(opts SettleOptions) Settler { return HubSettler{Hub: opts.Hub} })
+}
+
+func validateSettlementStrategy(name string) error {
+	if _, ok := settlers[name]; ok {
+		return nil
+	}
+	return fmt.Errorf("不支援的結算方式 %q（可用 %s）", name, strings.Join(slices.Sorted(maps.Keys(settlers)), "、"))
+}
+
+// newSettler 依 opts.Strategy 建立結算演算法，空的代表 defaultSettlementStrategy
+func newSettler(opts SettleOptions) (Settler, error) {
+	name := opts.Strategy
+	if name == "" {
+		name = defaultSettlementStrategy
+	}
+	if err := validateSettlementStrategy(name); err != nil {
+		return nil, err
+	}
+	return settlers[name](opts), nil
+}
+
+// GreedySettler 每次讓欠最多的人付給應收最多的人（同額時 ID 小的優先）。
+// 同樣的輸入在每台裝置上都得到同樣順序、同樣配對的結果
+type GreedySettler struct{}
+
+func (GreedySettler) Settle(balance map[int]Money) []transfer {
+	return heapMatch(balance)
+}
+
+// MinTransactionSettler 轉帳次數最少；人數過多或超過 Deadline 時退回 greedy
+type MinTransactionSettler struct {
+	Deadline time.Time
+}
+
+func (s MinTransactionSettler) Settle(balance map[int]Money) []transfer {
+	if transfers, ok := minimalSettle(balance, s.Deadline); ok {
+		return transfers
+	}
+	return heapMatch(balance)
+}
+
+// HubSettler 所有人只跟 Hub 一個人轉帳：欠錢的付給 Hub，Hub 再付給應收的人。
+// Hub 為 0 或沒有出現在 balance 時，由淨額絕對值最大的人（同額時 ID 小的）擔任
+type HubSettler struct {
+	Hub int
+}
+
+func (s HubSettler) Settle(balance map[int]Money) []transfer {
+	ids := slices.Sorted(maps.Keys(balance))
+	hub := s.Hub
+	if _, ok := balance[hub]; !ok {
+		hub = 0
+		for _, id := range ids {
+			if hub == 0 || balance[id].abs() > balance[hub].abs() {
+				hub = id
+			}
+		}
+	}
+	var in, out []transfer
+	for _, id := range ids {
+		amt := balance[id]
+		switch {
+		case id == hub || amt == 0:
+			continue
+		case amt < 0:
+			in = append(in, transfer{from: id, to: hub, amount: -amt})
+		default:
+			out = append(out, transfer{from: hub, to: id, amount: amt})
+		}
+		balance[hub] += amt
+		balance[id] = 0
+	}
+	return append(in, out...)
+}
+
+// SettleOptions 結算參數；Base 為本位幣，其餘零值代表預設
+type SettleOptions struct {
+	Base      string
+	Strategy  string
+	Remainder string
+	// Epsilon 淨額不超過這個金額（本位幣）就視為已結清，0 代表一個最小單位
+	Epsilon     float64
+	Constraints []SettlementConstraint
+	// ForgiveBelow 低於這個金額（本位幣）的轉帳直接免除，不列入結算
+	ForgiveBelow float64
+	// CashUnit 每筆轉帳湊整到這個金額（本位幣）的倍數，0 代表不湊整
+	CashUnit float64
+	// Hub hub 結算時負責收付的人（財務），0 代表淨額最大的人
+	Hub int
+}
+
+// SettleResult 結算結果與附帶的說明
+type SettleResult struct {
+	Settlements []Settlement
+	Rounding    []RoundingAdjustment
+	// Warnings 無法照結算偏好安排的配對
+	Warnings []string
+	// Forgiven 因低於 ForgiveBelow 而免除的轉帳與總額
+	Forgiven      []Settlement
+	ForgivenTotal float64
+	// Cash 湊整到現金面額時每個人被調整的量
+	Cash []CashAdjustment
+}
+
+// calculateWithOptions 依 opts 結算
+func calculateWithOptions(people []Person, bills []Bill, opts SettleOptions) (SettleResult, error) {
+	if err := validateRemainderPolicy(opts.Remainder); err != nil {
+		return SettleResult{}, err
+	}
+	if err := validateConstraints(people, opts.Constraints); err != nil {
+		return SettleResult{}, err
+	}
+	if opts.Hub != 0 && !slices.ContainsFunc(people, func(p Person) bool { return p.ID == opts.Hub }) {
+		return SettleResult{}, fmt.Errorf("負責收付的人 %d 不存在", opts.Hub)
+	}
+	if opts.Epsilon < 0 || math.IsNaN(opts.Epsilon) || math.IsInf(opts.Epsilon, 0) {
+		return SettleResult{}, fmt.Errorf("結清門檻 %v 無效", opts.Epsilon)
+	}
+	if opts.ForgiveBelow < 0 || math.IsNaN(opts.ForgiveBelow) || math.IsInf(opts.ForgiveBelow, 0) {
+		return SettleResult{}, fmt.Errorf("免除門檻 %v 無效", opts.ForgiveBelow)
+	}
+	if opts.CashUnit < 0 || math.IsNaN(opts.CashUnit) || math.IsInf(opts.CashUnit, 0) {
+		return SettleResult{}, fmt.Errorf("現金面額 %v 無效", opts.CashUnit)
+	}
+	cash := toMoney(opts.CashUnit, opts.Base)
+	if opts.CashUnit > 0 && cash == 0 {
+		return SettleResult{}, fmt.Errorf("現金面額 %v 小於 %s 的最小單位", opts.CashUnit, opts.Base)
+	}
+	epsilon := toMoney(opts.Epsilon, opts.Base)
+	if epsilon == 0 {
+		epsilon = 1
+	}
+
+	settler, err := newSettler(opts)
+	if err != nil {
+		return SettleResult{}, err
+	}
+	if _, ok := settler.(HubSettler); opts.Hub != 0 && !ok {
+		return SettleResult{}, fmt.Errorf("指定負責收付的人時結算方式須為 %s", settleHub)
+	}
+
+	balance, nameMap, adjustments := computeBalances(people, bills, opts.Base, opts.Remainder)
+	result := SettleResult{Rounding: adjustments}
+	if cash > 0 {
+		drift := roundBalancesToCash(balance, cash)
+		for _, id := range slices.Sorted(maps.Keys(drift)) {
+			result.Cash = append(result.Cash, CashAdjustment{PersonID: id, Person: nameMap[id], Amount: drift[id].Float(opts.Base)})
+		}
+	}
+	settleDust(balance, epsilon)
+
+	var transfers []transfer
+	if len(opts.Constraints) > 0 {
+		transfers, result.Warnings = settleWithConstraints(balance, opts.Constraints, nameMap, settler.Settle)
+	} else {
+		transfers = settler.Settle(balance)
+	}
+	transfers, forgiven := forgiveSmall(transfers, toMoney(opts.ForgiveBelow, opts.Base))
+	result.Settlements = toSettlements(transfers, nameMap, opts.Base)
+	result.Forgiven = toSettlements(forgiven, nameMap, opts.Base)
+	var total Money
+	for _, t := range forgiven {
+		total += t.amount
+	}
+	result.ForgivenTotal = total.Float(opts.Base)
+	return result, nil
+}
+
+// forgiveSmall 拆出金額低於 below（最小單位數）的轉帳
+func forgiveSmall(transfers []transfer, below Money) (kept, forgiven []transfer) {
+	for _, t := range transfers {
+		if t.amount < below {
+			forgiven = append(forgiven, t)
+		} else {
+			kept = append(kept, t)
+		}
+	}
+	return kept, forgiven
+}
+
+// settleDust 淨額不超過 epsilon（最小單位數）的人視為已結清
+func settleDust(balance map[int]Money, epsilon Money) {
+	for id, amt := range balance {
+		if amt.abs() <= epsilon {
+			balance[id] = 0
+		}
+	}
+}
+
+// minimalSettle 轉帳次數最少的結算：把所有人分成最多個「淨額加總為 0」的小圈子，
+// 每個 k 人的圈子只需要 k-1 筆轉帳，總筆數 = 人數 - 圈子數。
+// 以位元遮罩 DP 找出最多圈子數，人數過多或超過 deadline 時回傳 false
+func minimalSettle(balance map[int]Money, deadline time.Time) ([]transfer, bool) {
+	ids := make([]int, 0, len(balance))
+	for id, amt := range balance {
+		if amt != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	n := len(ids)
+	if n > minimalSettleMaxPeople {
+		return nil, false
+	}
+	amounts := make([]Money, n)
+	for i, id := range ids {
+		amounts[i] = balance[id]
+	}
+
+	size := 1 << n
+	sum := make([]Money, size)
+	dp := make([]int8, size)
+	for mask := 1; mask < size; mask++ {
+		if mask&0xfff == 0 && time.Now().After(deadline) {
+			return nil, false
+		}
+		low := mask & -mask
+		i := bitIndex(low)
+		sum[mask] = sum[mask^low] + amounts[i]
+		best := int8(0)
+		for m := mask; m != 0; m &= m - 1 {
+			if v := dp[mask^(m&-m)]; v > best {
+				best = v
+			}
+		}
+		if sum[mask] == 0 {
+			best++
+		}
+		dp[mask] = best
+	}
+
+	// 回溯：沿著 DP 的最佳路徑一次拿掉一個人，遇到加總為 0 的集合就切出一個圈子
+	var transfers []transfer
+	mask := size - 1
+	group := 0
+	for mask != 0 {
+		for m := mask; m != 0; m &= m - 1 {
+			bit := m & -m
+			gain := int8(0)
+			if sum[mask] == 0 {
+				gain = 1
+			}
+			if dp[mask^bit]+gain == dp[mask] {
+				group |= bit
+				mask ^= bit
+				break
+			}
+		}
+		if sum[mask] == 0 {
+			transfers = append(transfers, settleGroup(ids, amounts, group)...)
+			group = 0
+		}
+	}
+	return transfers, true
+}
+
+// settleGroup 在一個加總為 0 的圈子內配對，k 人最多 k-1 筆
+func settleGroup(ids []int, amounts []Money, group int) []transfer {
+	sub := make(map[int]Money)
+	for i := range ids {
+		if group&(1<<i) != 0 {
+			sub[ids[i]] = amounts[i]
+		}
+	}
+	return matchDebts(sub, nil)
+}
+
+// transfer 一筆轉帳（以 ID 與最小單位表示），輸出前再換成 Settlement
+type transfer struct {
+	from, to int
+	amount   Money
+}
+
+// debtEntry 堆積中的一位債務人或債權人，amount 一律為正數
+type debtEntry struct {
+	id     int
+	amount Money
+}
+
+// debtHeap 金額最大（同額時 ID 小的）在最上面的堆積
+type debtHeap []debtEntry
+
+func (h debtHeap) Len() int { return len(h) }
+func (h debtHeap) Less(i, j int) bool {
+	if h[i].amount != h[j].amount {
+		return h[i].amount > h[j].amount
+	}
+	return h[i].id < h[j].id
+}
+func (h debtHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *debtHeap) Push(x any)   { *h = append(*h, x.(debtEntry)) }
+func (h *debtHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
+
+// heapMatch 以兩個最大堆積配對：欠最多的人付給應收最多的人，付清的一方離開堆積，
+// 每筆轉帳至少讓一個人結清，所以最多 n-1 筆，整體 O(n log n)。會從 balance 扣除
+func heapMatch(balance map[int]Money) []transfer {
+	debtors := make(debtHeap, 0, len(balance))
+	creditors := make(debtHeap, 0, len(balance))
+	for id, amt := range balance {
+		switch {
+		case amt < 0:
+			debtors = append(debtors, debtEntry{id: id, amount: -amt})
+		case amt > 0:
+			creditors = append(creditors, debtEntry{id: id, amount: amt})
+		}
+	}
+	heap.Init(&debtors)
+	heap.Init(&creditors)
+
+	transfers := make([]transfer, 0, max(len(debtors)+len(creditors)-1, 0))
+	for len(debtors) > 0 && len(creditors) > 0 {
+		d, c := &debtors[0], &creditors[0]
+		amt := min(d.amount, c.amount)
+		transfers = append(transfers, transfer{from: d.id, to: c.id, amount: amt})
+		balance[d.id] += amt
+		balance[c.id] -= amt
+		d.amount -= amt
+		c.amount -= amt
+		if d.amount == 0 {
+			heap.Pop(&debtors)
+		} else {
+			heap.Fix(&debtors, 0)
+		}
+		if c.amount == 0 {
+			heap.Pop(&creditors)
+		} else {
+			heap.Fix(&creditors, 0)
+		}
+	}
+	// 依付款人、收款人的 ID 排列，方便在不同裝置上對照
+	slices.SortFunc(transfers, func(a, b transfer) int {
+		return cmp.Or(cmp.Compare(a.from, b.from), cmp.Compare(a.to, b.to))
+	})
+	return transfers
+}
+
+// matchDebts 依 ID 順序讓每位債務人付給還有餘額的債權人，並從 balance 扣除；
+// allowed 不為 nil 時跳過不允許的配對，配不完的餘額留在 balance 裡
+func matchDebts(balance map[int]Money, allowed func(from, to int) bool) []transfer {
+	ids := slices.Sorted(maps.Keys(balance))
+	var transfers []transfer
+	for _, d := range ids {
+		for _, c := range ids {
+			if balance[d] >= 0 {
+				break
+			}
+			if balance[c] <= 0 || (allowed != nil && !allowed(d, c)) {
+				continue
+			}
+			amt := min(-balance[d], balance[c])
+			transfers = append(transfers, transfer{from: d, to: c, amount: amt})
+			balance[d] += amt
+			balance[c] -= amt
+		}
+	}
+	return transfers
+}
+
+func toSettlements(transfers []transfer, nameMap map[int]string, base string) []Settlement {
+	var settlements []Settlement
+	for _, t := range transfers {
+		settlements = append(settlements, Settlement{From: nameMap[t.from], To: nameMap[t.to], Amount: t.amount.Float(base)})
+	}
+	return settlements
+}
+
+func bitIndex(bit int) int {
+	i := 0
+	for bit > 1 {
+		bit >>= 1
+		i++
+	}
+	return i
+}
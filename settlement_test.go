@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 最少轉帳次數結算測試
+// ==========================================
+func TestMinimalSettle(t *testing.T) {
+	names := map[int]string{1: "A", 2: "B", 3: "C", 4: "D", 5: "E"}
+	// A、D 與 B、C 各自可以互相抵銷，只需要 2 筆；greedy 可能配成 3 筆
+	balance := map[int]Money{1: 4000, 2: 3000, 3: -3000, 4: -4000, 5: 0}
+
+	transfers, ok := minimalSettle(balance, time.Now().Add(time.Second))
+	got := toSettlements(transfers, names, "TWD")
+	if !ok {
+		t.Fatal("人數很少時不應退回 greedy")
+	}
+	if len(got) != 2 {
+		t.Fatalf("應只需 2 筆轉帳, got %+v", got)
+	}
+	net := map[string]float64{}
+	for _, s := range got {
+		net[s.From] -= s.Amount
+		net[s.To] += s.Amount
+	}
+	for id, want := range balance {
+		if math.Abs(net[names[id]]-want.Float("TWD")) > 0.001 {
+			t.Errorf("%s 的淨額應為 %.2f, got %.2f", names[id], want.Float("TWD"), net[names[id]])
+		}
+	}
+
+	many := map[int]Money{}
+	for i := 1; i <= minimalSettleMaxPeople+1; i++ {
+		many[i] = Money(i%2*2-1) * 1000
+	}
+	if _, ok := minimalSettle(many, time.Now().Add(time.Second)); ok {
+		t.Error("人數超過上限應退回 greedy")
+	}
+
+	if _, err := calculateWithOptions([]Person{{ID: 1, Name: "A"}}, nil, SettleOptions{Base: "TWD", Strategy: "cheapest"}); err == nil {
+		t.Error("不支援的結算方式應報錯")
+	}
+}
+
+func TestProcessCalculate_MinimalStrategy(t *testing.T) {
+	req := CalculateRequest{
+		BaseCurrency:       "TWD",
+		SettlementStrategy: settleMinimal,
+		People:             []Person{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}, {ID: 3, Name: "C"}, {ID: 4, Name: "D"}},
+		Bills: []Bill{
+			{Title: "D owes A", Type: billTypeTransfer, Amount: 40, Currency: "TWD", PaidBy: 1, Participants: []int{4}},
+			{Title: "C owes B", Type: billTypeTransfer, Amount: 30, Currency: "TWD", PaidBy: 2, Participants: []int{3}},
+		},
+	}
+	data, _ := json.Marshal(req)
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Error != "" || len(resp.Settlements) != 2 {
+		t.Errorf("應回傳 2 筆轉帳, got %+v", resp)
+	}
+}
+
+// ==========================================
+// 結算結果的順序與配對必須固定
+// ==========================================
+func TestCalculate_Deterministic(t *testing.T) {
+	people := []Person{{ID: 3, Name: "C"}, {ID: 1, Name: "A"}, {ID: 4, Name: "D"}, {ID: 2, Name: "B"}, {ID: 5, Name: "E"}}
+	bills := []Bill{
+		{Title: "Hotel", Amount: 500, PaidBy: 1, Participants: []int{1, 2, 3, 4, 5}},
+		{Title: "Dinner", Amount: 250, PaidBy: 2, Participants: []int{1, 2, 3, 4, 5}},
+	}
+	// A 應收 350、B 應收 100，C、D、E 各應付 150
+	want := []Settlement{
+		{From: "C", To: "A", Amount: 150},
+		{From: "D", To: "A", Amount: 150},
+		{From: "E", To: "A", Amount: 50},
+		{From: "E", To: "B", Amount: 100},
+	}
+	for run := 0; run < 50; run++ {
+		got := calculate(people, bills)
+		if !sameJSON(got, want) {
+			t.Fatalf("第 %d 次結果不同: got %+v, want %+v", run+1, got, want)
+		}
+	}
+}
+
+// ==========================================
+// 依幣別決定的結清門檻
+// ==========================================
+func TestCalculateWithOptions_Epsilon(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{{ID: 1, AmountBase: 0.002, PaidBy: 1, Participants: []int{2}}}
+
+	// 0.002 KWD 是 2 個最小單位，應列出；換成 TWD 則四捨五入為 0
+	res, err := calculateWithOptions(people, bills, SettleOptions{Base: "KWD"})
+	if got := res.Settlements; err != nil || len(got) != 1 || got[0].Amount != 0.002 {
+		t.Errorf("KWD 應精確到 0.001, got %+v, %v", res.Settlements, err)
+	}
+	if res, _ := calculateWithOptions(people, bills, SettleOptions{Base: "TWD"}); len(res.Settlements) != 0 {
+		t.Errorf("不到 TWD 最小單位的金額不應列出, got %+v", res.Settlements)
+	}
+
+	// 日圓 1 圓的差額視為已結清
+	yen := []Bill{{ID: 1, AmountBase: 1, PaidBy: 1, Participants: []int{2}}}
+	if res, _ := calculateWithOptions(people, yen, SettleOptions{Base: "JPY"}); len(res.Settlements) != 0 {
+		t.Errorf("1 日圓應視為已結清, got %+v", res.Settlements)
+	}
+
+	// 指定門檻 10 元：欠 8 元不列出
+	small := []Bill{{ID: 1, AmountBase: 8, PaidBy: 1, Participants: []int{2}}}
+	if res, _ := calculateWithOptions(people, small, SettleOptions{Base: "TWD", Epsilon: 10}); len(res.Settlements) != 0 {
+		t.Errorf("低於門檻的欠款不應列出, got %+v", res.Settlements)
+	}
+	if _, err := calculateWithOptions(people, small, SettleOptions{Base: "TWD", Epsilon: -1}); err == nil {
+		t.Error("負數門檻應報錯")
+	}
+}
+
+// ==========================================
+// 小額免還
+// ==========================================
+func TestCalculateWithOptions_ForgiveBelow(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	bills := []Bill{
+		{ID: 1, Type: billTypeTransfer, AmountBase: 8, PaidBy: 1, Participants: []int{2}},
+		{ID: 2, Type: billTypeTransfer, AmountBase: 250, PaidBy: 1, Participants: []int{3}},
+	}
+	res, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", ForgiveBelow: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Settlements) != 1 || res.Settlements[0].From != "Charlie" {
+		t.Errorf("只應保留 Charlie 的 250, got %+v", res.Settlements)
+	}
+	if len(res.Forgiven) != 1 || res.Forgiven[0].From != "Bob" || res.ForgivenTotal != 8 {
+		t.Errorf("應回報免除 Bob 的 8 元, got %+v, total %v", res.Forgiven, res.ForgivenTotal)
+	}
+}
+
+// ==========================================
+// 可替換的結算演算法
+// ==========================================
+func TestHubSettler(t *testing.T) {
+	names := map[int]string{1: "A", 2: "B", 3: "C", 4: "D"}
+	balance := map[int]Money{1: 5000, 2: 1000, 3: -2000, 4: -4000}
+
+	// 沒有指定時由淨額最大的 A 當中心
+	got := toSettlements(HubSettler{}.Settle(maps.Clone(balance)), names, "TWD")
+	want := []Settlement{{From: "C", To: "A", Amount: 20}, {From: "D", To: "A", Amount: 40}, {From: "A", To: "B", Amount: 10}}
+	if !sameJSON(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// 指定 C 當中心：其他人都只跟 C 轉帳
+	got = toSettlements(HubSettler{Hub: 3}.Settle(maps.Clone(balance)), names, "TWD")
+	want = []Settlement{{From: "D", To: "C", Amount: 40}, {From: "C", To: "A", Amount: 50}, {From: "C", To: "B", Amount: 10}}
+	if !sameJSON(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestSettlerRegistry(t *testing.T) {
+	people := []Person{{ID: 1, Name: "A"}, {ID: 2, Name: "B"}, {ID: 3, Name: "C"}}
+	bills := []Bill{{ID: 1, AmountBase: 300, PaidBy: 1, Participants: []int{1, 2, 3}}}
+
+	for name := range settlers {
+		res, err := calculateWithOptions(people, bills, SettleOptions{Base: "TWD", Strategy: name})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(res.Settlements) != 2 {
+			t.Errorf("%s 應回傳 2 筆轉帳, got %+v", name, res.Settlements)
+		}
+	}
+
+	// 未指定時使用 -settlement-strategy 的預設
+	old := defaultSettlementStrategy
+	defaultSettlementStrategy = settleHub
+	defer func() { defaultSettlementStrategy = old }()
+	people = append(people, Person{ID: 4, Name: "D"})
+	bills = append(bills, Bill{ID: 2, AmountBase: 50, PaidBy: 2, Participants: []int{4}})
+	res, _ := calculateWithOptions(people, bills, SettleOptions{Base: "TWD"})
+	for _, s := range res.Settlements {
+		if s.From != "A" && s.To != "A" {
+			t.Errorf("hub 模式下每筆轉帳都應經過 A, got %+v", res.Settlements)
+		}
+	}
+}
+
+func BenchmarkSettlers(b *testing.B) {
+	rng := rand.New(rand.NewSource(42))
+	balance := map[int]Money{}
+	var sum Money
+	for i := 1; i < 18; i++ {
+		balance[i] = Money(rng.Intn(200000) - 100000)
+		sum += balance[i]
+	}
+	balance[18] = -sum
+
+	for _, name := range slices.Sorted(maps.Keys(settlers)) {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				settlers[name](SettleOptions{Base: "TWD"}).Settle(maps.Clone(balance))
+			}
+		})
+	}
+}
+
+// ==========================================
+// 透過財務結算
+// ==========================================
+func TestProcessCalculate_SettlementHub(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}, {ID: 4, Name: "Dana"}}
+	bills := []Bill{
+		{ID: 1, Title: "Hotel", Amount: 800, Currency: "TWD", PaidBy: 1, Participants: []int{1, 2, 3, 4}},
+		{ID: 2, Title: "Gas", Amount: 400, Currency: "TWD", PaidBy: 2, Participants: []int{1, 2, 3, 4}},
+	}
+	calc := func(req CalculateRequest) CalculateResponse {
+		t.Helper()
+		req.BaseCurrency, req.People, req.Bills = "TWD", people, bills
+		data, _ := json.Marshal(req)
+		var resp CalculateResponse
+		if err := json.Unmarshal([]byte(processCalculate(string(data))), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	// 只指定財務 Dana 就改用 hub：每筆轉帳都經過 Dana
+	resp := calc(CalculateRequest{SettlementHub: 4})
+	want := []Settlement{
+		{From: "Charlie", To: "Dana", Amount: 300},
+		{From: "Dana", To: "Alice", Amount: 500},
+		{From: "Dana", To: "Bob", Amount: 100},
+	}
+	if resp.Error != "" || !sameJSON(resp.Settlements, want) {
+		t.Errorf("got %+v (%s), want %+v", resp.Settlements, resp.Error, want)
+	}
+
+	if resp := calc(CalculateRequest{SettlementHub: 9}); resp.Error == "" {
+		t.Error("不存在的財務應報錯")
+	}
+	if resp := calc(CalculateRequest{SettlementHub: 4, SettlementStrategy: settleMinimal}); resp.Error == "" {
+		t.Error("財務只能搭配 hub 結算方式")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 快照 / 還原點 =================
+
+// maxSnapshots 超過時丟掉最舊的快照，避免狀態檔無限長大
+const maxSnapshots = 50
+
+type Snapshot struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	CreatedAt int64       `json:"createdAt"`
+	State     GlobalState `json:"state"`
+}
+
+// SnapshotInfo 列表時只回傳摘要，不含整份狀態
+type SnapshotInfo struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"createdAt"`
+	People    int    `json:"people"`
+	Bills     int    `json:"bills"`
+}
+
+type CreateSnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// takeSnapshot 擷取目前的可見狀態（不含垃圾桶與其他快照）
+func takeSnapshot(s *GlobalState, name string, now time.Time) Snapshot {
+	captured := cloneState(visibleState(*s))
+	snap := Snapshot{ID: 1, Name: name, CreatedAt: now.UnixMilli(), State: captured}
+	for _, existing := range s.Snapshots {
+		if existing.ID >= snap.ID {
+			snap.ID = existing.ID + 1
+		}
+	}
+	if snap.Name == "" {
+		snap.Name = now.Format("2006-01-02 15:04")
+	}
+	s.Snapshots = append(s.Snapshots, snap)
+	if len(s.Snapshots) > maxSnapshots {
+		s.Snapshots = s.Snapshots[len(s.Snapshots)-maxSnapshots:]
+	}
+	return snap
+}
+
+// restoreSnapshot 把整趟旅程回復到快照；目前的帳單/人員會進垃圾桶而非消失，
+// 已結算鎖定的帳單與快照不同時拒絕還原
+func restoreSnapshot(s *GlobalState, id int, now time.Time) error {
+	for _, snap := range s.Snapshots {
+		if snap.ID != id {
+			continue
+		}
+		restored := cloneState(snap.State)
+		restored.Snapshots = s.Snapshots
+		if err := keepLockedBills(*s, &restored); err != nil {
+			return err
+		}
+		*s = mergeWithTrash(*s, restored, now)
+		return nil
+	}
+	return errSnapshotNotFound
+}
+
+func snapshotInfos(snaps []Snapshot) []SnapshotInfo {
+	infos := make([]SnapshotInfo, 0, len(snaps))
+	for _, snap := range snaps {
+		infos = append(infos, SnapshotInfo{
+			ID:        snap.ID,
+			Name:      snap.Name,
+			CreatedAt: snap.CreatedAt,
+			People:    len(snap.State.People),
+			Bills:     len(snap.State.Bills),
+		})
+	}
+	return infos
+}
+
+// handleSnapshots：GET 列出快照，POST 建立新快照
+func handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		writeJSON(w, http.StatusOK, snapshotInfos(state.Snapshots))
+
+	case http.MethodPost:
+		var req CreateSnapshotRequest
+		body, err := readBody(w, r)
+		if err != nil {
+			return
+		}
+		if len(strings.TrimSpace(string(body))) > 0 {
+			if err := decodeJSON(body, &req); err != nil {
+				writeInvalidJSON(w, err)
+				return
+			}
+		}
+
+		var snap Snapshot
+		if _, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			snap = takeSnapshot(s, strings.TrimSpace(req.Name), clock.Now())
+			return nil
+		}); err != nil {
+			log.Printf("snapshot failed: %v", err)
+			writeError(w, http.StatusInternalServerError, "save state failed")
+			return
+		}
+		writeJSON(w, http.StatusCreated, snapshotInfos([]Snapshot{snap})[0])
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleSnapshotRestore 將整趟旅程回復到指定快照
+func handleSnapshotRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid snapshot id")
+		return
+	}
+
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		return restoreSnapshot(s, id, clock.Now())
+	})
+	if errors.Is(err, errSnapshotNotFound) {
+		writeError(w, http.StatusNotFound, "snapshot not found")
+		return
+	}
+	if errors.Is(err, errBillLocked) {
+		writeErrorFor(w, http.StatusConflict, err)
+		return
+	}
+	if err != nil {
+		log.Printf("restore snapshot failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+	writeJSON(w, http.StatusOK, visibleState(state))
+}
+
+// writeJSON 以 JSON 回應，寫入失敗只記 log
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("encode response failed: %v", err)
+	}
+}
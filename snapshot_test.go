@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 快照與還原測試
+// ==========================================
+func TestSnapshotSurvivesWipeAndRestores(t *testing.T) {
+	now := time.Now()
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 4000, PaidBy: 1, Participants: []int{1, 2}}}
+
+	snap := takeSnapshot(&state, "before bulk edit", now)
+
+	// 手機按下「重新開始」送來空狀態；快照欄位沒送，應該保留
+	wiped := overlaySyncedState(state, []byte(`{"people":[],"bills":[],"baseCurrency":"TWD"}`))
+	state = mergeWithTrash(state, wiped, now)
+	if len(visibleState(state).Bills) != 0 || len(state.Snapshots) != 1 {
+		t.Fatalf("清空後狀態不符預期: %+v", state)
+	}
+
+	if err := restoreSnapshot(&state, snap.ID, now); err != nil {
+		t.Fatalf("還原失敗: %v", err)
+	}
+	visible := visibleState(state)
+	if len(visible.Bills) != 1 || visible.Bills[0].Title != "Hotel" || len(visible.People) != 2 {
+		t.Errorf("還原後資料不一致: %+v", visible)
+	}
+	if err := restoreSnapshot(&state, 999, now); err != errSnapshotNotFound {
+		t.Errorf("不存在的快照應回傳 errSnapshotNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// ================= 分帳方式 =================
+
+// 負金額的帳單代表退款：PaidBy 是收到退款的人，
+// 沿用同樣的計算即可讓付款人的應收與參與者的應付同比例減少
+
+// billTypeTransfer 還款紀錄：PaidBy 付給唯一的參與者，直接抵銷雙方餘額而不分攤
+const billTypeTransfer = "transfer"
+
+func (b Bill) isTransfer() bool { return b.Type == billTypeTransfer }
+
+// 參與者的邊界情況：
+//   - 同一人在 Participants（或品項的 Participants）重複列出只算一次，要多分請用 Shares
+//   - 付款人不在參與者中：付款人只是代墊，不分攤，參與者分攤全額
+//   - 只有付款人自己參與（isPersonal）：個人花費，計入花費統計但不影響結算
+
+// isPersonal 只有付款人自己參與、也沒有其他付款人的帳單
+func (b Bill) isPersonal() bool {
+	if len(b.Payers) > 0 || b.isTransfer() || len(b.Participants) == 0 {
+		return false
+	}
+	for _, pid := range b.Participants {
+		if pid != b.PaidBy {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueIDs 去除重複的 ID，保留第一次出現的順序
+func uniqueIDs(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	out := make([]int, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// 小費/稅/服務費的分攤方式
+const (
+	extrasProportional = "proportional" // 依各人消費比例（預設）
+	extrasEqual        = "equal"        // 參與者平分
+)
+
+// billCharges 回傳每位付款人實際付出的金額（含小費、稅、服務費）與每位參與者應分攤的金額
+func billCharges(bill Bill, amt float64) (map[int]float64, map[int]float64) {
+	bill.Participants = uniqueIDs(bill.Participants)
+	if len(bill.LineItems) > 0 {
+		items := make([]BillItem, len(bill.LineItems))
+		for i, item := range bill.LineItems {
+			item.Participants = uniqueIDs(item.Participants)
+			items[i] = item
+		}
+		bill.LineItems = items
+	}
+	owed := billShares(bill, amt)
+
+	// 以帳單幣別填寫的金額，用與 Amount 相同的匯率換成本位幣
+	toBase := func(v float64) float64 {
+		if bill.Amount == 0 {
+			return v
+		}
+		return v * amt / bill.Amount
+	}
+
+	extras := toBase(bill.Tip + bill.Tax + bill.ServiceCharge)
+	if extras != 0 && len(owed) > 0 {
+		if bill.ExtrasSplit == extrasEqual || amt == 0 {
+			perPerson := extras / float64(len(bill.Participants))
+			for _, pid := range bill.Participants {
+				owed[pid] += perPerson
+			}
+		} else {
+			for pid, share := range owed {
+				owed[pid] = share + extras*share/amt
+			}
+		}
+	}
+
+	paid := make(map[int]float64, 1+len(bill.Payers))
+	if len(bill.Payers) == 0 {
+		paid[bill.PaidBy] = amt + extras
+		return paid, owed
+	}
+	for _, p := range bill.Payers {
+		paid[p.PersonID] += toBase(p.Amount)
+	}
+	return paid, owed
+}
+
+// billShares 回傳每位參與者應分攤的金額，總和等於 amt
+func billShares(bill Bill, amt float64) map[int]float64 {
+	owed := make(map[int]float64, len(bill.Participants))
+	if len(bill.Participants) == 0 {
+		return owed
+	}
+
+	// 品項金額以帳單幣別填寫，依比例換成 amt 後由各品項的參與者平分
+	if len(bill.LineItems) > 0 && bill.Amount != 0 {
+		for _, item := range bill.LineItems {
+			eaters := item.Participants
+			if len(eaters) == 0 {
+				eaters = bill.Participants
+			}
+			itemBase := amt * item.Amount / bill.Amount
+			for _, pid := range eaters {
+				owed[pid] += itemBase / float64(len(eaters))
+			}
+		}
+		return owed
+	}
+
+	// 指定金額以帳單幣別填寫，依比例換成 amt（本位幣）
+	if len(bill.ExactAmounts) > 0 && bill.Amount != 0 {
+		for pid, exact := range bill.ExactAmounts {
+			owed[pid] += amt * exact / bill.Amount
+		}
+		return owed
+	}
+
+	if len(bill.Shares) > 0 {
+		total := 0.0
+		for _, pid := range bill.Participants {
+			total += shareWeight(bill, pid)
+		}
+		if total > 0 {
+			for _, pid := range bill.Participants {
+				owed[pid] += amt * shareWeight(bill, pid) / total
+			}
+			return owed
+		}
+	}
+
+	perPerson := amt / float64(len(bill.Participants))
+	for _, pid := range bill.Participants {
+		owed[pid] += perPerson
+	}
+	return owed
+}
+
+// shareWeight 未在 Shares 中列出的參與者算 1 份
+func shareWeight(bill Bill, pid int) float64 {
+	if w, ok := bill.Shares[pid]; ok {
+		return w
+	}
+	return 1
+}
+
+// rollUpLineItems 有品項的帳單以品項總和作為帳單金額，
+// 並把各品項的參與者併入帳單參與者，讓換算與顯示都以同一個總額為準
+func rollUpLineItems(bills []Bill) []Bill {
+	out := make([]Bill, len(bills))
+	for i, bill := range bills {
+		if len(bill.LineItems) > 0 {
+			total := 0.0
+			seen := make(map[int]bool, len(bill.Participants))
+			for _, pid := range bill.Participants {
+				seen[pid] = true
+			}
+			for _, item := range bill.LineItems {
+				total += item.Amount
+				for _, pid := range item.Participants {
+					if !seen[pid] {
+						seen[pid] = true
+						bill.Participants = append(bill.Participants, pid)
+					}
+				}
+			}
+			bill.Amount = total
+		}
+		out[i] = bill
+	}
+	return out
+}
+
+// validateSplits 在換算前檢查各帳單的分攤設定，錯誤訊息會放進 CalculateResponse.Error
+func validateSplits(bills []Bill) error {
+	for _, bill := range bills {
+		isParticipant := make(map[int]bool, len(bill.Participants))
+		for _, pid := range bill.Participants {
+			isParticipant[pid] = true
+		}
+		if bill.Date != "" {
+			if _, err := time.Parse(billDateLayout, bill.Date); err != nil {
+				return fmt.Errorf("帳單「%s」的日期 %q 格式錯誤，請使用 YYYY-MM-DD", bill.Title, bill.Date)
+			}
+		}
+		if bill.Recurrence != nil {
+			if err := validateRecurrence(bill); err != nil {
+				return err
+			}
+		}
+		if bill.Treat && (bill.isTransfer() || bill.Amount < 0) {
+			return fmt.Errorf("帳單「%s」是還款或退款，不能設為請客", bill.Title)
+		}
+		if bill.isTransfer() {
+			if err := validateTransfer(bill); err != nil {
+				return err
+			}
+			continue
+		}
+		if bill.Type != "" {
+			return fmt.Errorf("帳單「%s」的類型 %q 不支援", bill.Title, bill.Type)
+		}
+		if math.IsNaN(bill.Amount) || math.IsInf(bill.Amount, 0) {
+			return fmt.Errorf("帳單「%s」的金額無效", bill.Title)
+		}
+		if bill.ManualRate < 0 || math.IsNaN(bill.ManualRate) || math.IsInf(bill.ManualRate, 0) {
+			return fmt.Errorf("帳單「%s」的手動匯率無效", bill.Title)
+		}
+		if bill.Amount < 0 {
+			if err := validateRefund(bill); err != nil {
+				return err
+			}
+		}
+		if err := validateExtras(bill); err != nil {
+			return err
+		}
+		if len(bill.Payers) > 0 {
+			if err := validatePayers(bill); err != nil {
+				return err
+			}
+		}
+		if len(bill.LineItems) > 0 {
+			if err := validateLineItems(bill); err != nil {
+				return err
+			}
+		}
+		if len(bill.ExactAmounts) > 0 {
+			if err := validateExactAmounts(bill, isParticipant); err != nil {
+				return err
+			}
+		}
+		if len(bill.Shares) == 0 {
+			continue
+		}
+		total := 0.0
+		for pid, w := range bill.Shares {
+			if !isParticipant[pid] {
+				return fmt.Errorf("帳單「%s」的分攤份數包含非參與者 %d", bill.Title, pid)
+			}
+			if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+				return fmt.Errorf("帳單「%s」的分攤份數必須是非負數", bill.Title)
+			}
+		}
+		for _, pid := range bill.Participants {
+			total += shareWeight(bill, pid)
+		}
+		if total == 0 {
+			return fmt.Errorf("帳單「%s」的分攤份數總和不能為 0", bill.Title)
+		}
+	}
+	return nil
+}
+
+func validateExactAmounts(bill Bill, isParticipant map[int]bool) error {
+	if len(bill.Shares) > 0 {
+		return fmt.Errorf("帳單「%s」不能同時指定份數與金額", bill.Title)
+	}
+	sum := 0.0
+	for pid, amt := range bill.ExactAmounts {
+		if !isParticipant[pid] {
+			return fmt.Errorf("帳單「%s」的指定金額包含非參與者 %d", bill.Title, pid)
+		}
+		// 退款時各人的指定金額也是負的，正負號須與帳單金額一致
+		if amt*bill.Amount < 0 || math.IsNaN(amt) || math.IsInf(amt, 0) {
+			return fmt.Errorf("帳單「%s」參與者 %d 的指定金額無效", bill.Title, pid)
+		}
+		sum += amt
+	}
+	if math.Abs(sum-bill.Amount) > minorUnit(bill.Currency) {
+		return fmt.Errorf("帳單「%s」的指定金額總和 %.2f 與帳單金額 %.2f 不符（差 %.2f）",
+			bill.Title, sum, bill.Amount, bill.Amount-sum)
+	}
+	return nil
+}
+
+func validateLineItems(bill Bill) error {
+	if len(bill.Shares) > 0 || len(bill.ExactAmounts) > 0 {
+		return fmt.Errorf("帳單「%s」使用品項分帳時不能再指定份數或金額", bill.Title)
+	}
+	for _, item := range bill.LineItems {
+		// 品項可以是負的（折扣、退貨），但不能是 NaN/Inf
+		if math.IsNaN(item.Amount) || math.IsInf(item.Amount, 0) {
+			return fmt.Errorf("帳單「%s」的品項「%s」金額無效", bill.Title, item.Name)
+		}
+		if len(item.Participants) == 0 && len(bill.Participants) == 0 {
+			return fmt.Errorf("帳單「%s」的品項「%s」沒有參與者", bill.Title, item.Name)
+		}
+	}
+	return nil
+}
+
+func validateExtras(bill Bill) error {
+	extras := []struct {
+		name  string
+		value float64
+	}{{"小費", bill.Tip}, {"稅", bill.Tax}, {"服務費", bill.ServiceCharge}}
+	for _, e := range extras {
+		if e.value < 0 || math.IsNaN(e.value) || math.IsInf(e.value, 0) {
+			return fmt.Errorf("帳單「%s」的%s金額無效", bill.Title, e.name)
+		}
+	}
+	switch bill.ExtrasSplit {
+	case "", extrasProportional, extrasEqual:
+		return nil
+	}
+	return fmt.Errorf("帳單「%s」的附加費用分攤方式 %q 不支援", bill.Title, bill.ExtrasSplit)
+}
+
+// validatePayers 多人付款時，各付款金額總和須等於帳單總額（含附加費用）
+func validatePayers(bill Bill) error {
+	sum := 0.0
+	for _, p := range bill.Payers {
+		if p.Amount < 0 || math.IsNaN(p.Amount) || math.IsInf(p.Amount, 0) {
+			return fmt.Errorf("帳單「%s」付款人 %d 的金額無效", bill.Title, p.PersonID)
+		}
+		sum += p.Amount
+	}
+	total := bill.Amount + bill.Tip + bill.Tax + bill.ServiceCharge
+	if math.Abs(sum-total) > minorUnit(bill.Currency) {
+		return fmt.Errorf("帳單「%s」的付款金額總和 %.2f 與帳單總額 %.2f 不符", bill.Title, sum, total)
+	}
+	return nil
+}
+
+// validateTransfer 還款必須是「一個人付給另一個人」的單純金額
+func validateTransfer(bill Bill) error {
+	if len(bill.Participants) != 1 || bill.Participants[0] == bill.PaidBy {
+		return fmt.Errorf("還款「%s」必須指定一位不同於付款人的收款人", bill.Title)
+	}
+	if len(bill.Shares) > 0 || len(bill.ExactAmounts) > 0 || len(bill.LineItems) > 0 || len(bill.Payers) > 0 ||
+		bill.Tip != 0 || bill.Tax != 0 || bill.ServiceCharge != 0 {
+		return fmt.Errorf("還款「%s」不能設定分攤方式或附加費用", bill.Title)
+	}
+	if bill.Amount <= 0 || math.IsNaN(bill.Amount) || math.IsInf(bill.Amount, 0) {
+		return fmt.Errorf("還款「%s」的金額必須大於 0", bill.Title)
+	}
+	return nil
+}
+
+// validateRefund 退款只能是單純的金額沖回，不適用小費或多人付款
+func validateRefund(bill Bill) error {
+	if bill.Tip != 0 || bill.Tax != 0 || bill.ServiceCharge != 0 {
+		return fmt.Errorf("退款「%s」不能設定小費、稅或服務費", bill.Title)
+	}
+	if len(bill.Payers) > 0 {
+		return fmt.Errorf("退款「%s」只能有一位收款人（PaidBy）", bill.Title)
+	}
+	if len(bill.Participants) == 0 {
+		return fmt.Errorf("退款「%s」需要指定分回給哪些參與者", bill.Title)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 分帳設定驗證測試
+// ==========================================
+func TestValidateSplits(t *testing.T) {
+	tests := []struct {
+		name    string
+		bill    Bill
+		wantErr string
+	}{
+		{
+			name: "指定金額總和正確",
+			bill: Bill{Title: "Dinner", Amount: 1000, Participants: []int{1, 2}, ExactAmounts: map[int]float64{1: 400, 2: 600}},
+		},
+		{
+			name:    "指定金額總和不符",
+			bill:    Bill{Title: "Dinner", Amount: 1000, Participants: []int{1, 2}, ExactAmounts: map[int]float64{1: 400, 2: 500}},
+			wantErr: "不符",
+		},
+		{
+			name:    "指定金額包含非參與者",
+			bill:    Bill{Title: "Dinner", Amount: 1000, Participants: []int{1}, ExactAmounts: map[int]float64{1: 500, 3: 500}},
+			wantErr: "非參與者",
+		},
+		{
+			name: "退款的指定金額也是負的",
+			bill: Bill{Title: "Refund", Amount: -100, Participants: []int{1, 2}, ExactAmounts: map[int]float64{1: -40, 2: -60}},
+		},
+		{
+			name:    "退款不能有小費",
+			bill:    Bill{Title: "Refund", Amount: -100, Participants: []int{1}, Tip: 10},
+			wantErr: "小費",
+		},
+		{
+			name:    "份數為負",
+			bill:    Bill{Title: "Hotel", Amount: 1000, Participants: []int{1, 2}, Shares: map[int]float64{1: -1}},
+			wantErr: "非負數",
+		},
+		{
+			name:    "退款不能設為請客",
+			bill:    Bill{Title: "Refund", Amount: -100, PaidBy: 1, Participants: []int{1, 2}, Treat: true},
+			wantErr: "請客",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSplits([]Bill{tt.bill})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("不應報錯, got %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("錯誤訊息應包含 %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// ==========================================
+// 參與者的邊界情況
+// ==========================================
+func TestComputeBalances_ParticipantEdgeCases(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	tests := []struct {
+		name string
+		bill Bill
+		want map[int]Money
+	}{
+		{
+			name: "付款人不在參與者中只是代墊",
+			bill: Bill{ID: 1, AmountBase: 300, PaidBy: 1, Participants: []int{2, 3}},
+			want: map[int]Money{1: 30000, 2: -15000, 3: -15000},
+		},
+		{
+			name: "重複列出的參與者只算一次",
+			bill: Bill{ID: 1, AmountBase: 300, PaidBy: 1, Participants: []int{1, 2, 2, 3}},
+			want: map[int]Money{1: 20000, 2: -10000, 3: -10000},
+		},
+		{
+			name: "品項中重複的參與者也只算一次",
+			bill: Bill{ID: 1, Amount: 300, AmountBase: 300, PaidBy: 1, Participants: []int{1, 2, 3},
+				LineItems: []BillItem{{Name: "Pizza", Amount: 300, Participants: []int{2, 3, 3}}}},
+			want: map[int]Money{1: 30000, 2: -15000, 3: -15000},
+		},
+		{
+			name: "平分小費時重複的參與者只算一次",
+			bill: Bill{ID: 1, Amount: 200, AmountBase: 200, Tip: 100, ExtrasSplit: extrasEqual, PaidBy: 1, Participants: []int{1, 2, 2}},
+			want: map[int]Money{1: 15000, 2: -15000, 3: 0},
+		},
+		{
+			name: "只有付款人自己的帳單不影響結算",
+			bill: Bill{ID: 1, AmountBase: 100, PaidBy: 2, Participants: []int{2, 2}},
+			want: map[int]Money{1: 0, 2: 0, 3: 0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balance, _, adjustments := computeBalances(people, []Bill{tt.bill}, "TWD", remainderRotate)
+			for id, want := range tt.want {
+				if balance[id] != want {
+					t.Errorf("%d 的淨額 got %d, want %d", id, balance[id], want)
+				}
+			}
+			if len(adjustments) != 0 {
+				t.Errorf("不應有除不盡的調整: %+v", adjustments)
+			}
+		})
+	}
+
+	if !(Bill{PaidBy: 2, Participants: []int{2}}).isPersonal() {
+		t.Error("只有付款人自己參與應視為個人花費")
+	}
+	if (Bill{PaidBy: 2, Participants: []int{2}, Payers: []Payer{{PersonID: 1, Amount: 50}, {PersonID: 2, Amount: 50}}}).isPersonal() {
+		t.Error("有其他付款人時不是個人花費")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ================= 狀態檔加密 (AES-GCM) =================
+
+// 加密檔格式：magic | salt | nonce | ciphertext
+var encryptedStateMagic = []byte("BSENC1\n")
+
+const (
+	stateSaltSize    = 16
+	stateKDFRounds   = 600_000
+	stateKeySize     = 32
+	passphraseEnvVar = "SPLITTER_PASSPHRASE"
+)
+
+var errPassphraseRequired = errors.New("狀態檔已加密，請提供 -passphrase 或設定 " + passphraseEnvVar)
+
+// stateCipher 快取由密碼推導的金鑰，避免每次存檔都重跑 PBKDF2
+type stateCipher struct {
+	passphrase string
+	salt       []byte
+	aead       cipher.AEAD
+}
+
+func newStateCipher(passphrase string) *stateCipher {
+	return &stateCipher{passphrase: passphrase}
+}
+
+func (c *stateCipher) useSalt(salt []byte) error {
+	if c.aead != nil && bytes.Equal(c.salt, salt) {
+		return nil
+	}
+	key, err := pbkdf2.Key(sha256.New, c.passphrase, salt, stateKDFRounds, stateKeySize)
+	if err != nil {
+		return err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+	c.salt = append([]byte(nil), salt...)
+	c.aead = aead
+	return nil
+}
+
+func (c *stateCipher) seal(plaintext []byte) ([]byte, error) {
+	if c.aead == nil {
+		salt := make([]byte, stateSaltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		if err := c.useSalt(salt); err != nil {
+			return nil, err
+		}
+	}
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(encryptedStateMagic)+len(c.salt)+len(nonce)+len(plaintext)+c.aead.Overhead())
+	out = append(out, encryptedStateMagic...)
+	out = append(out, c.salt...)
+	out = append(out, nonce...)
+	return c.aead.Seal(out, nonce, plaintext, encryptedStateMagic), nil
+}
+
+func (c *stateCipher) open(data []byte) ([]byte, error) {
+	rest := data[len(encryptedStateMagic):]
+	if len(rest) < stateSaltSize {
+		return nil, errors.New("加密狀態檔格式錯誤")
+	}
+	if err := c.useSalt(rest[:stateSaltSize]); err != nil {
+		return nil, err
+	}
+	rest = rest[stateSaltSize:]
+	ns := c.aead.NonceSize()
+	if len(rest) < ns {
+		return nil, errors.New("加密狀態檔格式錯誤")
+	}
+	plaintext, err := c.aead.Open(nil, rest[:ns], rest[ns:], encryptedStateMagic)
+	if err != nil {
+		return nil, fmt.Errorf("解密失敗（密碼錯誤或檔案損毀）: %w", err)
+	}
+	return plaintext, nil
+}
+
+func isEncryptedState(data []byte) bool {
+	return bytes.HasPrefix(data, encryptedStateMagic)
+}
+
+// encodeStateFile 將狀態序列化成存檔格式，c 不為 nil 時加密
+func encodeStateFile(state GlobalState, c *stateCipher) ([]byte, error) {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return data, nil
+	}
+	return c.seal(data)
+}
+
+// decodeStateFile 視需要解密後再解析、遷移；未加密的舊檔仍可讀取
+func decodeStateFile(data []byte, c *stateCipher) (GlobalState, error) {
+	if isEncryptedState(data) {
+		if c == nil {
+			return GlobalState{}, errPassphraseRequired
+		}
+		var err error
+		if data, err = c.open(data); err != nil {
+			return GlobalState{}, err
+		}
+	}
+	return decodeState(data)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ==========================================
+// 加密狀態檔測試
+// ==========================================
+func TestFileStore_Encrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.enc")
+	state := newGlobalState()
+	state.Bills = []Bill{{ID: 1, Title: "Hotel", Amount: 4200, PaidBy: 1, Participants: []int{1}}}
+
+	if err := NewFileStore(path, "secret").Save(state); err != nil {
+		t.Fatalf("存檔失敗: %v", err)
+	}
+
+	raw, _ := os.ReadFile(path)
+	if !isEncryptedState(raw) || bytes.Contains(raw, []byte("Hotel")) {
+		t.Fatal("檔案內容不應為明文")
+	}
+
+	loaded, err := NewFileStore(path, "secret").Load()
+	if err != nil {
+		t.Fatalf("解密失敗: %v", err)
+	}
+	if len(loaded.Bills) != 1 || loaded.Bills[0].Title != "Hotel" {
+		t.Errorf("解密後資料不一致: %+v", loaded.Bills)
+	}
+
+	if _, err := NewFileStore(path, "wrong").Load(); err == nil {
+		t.Error("錯誤密碼應該無法解密")
+	}
+	if _, err := NewFileStore(path, "").Load(); !errors.Is(err, errPassphraseRequired) {
+		t.Errorf("未提供密碼應回傳 errPassphraseRequired, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ================= 本機匯率檔 =================
+
+const providerStatic = "static"
+
+// StaticRateFetcher 從本機 JSON 檔讀取匯率，格式同匯率 API 與內建快照：
+// {"date": "2026-05-01", "usd": {"twd": 30.5, "jpy": 148.5, ...}}，其他本位幣以交叉匯率換算。
+// 不連網、結果固定，用於展示、無網路環境與可重現的端對端測試；沒有歷史匯率
+type StaticRateFetcher struct {
+	snapshot rateEntry
+}
+
+// rateFetcherForMode 解析 -rates 的設定，回傳 fetcher 與顯示用的來源名稱
+func rateFetcherForMode(mode string) (RateFetcher, string, error) {
+	kind, path, _ := strings.Cut(mode, ":")
+	if kind != providerStatic || path == "" {
+		return nil, "", fmt.Errorf("-rates 格式錯誤 %q（例如 static:rates.json）", mode)
+	}
+	f, err := NewStaticRateFetcher(path)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, providerStatic, nil
+}
+
+func NewStaticRateFetcher(path string) (*StaticRateFetcher, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("讀取匯率檔：%w", err)
+	}
+	snapshot, err := parseStaticRates(data)
+	if err != nil {
+		return nil, fmt.Errorf("匯率檔 %s 格式錯誤：%w", path, err)
+	}
+	return &StaticRateFetcher{snapshot: snapshot}, nil
+}
+
+// parseStaticRates 檔案中除了 date 之外只能有一個幣別（匯率的基準）
+func parseStaticRates(data []byte) (rateEntry, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return rateEntry{}, err
+	}
+	var pivot string
+	for key := range raw {
+		if key == "date" {
+			continue
+		}
+		if pivot != "" {
+			return rateEntry{}, errors.New("只能有一個基準幣別")
+		}
+		pivot = key
+	}
+	if pivot == "" {
+		return rateEntry{}, errors.New("無匯率資料")
+	}
+	return parseRateResponse(pivot, data)
+}
+
+func (s *StaticRateFetcher) Fetch(ctx context.Context, base string) (rateEntry, error) {
+	return rebaseRates(s.snapshot, base)
+}
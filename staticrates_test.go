@@ -0,0 +1,57 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 本機匯率檔測試
+// ==========================================
+func TestStaticRates_EndToEnd(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	if err := os.WriteFile(path, []byte(`{"date": "2026-05-01", "usd": {"usd": 1, "twd": 32, "jpy": 160}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	useRateFetcher(t, nil)
+	oldName, oldTTL := rateProviderName, rateCacheTTL
+	t.Cleanup(func() { rateProviderName, rateCacheTTL = oldName, oldTTL })
+	if err := configureRates(RateConfig{Mode: "static:" + path, TTL: time.Minute}); err != nil {
+		t.Fatal(err)
+	}
+	if rateProviderName != providerStatic {
+		t.Errorf("provider = %s", rateProviderName)
+	}
+
+	// 本位幣不是檔案的基準幣別時以交叉匯率換算：1000 JPY = 1000 ÷ 160 × 32 = 200 TWD
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	bills := []Bill{{ID: 1, Title: "Ramen", Amount: 1000, Currency: "JPY", PaidBy: 1, Participants: []int{1, 2}}}
+	resp := runCalculate(t.Context(), CalculateRequest{BaseCurrency: "TWD", People: people, Bills: bills})
+	if resp.Error != "" {
+		t.Fatal(resp.Error)
+	}
+	if resp.Bills[0].AmountBase != 200 || resp.RateDate != "2026-05-01" {
+		t.Errorf("amountBase = %v, rateDate = %q", resp.Bills[0].AmountBase, resp.RateDate)
+	}
+	if len(resp.Settlements) != 1 || resp.Settlements[0].Amount != 100 {
+		t.Errorf("settlements = %+v", resp.Settlements)
+	}
+}
+
+func TestRateFetcherForMode_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	twoPivots := filepath.Join(dir, "two.json")
+	os.WriteFile(twoPivots, []byte(`{"usd": {"twd": 32}, "eur": {"twd": 35}}`), 0o644)
+	for _, mode := range []string{
+		"static",
+		"remote:rates.json",
+		"static:" + filepath.Join(dir, "missing.json"),
+		"static:" + twoPivots,
+	} {
+		if _, _, err := rateFetcherForMode(mode); err == nil {
+			t.Errorf("rateFetcherForMode(%q) 應該失敗", mode)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// ================= 狀態持久化 =================
+
+// Store 抽象化 GlobalState 的存放位置
+type Store interface {
+	Load() (GlobalState, error)
+	Save(state GlobalState) error
+}
+
+// FileStore 將狀態以 JSON 檔案形式存在本機；passphrase 非空時以 AES-GCM 加密
+type FileStore struct {
+	path   string
+	cipher *stateCipher
+}
+
+func NewFileStore(path, passphrase string) *FileStore {
+	fs := &FileStore{path: path}
+	if passphrase != "" {
+		fs.cipher = newStateCipher(passphrase)
+	}
+	return fs
+}
+
+// Load 讀取狀態檔；檔案不存在時回傳空白狀態。
+// 讀取前會先處理上次寫到一半的暫存檔，主檔損毀時改用 .bak 修復
+func (fs *FileStore) Load() (GlobalState, error) {
+	fs.recoverTemp()
+
+	data, err := os.ReadFile(fs.path)
+	if errors.Is(err, os.ErrNotExist) {
+		if state, ok := fs.loadBackup(); ok {
+			return state, nil
+		}
+		return newGlobalState(), nil
+	}
+	if err != nil {
+		return GlobalState{}, err
+	}
+	// 未加密的舊檔仍可讀取，下次存檔時才會加密
+	state, err := decodeStateFile(data, fs.cipher)
+	if err != nil {
+		if errors.Is(err, errPassphraseRequired) {
+			return GlobalState{}, err
+		}
+		if backup, ok := fs.loadBackup(); ok {
+			log.Printf("state file %s is damaged (%v), recovered from backup", fs.path, err)
+			return backup, nil
+		}
+		return GlobalState{}, fmt.Errorf("讀取狀態檔 %s 失敗: %w", fs.path, err)
+	}
+	return state, nil
+}
+
+// Save 以「寫暫存檔 → fsync → rename」的方式原子寫入，並保留上一版為 .bak
+func (fs *FileStore) Save(state GlobalState) error {
+	data, err := encodeStateFile(state, fs.cipher)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(fs.path); err == nil {
+		_ = os.Remove(fs.backupPath())
+		if err := os.Link(fs.path, fs.backupPath()); err != nil {
+			log.Printf("backup %s failed: %v", fs.path, err)
+		}
+	}
+	return writeFileAtomic(fs.path, data, 0o600)
+}
+
+func (fs *FileStore) backupPath() string { return fs.path + ".bak" }
+
+// recoverTemp 處理當機留下的暫存檔：完整的就完成當初的 rename，不完整的直接刪掉
+func (fs *FileStore) recoverTemp() {
+	tmp := fs.path + ".tmp"
+	data, err := os.ReadFile(tmp)
+	if err != nil {
+		return
+	}
+	if _, err := decodeStateFile(data, fs.cipher); err == nil {
+		if err := os.Rename(tmp, fs.path); err == nil {
+			log.Printf("recovered interrupted write of %s", fs.path)
+			return
+		}
+	}
+	_ = os.Remove(tmp)
+}
+
+func (fs *FileStore) loadBackup() (GlobalState, bool) {
+	data, err := os.ReadFile(fs.backupPath())
+	if err != nil {
+		return GlobalState{}, false
+	}
+	state, err := decodeStateFile(data, fs.cipher)
+	if err != nil {
+		return GlobalState{}, false
+	}
+	return state, true
+}
+
+// writeFileAtomic 寫入 path.tmp 並 fsync 後 rename，確保讀者只會看到完整的檔案
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	// 讓 rename 本身也落盤；Windows 無法開啟目錄，忽略錯誤
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		_ = dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// verifyStateFile 供 -verify-state 使用，回傳發現的問題（空的代表完整）
+func verifyStateFile(path, passphrase string) []string {
+	var problems []string
+	fs := NewFileStore(path, passphrase)
+
+	if _, err := os.Stat(path + ".tmp"); err == nil {
+		problems = append(problems, "存在未完成寫入的暫存檔 "+path+".tmp")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return append(problems, fmt.Sprintf("無法讀取 %s: %v", path, err))
+	}
+	state, err := decodeStateFile(data, fs.cipher)
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("狀態檔無法解析: %v", err))
+		if _, ok := fs.loadBackup(); ok {
+			problems = append(problems, "可從 "+fs.backupPath()+" 修復（下次啟動時會自動套用）")
+		}
+		return problems
+	}
+
+	people := make(map[int]bool, len(state.People))
+	for _, p := range state.People {
+		if people[p.ID] {
+			problems = append(problems, fmt.Sprintf("人員 ID %d 重複", p.ID))
+		}
+		people[p.ID] = true
+	}
+	bills := make(map[int]bool, len(state.Bills))
+	for _, b := range state.Bills {
+		if bills[b.ID] {
+			problems = append(problems, fmt.Sprintf("帳單 ID %d 重複", b.ID))
+		}
+		bills[b.ID] = true
+		if !people[b.PaidBy] {
+			problems = append(problems, fmt.Sprintf("帳單 %d 的付款人 %d 不存在", b.ID, b.PaidBy))
+		}
+		for _, pid := range b.Participants {
+			if !people[pid] {
+				problems = append(problems, fmt.Sprintf("帳單 %d 的參與者 %d 不存在", b.ID, pid))
+			}
+		}
+	}
+	return problems
+}
+
+// newGlobalState 回傳目前版本的空白狀態
+func newGlobalState() GlobalState {
+	return GlobalState{
+		SchemaVersion: currentSchemaVersion,
+		People:        []Person{},
+		Bills:         []Bill{},
+		BaseCurrency:  defaultBase,
+		LastUpdated:   clock.Now().UnixMilli(),
+		Categories:    defaultCategories(),
+	}
+}
+
+// TxStore 由多個實例共用的儲存（如 PostgreSQL）實作：
+// 在同一筆交易中讀取、修改並寫回狀態，避免實例之間互相覆蓋
+type TxStore interface {
+	Store
+	Update(fn func(state *GlobalState) error) (GlobalState, error)
+}
+
+// cloneState 深拷貝狀態，避免修改失敗或日誌比對時共用同一個 slice/map
+func cloneState(s GlobalState) GlobalState {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return s
+	}
+	var c GlobalState
+	if err := json.Unmarshal(data, &c); err != nil {
+		return s
+	}
+	return c
+}
+
+// persistLocked 將 state 寫入 rm.store（nil 時僅保存在記憶體中），呼叫端需持有 rm.mu
+func (rm *room) persistLocked(state GlobalState) error {
+	if rm.store == nil {
+		return nil
+	}
+	if err := rm.store.Save(state); err != nil {
+		return fmt.Errorf("persist state: %w", err)
+	}
+	return nil
+}
+
+// loadStore 設定 rm.store 並以其內容取代目前的 rm.state
+func (rm *room) loadStore(s Store) error {
+	state, err := s.Load()
+	if err != nil {
+		return err
+	}
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.store = s
+	rm.state = state
+	return nil
+}
+
+// currentState 回傳最新狀態；共用儲存時每次都重新讀取，以看到其他實例的修改
+func (rm *room) currentState() (GlobalState, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if ts, ok := rm.store.(TxStore); ok {
+		state, err := ts.Load()
+		if err != nil {
+			return GlobalState{}, err
+		}
+		rm.state = state
+	}
+	return rm.state, nil
+}
+
+// updateStateAs 在鎖（或資料庫交易）內修改狀態、更新 LastUpdated 並持久化，
+// 並把這次變更以 actor 的名義記入動態紀錄
+func (rm *room) updateStateAs(actor Actor, fn func(state *GlobalState) error) (GlobalState, error) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	stamp := func(state *GlobalState) error {
+		before, prev, history, rev := activitySubject(*state), state.Activity, state.BillHistory, state.Revision
+		archived := state.ArchivedAt != 0
+		if err := fn(state); err != nil {
+			return err
+		}
+		// 封存的房間只接受取消封存
+		if archived && state.ArchivedAt != 0 {
+			return errRoomArchived
+		}
+		now := clock.Now()
+		recordActivity(state, prev, before, actor, now)
+		stampVersions(before, state, rev+1, now, actor.DeviceID)
+		recordBillHistory(state, history, before.Bills)
+		state.SchemaVersion = currentSchemaVersion
+		state.LastUpdated = now.UnixMilli()
+		// 匯入、還原快照會整份換掉狀態，版本號仍接著原本的往上加
+		state.Revision = rev + 1
+		return nil
+	}
+
+	if ts, ok := rm.store.(TxStore); ok {
+		state, err := ts.Update(stamp)
+		if err != nil {
+			return GlobalState{}, err
+		}
+		rm.state = state
+		rm.changes.notify()
+		return state, nil
+	}
+
+	next := cloneState(rm.state)
+	if err := stamp(&next); err != nil {
+		return GlobalState{}, err
+	}
+	// 沒寫進儲存就不套用：記憶體中的狀態不會與儲存分岔，呼叫端也會收到錯誤（API 回 500）
+	if err := rm.persistLocked(next); err != nil {
+		return GlobalState{}, err
+	}
+	rm.state = next
+	rm.changes.notify()
+	return rm.state, nil
+}
+
+// 以下操作預設房間，供桌面版、背景工作與沒有指定房間的 /api 路由使用
+
+func loadStateStore(s Store) error {
+	return defaultRoom.loadStore(s)
+}
+
+func currentState() (GlobalState, error) {
+	return defaultRoom.currentState()
+}
+
+func updateState(fn func(state *GlobalState) error) (GlobalState, error) {
+	return defaultRoom.updateStateAs(Actor{}, fn)
+}
+
+func updateStateAs(actor Actor, fn func(state *GlobalState) error) (GlobalState, error) {
+	return defaultRoom.updateStateAs(actor, fn)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 原子寫入與當機復原測試
+// ==========================================
+func TestFileStore_RecoversFromDamagedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	fs := NewFileStore(path, "")
+
+	first := newGlobalState()
+	first.BaseCurrency = "EUR"
+	second := newGlobalState()
+	second.BaseCurrency = "JPY"
+	if err := fs.Save(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.Save(second); err != nil {
+		t.Fatal(err)
+	}
+
+	// 舊版非原子寫入留下的半截檔案 → 改用 .bak 的上一版
+	os.WriteFile(path, []byte(`{"people":[{"id":1,"na`), 0o600)
+	got, err := fs.Load()
+	if err != nil || got.BaseCurrency != "EUR" {
+		t.Fatalf("應從 .bak 復原, got %+v, %v", got.BaseCurrency, err)
+	}
+
+	// rename 前當機留下完整的暫存檔 → 完成當初的寫入
+	data, _ := encodeStateFile(second, nil)
+	os.WriteFile(path+".tmp", data, 0o600)
+	got, err = fs.Load()
+	if err != nil || got.BaseCurrency != "JPY" {
+		t.Fatalf("應套用完整的暫存檔, got %+v, %v", got.BaseCurrency, err)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("暫存檔應已被處理")
+	}
+}
+
+func TestVerifyStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	state.Bills = []Bill{{ID: 1, Amount: 100, PaidBy: 2, Participants: []int{1}}}
+	if err := NewFileStore(path, "").Save(state); err != nil {
+		t.Fatal(err)
+	}
+
+	problems := verifyStateFile(path, "")
+	if len(problems) != 1 {
+		t.Errorf("應找到 1 個問題（付款人不存在）, got %v", problems)
+	}
+}
+
+// failingStore 模擬磁碟已滿之類的寫入失敗
+type failingStore struct{ err error }
+
+func (f failingStore) Load() (GlobalState, error) { return newGlobalState(), nil }
+func (f failingStore) Save(GlobalState) error     { return f.err }
+
+func TestUpdateState_PersistFailure(t *testing.T) {
+	withRoomState(t, newGlobalState())
+	diskFull := errors.New("no space left on device")
+	defaultRoom.mu.Lock()
+	defaultRoom.store = failingStore{err: diskFull}
+	defaultRoom.mu.Unlock()
+
+	// 寫入失敗要回傳錯誤，記憶體中的狀態維持原樣
+	if _, err := updateState(func(s *GlobalState) error {
+		s.People = []Person{{ID: 1, Name: "Alice"}}
+		return nil
+	}); !errors.Is(err, diskFull) {
+		t.Errorf("應回傳寫入錯誤, got %v", err)
+	}
+	if state, _ := currentState(); len(state.People) != 0 || state.Revision != 0 {
+		t.Errorf("寫入失敗時不應套用修改, got %+v revision %d", state.People, state.Revision)
+	}
+
+	// API 不能對沒寫進去的修改回 201
+	rec := httptest.NewRecorder()
+	handlePeople(rec, httptest.NewRequest(http.MethodPost, "/api/people", strings.NewReader(`{"name":"Bob"}`)))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("寫入失敗應回 500, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// ================= 統計摘要（/api/summary） =================
+
+// PersonSummary 某人付出的金額、應分攤的金額與兩者的差（本位幣，不含還款）
+type PersonSummary struct {
+	PersonID int     `json:"personId"`
+	Person   string  `json:"person"`
+	Paid     float64 `json:"paid"`
+	Owed     float64 `json:"owed"`
+	Net      float64 `json:"net"`
+}
+
+// CategoryTotal 某個分類的花費，沒有分類的帳單 Category 為空字串
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Total    float64 `json:"total"`
+	Count    int     `json:"count"`
+}
+
+// CurrencyTotal 以某個幣別付款的花費：Amount 為原幣別金額，AmountBase 為換算後的本位幣金額
+type CurrencyTotal struct {
+	Currency   string  `json:"currency"`
+	Amount     float64 `json:"amount"`
+	AmountBase float64 `json:"amountBase"`
+	Count      int     `json:"count"`
+}
+
+// DailySpend 某一天的花費（沒有日期的帳單不列入）
+type DailySpend struct {
+	Date  string  `json:"date"`
+	Total float64 `json:"total"`
+}
+
+// SummaryResponse GET /api/summary 的回應；金額皆為本位幣，還款紀錄不算花費
+type SummaryResponse struct {
+	BaseCurrency string          `json:"baseCurrency"`
+	RateDate     string          `json:"rateDate,omitempty"`
+	TotalSpend   float64         `json:"totalSpend"`
+	BillCount    int             `json:"billCount"`
+	People       []PersonSummary `json:"people"`
+	Categories   []CategoryTotal `json:"categories"`
+	Currencies   []CurrencyTotal `json:"currencies"`
+	Daily        []DailySpend    `json:"daily"`
+}
+
+// buildSummary 依 processCalculate 相同的步驟（群組、臨時參加者、品項、換匯）換算帳單後統計
+func buildSummary(ctx context.Context, state GlobalState, dr dateRange) (SummaryResponse, error) {
+	base := stateBase(state)
+	resp := SummaryResponse{
+		BaseCurrency: base,
+		People:       []PersonSummary{},
+		Categories:   []CategoryTotal{},
+		Currencies:   []CurrencyTotal{},
+		Daily:        []DailySpend{},
+	}
+
+	bills := filterBillsByDate(state.Bills, dr)
+	if errs := validatePeopleAndBills(state.People, bills); len(errs) > 0 {
+		return resp, errs
+	}
+	bills, err := expandGroups(state.Groups, bills)
+	if err != nil {
+		return resp, err
+	}
+	people, bills, err := expandGuests(state.People, bills)
+	if err != nil {
+		return resp, err
+	}
+	if bills, err = applyIncomeWeights(people, bills); err != nil {
+		return resp, err
+	}
+	bills = rollUpLineItems(bills)
+	if err := validateSplits(bills); err != nil {
+		return resp, err
+	}
+	converted, _, rateDate, err := convertBillsWithRates(ctx, base, bills, conversionOptions{
+		Table:        state.RateTable,
+		Locked:       state.LockedRates,
+		FXFeePercent: state.FXFeePercent,
+	})
+	if err != nil {
+		return resp, err
+	}
+	resp.RateDate = rateDate
+
+	paid, owed := map[int]float64{}, map[int]float64{}
+	categories, currencies, daily := map[string]*CategoryTotal{}, map[string]*CurrencyTotal{}, map[string]float64{}
+	var total float64
+	for _, bill := range converted {
+		if bill.isTransfer() || len(bill.Participants) == 0 {
+			continue
+		}
+		amt := bill.AmountBase
+		if amt == 0 {
+			amt = bill.Amount
+		}
+		billPaid, billOwed := billCharges(bill, amt)
+		if bill.Treat {
+			// 請客的花費算在付款人身上
+			billOwed = billPaid
+		}
+		var spent float64
+		for pid, v := range billPaid {
+			paid[pid] += v
+			spent += v
+		}
+		for pid, v := range billOwed {
+			owed[pid] += v
+		}
+		total += spent
+		resp.BillCount++
+
+		category := strings.TrimSpace(bill.Category)
+		c := categories[strings.ToLower(category)]
+		if c == nil {
+			c = &CategoryTotal{Category: category}
+			categories[strings.ToLower(category)] = c
+		}
+		c.Total += spent
+		c.Count++
+
+		cur := strings.ToUpper(strings.TrimSpace(bill.Currency))
+		if cur == "" {
+			cur = base
+		}
+		ct := currencies[cur]
+		if ct == nil {
+			ct = &CurrencyTotal{Currency: cur}
+			currencies[cur] = ct
+		}
+		ct.Amount += bill.Amount + bill.Tip + bill.Tax + bill.ServiceCharge
+		ct.AmountBase += spent
+		ct.Count++
+
+		if bill.Date != "" {
+			daily[bill.Date] += spent
+		}
+	}
+
+	round := func(v float64) float64 { return toMoney(v, base).Float(base) }
+	resp.TotalSpend = round(total)
+	for _, p := range people {
+		resp.People = append(resp.People, PersonSummary{
+			PersonID: p.ID,
+			Person:   p.Name,
+			Paid:     round(paid[p.ID]),
+			Owed:     round(owed[p.ID]),
+			Net:      round(paid[p.ID] - owed[p.ID]),
+		})
+	}
+	for _, c := range categories {
+		c.Total = round(c.Total)
+		resp.Categories = append(resp.Categories, *c)
+	}
+	slices.SortFunc(resp.Categories, func(a, b CategoryTotal) int {
+		return cmp.Or(cmp.Compare(b.Total, a.Total), cmp.Compare(a.Category, b.Category))
+	})
+	for _, ct := range currencies {
+		ct.Amount, ct.AmountBase = toMoney(ct.Amount, ct.Currency).Float(ct.Currency), round(ct.AmountBase)
+		resp.Currencies = append(resp.Currencies, *ct)
+	}
+	slices.SortFunc(resp.Currencies, func(a, b CurrencyTotal) int {
+		return cmp.Or(cmp.Compare(b.AmountBase, a.AmountBase), cmp.Compare(a.Currency, b.Currency))
+	})
+	for _, date := range slices.Sorted(maps.Keys(daily)) {
+		resp.Daily = append(resp.Daily, DailySpend{Date: date, Total: round(daily[date])})
+	}
+	return resp, nil
+}
+
+// handleSummary GET /api/summary?from=&to=：總花費、每人付出/分攤、分類、幣別與每日花費
+func handleSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	q := r.URL.Query()
+	dr, err := parseDateRange(q.Get("from"), q.Get("to"))
+	if err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	}
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		log.Printf("load state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	resp, err := buildSummary(r.Context(), visibleState(state), dr)
+	if err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
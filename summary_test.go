@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ==========================================
+// 統計摘要測試
+// ==========================================
+func TestBuildSummary(t *testing.T) {
+	state := newGlobalState()
+	state.BaseCurrency = "TWD"
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Dinner", Date: "2026-05-02", Category: "Food", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Taxi", Date: "2026-05-01", Category: "Transport", Amount: 10, Currency: "usd", ManualRate: 32, PaidBy: 2, Participants: []int{1, 2}},
+		{ID: 3, Title: "Snack", Date: "2026-05-02", Category: "food", Amount: 90, PaidBy: 2, Participants: []int{2}, Guests: []string{"Dave"}},
+		{ID: 4, Title: "Cake", Amount: 100, PaidBy: 1, Participants: []int{1, 2}, Treat: true},
+		// 還款不算花費
+		{ID: 5, Type: billTypeTransfer, Title: "Repay", Date: "2026-05-03", Amount: 50, PaidBy: 2, Participants: []int{1}},
+	}
+
+	got, err := buildSummary(context.Background(), state, dateRange{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.BaseCurrency != "TWD" || got.TotalSpend != 810 || got.BillCount != 4 {
+		t.Errorf("total = %v (%d 筆), want 810 (4 筆)", got.TotalSpend, got.BillCount)
+	}
+
+	want := []PersonSummary{
+		{PersonID: 1, Person: "Alice", Paid: 400, Owed: 410, Net: -10},
+		{PersonID: 2, Person: "Bob", Paid: 410, Owed: 355, Net: 55},
+		{PersonID: -1, Person: "Dave", Paid: 0, Owed: 45, Net: -45},
+	}
+	if !sameJSON(got.People, want) {
+		t.Errorf("people = %+v", got.People)
+	}
+	// 分類不分大小寫合併，依金額由大到小
+	if len(got.Categories) != 3 || got.Categories[0] != (CategoryTotal{Category: "Food", Total: 390, Count: 2}) || got.Categories[1].Category != "Transport" || got.Categories[2].Category != "" {
+		t.Errorf("categories = %+v", got.Categories)
+	}
+	if len(got.Currencies) != 2 || got.Currencies[1] != (CurrencyTotal{Currency: "USD", Amount: 10, AmountBase: 320, Count: 1}) {
+		t.Errorf("currencies = %+v", got.Currencies)
+	}
+	wantDaily := []DailySpend{{Date: "2026-05-01", Total: 320}, {Date: "2026-05-02", Total: 390}}
+	if !sameJSON(got.Daily, wantDaily) {
+		t.Errorf("daily = %+v", got.Daily)
+	}
+
+	// 日期篩選
+	dr, _ := parseDateRange("2026-05-02", "")
+	if got, err := buildSummary(context.Background(), state, dr); err != nil || got.TotalSpend != 390 {
+		t.Errorf("篩選後 total = %v, err = %v", got.TotalSpend, err)
+	}
+}
+
+func TestSummaryAPI(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	state.Bills = []Bill{
+		{ID: 1, Title: "Lunch", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Old", Amount: 999, PaidBy: 1, Participants: []int{1, 2}, DeletedAt: 1},
+	}
+	withRoomState(t, state)
+
+	rec := httptest.NewRecorder()
+	handleSummary(rec, httptest.NewRequest(http.MethodGet, "/api/summary", nil))
+	var resp SummaryResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("取得摘要失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if resp.TotalSpend != 300 || len(resp.People) != 2 || resp.People[1].Owed != 150 {
+		t.Errorf("垃圾桶裡的帳單不應列入, got %+v", resp)
+	}
+
+	rec = httptest.NewRecorder()
+	handleSummary(rec, httptest.NewRequest(http.MethodGet, "/api/summary?from=bad", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("日期格式錯誤應回 400, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ================= 合併同步（兩台裝置各自修改） =================
+
+// 合併結果（SyncConflict.Resolution）
+const (
+	resolutionServer     = "server"     // 保留其他裝置較新的修改
+	resolutionClient     = "client"     // 採用這次送來、較新的修改
+	resolutionDeleted    = "deleted"    // 其他裝置已刪除，這次的修改沒有套用
+	resolutionRestored   = "restored"   // 其他裝置刪除了，但這次的修改比刪除新，已還原
+	resolutionRenumbered = "renumbered" // 與其他裝置新增的項目 ID 相同，這次新增的改用新的 ID
+	resolutionMerged     = "merged"     // 兩台裝置依據同一版各自修改，逐欄位合併了兩邊的修改
+)
+
+// SyncConflict 合併同步時兩台裝置都動到的一筆帳單或成員，以及採用了哪一邊
+type SyncConflict struct {
+	Target     string `json:"target"` // bill、person
+	ID         int    `json:"id"`
+	Title      string `json:"title"`
+	Resolution string `json:"resolution"`
+	Message    string `json:"message"`
+	// From 改用新 ID（renumbered）時為客戶端原本使用的 ID
+	From int `json:"from,omitempty"`
+	// Fields 逐欄位合併（merged）時兩邊都改成不同值、依編輯時間擇一的欄位
+	Fields []string `json:"fields,omitempty"`
+}
+
+// SyncResponse POST /api/sync 的回應：合併後的完整狀態。客戶端依據的版本已落後時不再整份覆蓋，
+// 而是逐筆合併，Merged 為 true 並在 Conflicts 列出兩邊都改到的項目
+type SyncResponse struct {
+	GlobalState
+	Merged    bool           `json:"merged,omitempty"`
+	Conflicts []SyncConflict `json:"conflicts,omitempty"`
+}
+
+// syncMeta 合併時帳單與成員共用的欄位
+type syncMeta struct {
+	id                             int
+	title                          string
+	revision, updatedAt, deletedAt int64
+	updatedBy                      string
+	version                        int
+	locked                         bool
+}
+
+// unseen 客戶端自己新增、還沒從伺服器取得任何版本資訊的項目
+func (m syncMeta) unseen() bool {
+	return m.revision == 0 && m.version == 0
+}
+
+// syncKind 帳單或成員的存取方式，讓兩者共用同一套合併與版本記錄
+type syncKind[T any] struct {
+	target, label string
+	meta          func(T) syncMeta
+	changed       func(a, b T) bool
+	setID         func(*T, int)
+	setVersion    func(e *T, m syncMeta)
+	restore       func(*T)
+	// mergeFields 以共同的舊版本 base 逐欄位合併 cur 與 in，回傳兩邊都改成不同值的欄位；nil 代表不支援
+	mergeFields func(base, cur, in T) (T, []string)
+}
+
+var billSync = syncKind[Bill]{
+	target: "bill", label: "帳單",
+	meta: func(b Bill) syncMeta {
+		return syncMeta{b.ID, b.Title, b.Revision, b.UpdatedAt, b.DeletedAt, b.UpdatedBy, b.Version, b.Locked}
+	},
+	changed: billChanged,
+	setID:   func(b *Bill, id int) { b.ID = id },
+	setVersion: func(b *Bill, m syncMeta) {
+		b.Revision, b.UpdatedAt, b.UpdatedBy, b.Version = m.revision, m.updatedAt, m.updatedBy, m.version
+	},
+	restore:     func(b *Bill) { b.DeletedAt = 0 },
+	mergeFields: mergeBillFields,
+}
+
+var personSync = syncKind[Person]{
+	target: "person", label: "成員",
+	meta: func(p Person) syncMeta {
+		return syncMeta{p.ID, p.Name, p.Revision, p.UpdatedAt, p.DeletedAt, p.UpdatedBy, 0, false}
+	},
+	changed: personChanged,
+	setID:   func(p *Person, id int) { p.ID = id },
+	setVersion: func(p *Person, m syncMeta) {
+		p.Revision, p.UpdatedAt, p.UpdatedBy = m.revision, m.updatedAt, m.updatedBy
+	},
+	restore: func(p *Person) { p.DeletedAt = 0 },
+}
+
+// stampVersions 新增、修改或刪除的帳單與成員記下這次的版本 rev、編輯時間與裝置 device，帳單自己的版本加 1；
+// 沒有變動的沿用原本的版本資訊，客戶端送來的值不算數
+func stampVersions(before GlobalState, after *GlobalState, rev int64, now time.Time, device string) {
+	stampEntities(before.Bills, after.Bills, billSync, rev, now, device)
+	stampEntities(before.People, after.People, personSync, rev, now, device)
+}
+
+func stampEntities[T any](before, after []T, k syncKind[T], rev int64, now time.Time, device string) {
+	prev := make(map[int]T, len(before))
+	for _, e := range before {
+		prev[k.meta(e).id] = e
+	}
+	for i := range after {
+		m := k.meta(after[i])
+		old, existed := prev[m.id]
+		om := k.meta(old)
+		if existed && om.deletedAt == m.deletedAt && !k.changed(old, after[i]) {
+			k.setVersion(&after[i], om)
+			continue
+		}
+		// 客戶端帶上的編輯時間只能比上一次新、且不能超過現在；只是刪除的沿用原本的編輯時間，刪除時間另記在 DeletedAt
+		at := m.updatedAt
+		switch {
+		case at > om.updatedAt && at <= now.UnixMilli():
+		case existed && m.deletedAt != 0 && om.deletedAt == 0:
+			at = om.updatedAt
+		default:
+			at = now.UnixMilli()
+		}
+		k.setVersion(&after[i], syncMeta{revision: rev, updatedAt: at, updatedBy: device, version: om.version + 1})
+	}
+}
+
+// mergeConcurrent in 依據的是 cur 之前的版本（兩台裝置同時修改）時，從 history 找出共同的舊版本逐欄位合併；
+// 有一方刪除、已鎖定或找不到舊版本時回傳 false，由呼叫端整筆擇一
+func mergeConcurrent[T any](k syncKind[T], history func(id, version int) (T, bool), cur, in T) (T, SyncConflict, bool) {
+	m, cm := k.meta(in), k.meta(cur)
+	if k.mergeFields == nil || history == nil || m.version == 0 || m.version >= cm.version || m.deletedAt != 0 || cm.deletedAt != 0 || cm.locked {
+		return cur, SyncConflict{}, false
+	}
+	base, ok := history(m.id, m.version)
+	if !ok {
+		return cur, SyncConflict{}, false
+	}
+	merged, fields := k.mergeFields(base, cur, in)
+	title := k.meta(merged).title
+	c := SyncConflict{Target: k.target, ID: m.id, Title: title, Resolution: resolutionMerged, Fields: fields,
+		Message: fmt.Sprintf("兩台裝置同時修改了%s「%s」，已合併兩邊的修改", k.label, title)}
+	if len(fields) > 0 {
+		c.Message = fmt.Sprintf("兩台裝置同時修改了%s「%s」的 %s，採用編輯時間較新的值，其餘修改已合併", k.label, title, strings.Join(fields, "、"))
+	}
+	return merged, c, true
+}
+
+// mergeEntities 以客戶端依據的版本 base 逐筆合併 incoming 與伺服器上的 cur：
+//   - 伺服器上的版本不比 base 新：客戶端看過這一版，直接採用客戶端的內容（包括刪除）
+//   - 伺服器上的版本比 base 新、客戶端也改了：找得到共同的舊版本（history）就逐欄位合併，
+//     否則編輯時間較新的一方勝出，已鎖定的一律保留伺服器版本
+//   - 客戶端新增（沒有版本）卻撞到其他裝置新增的 ID：改用 nextID 起算的新 ID
+//   - 其他裝置刪除、客戶端修改：修改比刪除新就還原（直接改 cur），否則維持刪除
+//
+// 回傳交給 applySyncedState 的清單、被客戶端刪除的項目、換過的 ID 與衝突
+func mergeEntities[T any](cur, incoming []T, base int64, k syncKind[T], history func(id, version int) (T, bool), nextID int) (resolved, dropped []T, renumbered map[int]int, conflicts []SyncConflict) {
+	index := make(map[int]int, len(cur))
+	for i, e := range cur {
+		index[k.meta(e).id] = i
+	}
+	renumbered = make(map[int]int)
+	seen := make(map[int]bool, len(incoming))
+	conflict := func(m syncMeta, resolution, format string) {
+		conflicts = append(conflicts, SyncConflict{
+			Target: k.target, ID: m.id, Title: m.title, Resolution: resolution,
+			Message: fmt.Sprintf(format, k.label, m.title),
+		})
+	}
+
+	for _, in := range incoming {
+		m := k.meta(in)
+		i, ok := index[m.id]
+		if !ok {
+			resolved = append(resolved, in)
+			continue
+		}
+		c := cur[i]
+		cm := k.meta(c)
+		known, same := cm.revision <= base, !k.changed(c, in)
+		merged, mc, concurrent := mergeConcurrent(k, history, c, in)
+		switch {
+		case !known && m.unseen() && !same:
+			renumbered[m.id] = nextID
+			k.setID(&in, nextID)
+			nextID++
+			resolved = append(resolved, in)
+			conflict(k.meta(in), resolutionRenumbered, "%s「%s」與其他裝置新增的項目 ID 相同，已改用新的 ID")
+			conflicts[len(conflicts)-1].From = m.id
+			continue
+		case cm.deletedAt != 0 && known:
+			// 刪除發生在客戶端看過的版本之前，客戶端重複使用了這個 ID，交給 mergeWithTrash 處理
+			resolved = append(resolved, in)
+		case cm.deletedAt != 0 && same:
+		case cm.deletedAt != 0 && m.updatedAt > cm.deletedAt && !cm.locked:
+			k.restore(&cur[i])
+			resolved = append(resolved, in)
+			conflict(m, resolutionRestored, "%s「%s」已被其他裝置刪除，但這次的修改比較新，已還原")
+		case cm.deletedAt != 0:
+			conflict(m, resolutionDeleted, "%s「%s」已被其他裝置刪除，這次的修改沒有套用（可從垃圾桶還原）")
+		case known || same:
+			resolved = append(resolved, in)
+		case concurrent:
+			resolved = append(resolved, merged)
+			conflicts = append(conflicts, mc)
+		case cm.locked:
+			resolved = append(resolved, c)
+			conflict(cm, resolutionServer, "%s「%s」已結算鎖定，保留伺服器上的版本")
+		case cm.updatedAt >= m.updatedAt:
+			resolved = append(resolved, c)
+			conflict(cm, resolutionServer, "其他裝置較晚修改了%s「%s」，保留其他裝置的版本")
+		default:
+			resolved = append(resolved, in)
+			conflict(m, resolutionClient, "兩台裝置都修改了%s「%s」，採用這次較新的修改")
+		}
+		seen[m.id] = true
+	}
+
+	for _, c := range cur {
+		cm := k.meta(c)
+		if seen[cm.id] || cm.deletedAt != 0 {
+			continue
+		}
+		if cm.revision > base {
+			// 客戶端依據的版本之後才新增或修改，客戶端沒看過，不算它刪除的
+			resolved = append(resolved, c)
+		} else {
+			dropped = append(dropped, c)
+		}
+	}
+	return resolved, dropped, renumbered, conflicts
+}
+
+// mergeDivergedState 客戶端依據的版本 base 已落後時，把它送來的完整狀態 incoming 與伺服器上的 s 逐筆合併，
+// 回傳交給 applySyncedState 的狀態；設定類的欄位（分類、本位幣等）仍以客戶端送來的為準
+func mergeDivergedState(s *GlobalState, incoming GlobalState, base int64) (GlobalState, []SyncConflict) {
+	people, droppedPeople, personIDs, conflicts := mergeEntities(s.People, incoming.People, base, personSync, nil, maxPersonID(s.People, incoming.People)+1)
+	if len(personIDs) > 0 {
+		person := func(id int) int {
+			if to, ok := personIDs[id]; ok {
+				return to
+			}
+			return id
+		}
+		incoming.Bills = cloneState(GlobalState{Bills: incoming.Bills}).Bills
+		for i := range incoming.Bills {
+			remapBillPeople(&incoming.Bills[i], person)
+		}
+	}
+	bills, _, _, billConflicts := mergeEntities(s.Bills, incoming.Bills, base, billSync, billHistoryOf(*s), maxBillID(s.Bills, incoming.Bills)+1)
+	conflicts = append(conflicts, billConflicts...)
+
+	// 客戶端刪掉的成員若還有合併後的帳單用到（例如其他裝置剛新增的），先保留
+	used := make(map[int]bool)
+	for _, b := range bills {
+		probe := b
+		remapBillPeople(&probe, func(id int) int {
+			used[id] = true
+			return id
+		})
+	}
+	for _, p := range droppedPeople {
+		if used[p.ID] {
+			people = append(people, p)
+			conflicts = append(conflicts, SyncConflict{
+				Target: personSync.target, ID: p.ID, Title: p.Name, Resolution: resolutionServer,
+				Message: fmt.Sprintf("成員「%s」仍有其他裝置新增的帳單使用，沒有刪除", p.Name),
+			})
+		}
+	}
+
+	incoming.People, incoming.Bills = people, bills
+	return incoming, conflicts
+}
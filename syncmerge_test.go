@@ -0,0 +1,139 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 合併同步測試
+// ==========================================
+func TestSync_MergeDiverged(t *testing.T) {
+	reg := useRooms(t)
+	// 垃圾桶的刪除時間取自系統時間，假時鐘從現在開始
+	fc := &fakeClock{t: time.Now()}
+	useClock(t, fc)
+	t0 := fc.Now().UnixMilli()
+	rm, _ := reg.create()
+	rt := newServerRouter()
+
+	post := func(rev int64, people []Person, bills []Bill) (*httptest.ResponseRecorder, SyncResponse) {
+		body, _ := json.Marshal(GlobalState{People: people, Bills: bills})
+		req := httptest.NewRequest(http.MethodPost, "/api/rooms/"+rm.code+"/sync", strings.NewReader(string(body)))
+		req.Header.Set("If-Match", fmt.Sprintf(`"%d"`, rev))
+		rec := httptest.NewRecorder()
+		rt.ServeHTTP(rec, req)
+		var resp SyncResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+	bill := func(id int, title string, amount float64) Bill {
+		return Bill{ID: id, Title: title, Amount: amount, PaidBy: 1, Participants: []int{1, 2}}
+	}
+
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	rec, base := post(0, people, []Bill{bill(1, "Hotel", 300), bill(2, "Taxi", 100), bill(3, "Lunch", 200), bill(4, "Museum", 50)})
+	if rec.Code != http.StatusOK || base.Merged || base.Revision != 1 {
+		t.Fatalf("同步失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	for _, b := range base.Bills {
+		if b.Revision != 1 || b.UpdatedAt != t0 {
+			t.Errorf("新增的帳單應記下版本與時間, got %+v", b)
+		}
+	}
+
+	// 手機 A：改 Hotel、Taxi，刪 Lunch、Museum，新增 Dinner
+	fc.Advance(time.Minute)
+	a := []Bill{base.Bills[0], base.Bills[1], bill(5, "Dinner", 600)}
+	a[0].Amount, a[1].Amount = 400, 120
+	if rec, resp := post(1, base.People, a); rec.Code != http.StatusOK || resp.Merged {
+		t.Fatalf("手機 A 同步失敗: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 手機 B 仍依據第 1 版：Hotel 的修改比 A 舊、Taxi 比 A 新、Lunch 在刪除後才改、
+	// Museum 在刪除前就改了，另外也新增了 ID 5 的帳單，並刪掉 Bob
+	fc.Advance(2 * time.Minute)
+	b := []Bill{base.Bills[0], base.Bills[1], base.Bills[2], base.Bills[3], bill(5, "Snacks", 80)}
+	b[0].Amount, b[0].UpdatedAt = 500, t0+30_000
+	b[1].Amount, b[1].UpdatedAt = 150, t0+90_000
+	b[2].Amount, b[2].UpdatedAt = 250, t0+90_000
+	b[3].Amount, b[3].UpdatedAt = 60, t0-1
+	for i := range b {
+		b[i].Participants = []int{1}
+	}
+	b[1].Participants = []int{1, 2} // Bob 仍出現在伺服器版本的帳單
+	rec, resp := post(1, base.People[:1], b)
+	if rec.Code != http.StatusOK || !resp.Merged || resp.Revision != 3 {
+		t.Fatalf("應逐筆合併: %d %s", rec.Code, rec.Body.String())
+	}
+
+	// Hotel、Taxi 兩邊都依據第 1 版，逐欄位合併；都改了金額，依編輯時間擇一
+	got := map[string]string{}
+	for _, c := range resp.Conflicts {
+		got[c.Target+":"+c.Title] = c.Resolution
+		if c.Resolution == resolutionMerged && strings.Join(c.Fields, ",") != "amount" {
+			t.Errorf("兩邊都改的欄位 = %v", c.Fields)
+		}
+		if c.Message == "" {
+			t.Errorf("衝突應附上說明: %+v", c)
+		}
+	}
+	want := map[string]string{
+		"bill:Hotel":  resolutionMerged,
+		"bill:Taxi":   resolutionMerged,
+		"bill:Lunch":  resolutionRestored,
+		"bill:Museum": resolutionDeleted,
+		"bill:Snacks": resolutionRenumbered,
+		"person:Bob":  resolutionServer,
+	}
+	if len(got) != len(want) {
+		t.Errorf("衝突 = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s 的處理 = %q, want %q", k, got[k], v)
+		}
+	}
+
+	amounts := map[string]float64{}
+	for _, bl := range resp.Bills {
+		amounts[bl.Title] = bl.Amount
+	}
+	if len(resp.Bills) != 5 || amounts["Hotel"] != 400 || amounts["Taxi"] != 150 || amounts["Lunch"] != 250 || amounts["Dinner"] != 600 || amounts["Snacks"] != 80 {
+		t.Errorf("合併後的帳單 = %v", amounts)
+	}
+	if len(resp.People) != 2 {
+		t.Errorf("仍被帳單使用的 Bob 不應刪除, got %+v", resp.People)
+	}
+	state, _ := rm.currentState()
+	if trashed := len(state.Bills) - len(visibleState(state).Bills); trashed != 1 {
+		t.Errorf("垃圾桶應只剩 Museum, got %d", trashed)
+	}
+}
+
+func TestStampVersions(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	before := GlobalState{Bills: []Bill{{ID: 1, Title: "Hotel", Amount: 300, Revision: 3, UpdatedAt: 1000}}}
+	after := GlobalState{Bills: []Bill{
+		{ID: 1, Title: "Hotel", Amount: 300, Revision: 99, UpdatedAt: 5000},
+		{ID: 2, Title: "Taxi", Amount: 100, UpdatedAt: now.Add(time.Hour).UnixMilli()},
+		{ID: 3, Title: "Lunch", Amount: 200, UpdatedAt: 2000},
+	}}
+	stampVersions(before, &after, 4, now, "phone")
+
+	// 沒有變動的不接受客戶端送來的版本資訊；編輯時間不能在未來
+	if b := after.Bills[0]; b.Revision != 3 || b.UpdatedAt != 1000 {
+		t.Errorf("沒有變動的帳單 = %+v", b)
+	}
+	if b := after.Bills[1]; b.Revision != 4 || b.UpdatedAt != now.UnixMilli() {
+		t.Errorf("未來的編輯時間應改為現在, got %+v", b)
+	}
+	if b := after.Bills[2]; b.Revision != 4 || b.UpdatedAt != 2000 || b.UpdatedBy != "phone" {
+		t.Errorf("離線時的編輯時間應保留, got %+v", b)
+	}
+}
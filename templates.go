@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= 帳單範本 =================
+
+const (
+	splitModeEqual  = "equal"
+	splitModeShares = "shares"
+	splitModeIncome = "income" // 依成員的收入比例（Person.Weight）
+)
+
+// BillTemplate 常用的帳單樣式（「早餐，全員」），套用時只需要補上金額
+type BillTemplate struct {
+	ID           int             `json:"id"`
+	Name         string          `json:"name"`
+	Title        string          `json:"title"`
+	Category     string          `json:"category,omitempty"`
+	Currency     string          `json:"currency,omitempty"`
+	Amount       float64         `json:"amount,omitempty"` // 預設金額，0 代表每次套用時輸入
+	PaidBy       int             `json:"paidBy,omitempty"`
+	Participants []int           `json:"participants,omitempty"`
+	Groups       []int           `json:"groups,omitempty"`
+	SplitMode    string          `json:"splitMode,omitempty"` // "equal"（預設）、"shares" 或 "income"
+	Shares       map[int]float64 `json:"shares,omitempty"`
+}
+
+// FromTemplateRequest POST /api/bills/from-template/{id} 的內容，未填的欄位沿用範本
+type FromTemplateRequest struct {
+	Title    string  `json:"title,omitempty"`
+	Date     string  `json:"date,omitempty"` // 預設今天
+	Amount   float64 `json:"amount,omitempty"`
+	Currency string  `json:"currency,omitempty"`
+	PaidBy   int     `json:"paidBy,omitempty"`
+}
+
+var (
+	errTemplateNotFound = errors.New("template not found")
+	errInvalidTemplate  = errors.New("invalid template")
+)
+
+func validateTemplate(t *BillTemplate) error {
+	t.Name = strings.TrimSpace(t.Name)
+	t.Title = strings.TrimSpace(t.Title)
+	if t.Name == "" {
+		t.Name = t.Title
+	}
+	if t.Name == "" {
+		return fmt.Errorf("範本名稱不能是空白")
+	}
+	switch t.SplitMode {
+	case "", splitModeEqual, splitModeIncome:
+		if len(t.Shares) > 0 {
+			return fmt.Errorf("範本「%s」平均或依收入比例分攤時不能設定份數", t.Name)
+		}
+	case splitModeShares:
+		if len(t.Shares) == 0 {
+			return fmt.Errorf("範本「%s」依份數分攤時需要設定份數", t.Name)
+		}
+	default:
+		return fmt.Errorf("範本「%s」的分攤方式 %q 不支援", t.Name, t.SplitMode)
+	}
+	if t.Amount < 0 {
+		return fmt.Errorf("範本「%s」的預設金額不可為負數", t.Name)
+	}
+	return nil
+}
+
+// billFromTemplate 依範本與請求內容產生新帳單，ID 取目前（含垃圾桶）最大值加一
+func billFromTemplate(s *GlobalState, t BillTemplate, req FromTemplateRequest, today time.Time) (Bill, error) {
+	bill := Bill{
+		Title:        t.Title,
+		Date:         today.Format(billDateLayout),
+		Amount:       t.Amount,
+		Category:     t.Category,
+		Currency:     t.Currency,
+		PaidBy:       t.PaidBy,
+		Participants: append([]int{}, t.Participants...),
+		Groups:       append([]int(nil), t.Groups...),
+	}
+	if t.SplitMode == splitModeIncome {
+		bill.SplitMode = splitModeIncome
+	}
+	if t.SplitMode == splitModeShares {
+		bill.Shares = make(map[int]float64, len(t.Shares))
+		for pid, w := range t.Shares {
+			bill.Shares[pid] = w
+		}
+	}
+	if req.Title != "" {
+		bill.Title = req.Title
+	}
+	if req.Date != "" {
+		bill.Date = req.Date
+	}
+	if req.Amount != 0 {
+		bill.Amount = req.Amount
+	}
+	if req.Currency != "" {
+		bill.Currency = req.Currency
+	}
+	if req.PaidBy != 0 {
+		bill.PaidBy = req.PaidBy
+	}
+	if bill.Title == "" {
+		bill.Title = t.Name
+	}
+	if bill.Amount == 0 {
+		return Bill{}, fmt.Errorf("範本「%s」沒有預設金額，請輸入金額", t.Name)
+	}
+	if bill.PaidBy == 0 {
+		return Bill{}, fmt.Errorf("範本「%s」沒有預設付款人，請指定付款人", t.Name)
+	}
+
+	grouped, err := expandGroups(s.Groups, []Bill{bill})
+	if err != nil {
+		return Bill{}, err
+	}
+	if len(grouped[0].Participants) == 0 {
+		return Bill{}, fmt.Errorf("範本「%s」沒有參與者", t.Name)
+	}
+	known := make(map[int]bool, len(s.People))
+	for _, p := range s.People {
+		if p.DeletedAt == 0 {
+			known[p.ID] = true
+		}
+	}
+	if err := checkBillPeople(grouped[0], known); err != nil {
+		return Bill{}, err
+	}
+	if err := validateSplits(grouped); err != nil {
+		return Bill{}, err
+	}
+
+	bill.ID = 1
+	for _, b := range s.Bills {
+		if b.ID >= bill.ID {
+			bill.ID = b.ID + 1
+		}
+	}
+	return bill, nil
+}
+
+// handleTemplates GET 列出、POST 新增 /api/templates
+func handleTemplates(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		templates := state.Templates
+		if templates == nil {
+			templates = []BillTemplate{}
+		}
+		writeJSON(w, http.StatusOK, templates)
+
+	case http.MethodPost:
+		var t BillTemplate
+		if !decodeTemplate(w, r, &t) {
+			return
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			t.ID = 1
+			for _, existing := range s.Templates {
+				if existing.ID >= t.ID {
+					t.ID = existing.ID + 1
+				}
+			}
+			s.Templates = append(s.Templates, t)
+			return nil
+		})
+		if !templateUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, t)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleTemplate PUT 修改、DELETE 刪除 /api/templates/{id}
+func handleTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid template id")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var t BillTemplate
+		if !decodeTemplate(w, r, &t) {
+			return
+		}
+		t.ID = id
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			for i := range s.Templates {
+				if s.Templates[i].ID == id {
+					s.Templates[i] = t
+					return nil
+				}
+			}
+			return errTemplateNotFound
+		})
+		if !templateUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusOK, t)
+
+	case http.MethodDelete:
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			for i := range s.Templates {
+				if s.Templates[i].ID == id {
+					s.Templates = append(s.Templates[:i], s.Templates[i+1:]...)
+					return nil
+				}
+			}
+			return errTemplateNotFound
+		})
+		if !templateUpdateOK(w, err) {
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
+
+// handleBillFromTemplate POST /api/bills/from-template/{id}：套用範本新增一筆帳單
+func handleBillFromTemplate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid template id")
+		return
+	}
+
+	var req FromTemplateRequest
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+	if len(strings.TrimSpace(string(body))) > 0 {
+		if err := decodeJSON(body, &req); err != nil {
+			writeInvalidJSON(w, err)
+			return
+		}
+	}
+
+	var bill Bill
+	_, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		for _, t := range s.Templates {
+			if t.ID == id {
+				b, err := billFromTemplate(s, t, req, clock.Now())
+				if err != nil {
+					return fmt.Errorf("%w: %v", errInvalidTemplate, err)
+				}
+				bill = b
+				s.Bills = append(s.Bills, bill)
+				ensureBillCategories(s)
+				return nil
+			}
+		}
+		return errTemplateNotFound
+	})
+	if !templateUpdateOK(w, err) {
+		return
+	}
+	writeJSON(w, http.StatusCreated, bill)
+}
+
+func decodeTemplate(w http.ResponseWriter, r *http.Request, t *BillTemplate) bool {
+	body, err := readBody(w, r)
+	if err != nil {
+		return false
+	}
+	if err := decodeJSON(body, t); err != nil {
+		writeInvalidJSON(w, err)
+		return false
+	}
+	if err := validateTemplate(t); err != nil {
+		writeErrorFor(w, http.StatusBadRequest, err)
+		return false
+	}
+	return true
+}
+
+// templateUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func templateUpdateOK(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errTemplateNotFound):
+		writeError(w, http.StatusNotFound, "template not found")
+	case errors.Is(err, errInvalidTemplate):
+		writeErrorFor(w, http.StatusBadRequest, err)
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 帳單範本與快速新增測試
+// ==========================================
+func TestBillFromTemplate(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}, {ID: 3, Name: "Charlie"}}
+	state.Bills = []Bill{{ID: 4, Title: "Hotel", Amount: 3000, PaidBy: 1, Participants: []int{1, 2, 3}}}
+	state.Groups = []Group{{ID: 1, Name: "Everyone", Members: []int{1, 2, 3}}}
+	withRoomState(t, state)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/templates", handleTemplates)
+	mux.HandleFunc("/api/templates/{id}", handleTemplate)
+	mux.HandleFunc("/api/bills/{id}/{rest...}", handleBillSubresource)
+	mux.HandleFunc("/api/bills/from-template/{id}", handleBillFromTemplate)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return rec
+	}
+
+	rec := do(http.MethodPost, "/api/templates", `{"name":"早餐","title":"Breakfast","category":"飲食","groups":[1]}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("新增範本失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/api/templates", `{"name":"X","splitMode":"shares"}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("依份數分攤卻沒設定份數應回傳 400, got %d", rec.Code)
+	}
+
+	if rec := do(http.MethodPost, "/api/bills/from-template/1", `{"paidBy":2}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("範本沒有金額且未輸入時應回傳 400, got %d", rec.Code)
+	}
+	rec = do(http.MethodPost, "/api/bills/from-template/1", `{"amount":450,"paidBy":2,"date":"2025-05-02"}`)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("套用範本失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	var bill Bill
+	if err := json.Unmarshal(rec.Body.Bytes(), &bill); err != nil {
+		t.Fatal(err)
+	}
+	if bill.ID != 5 || bill.Title != "Breakfast" || bill.Category != "飲食" || bill.Date != "2025-05-02" || len(bill.Groups) != 1 {
+		t.Errorf("產生的帳單不正確: %+v", bill)
+	}
+	state, _ = currentState()
+	if len(state.Bills) != 2 {
+		t.Errorf("帳單應新增到狀態中: %+v", state.Bills)
+	}
+
+	if rec := do(http.MethodPost, "/api/bills/from-template/9", `{"amount":1}`); rec.Code != http.StatusNotFound {
+		t.Errorf("不存在的範本應回傳 404, got %d", rec.Code)
+	}
+	if rec := do(http.MethodDelete, "/api/templates/1", ""); rec.Code != http.StatusNoContent {
+		t.Errorf("刪除範本失敗: %d", rec.Code)
+	}
+}
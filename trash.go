@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ================= 垃圾桶（軟刪除與還原） =================
+
+// trashRetention 軟刪除的項目保留多久後永久清除
+var trashRetention = 30 * 24 * time.Hour
+
+type TrashResponse struct {
+	People []Person `json:"people"`
+	Bills  []Bill   `json:"bills"`
+}
+
+type RestoreRequest struct {
+	Kind string `json:"kind"` // "bill" 或 "person"
+	ID   int    `json:"id"`
+}
+
+// overlaySyncedState 把客戶端送來的 JSON 疊在目前狀態上：
+// 人員與帳單一律以客戶端為準，其餘伺服器管理的欄位（快照等）沒送就保留原值
+func overlaySyncedState(cur GlobalState, body []byte) GlobalState {
+	incoming := cloneState(cur)
+	incoming.People, incoming.Bills = nil, nil
+	if err := json.Unmarshal(body, &incoming); err != nil {
+		return cur
+	}
+	return incoming
+}
+
+// mergeWithTrash 套用客戶端送來的完整狀態：客戶端不再列出的帳單/人員
+// 不直接丟掉，而是標記 DeletedAt 留在垃圾桶裡
+func mergeWithTrash(cur, incoming GlobalState, now time.Time) GlobalState {
+	stamp := now.UnixMilli()
+	merged := incoming
+	// webhook、封存分別只透過 /api/webhooks、/api/rooms/{code}/archive 管理，客戶端送來（或快照還原）的狀態不會帶
+	merged.Webhooks = cur.Webhooks
+	merged.ArchivedAt = cur.ArchivedAt
+
+	livePeople := make(map[int]bool, len(incoming.People))
+	for i := range merged.People {
+		merged.People[i].DeletedAt = 0
+		livePeople[merged.People[i].ID] = true
+	}
+	nextPersonID := maxPersonID(cur.People, incoming.People) + 1
+	for _, p := range cur.People {
+		if p.DeletedAt == 0 && livePeople[p.ID] {
+			continue
+		}
+		if p.DeletedAt == 0 {
+			p.DeletedAt = stamp
+		} else if livePeople[p.ID] {
+			// 客戶端重複使用了垃圾桶裡的 ID，把垃圾桶的項目換個 ID 保留
+			p.ID = nextPersonID
+			nextPersonID++
+		}
+		merged.People = append(merged.People, p)
+	}
+
+	liveBills := make(map[int]bool, len(incoming.Bills))
+	for i := range merged.Bills {
+		merged.Bills[i].DeletedAt = 0
+		liveBills[merged.Bills[i].ID] = true
+	}
+	nextBillID := maxBillID(cur.Bills, incoming.Bills) + 1
+	for _, b := range cur.Bills {
+		if b.DeletedAt == 0 && liveBills[b.ID] {
+			continue
+		}
+		if b.DeletedAt == 0 {
+			b.DeletedAt = stamp
+		} else if liveBills[b.ID] {
+			b.ID = nextBillID
+			nextBillID++
+		}
+		merged.Bills = append(merged.Bills, b)
+	}
+
+	purgeTrash(&merged, now)
+	return merged
+}
+
+// purgeTrash 永久移除超過保留期限的軟刪除項目
+func purgeTrash(state *GlobalState, now time.Time) {
+	cutoff := now.Add(-trashRetention).UnixMilli()
+
+	people := state.People[:0]
+	for _, p := range state.People {
+		if p.DeletedAt == 0 || p.DeletedAt > cutoff {
+			people = append(people, p)
+		}
+	}
+	state.People = people
+
+	bills := state.Bills[:0]
+	for _, b := range state.Bills {
+		if b.DeletedAt == 0 || b.DeletedAt > cutoff {
+			bills = append(bills, b)
+		}
+	}
+	state.Bills = bills
+}
+
+// visibleState 回傳不含垃圾桶項目的狀態，給前端同步使用
+func visibleState(state GlobalState) GlobalState {
+	people := make([]Person, 0, len(state.People))
+	for _, p := range state.People {
+		if p.DeletedAt == 0 {
+			people = append(people, p)
+		}
+	}
+	bills := make([]Bill, 0, len(state.Bills))
+	for _, b := range state.Bills {
+		if b.DeletedAt == 0 {
+			bills = append(bills, b)
+		}
+	}
+	state.People = people
+	state.Bills = bills
+	state.Snapshots = nil
+	state.Activity = nil
+	state.BillHistory = nil
+	state.Webhooks = nil
+	return state
+}
+
+func trashOf(state GlobalState) TrashResponse {
+	resp := TrashResponse{People: []Person{}, Bills: []Bill{}}
+	for _, p := range state.People {
+		if p.DeletedAt != 0 {
+			resp.People = append(resp.People, p)
+		}
+	}
+	for _, b := range state.Bills {
+		if b.DeletedAt != 0 {
+			resp.Bills = append(resp.Bills, b)
+		}
+	}
+	return resp
+}
+
+func maxPersonID(lists ...[]Person) int {
+	top := 0
+	for _, list := range lists {
+		for _, p := range list {
+			if p.ID > top {
+				top = p.ID
+			}
+		}
+	}
+	return top
+}
+
+func maxBillID(lists ...[]Bill) int {
+	top := 0
+	for _, list := range lists {
+		for _, b := range list {
+			if b.ID > top {
+				top = b.ID
+			}
+		}
+	}
+	return top
+}
+
+// handleTrash 列出垃圾桶中的帳單與人員
+func handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	state, err := roomOf(r).currentState()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "load state failed")
+		return
+	}
+	purgeTrash(&state, clock.Now())
+
+	writeJSON(w, http.StatusOK, trashOf(state))
+}
+
+var errNotInTrash = errors.New("not in trash")
+
+// handleTrashRestore 將垃圾桶中的項目放回
+func handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		return
+	}
+
+	var req RestoreRequest
+	if err := decodeJSON(body, &req); err != nil {
+		writeInvalidJSON(w, err)
+		return
+	}
+	if req.Kind != "bill" && req.Kind != "person" {
+		writeError(w, http.StatusBadRequest, `kind must be "bill" or "person"`)
+		return
+	}
+
+	state, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		return restoreFromTrash(s, req)
+	})
+	if errors.Is(err, errNotInTrash) {
+		writeError(w, http.StatusNotFound, "not found in trash")
+		return
+	}
+	if err != nil {
+		log.Printf("restore failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, visibleState(state))
+}
+
+func restoreFromTrash(s *GlobalState, req RestoreRequest) error {
+	switch req.Kind {
+	case "person":
+		for i := range s.People {
+			if s.People[i].ID == req.ID && s.People[i].DeletedAt != 0 {
+				s.People[i].DeletedAt = 0
+				return nil
+			}
+		}
+	case "bill":
+		for i := range s.Bills {
+			if s.Bills[i].ID == req.ID && s.Bills[i].DeletedAt != 0 {
+				s.Bills[i].DeletedAt = 0
+				return nil
+			}
+		}
+	}
+	return errNotInTrash
+}
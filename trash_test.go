@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ==========================================
+// 軟刪除與還原測試
+// ==========================================
+func TestMergeWithTrash(t *testing.T) {
+	now := time.Now()
+	cur := newGlobalState()
+	cur.People = []Person{{ID: 1, Name: "Alice"}, {ID: 2, Name: "Bob"}}
+	cur.Bills = []Bill{
+		{ID: 1, Title: "Taxi", Amount: 300, PaidBy: 1, Participants: []int{1, 2}},
+		{ID: 2, Title: "Lunch", Amount: 600, PaidBy: 2, Participants: []int{1, 2}},
+	}
+
+	// 手機刪掉了 Lunch，接著新增一筆沿用 ID 2 的帳單
+	incoming := newGlobalState()
+	incoming.People = cur.People
+	incoming.Bills = []Bill{cur.Bills[0]}
+	merged := mergeWithTrash(cloneState(cur), cloneState(incoming), now)
+
+	incoming.Bills = append(incoming.Bills, Bill{ID: 2, Title: "Museum", Amount: 500, PaidBy: 1, Participants: []int{1, 2}})
+	merged = mergeWithTrash(merged, incoming, now)
+
+	trash := trashOf(merged)
+	if len(trash.Bills) != 1 || trash.Bills[0].Title != "Lunch" {
+		t.Fatalf("Lunch 應該進入垃圾桶, got %+v", trash.Bills)
+	}
+	if trash.Bills[0].ID == 2 {
+		t.Error("垃圾桶中的帳單與現有帳單 ID 重複")
+	}
+	if visible := visibleState(merged); len(visible.Bills) != 2 {
+		t.Errorf("前端應只看到 2 筆帳單, got %+v", visible.Bills)
+	}
+
+	if err := restoreFromTrash(&merged, RestoreRequest{Kind: "bill", ID: trash.Bills[0].ID}); err != nil {
+		t.Fatalf("還原失敗: %v", err)
+	}
+	if len(visibleState(merged).Bills) != 3 {
+		t.Error("還原後應有 3 筆帳單")
+	}
+
+	// 超過保留期限的項目會被永久清除
+	merged.Bills[0].DeletedAt = now.Add(-2 * trashRetention).UnixMilli()
+	purgeTrash(&merged, now)
+	if len(merged.Bills) != 2 {
+		t.Errorf("過期項目未清除, got %d 筆", len(merged.Bills))
+	}
+}
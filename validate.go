@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// ================= 人員與帳單驗證 =================
+
+// FieldError 單一欄位的驗證錯誤，Field 為 JSON 路徑（例如 bills[2].paidBy）
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors 一次回報所有問題，讓前端可以逐欄標示，而不是改一個送一次
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, len(v))
+	for i, e := range v {
+		msgs[i] = e.Message
+	}
+	return strings.Join(msgs, "；")
+}
+
+// validatePeopleAndBills 檢查人員 ID 不重複、名字不是空白，帳單的付款人與參與者都在名單內，
+// 金額不是 NaN/Inf。臨時參加者與群組不在這裡展開，分別由 expandGuests、expandGroups 檢查
+func validatePeopleAndBills(people []Person, bills []Bill) ValidationErrors {
+	var errs ValidationErrors
+	add := func(field, format string, args ...any) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	known := make(map[int]bool, len(people))
+	for i, p := range people {
+		if known[p.ID] {
+			add(fmt.Sprintf("people[%d].id", i), "人員 ID %d 重複", p.ID)
+		}
+		known[p.ID] = true
+		if strings.TrimSpace(p.Name) == "" {
+			add(fmt.Sprintf("people[%d].name", i), "第 %d 位人員的名字不能是空白", i+1)
+		}
+		if p.Weight < 0 || math.IsNaN(p.Weight) || math.IsInf(p.Weight, 0) {
+			add(fmt.Sprintf("people[%d].weight", i), "成員「%s」的收入比例必須是非負數", p.Name)
+		}
+		if cur := strings.TrimSpace(p.PreferredCurrency); cur != "" && !isCurrencyCode(strings.ToUpper(cur)) {
+			add(fmt.Sprintf("people[%d].preferredCurrency", i), "成員「%s」的偏好幣別 %q 格式錯誤", p.Name, cur)
+		}
+	}
+
+	for i, b := range bills {
+		field := fmt.Sprintf("bills[%d]", i)
+		if math.IsNaN(b.Amount) || math.IsInf(b.Amount, 0) {
+			add(field+".amount", "帳單「%s」的金額無效", b.Title)
+		}
+		if f := b.FXFeePercent; f != nil && (*f < 0 || math.IsNaN(*f) || math.IsInf(*f, 0)) {
+			add(field+".fxFeePercent", "帳單「%s」的海外交易手續費必須是非負數", b.Title)
+		}
+		if b.SplitMode != "" && b.SplitMode != splitModeIncome {
+			add(field+".splitMode", "帳單「%s」的分攤方式 %q 不支援", b.Title, b.SplitMode)
+		}
+		if len(b.Payers) == 0 && !known[b.PaidBy] {
+			add(field+".paidBy", "帳單「%s」的付款人 ID %d 不存在", b.Title, b.PaidBy)
+		}
+		for j, p := range b.Payers {
+			if !known[p.PersonID] {
+				add(fmt.Sprintf("%s.payers[%d].personId", field, j), "帳單「%s」的付款人 ID %d 不存在", b.Title, p.PersonID)
+			}
+			if math.IsNaN(p.Amount) || math.IsInf(p.Amount, 0) {
+				add(fmt.Sprintf("%s.payers[%d].amount", field, j), "帳單「%s」的付款金額無效", b.Title)
+			}
+		}
+		for j, pid := range b.Participants {
+			if !known[pid] {
+				add(fmt.Sprintf("%s.participants[%d]", field, j), "帳單「%s」的參與者 ID %d 不存在", b.Title, pid)
+			}
+		}
+		for j, item := range b.LineItems {
+			if math.IsNaN(item.Amount) || math.IsInf(item.Amount, 0) {
+				add(fmt.Sprintf("%s.lineItems[%d].amount", field, j), "帳單「%s」的品項「%s」金額無效", b.Title, item.Name)
+			}
+			for k, pid := range item.Participants {
+				if !known[pid] {
+					add(fmt.Sprintf("%s.lineItems[%d].participants[%d]", field, j, k), "帳單「%s」的品項「%s」參與者 ID %d 不存在", b.Title, item.Name, pid)
+				}
+			}
+		}
+	}
+	return errs
+}
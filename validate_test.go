@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ==========================================
+// 人員與帳單驗證測試
+// ==========================================
+func TestValidatePeopleAndBills(t *testing.T) {
+	people := []Person{{ID: 1, Name: "Alice"}, {ID: 1, Name: "Bob"}, {ID: 3, Name: "  "}}
+	bills := []Bill{
+		{Title: "Dinner", Amount: 300, PaidBy: 9, Participants: []int{1, 4}},
+		{Title: "Taxi", Amount: math.NaN(), PaidBy: 1, Participants: []int{1}},
+		{Title: "Hotel", Amount: 900, PaidBy: 1, Participants: []int{1, 3}},
+	}
+
+	errs := validatePeopleAndBills(people, bills)
+	got := make(map[string]bool, len(errs))
+	for _, e := range errs {
+		got[e.Field] = true
+	}
+	for _, field := range []string{"people[1].id", "people[2].name", "bills[0].paidBy", "bills[0].participants[1]", "bills[1].amount"} {
+		if !got[field] {
+			t.Errorf("應回報欄位 %s 的錯誤, got %+v", field, errs)
+		}
+	}
+	if len(errs) != 5 {
+		t.Errorf("應回報 5 個錯誤, got %d: %+v", len(errs), errs)
+	}
+
+	if errs := validatePeopleAndBills(people[:1], bills[2:2]); len(errs) != 0 {
+		t.Errorf("正確的資料不應有錯誤: %+v", errs)
+	}
+}
+
+func TestProcessCalculate_FieldErrors(t *testing.T) {
+	req := `{"baseCurrency":"TWD","people":[{"id":1,"name":"Alice"}],"bills":[{"title":"Taxi","amount":100,"currency":"TWD","paidBy":2,"participants":[1]}]}`
+	var resp CalculateResponse
+	if err := json.Unmarshal([]byte(processCalculate(req)), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Errors) != 1 || resp.Errors[0].Field != "bills[0].paidBy" || resp.Error == "" {
+		t.Errorf("應回傳欄位層級錯誤, got %+v", resp)
+	}
+}
+
+func TestSync_RejectsInvalidState(t *testing.T) {
+	withRoomState(t, newGlobalState())
+
+	body := `{"people":[{"id":1,"name":"Alice"}],"bills":[{"id":1,"title":"Taxi","amount":100,"paidBy":1,"participants":[1,2]}]}`
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/sync", strings.NewReader(body))
+	ifMatchCurrent(req)
+	handleSync(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("參與者不存在應回傳 400, got %d", rec.Code)
+	}
+	var resp validationErrorBody
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil || len(resp.Details) != 1 || resp.Field != "bills[0].participants[1]" {
+		t.Errorf("回應應包含欄位錯誤: %s", rec.Body.String())
+	}
+
+	state, _ := currentState()
+	if len(state.Bills) != 0 {
+		t.Error("驗證失敗時不應寫入狀態")
+	}
+}
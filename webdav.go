@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= WebDAV 遠端狀態檔 =================
+
+// WebDAVStore 把狀態檔放在 WebDAV（如 Nextcloud）上，讓兩台電腦共用同一趟旅程。
+// 房間透過 Update 修改：先取回遠端最新的狀態再套用修改，以 ETag 做條件式 PUT，
+// 期間被另一台改過就重新讀取再套用，兩台的修改都會保留。
+// 直接 Save 整份狀態時（還原備份、匯入）遠端若被改過，LastUpdated 較新的一方勝出，
+// 較舊的一方另存成衝突副本，不會直接消失
+type WebDAVStore struct {
+	mu       sync.Mutex
+	url      string
+	user     string
+	password string
+	client   *http.Client
+	cipher   *stateCipher
+	etag     string      // 上次讀取或寫入時遠端的 ETag
+	exists   bool        // 遠端檔案是否存在
+	last     GlobalState // 對應 etag 的遠端狀態，條件式 GET 回 304 時直接使用
+}
+
+var (
+	errRemoteNewer = errors.New("遠端狀態較新，本機修改已另存為衝突副本")
+	errRemoteBusy  = errors.New("遠端狀態持續被其他裝置修改，請稍後再試")
+)
+
+// webdavUpdateAttempts Update 遇到 412 時最多重新讀取、套用幾次
+const webdavUpdateAttempts = 5
+
+func NewWebDAVStore(url, user, password, passphrase string) *WebDAVStore {
+	ws := &WebDAVStore{
+		url:      url,
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+	if passphrase != "" {
+		ws.cipher = newStateCipher(passphrase)
+	}
+	return ws
+}
+
+// webdavRoomURL 房間狀態檔的網址：與預設狀態檔放在同一個目錄，檔名加上房間代碼
+// （state.json → state-ABC234.json），不必另外建立目錄
+func webdavRoomURL(stateURL, code string) string {
+	base, query, _ := strings.Cut(stateURL, "?")
+	dir, name := "", base
+	if i := strings.LastIndex(base, "/"); i >= 0 {
+		dir, name = base[:i+1], base[i+1:]
+	}
+	stem, ext := name, ""
+	if i := strings.LastIndex(name, "."); i > 0 {
+		stem, ext = name[:i], name[i:]
+	}
+	u := dir + stem + "-" + code + ext
+	if query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+func (ws *WebDAVStore) Load() (GlobalState, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.loadLocked()
+}
+
+// loadLocked 取回遠端狀態；已有 ETag 時以 If-None-Match 詢問，沒變就不必重新下載
+func (ws *WebDAVStore) loadLocked() (GlobalState, error) {
+	header := http.Header{}
+	if ws.etag != "" {
+		header.Set("If-None-Match", ws.etag)
+	}
+	resp, err := ws.request(http.MethodGet, ws.url, header, nil)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && ws.etag != "" {
+		return cloneState(ws.last), nil
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		ws.etag, ws.exists, ws.last = "", false, GlobalState{}
+		return newGlobalState(), nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return GlobalState{}, fmt.Errorf("WebDAV GET: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	state, err := decodeStateFile(data, ws.cipher)
+	if err != nil {
+		return GlobalState{}, err
+	}
+	ws.etag, ws.exists, ws.last = resp.Header.Get("ETag"), true, cloneState(state)
+	return state, nil
+}
+
+// Update 讀取遠端最新的狀態、套用 fn 後條件式寫回；遠端在這之間被改過（412）就重來
+func (ws *WebDAVStore) Update(fn func(state *GlobalState) error) (GlobalState, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for range webdavUpdateAttempts {
+		state, err := ws.loadLocked()
+		if err != nil {
+			return GlobalState{}, err
+		}
+		if err := fn(&state); err != nil {
+			return GlobalState{}, err
+		}
+		data, err := encodeStateFile(state, ws.cipher)
+		if err != nil {
+			return GlobalState{}, err
+		}
+		ok, err := ws.putLocked(state, data)
+		if err != nil {
+			return GlobalState{}, err
+		}
+		if ok {
+			return state, nil
+		}
+	}
+	return GlobalState{}, errRemoteBusy
+}
+
+func (ws *WebDAVStore) Save(state GlobalState) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	data, err := encodeStateFile(state, ws.cipher)
+	if err != nil {
+		return err
+	}
+	// 已經知道遠端比這份新（例如上次衝突落敗後又存同一份）：不送出，免得帶著新的 ETag 蓋掉遠端
+	if ws.exists && state.LastUpdated < ws.last.LastUpdated {
+		if err := ws.putConflictCopy(data, state.LastUpdated); err != nil {
+			return err
+		}
+		return errRemoteNewer
+	}
+
+	ok, err := ws.putLocked(state, data)
+	if err != nil || ok {
+		return err
+	}
+	return ws.resolveConflictLocked(state, data)
+}
+
+// putLocked 以上次看到的 ETag 做條件式 PUT；遠端已被改過時回傳 false
+func (ws *WebDAVStore) putLocked(state GlobalState, data []byte) (bool, error) {
+	header := http.Header{}
+	switch {
+	case ws.etag != "":
+		header.Set("If-Match", ws.etag)
+	case !ws.exists:
+		header.Set("If-None-Match", "*")
+	}
+
+	resp, err := ws.request(http.MethodPut, ws.url, header, data)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusPreconditionFailed:
+		return false, nil
+	case resp.StatusCode/100 != 2:
+		return false, fmt.Errorf("WebDAV PUT: HTTP %d", resp.StatusCode)
+	}
+	ws.etag, ws.exists, ws.last = resp.Header.Get("ETag"), true, cloneState(state)
+	return true, nil
+}
+
+// resolveConflictLocked 遠端在上次讀取後被其他裝置修改：last-writer-wins，輸家另存衝突副本
+func (ws *WebDAVStore) resolveConflictLocked(local GlobalState, localData []byte) error {
+	remote, err := ws.loadLocked()
+	if err != nil {
+		return err
+	}
+
+	if remote.LastUpdated > local.LastUpdated {
+		if err := ws.putConflictCopy(localData, local.LastUpdated); err != nil {
+			return err
+		}
+		return errRemoteNewer
+	}
+
+	remoteData, err := encodeStateFile(remote, ws.cipher)
+	if err != nil {
+		return err
+	}
+	if err := ws.putConflictCopy(remoteData, remote.LastUpdated); err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	if ws.etag != "" {
+		header.Set("If-Match", ws.etag)
+	}
+	resp, err := ws.request(http.MethodPut, ws.url, header, localData)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("WebDAV PUT: HTTP %d", resp.StatusCode)
+	}
+	ws.etag, ws.exists, ws.last = resp.Header.Get("ETag"), true, cloneState(local)
+	return nil
+}
+
+// putConflictCopy 以落敗版本的 LastUpdated 命名衝突副本
+func (ws *WebDAVStore) putConflictCopy(data []byte, lastUpdated int64) error {
+	stamp := time.UnixMilli(lastUpdated).Format("20060102-150405.000")
+	target := strings.TrimSuffix(ws.url, ".json") + ".conflict-" + stamp + ".json"
+	resp, err := ws.request(http.MethodPut, target, nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("WebDAV PUT conflict copy: HTTP %d", resp.StatusCode)
+	}
+	log.Printf("webdav: state conflict, saved copy to %s", target)
+	return nil
+}
+
+func (ws *WebDAVStore) request(method, url string, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if ws.user != "" {
+		req.SetBasicAuth(ws.user, ws.password)
+	}
+	return ws.client.Do(req)
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ==========================================
+// WebDAV 衝突處理測試
+// ==========================================
+
+// fakeDAV 支援 ETag / If-Match / If-None-Match 的最小 WebDAV 伺服器
+type fakeDAV struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	rev   map[string]int
+	gets  int // 回傳完整內容的 GET 次數
+}
+
+func (d *fakeDAV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, ok := d.files[r.URL.Path]
+	etag := fmt.Sprintf(`"%d"`, d.rev[r.URL.Path])
+	switch r.Method {
+	case http.MethodGet:
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		d.gets++
+		w.Write(data)
+	case http.MethodPut:
+		if m := r.Header.Get("If-Match"); m != "" && (!ok || m != etag) {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		if r.Header.Get("If-None-Match") == "*" && ok {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		d.files[r.URL.Path] = body
+		d.rev[r.URL.Path]++
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, d.rev[r.URL.Path]))
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+func TestWebDAVStore_LastWriterWinsWithConflictCopy(t *testing.T) {
+	dav := &fakeDAV{files: map[string][]byte{}, rev: map[string]int{}}
+	srv := httptest.NewServer(dav)
+	defer srv.Close()
+
+	laptopA := NewWebDAVStore(srv.URL+"/trip.json", "", "", "")
+	laptopB := NewWebDAVStore(srv.URL+"/trip.json", "", "", "")
+
+	state, _ := laptopA.Load()
+	laptopB.Load()
+
+	state.BaseCurrency, state.LastUpdated = "EUR", 100
+	if err := laptopA.Save(state); err != nil {
+		t.Fatalf("A 存檔失敗: %v", err)
+	}
+
+	// B 沒看過 A 的修改，但時間較新 → B 勝出，A 的版本另存衝突副本
+	state.BaseCurrency, state.LastUpdated = "JPY", 200
+	if err := laptopB.Save(state); err != nil {
+		t.Fatalf("B 存檔失敗: %v", err)
+	}
+
+	// A 再用舊的時間存檔 → 遠端較新，A 的修改另存衝突副本
+	state.BaseCurrency, state.LastUpdated = "USD", 150
+	if err := laptopA.Save(state); !errors.Is(err, errRemoteNewer) {
+		t.Fatalf("應回傳 errRemoteNewer, got %v", err)
+	}
+
+	// A 沒有重新讀取又存了同一份舊狀態：不能因為 ETag 已更新就蓋掉遠端
+	if err := laptopA.Save(state); !errors.Is(err, errRemoteNewer) {
+		t.Fatalf("再次存舊狀態應回傳 errRemoteNewer, got %v", err)
+	}
+	final, _ := NewWebDAVStore(srv.URL+"/trip.json", "", "", "").Load()
+	if final.BaseCurrency != "JPY" {
+		t.Errorf("遠端應保留較新的 JPY, got %s", final.BaseCurrency)
+	}
+	if got, _ := laptopA.Load(); got.BaseCurrency != "JPY" {
+		t.Errorf("A 重新讀取後應看到 JPY, got %s", got.BaseCurrency)
+	}
+	conflicts := 0
+	for path := range dav.files {
+		if strings.Contains(path, ".conflict-") {
+			conflicts++
+		}
+	}
+	if conflicts != 2 {
+		t.Errorf("應有 2 份衝突副本, got %d", conflicts)
+	}
+}
+
+func TestWebDAVStore_RoomsConverge(t *testing.T) {
+	dav := &fakeDAV{files: map[string][]byte{}, rev: map[string]int{}}
+	srv := httptest.NewServer(dav)
+	defer srv.Close()
+
+	// 兩台電腦各自的房間共用同一個遠端狀態檔
+	laptopA, laptopB := newRoom("", GlobalState{}), newRoom("", GlobalState{})
+	for _, rm := range []*room{laptopA, laptopB} {
+		if err := rm.loadStore(NewWebDAVStore(srv.URL+"/trip.json", "", "", "")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	edit := func(rm *room, fn func(s *GlobalState)) {
+		t.Helper()
+		if _, err := rm.updateStateAs(Actor{}, func(s *GlobalState) error {
+			fn(s)
+			return nil
+		}); err != nil {
+			t.Fatalf("修改失敗: %v", err)
+		}
+	}
+
+	edit(laptopA, func(s *GlobalState) { s.People = append(s.People, Person{ID: 1, Name: "Alice"}) })
+	// B 還沒讀過 A 的修改：寫入前先取回遠端，A 的人員不會被蓋掉
+	edit(laptopB, func(s *GlobalState) {
+		s.Bills = append(s.Bills, Bill{ID: 1, Title: "Hotel", Amount: 300, PaidBy: 1, Participants: []int{1}})
+	})
+	edit(laptopA, func(s *GlobalState) { s.BaseCurrency = "JPY" })
+
+	for name, rm := range map[string]*room{"A": laptopA, "B": laptopB} {
+		state, err := rm.currentState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(state.People) != 1 || len(state.Bills) != 1 || state.BaseCurrency != "JPY" || state.Revision != 3 {
+			t.Errorf("%s 應看到兩台的修改, got %d 人 %d 帳單 %s revision %d", name, len(state.People), len(state.Bills), state.BaseCurrency, state.Revision)
+		}
+	}
+
+	// 遠端沒有變動時以 If-None-Match 詢問，不重新下載
+	gets := func() int {
+		dav.mu.Lock()
+		defer dav.mu.Unlock()
+		return dav.gets
+	}
+	before := gets()
+	laptopA.currentState()
+	laptopA.currentState()
+	if n := gets() - before; n != 0 {
+		t.Errorf("遠端未變動時不應重新下載, got %d 次", n)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ================= Webhook =================
+
+// maxWebhooks 可登記的 webhook 數量上限
+const maxWebhooks = 20
+
+const (
+	webhookSignatureHeader = "X-Splitter-Signature"
+	webhookEventHeader     = "X-Splitter-Event"
+	webhookDeliveryHeader  = "X-Splitter-Delivery"
+)
+
+var (
+	// webhookAttempts 每個事件最多送幾次（含第一次）
+	webhookAttempts = 5
+	// webhookRetryBase 第一次重試前等待的時間，之後每次加倍
+	webhookRetryBase = time.Second
+	webhookClient    = &http.Client{Timeout: 10 * time.Second}
+)
+
+// webhookEvents 可以訂閱的事件，與 /api/events 相同
+var webhookEvents = []string{eventBillAdded, eventStateUpdated, eventCalculationDone}
+
+// Webhook 事件發生時，伺服器以 POST 把事件送到 URL；Events 空的代表訂閱全部事件。
+// Secret 用來簽章，只在建立時的回應中出現，列表不回傳
+type Webhook struct {
+	ID        int      `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events,omitempty"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt int64    `json:"createdAt"`
+}
+
+// CreateWebhookRequest POST /api/webhooks 的內容；Secret 沒填時由伺服器產生
+type CreateWebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+// WebhookPayload 送出的內容；ID 與 /api/events 的事件編號相同，重試時不變，可用來去除重複
+type WebhookPayload struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	Timestamp int64           `json:"timestamp"` // 第一次送出的時間（Unix 秒）
+	Data      json.RawMessage `json:"data"`
+}
+
+var (
+	errWebhookNotFound = errors.New("webhook not found")
+	errInvalidWebhook  = errors.New("invalid webhook")
+)
+
+func (h Webhook) wants(event string) bool {
+	return len(h.Events) == 0 || slices.Contains(h.Events, event)
+}
+
+func validateWebhook(req *CreateWebhookRequest) error {
+	req.URL = strings.TrimSpace(req.URL)
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: url 必須是完整的 http 或 https 網址", errInvalidWebhook)
+	}
+	for _, e := range req.Events {
+		if !slices.Contains(webhookEvents, e) {
+			return fmt.Errorf("%w: 不支援的事件 %q（可用：%s）", errInvalidWebhook, e, strings.Join(webhookEvents, "、"))
+		}
+	}
+	return nil
+}
+
+// newWebhookSecret 產生 32 bytes 的隨機金鑰（十六進位）
+func newWebhookSecret() string {
+	buf := make([]byte, 32)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// signWebhook X-Splitter-Signature 的值：sha256= 加上以 secret 對整個 body 算的 HMAC-SHA256（十六進位）
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleWebhooks GET 列出、POST 登記 /api/webhooks
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		state, err := roomOf(r).currentState()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "load state failed")
+			return
+		}
+		hooks := make([]Webhook, 0, len(state.Webhooks))
+		for _, h := range state.Webhooks {
+			h.Secret = ""
+			hooks = append(hooks, h)
+		}
+		writeJSON(w, http.StatusOK, hooks)
+
+	case http.MethodPost:
+		var req CreateWebhookRequest
+		if !decodeResource(w, r, &req) {
+			return
+		}
+		if err := validateWebhook(&req); err != nil {
+			writeErrorFor(w, http.StatusBadRequest, err)
+			return
+		}
+		hook := Webhook{URL: req.URL, Events: slices.Compact(slices.Sorted(slices.Values(req.Events))), Secret: req.Secret, CreatedAt: clock.Now().UnixMilli()}
+		if hook.Secret == "" {
+			hook.Secret = newWebhookSecret()
+		}
+		_, err := roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+			if len(s.Webhooks) >= maxWebhooks {
+				return fmt.Errorf("%w: 最多只能登記 %d 個 webhook", errInvalidWebhook, maxWebhooks)
+			}
+			hook.ID = 1
+			for _, existing := range s.Webhooks {
+				if existing.ID >= hook.ID {
+					hook.ID = existing.ID + 1
+				}
+			}
+			s.Webhooks = append(s.Webhooks, hook)
+			return nil
+		})
+		if !webhookUpdateOK(w, err) {
+			return
+		}
+		writeJSON(w, http.StatusCreated, hook)
+	}
+}
+
+// handleWebhook DELETE /api/webhooks/{id}：取消登記，還在重試中的事件不再送出
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+	_, err = roomOf(r).updateStateAs(actorFromRequest(r), func(s *GlobalState) error {
+		for i := range s.Webhooks {
+			if s.Webhooks[i].ID == id {
+				s.Webhooks = slices.Delete(s.Webhooks, i, i+1)
+				return nil
+			}
+		}
+		return errWebhookNotFound
+	})
+	if !webhookUpdateOK(w, err) {
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// webhookUpdateOK 將 updateState 的錯誤對應成 HTTP 狀態碼，成功時回傳 true
+func webhookUpdateOK(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, errWebhookNotFound):
+		writeError(w, http.StatusNotFound, "webhook not found")
+	case errors.Is(err, errInvalidWebhook):
+		writeErrorFor(w, http.StatusBadRequest, err)
+	default:
+		log.Printf("update state failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "save state failed")
+	}
+	return false
+}
+
+// runWebhookLoop 依序讀取房間 lastID 之後的事件，交給訂閱的 webhook，直到 ctx 結束。
+// 每次送出各自重試，不同事件抵達的順序不保證，接收端可依 payload 的 id 排序
+func (rm *room) runWebhookLoop(ctx context.Context, lastID int64) {
+	for {
+		next := rm.events.changes.wait()
+		events, ok := rm.events.since(lastID)
+		if !ok {
+			// 積太多事件來不及處理：跳過中間的事件，從最新的接著送
+			log.Printf("webhooks: fell behind, skipping events %d..%d", lastID+1, rm.events.latestID())
+			lastID = rm.events.latestID()
+		}
+		if len(events) > 0 {
+			if state, err := rm.currentState(); err != nil {
+				log.Printf("webhooks: load state failed: %v", err)
+			} else {
+				for _, e := range events {
+					for _, h := range state.Webhooks {
+						if h.wants(e.Type) {
+							go rm.deliverWebhook(ctx, h, e)
+						}
+					}
+				}
+			}
+			lastID = events[len(events)-1].ID
+		}
+		select {
+		case <-next:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverWebhook 送出一個事件；連線失敗、5xx、408、429 時以指數退避重試，
+// 重試前 webhook 已被刪除就放棄
+func (rm *room) deliverWebhook(ctx context.Context, h Webhook, e Event) {
+	body, err := json.Marshal(WebhookPayload{ID: e.ID, Type: e.Type, Timestamp: clock.Now().Unix(), Data: e.Data})
+	if err != nil {
+		log.Printf("webhooks: encode event %d failed: %v", e.ID, err)
+		return
+	}
+	signature := signWebhook(h.Secret, body)
+
+	for attempt := 1; ; attempt++ {
+		status, err := postWebhook(ctx, h.URL, e, signature, body)
+		retry := err != nil || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+		if !retry {
+			if status >= 300 {
+				log.Printf("webhooks: %s rejected event %d: HTTP %d", h.URL, e.ID, status)
+			}
+			return
+		}
+		if attempt >= webhookAttempts {
+			log.Printf("webhooks: giving up on event %d for %s after %d attempts (HTTP %d, %v)", e.ID, h.URL, attempt, status, err)
+			return
+		}
+		select {
+		case <-time.After(webhookRetryBase << (attempt - 1)):
+		case <-ctx.Done():
+			return
+		}
+		if !rm.webhookRegistered(h.ID) {
+			return
+		}
+	}
+}
+
+func postWebhook(ctx context.Context, target string, e Event, signature string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "splitter-webhook/1")
+	req.Header.Set(webhookEventHeader, e.Type)
+	req.Header.Set(webhookDeliveryHeader, strconv.FormatInt(e.ID, 10))
+	req.Header.Set(webhookSignatureHeader, signature)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+func (rm *room) webhookRegistered(id int) bool {
+	state, err := rm.currentState()
+	if err != nil {
+		// 讀不到狀態時照常重試，不因暫時的錯誤丟掉事件
+		return true
+	}
+	return slices.ContainsFunc(state.Webhooks, func(h Webhook) bool { return h.ID == id })
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ==========================================
+// Webhook 測試
+// ==========================================
+func TestWebhooksAPI(t *testing.T) {
+	state := newGlobalState()
+	state.People = []Person{{ID: 1, Name: "Alice"}}
+	withRoomState(t, state)
+
+	post := func(body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handleWebhooks(rec, httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body)))
+		return rec
+	}
+
+	for _, body := range []string{`{"url":"ftp://example.com/hook"}`, `{"url":"/hook"}`, `{"url":"https://example.com/hook","events":["bill-deleted"]}`} {
+		if rec := post(body); rec.Code != http.StatusBadRequest {
+			t.Errorf("%s 應回 400, got %d", body, rec.Code)
+		}
+	}
+
+	rec := post(`{"url":"https://example.com/hook","events":["bill-added","bill-added"]}`)
+	var hook Webhook
+	if err := json.Unmarshal(rec.Body.Bytes(), &hook); err != nil || rec.Code != http.StatusCreated {
+		t.Fatalf("登記失敗: %d %s", rec.Code, rec.Body.String())
+	}
+	if hook.ID != 1 || len(hook.Secret) != 64 || len(hook.Events) != 1 {
+		t.Errorf("未填金鑰時應產生金鑰、重複的事件應合併, got %+v", hook)
+	}
+	if rec := post(`{"url":"https://example.com/other","secret":"s3cret"}`); !strings.Contains(rec.Body.String(), `"secret":"s3cret"`) {
+		t.Errorf("應使用指定的金鑰, got %s", rec.Body.String())
+	}
+
+	// 列表不含金鑰
+	rec = httptest.NewRecorder()
+	handleWebhooks(rec, httptest.NewRequest(http.MethodGet, "/api/webhooks", nil))
+	if !strings.Contains(rec.Body.String(), `"id":2`) || strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("列表不應含金鑰, got %s", rec.Body.String())
+	}
+
+	// 同步給客戶端的狀態不含 webhook，客戶端送回來時也不會清掉
+	defaultRoom.mu.Lock()
+	cur := cloneState(defaultRoom.state)
+	defaultRoom.mu.Unlock()
+	if data, _ := json.Marshal(visibleState(cur)); strings.Contains(string(data), "webhooks") {
+		t.Error("同步給客戶端的狀態不應含 webhook")
+	}
+	if err := applySyncedState(&cur, GlobalState{People: []Person{{ID: 1, Name: "Alice"}}}); err != nil || len(cur.Webhooks) != 2 {
+		t.Errorf("客戶端送來的狀態不應清掉 webhook, got %+v (%v)", cur.Webhooks, err)
+	}
+
+	del := func(id string) int {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodDelete, "/api/webhooks/"+id, nil)
+		req.SetPathValue("id", id)
+		handleWebhook(rec, req)
+		return rec.Code
+	}
+	if code := del("1"); code != http.StatusNoContent {
+		t.Errorf("刪除應回 204, got %d", code)
+	}
+	if code := del("1"); code != http.StatusNotFound {
+		t.Errorf("已刪除的 webhook 應回 404, got %d", code)
+	}
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	savedAttempts, savedBase := webhookAttempts, webhookRetryBase
+	webhookAttempts, webhookRetryBase = 3, time.Millisecond
+
+	type delivery struct {
+		header http.Header
+		body   []byte
+	}
+	got := make(chan delivery, 10)
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		calls++
+		if calls == 1 {
+			// 第一次失敗，應退避後重試
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		got <- delivery{r.Header, body}
+	}))
+	t.Cleanup(srv.Close)
+
+	state := newGlobalState()
+	state.Webhooks = []Webhook{{ID: 1, URL: srv.URL, Events: []string{eventBillAdded}, Secret: "s3cret"}}
+	withRoomState(t, state)
+	savedEvents := defaultRoom.events
+	defaultRoom.events = newEventLog()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defaultRoom.runWebhookLoop(ctx, 0)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+		defaultRoom.events = savedEvents
+		webhookAttempts, webhookRetryBase = savedAttempts, savedBase
+	})
+
+	defaultRoom.events.publish(eventCalculationDone, map[string]int{"total": 1})
+	defaultRoom.events.publish(eventBillAdded, Bill{ID: 3, Title: "Taxi"})
+
+	var d delivery
+	select {
+	case d = <-got:
+	case <-time.After(5 * time.Second):
+		t.Fatal("沒有收到 webhook")
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(d.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != 2 || payload.Type != eventBillAdded || !strings.Contains(string(payload.Data), `"title":"Taxi"`) {
+		t.Errorf("payload = %s", d.body)
+	}
+	if sig := d.header.Get(webhookSignatureHeader); sig != signWebhook("s3cret", d.body) {
+		t.Errorf("簽章不符: %s", sig)
+	}
+	if d.header.Get(webhookEventHeader) != eventBillAdded || d.header.Get(webhookDeliveryHeader) != "2" {
+		t.Errorf("headers = %v", d.header)
+	}
+
+	// 沒有訂閱的 calculation-done 不送
+	select {
+	case d := <-got:
+		t.Errorf("不應收到未訂閱的事件: %s", d.body)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n 'hello' | openssl dgst -sha256 -hmac key
+	want := "sha256=9307b3b915efb5171ff14d8cb55fbcc798c6c0ef1456d66ded1a6aa723a58b7b"
+	if got := signWebhook("key", []byte("hello")); got != want {
+		t.Errorf("signWebhook = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ================= WebSocket（RFC 6455，只實作伺服器端推播需要的部分） =================
+
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xA
+)
+
+// wsMaxFrame 客戶端只會送控制訊框，過大的資料訊框直接斷線
+const wsMaxFrame = 64 << 10
+
+var errWSFrameTooLarge = errors.New("websocket frame too large")
+
+// wsConn 一條 WebSocket 連線；寫入以 mu 保護，讀取只在 readLoop 一個 goroutine 進行
+type wsConn struct {
+	conn net.Conn
+	br   *bufio.Reader
+	mu   sync.Mutex
+}
+
+// upgradeWebSocket 完成握手並接管底層連線，失敗時已回應錯誤
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil, errors.New("method not allowed")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		writeError(w, http.StatusUpgradeRequired, "websocket upgrade required")
+		return nil, errors.New("not a websocket request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, "unsupported websocket version")
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "missing Sec-WebSocket-Key")
+		return nil, errors.New("missing key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "websocket not supported")
+		return nil, errors.New("response writer cannot hijack")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+func wsAccept(key string) string {
+	sum := sha1.Sum([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken 標頭（可能是逗號分隔的清單）是否包含 token，不分大小寫
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// writeFrame 送出一個完整（FIN）的訊框；伺服器送出的訊框不加遮罩
+func (c *wsConn) writeFrame(op byte, payload []byte, deadline time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	header := []byte{0x80 | op, 0}
+	switch n := len(payload); {
+	case n < 126:
+		header[1] = byte(n)
+	case n <= 0xFFFF:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.conn.SetWriteDeadline(deadline)
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readFrame 讀一個客戶端訊框並解除遮罩
+func (c *wsConn) readFrame() (op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return 0, nil, err
+	}
+	op = head[0] & 0x0F
+	masked := head[1]&0x80 != 0
+	n := uint64(head[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxFrame {
+		return 0, nil, errWSFrameTooLarge
+	}
+	var mask [4]byte
+	if masked {
+		if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return op, payload, nil
+}
+
+// readLoop 處理客戶端的 ping 與 close，其餘訊息忽略；連線結束時回傳
+func (c *wsConn) readLoop() error {
+	for {
+		op, payload, err := c.readFrame()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload, time.Now().Add(wsWriteTimeout)); err != nil {
+				return err
+			}
+		case wsOpClose:
+			c.writeFrame(wsOpClose, nil, time.Now().Add(wsWriteTimeout))
+			return fmt.Errorf("websocket closed by client")
+		}
+	}
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dialWS 以最簡單的方式完成握手，回傳的 wsConn 可用 readFrame 讀伺服器送來的（未遮罩）訊框
+func dialWS(t *testing.T, srv *httptest.Server) *wsConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET /api/ws HTTP/1.1\r\nHost: test\r\nUpgrade: websocket\r\nConnection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n\r\n"
+	if _, err := conn.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("握手失敗: %d %v", resp.StatusCode, resp.Header)
+	}
+	return &wsConn{conn: conn, br: br}
+}
+
+// writeMasked 客戶端送出的訊框必須加遮罩
+func writeMasked(t *testing.T, c *wsConn, op byte, payload []byte) {
+	t.Helper()
+	mask := [4]byte{1, 2, 3, 4}
+	frame := []byte{0x80 | op, 0x80 | byte(len(payload))}
+	frame = append(frame, mask[:]...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readStateEvent(t *testing.T, c *wsConn) StateEvent {
+	t.Helper()
+	op, payload, err := c.readFrame()
+	if err != nil || op != wsOpText {
+		t.Fatalf("讀取事件失敗: op %d, err %v", op, err)
+	}
+	var ev StateEvent
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		t.Fatal(err)
+	}
+	return ev
+}
+
+// ==========================================
+// WebSocket 即時推播測試
+// ==========================================
+func TestWebSocket_BroadcastsStateChanges(t *testing.T) {
+	state := newGlobalState()
+	state.Revision = 3
+	withRoomState(t, state)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go defaultRoom.hub.run(ctx)
+
+	srv := httptest.NewServer(http.HandlerFunc(handleWS))
+	defer srv.Close()
+	c := dialWS(t, srv)
+
+	// 連上時先收到目前狀態
+	if ev := readStateEvent(t, c); ev.Type != "state" || ev.Revision != 3 {
+		t.Fatalf("event = %+v", ev)
+	}
+
+	// 任何成功的修改都會推播
+	if _, err := updateState(func(s *GlobalState) error {
+		s.People = append(s.People, Person{ID: 1, Name: "Alice"})
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := readStateEvent(t, c); ev.Revision != 4 || len(ev.State.People) != 1 {
+		t.Errorf("event = %+v", ev)
+	}
+
+	writeMasked(t, c, wsOpPing, []byte("hi"))
+	if op, payload, err := c.readFrame(); err != nil || op != wsOpPong || string(payload) != "hi" {
+		t.Errorf("ping 應回 pong, got op %d %q %v", op, payload, err)
+	}
+
+	writeMasked(t, c, wsOpClose, nil)
+	if op, _, err := c.readFrame(); err != nil || op != wsOpClose {
+		t.Errorf("close 應回 close, got op %d %v", op, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for defaultRoom.hub.count() != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := defaultRoom.hub.count(); n != 0 {
+		t.Errorf("斷線後應移除連線, clients = %d", n)
+	}
+}
+
+func TestWebSocket_RequiresUpgrade(t *testing.T) {
+	rec := httptest.NewRecorder()
+	handleWS(rec, httptest.NewRequest(http.MethodGet, "/api/ws", nil))
+	if rec.Code != http.StatusUpgradeRequired {
+		t.Errorf("一般 GET 應回傳 426, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ================= 即時推播（/api/ws） =================
+
+var (
+	// wsWriteTimeout 送不出去的連線（手機休眠、網路斷掉）超過這個時間就放棄
+	wsWriteTimeout = 10 * time.Second
+	// wsPingInterval 定期 ping，讓中間的代理伺服器不會把閒置連線切掉
+	wsPingInterval = 30 * time.Second
+)
+
+// StateEvent 推播給客戶端的事件；連上時先送一次目前狀態，之後每次變更再送
+type StateEvent struct {
+	Type     string      `json:"type"` // "state"
+	Revision int64       `json:"revision"`
+	State    GlobalState `json:"state"`
+}
+
+// wsClient 每條連線一個待送佇列，寫入由自己的 goroutine 負責，慢的客戶端不會拖累廣播
+type wsClient struct {
+	conn *wsConn
+	send chan []byte
+}
+
+// wsHub 管理所有連線；狀態變更時廣播給每一位
+type wsHub struct {
+	room    *room
+	mu      sync.Mutex
+	clients map[*wsClient]bool
+}
+
+func newWSHub(rm *room) *wsHub {
+	return &wsHub{room: rm, clients: make(map[*wsClient]bool)}
+}
+
+func (h *wsHub) remove(c *wsClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.clients[c] {
+		delete(h.clients, c)
+		close(c.send)
+	}
+}
+
+func (h *wsHub) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients)
+}
+
+// broadcast 放進每位客戶端的佇列；佇列已滿代表對方跟不上，直接斷線讓它重連後拿最新狀態
+func (h *wsHub) broadcast(msg []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for c := range h.clients {
+		select {
+		case c.send <- msg:
+		default:
+			delete(h.clients, c)
+			close(c.send)
+		}
+	}
+}
+
+func stateEventJSON(state GlobalState) ([]byte, error) {
+	return json.Marshal(StateEvent{Type: "state", Revision: state.Revision, State: visibleState(state)})
+}
+
+// run 等待狀態變更並廣播，直到 ctx 結束；共用儲存時也定期重新讀取，看到其他實例的修改
+func (h *wsHub) run(ctx context.Context) {
+	recheck := time.NewTicker(syncRecheckInterval)
+	defer recheck.Stop()
+	var last int64
+	if state, err := h.room.currentState(); err == nil {
+		last = state.Revision
+	}
+	for {
+		// 先取得 channel 再讀狀態，讀完到開始等待之間的變更才不會漏掉
+		next := h.room.changes.wait()
+		if state, err := h.room.currentState(); err != nil {
+			log.Printf("ws: load state failed: %v", err)
+		} else if state.Revision != last {
+			if msg, err := stateEventJSON(state); err == nil {
+				h.broadcast(msg)
+			}
+			last = state.Revision
+		}
+		select {
+		case <-next:
+		case <-recheck.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serve 處理一條已升級的連線：先送目前狀態，之後由 writeLoop 推播，readLoop 結束就斷線。
+// 加入與讀取目前狀態在同一個鎖內，之後的變更一定會廣播到；客戶端以 revision 略過較舊的事件
+func (h *wsHub) serve(conn *wsConn) {
+	c := &wsClient{conn: conn, send: make(chan []byte, 8)}
+	h.mu.Lock()
+	state, err := h.room.currentState()
+	var msg []byte
+	if err == nil {
+		msg, err = stateEventJSON(state)
+	}
+	if err != nil {
+		h.mu.Unlock()
+		conn.Close()
+		return
+	}
+	c.send <- msg
+	h.clients[c] = true
+	h.mu.Unlock()
+
+	go c.writeLoop()
+	c.conn.readLoop()
+	h.remove(c)
+}
+
+func (c *wsClient) writeLoop() {
+	defer c.conn.Close()
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				c.conn.writeFrame(wsOpClose, nil, time.Now().Add(wsWriteTimeout))
+				return
+			}
+			if err := c.conn.writeFrame(wsOpText, msg, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.writeFrame(wsOpPing, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleWS GET /api/ws：升級成 WebSocket 後，每次有人同步或透過 API 修改資料都會收到最新狀態
+func handleWS(w http.ResponseWriter, r *http.Request) {
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer roomOf(r).devices.connect(deviceFromRequest(r))()
+	roomOf(r).hub.serve(conn)
+}